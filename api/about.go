@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// aboutCacheTTL is how long a built /about response is served before counts are read again
+const aboutCacheTTL = 30 * time.Second
+
+// aboutCache holds the last /about response
+var aboutCache struct {
+	mu      sync.Mutex
+	body    []byte
+	expires time.Time
+}
+
+// aboutInfo returns the configured fields describing the relay
+func aboutInfo() map[string]interface{} {
+	info := map[string]interface{}{}
+	for _, field := range GlobalConfig.AboutFields() {
+		switch field {
+		case "name":
+			info[field] = GlobalConfig.ServerServiceName()
+		case "description":
+			info[field] = GlobalConfig.ServerServiceSummary()
+		case "actor":
+			info[field] = RelayActor().ID
+		case "subscribers":
+			info[field] = len(RelayState.SubscribersAndFollowers)
+		case "open":
+			info[field] = !RelayState.RelayConfig.ManuallyAccept && !RelayState.RelayConfig.AllowlistOnly
+		case "relay_styles":
+			info[field] = relayStyles()
+		case "blocked_domains":
+			info[field] = len(RelayState.BlockedDomains)
+		}
+	}
+	return info
+}
+
+// handleAbout describes the relay for directories and relay listing sites
+// GET /about
+// Response: {"name": "...", "description": "...", "actor": "https://relay.example.com/actor", "subscribers": 10, "open": true, "relay_styles": [...]}
+func handleAbout(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	aboutCache.mu.Lock()
+	if time.Now().After(aboutCache.expires) {
+		body, err := json.Marshal(aboutInfo())
+		if err != nil {
+			aboutCache.mu.Unlock()
+			writer.WriteHeader(500)
+			writer.Write(nil)
+			return
+		}
+		aboutCache.body = body
+		aboutCache.expires = time.Now().Add(aboutCacheTTL)
+	}
+	body := aboutCache.body
+	aboutCache.mu.Unlock()
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(aboutCacheTTL.Seconds())))
+	writer.WriteHeader(200)
+	writer.Write(body)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleAbout(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	aboutCache.expires = time.Time{}
+	defer func() { aboutCache.expires = time.Time{} }()
+
+	s := httptest.NewServer(http.HandlerFunc(handleAbout))
+	defer s.Close()
+	getAbout := func() map[string]interface{} {
+		r, err := http.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		if r.StatusCode != 200 {
+			t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+		}
+		var about map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&about)
+		return about
+	}
+
+	RelayState.AddSubscriber(models.Subscriber{Domain: "a.example.com", InboxURL: "https://a.example.com/inbox"})
+	RelayState.SetBlockedDomain("blocked.example.com", true)
+	about := getAbout()
+	if about["name"] != GlobalConfig.ServerServiceName() || about["actor"] != RelayActor().ID || about["open"] != true {
+		t.Fatalf("Expected relay description, but got %v", about)
+	}
+	if about["subscribers"] != float64(1) {
+		t.Fatalf("Expected 1 subscriber, but got %v", about["subscribers"])
+	}
+	if styles, _ := about["relay_styles"].([]interface{}); len(styles) != 2 {
+		t.Fatalf("Expected mastodon and litepub relay styles, but got %v", about["relay_styles"])
+	}
+	if _, ok := about["blocked_domains"]; ok {
+		t.Fatalf("Expected blocked domain count to be hidden by default, but got %v", about)
+	}
+
+	RelayState.AddSubscriber(models.Subscriber{Domain: "b.example.com", InboxURL: "https://b.example.com/inbox"})
+	if about := getAbout(); about["subscribers"] != float64(1) {
+		t.Fatalf("Expected cached subscriber count, but got %v", about["subscribers"])
+	}
+
+	defer func(config *models.RelayConfig) { GlobalConfig = config }(GlobalConfig)
+	viper.Set("ABOUT_FIELDS", "subscribers,open,blocked_domains")
+	defer viper.Set("ABOUT_FIELDS", "")
+	config, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = config
+	RelayState.SetConfig(ManuallyAccept, true)
+	aboutCache.expires = time.Time{}
+
+	about = getAbout()
+	if len(about) != 3 || about["subscribers"] != float64(2) || about["open"] != false || about["blocked_domains"] != float64(1) {
+		t.Fatalf("Expected configured fields only, but got %v", about)
+	}
+
+	r, _ := http.Post(s.URL, "application/json", nil)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405 for POST, but got %d", r.StatusCode)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// accessLogWriter records the status written by a handler and extra fields handlers attach to the access log
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	fields logrus.Fields
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps Server-Sent Events working through the wrapper
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the original ResponseWriter to http.ResponseController
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// annotateAccessLog adds the request id, type and actor domain of an inbox activity to the access log entry of writer
+func annotateAccessLog(writer http.ResponseWriter, activity *models.Activity, requestID string) {
+	w, ok := writer.(*accessLogWriter)
+	if !ok {
+		return
+	}
+	w.fields["request_id"] = requestID
+	w.fields["activity_type"] = activity.Type
+	if actorID, err := url.Parse(activity.Actor); err == nil {
+		w.fields["actor_domain"] = actorID.Host
+	}
+}
+
+// withAccessLog emits one log entry for every request served by next.
+// It only observes the response, counters are left to the handlers.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		startedAt := time.Now()
+		w := &accessLogWriter{ResponseWriter: writer, fields: logrus.Fields{}}
+		next.ServeHTTP(w, request)
+
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.fields["method"] = request.Method
+		w.fields["path"] = request.URL.Path
+		w.fields["status"] = w.status
+		w.fields["duration_ms"] = time.Since(startedAt).Milliseconds()
+		w.fields["remote_host"] = sourceIP(request.RemoteAddr)
+		logger.WithFields(w.fields).Info("HTTP request")
+	})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestAccessLog(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	})
+	mux.HandleFunc("/actor", handleRelayActor)
+	s := httptest.NewServer(withAccessLog(mux))
+	defer s.Close()
+
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	accessEntry := func() *logrus.Entry {
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "HTTP request" {
+				return entry
+			}
+		}
+		return nil
+	}
+
+	r, err := http.Post(s.URL+"/inbox", "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	r.Body.Close()
+	entry := accessEntry()
+	if entry == nil {
+		t.Fatal("Expected an access log entry for the inbox request")
+	}
+	for field, expected := range map[string]interface{}{
+		"method":        "POST",
+		"path":          "/inbox",
+		"status":        202,
+		"remote_host":   "127.0.0.1",
+		"activity_type": "Follow",
+		"actor_domain":  domain.Host,
+	} {
+		if entry.Data[field] != expected {
+			t.Errorf("Expected field %s to be %v, but got %v", field, expected, entry.Data[field])
+		}
+	}
+	if _, ok := entry.Data["duration_ms"]; !ok {
+		t.Error("Expected field duration_ms to be set")
+	}
+	total, _ := RelayState.RedisClient.Get(context.TODO(), "relay:stats:inbox:total").Int()
+	if total != 1 {
+		t.Fatalf("Expected inbox count to be 1, but got %d", total)
+	}
+
+	hook.Reset()
+	r, _ = http.Post(s.URL+"/actor", "application/json", nil)
+	r.Body.Close()
+	entry = accessEntry()
+	if entry == nil || entry.Data["status"] != 400 || entry.Data["path"] != "/actor" {
+		t.Fatalf("Expected access log entry with status 400 for /actor, but got %v", entry)
+	}
+	if _, ok := entry.Data["activity_type"]; ok {
+		t.Fatal("Expected activity_type only on inbox requests")
+	}
+}
+
+func TestInboxAcceptBody(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	s := httptest.NewServer(withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	})))
+	defer s.Close()
+
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	r, _ := http.Post(s.URL, "application/activity+json", nil)
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != 202 || len(body) != 0 {
+		t.Fatalf("Expected empty 202 response by default, but got %d %q", r.StatusCode, body)
+	}
+
+	defer func(config *models.RelayConfig) { GlobalConfig = config }(GlobalConfig)
+	viper.Set("INBOX_ACCEPT_BODY", true)
+	defer viper.Set("INBOX_ACCEPT_BODY", false)
+	GlobalConfig, _ = models.NewRelayConfig()
+
+	hook.Reset()
+	r, _ = http.Post(s.URL, "application/activity+json", nil)
+	var response map[string]string
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if r.StatusCode != 202 || response["relay"] != GlobalConfig.ServerServiceName() || response["request_id"] == "" {
+		t.Fatalf("Expected relay name and request id in 202 response, but got %d %v", r.StatusCode, response)
+	}
+	var logged interface{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "HTTP request" {
+			logged = entry.Data["request_id"]
+		}
+	}
+	if logged != response["request_id"] {
+		t.Fatalf("Expected request id %s in the access log, but got %v", response["request_id"], logged)
+	}
+}
@@ -1,13 +1,19 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/patrickmn/go-cache"
-	"github.com/sirupsen/logrus"
 	"github.com/yukimochi/Activity-Relay/delaymetrics"
 	"github.com/yukimochi/Activity-Relay/discord"
+	"github.com/yukimochi/Activity-Relay/geoip"
 	"github.com/yukimochi/Activity-Relay/models"
 	"github.com/yukimochi/machinery-v1/v1"
 )
@@ -16,18 +22,52 @@ var (
 	version      string
 	GlobalConfig *models.RelayConfig
 
-	// RelayActor : Relay's Actor
-	RelayActor models.Actor
+	// BuildCommit : Git commit the relay was built from
+	BuildCommit string
+	// BuildDate : Time the relay was built
+	BuildDate string
+
+	// currentRelayActor : Relay's Actor, replaced by the actor key reload while handlers read it
+	currentRelayActor atomic.Pointer[models.Actor]
+	// RelayIdentityActors : Actors of additional relay identities by hostname
+	RelayIdentityActors map[string]models.Actor
 	// Nodeinfo : Relay's Nodeinfo
 	Nodeinfo models.NodeinfoResources
 	// WebfingerResources : Relay's Webfinger Resources
 	WebfingerResources []models.WebfingerResource
+	// HostMeta : Relay's Host-meta
+	HostMeta models.HostMeta
+
+	// InboxSignaturePolicy : Relay's accepted HTTP Signatures
+	InboxSignaturePolicy SignaturePolicy
+	// InboxRateLimit : Relay's inbox rate limit per instance
+	InboxRateLimit RateLimitConfig
+	// InboxMaxBodySize : Relay's accepted activity size in bytes
+	InboxMaxBodySize int64
+	// AdminAuth : Relay's admin API credentials
+	AdminAuth AdminAuthConfig
+	// CORSPolicy : Relay's cross-origin access to JSON API
+	CORSPolicy CORSConfig
+	// InboxMirror : Relay's copies of relayed activities for an internal sink
+	InboxMirror MirrorConfig
+	// InboxGeoBlock : Relay's inbox connections rejected by country
+	InboxGeoBlock GeoBlockConfig
 
-	ActorCache      *cache.Cache
+	ActorCache      *models.ActorCache
 	MachineryServer *machinery.Server
 	RelayState      models.RelayState
 )
 
+// RelayActor returns Relay's Actor
+func RelayActor() models.Actor {
+	return *currentRelayActor.Load()
+}
+
+// setRelayActor replaces Relay's Actor, safe while it is read
+func setRelayActor(actor models.Actor) {
+	currentRelayActor.Store(&actor)
+}
+
 func Entrypoint(g *models.RelayConfig, v string) error {
 	var err error
 
@@ -39,17 +79,55 @@ func Entrypoint(g *models.RelayConfig, v string) error {
 		return err
 	}
 
+	if report := RelayState.Validate(); len(report.Anomalies) > 0 {
+		logger.WithField("anomalies", len(report.Anomalies)).Warn("Redis state is inconsistent, check /api/admin/state/validate")
+	}
+
 	handlersRegister()
+	GlobalConfig.ReloadActorKeyOnSignal(func() {
+		setRelayActor(models.NewActivityPubActorFromRelayConfig(GlobalConfig))
+	})
 
-	logrus.Info("Starting API Server at ", GlobalConfig.ServerBind())
-	err = http.ListenAndServe(GlobalConfig.ServerBind(), nil)
-	if err != nil {
+	stopSubscriberSnapshots := startSubscriberSnapshots(subscriberSnapshotInterval)
+	defer stopSubscriberSnapshots()
+	stopDelayMetricsPruning := startDelayMetricsPruning(GlobalConfig.DelayMetricsPruneInterval())
+	defer stopDelayMetricsPruning()
+	stopBatchDelivery := startBatchDelivery(GlobalConfig.BatchDeliveryInterval())
+	defer stopBatchDelivery()
+	stopBlocklistRefresh := startBlocklistRefresh(GlobalConfig.BlocklistRefreshInterval())
+	defer stopBlocklistRefresh()
+	stopDeferredUnfollows := startDeferredUnfollows(unfollowPollInterval)
+	defer stopDeferredUnfollows()
+	if !RelayState.Paused && heldActivityCount() > 0 {
+		// Finish a replay interrupted before the restart
+		go replayHeldActivities()
+	}
+
+	server := &http.Server{Addr: GlobalConfig.ServerBind(), Handler: withAccessLog(http.DefaultServeMux)}
+	go shutdownOnSignal(server)
+
+	logger.WithField("bind", GlobalConfig.ServerBind()).Info("Starting API Server")
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
 	return nil
 }
 
+// shutdownOnSignal stops server on SIGINT or SIGTERM, letting in-flight requests finish
+func shutdownOnSignal(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	signal.Stop(signals)
+
+	logger.Info("Shutting down API Server")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
 func initialize(globalConfig *models.RelayConfig) error {
 	var err error
 
@@ -62,21 +140,76 @@ func initialize(globalConfig *models.RelayConfig) error {
 		return err
 	}
 
-	RelayActor = models.NewActivityPubActorFromRelayConfig(globalConfig)
-	ActorCache = cache.New(5*time.Minute, 10*time.Minute)
+	setRelayActor(models.NewActivityPubActorFromRelayConfig(globalConfig))
+	ActorCache = models.NewActorCache(globalConfig.ActorCacheTTL(), globalConfig.ActorCacheSize())
+	InboxSignaturePolicy = SignaturePolicy{
+		AllowedAlgorithms: globalConfig.SignatureAllowedAlgorithms(),
+		RequireDigest:     globalConfig.SignatureRequireDigest(),
+		ClockSkew:         globalConfig.SignatureClockSkew(),
+	}
+	InboxRateLimit = RateLimitConfig{
+		Rate:  globalConfig.InboxRateLimit(),
+		Burst: globalConfig.InboxRateBurst(),
+	}
+
+	InboxMaxBodySize = globalConfig.InboxMaxBodySize()
+	AdminAuth = AdminAuthConfig{
+		Token:           globalConfig.AdminToken(),
+		AllowedNetworks: globalConfig.AdminAllowedNetworks(),
+	}
+	if AdminAuth.Token == "" {
+		logger.Warn("ADMIN_TOKEN is not set, admin API is disabled")
+	}
+	CORSPolicy = CORSConfig{
+		AllowedOrigins: globalConfig.CORSAllowedOrigins(),
+	}
+	InboxMirror = MirrorConfig{
+		URL:        globalConfig.MirrorURL(),
+		Types:      globalConfig.MirrorActivityTypes(),
+		SampleRate: globalConfig.MirrorSampleRate(),
+	}
+	InboxGeoBlock = GeoBlockConfig{
+		BlockedCountries: globalConfig.GeoIPBlockedCountries(),
+		ClientIPHeader:   globalConfig.GeoIPClientIPHeader(),
+	}
+	if globalConfig.GeoIPDBPath() != "" {
+		geoIPReader, err := geoip.Open(globalConfig.GeoIPDBPath())
+		if err != nil {
+			return errors.New("GEOIP_DB_PATH: " + err.Error())
+		}
+		InboxGeoBlock.Resolver = geoIPReader
+	}
 
 	Nodeinfo = models.GenerateNodeinfoResources(globalConfig.ServerHostname(), version)
-	WebfingerResources = append(WebfingerResources, RelayActor.GenerateWebfingerResource(globalConfig.ServerHostname()))
+	relayActor := RelayActor()
+	WebfingerResources = append(WebfingerResources, relayActor.GenerateWebfingerResource(globalConfig.ServerHostname()))
+	RelayIdentityActors = map[string]models.Actor{}
+	for _, identity := range globalConfig.RelayIdentities() {
+		actor := models.NewActivityPubActorFromRelayIdentity(globalConfig, identity)
+		RelayIdentityActors[identity.Host()] = actor
+		WebfingerResources = append(WebfingerResources, actor.GenerateWebfingerResource(&url.URL{Scheme: "https", Host: identity.Host()}))
+	}
+	HostMeta = models.GenerateHostMeta(globalConfig.ServerHostname())
+
+	// Outbound fetches and webhooks share one client
+	models.ConfigureHTTPClient(globalConfig.HTTPTimeout(), globalConfig.UserAgent(version), globalConfig.OutboundTLSMinVersion())
 
 	// Initialize Discord notifications
+	discord.SetHTTPClient(models.HTTPClient)
 	discord.Initialize(
+		globalConfig.WebhookType(),
 		globalConfig.DiscordWebhookURL(),
 		globalConfig.ServerServiceName(),
 		globalConfig.ServiceIconURL(),
 	)
+	for _, webhook := range globalConfig.DiscordWebhooks() {
+		discord.AddWebhook(webhook)
+	}
+	discord.EnableBatching(globalConfig.DiscordBatchWindow())
 
 	// Initialize delay metrics
-	delaymetrics.Initialize(redisClient)
+	delaymetrics.Initialize(redisClient, globalConfig.DelayMetricsExcludedHosts()...)
+	delaymetrics.SetHistogramBuckets(globalConfig.DelayMetricsHistogramBuckets())
 
 	return nil
 }
@@ -84,12 +217,46 @@ func initialize(globalConfig *models.RelayConfig) error {
 func handlersRegister() {
 	http.HandleFunc("/.well-known/nodeinfo", handleNodeinfoLink)
 	http.HandleFunc("/.well-known/webfinger", handleWebfinger)
+	http.HandleFunc("/.well-known/host-meta", handleHostMeta)
+	http.HandleFunc("/.well-known/host-meta.json", handleHostMetaJSON)
+	http.HandleFunc("/nodeinfo/2.0", handleNodeinfo20)
 	http.HandleFunc("/nodeinfo/2.1", handleNodeinfo)
 	http.HandleFunc("/actor", handleRelayActor)
+	http.HandleFunc("/actor/followers", handleFollowers)
+	http.HandleFunc("/actor/outbox", handleOutbox)
+	http.HandleFunc("/actor/followers_synchronization", handleFollowersSynchronization)
 	http.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
 		handleInbox(w, r, decodeActivity)
 	})
-	http.HandleFunc("/api/stats", handleDeliveryStats)
-	http.HandleFunc("/api/admin/unfollow", handleAdminUnfollow)
-	http.HandleFunc("/api/delay-metrics", handleDelayMetrics)
+	http.HandleFunc("/api/stats", withCORS(handleDeliveryStats))
+	http.HandleFunc("/api/stats/by-domain", withCORS(handleDomainDeliveryStats))
+	http.HandleFunc("/api/stats/by-type", withCORS(handleActivityTypeStats))
+	http.HandleFunc("/api/stats/stream", withCORS(handleStatsStream))
+	http.HandleFunc("/api/stats/subscribers", withCORS(handleSubscriberStats))
+	http.HandleFunc("/api/admin/unfollow", withCORS(requireAdminToken(handleAdminUnfollow)))
+	http.HandleFunc("/api/admin/unfollow/bulk", withCORS(requireAdminToken(handleAdminBulkUnfollow)))
+	http.HandleFunc("/api/admin/unfollow/inactive", withCORS(requireAdminToken(handleAdminUnfollowInactive)))
+	http.HandleFunc("/api/admin/redeliver", withCORS(requireAdminToken(handleAdminRedeliver)))
+	http.HandleFunc("/api/admin/resend-accept", withCORS(requireAdminToken(handleAdminResendAccept)))
+	http.HandleFunc("/api/admin/subscribers", withCORS(requireAdminToken(handleAdminList)))
+	http.HandleFunc("/api/admin/pending", withCORS(requireAdminToken(handleAdminPending)))
+	http.HandleFunc("/api/admin/approve", withCORS(requireAdminToken(handleAdminApprove)))
+	http.HandleFunc("/api/admin/reject", withCORS(requireAdminToken(handleAdminReject)))
+	http.HandleFunc("/api/admin/block", withCORS(requireAdminToken(handleAdminBlock)))
+	http.HandleFunc("/api/admin/allow", withCORS(requireAdminToken(handleAdminAllow)))
+	http.HandleFunc("/api/admin/batch", withCORS(requireAdminToken(handleAdminBatch)))
+	http.HandleFunc("/api/admin/pause", withCORS(requireAdminToken(handleAdminPause)))
+	http.HandleFunc("/api/admin/activity-types", withCORS(requireAdminToken(handleAdminActivityTypes)))
+	http.HandleFunc("/api/admin/audit", withCORS(requireAdminToken(handleAdminAuditLog)))
+	http.HandleFunc("/api/admin/export", withCORS(requireAdminToken(handleAdminExport)))
+	http.HandleFunc("/api/admin/import", withCORS(requireAdminToken(handleAdminImport)))
+	http.HandleFunc("/api/admin/state/validate", withCORS(requireAdminToken(handleAdminValidateState)))
+	http.HandleFunc("/api/delay-metrics", withCORS(handleDelayMetrics))
+	http.HandleFunc("/about", withCORS(handleAbout))
+	http.HandleFunc("/api/version", withCORS(handleVersion))
+	http.HandleFunc("/api/admin/delay-metrics/excluded", withCORS(requireAdminToken(handleAdminDelayMetricsExcluded)))
+	http.HandleFunc("/api/admin/delay-metrics/prune", withCORS(requireAdminToken(handleAdminDelayMetricsPrune)))
+	http.HandleFunc(GlobalConfig.MetricsPath(), handleMetrics)
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
 }
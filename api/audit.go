@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+const auditLogKey = "relay:audit"
+
+// auditLogLimit is the number of admin actions kept in the audit log
+const auditLogLimit = 1000
+
+// AuditEntry is an admin action recorded in the audit log
+type AuditEntry struct {
+	Action    string `json:"action"`
+	Domain    string `json:"domain"`
+	Timestamp int64  `json:"timestamp"`
+	SourceIP  string `json:"source_ip"`
+	Actor     string `json:"actor,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type adminIdentityContextKey struct{}
+
+// adminTokenIdentity identifies an admin token without exposing it
+func adminTokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+func withAdminIdentity(request *http.Request, identity string) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), adminIdentityContextKey{}, identity))
+}
+
+func sourceIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// recordAdminAction appends an admin action to the audit log, keeping the latest auditLogLimit entries
+func recordAdminAction(request *http.Request, action, domain, reason string) {
+	entry := AuditEntry{
+		Action:    action,
+		Domain:    domain,
+		Timestamp: time.Now().Unix(),
+		SourceIP:  sourceIP(request.RemoteAddr),
+		Reason:    reason,
+	}
+	if identity, ok := request.Context().Value(adminIdentityContextKey{}).(string); ok {
+		entry.Actor = identity
+	}
+	data, _ := json.Marshal(entry)
+
+	ctx := context.TODO()
+	pipe := RelayState.RedisClient.TxPipeline()
+	pipe.LPush(ctx, models.RedisKey(auditLogKey), data)
+	pipe.LTrim(ctx, models.RedisKey(auditLogKey), 0, auditLogLimit-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.WithError(err).Error("Failed to record admin action")
+	}
+}
+
+// GetAuditLog returns up to limit recent admin actions, newest first
+func GetAuditLog(limit int) ([]AuditEntry, error) {
+	values, err := RelayState.RedisClient.LRange(context.TODO(), models.RedisKey(auditLogKey), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(values))
+	for _, value := range values {
+		var entry AuditEntry
+		if json.Unmarshal([]byte(value), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// handleAdminAuditLog returns recent admin actions
+// GET /api/admin/audit?limit=100
+// Response: {"entries": [{"action": "unfollow", "domain": "example.com", "timestamp": 1700000000, "source_ip": "192.0.2.1"}, ...]}
+func handleAdminAuditLog(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	limit := 100
+	if l := request.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(parsed, auditLogLimit)
+	}
+
+	entries, err := GetAuditLog(limit)
+	if err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(500)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "failed to read audit log"})
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]AuditEntry{"entries": entries})
+}
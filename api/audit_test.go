@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	defer func(auth AdminAuthConfig) { AdminAuth = auth }(AdminAuth)
+	AdminAuth = AdminAuthConfig{Token: "secret"}
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	block := httptest.NewServer(requireAdminToken(handleAdminBlock))
+	defer block.Close()
+	audit := httptest.NewServer(requireAdminToken(handleAdminAuditLog))
+	defer audit.Close()
+
+	for _, method := range []string{"POST", "DELETE"} {
+		req, _ := http.NewRequest(method, block.URL, strings.NewReader(`{"domain":"Spam.Example.com"}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		r.Body.Close()
+	}
+
+	req, _ := http.NewRequest("GET", audit.URL, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	var response struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	json.NewDecoder(r.Body).Decode(&response)
+	if len(response.Entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, but got %d", len(response.Entries))
+	}
+	if response.Entries[0].Action != "unblock" || response.Entries[1].Action != "block" {
+		t.Fatalf("Expected newest entry first, but got %+v", response.Entries)
+	}
+	entry := response.Entries[1]
+	if entry.Domain != "spam.example.com" || entry.SourceIP != "127.0.0.1" || entry.Timestamp == 0 {
+		t.Fatalf("Expected entry to record domain, source and time, but got %+v", entry)
+	}
+	if entry.Actor != adminTokenIdentity("secret") || strings.Contains(entry.Actor, "secret") {
+		t.Fatalf("Expected actor to be the token identity, but got %s", entry.Actor)
+	}
+}
+
+func TestAuditLogIsCapped(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	request := httptest.NewRequest("POST", "/api/admin/block", nil)
+	for i := 0; i < auditLogLimit+5; i++ {
+		recordAdminAction(request, "block", "example"+strconv.Itoa(i)+".com", "")
+	}
+	length, _ := RelayState.RedisClient.LLen(context.TODO(), auditLogKey).Result()
+	if length != auditLogLimit {
+		t.Fatalf("Expected audit log to be capped at %d, but got %d", auditLogLimit, length)
+	}
+
+	entries, _ := GetAuditLog(1)
+	if len(entries) != 1 || entries[0].Domain != "example"+strconv.Itoa(auditLogLimit+4)+".com" {
+		t.Fatalf("Expected latest entry to be kept, but got %+v", entries)
+	}
+}
+
+func TestHandleAdminAuditLogLimit(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminAuditLog))
+	defer s.Close()
+
+	r, _ := http.Get(s.URL + "?limit=abc")
+	r.Body.Close()
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected status 400 for invalid limit, but got %d", r.StatusCode)
+	}
+}
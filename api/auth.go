@@ -0,0 +1,59 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AdminAuthConfig : Credentials accepted by admin API
+type AdminAuthConfig struct {
+	Token string
+	// AllowedNetworks restricts source addresses, empty allows all
+	AllowedNetworks []*net.IPNet
+}
+
+func (config AdminAuthConfig) allowsAddress(remoteAddr string) bool {
+	if len(config.AllowedNetworks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range config.AllowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdminToken rejects requests without valid admin bearer token
+func requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !AdminAuth.allowsAddress(request.RemoteAddr) {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(403)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "source address not allowed"})
+			return
+		}
+
+		token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !ok || AdminAuth.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(AdminAuth.Token)) != 1 {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writer.WriteHeader(401)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		next(writer, withAdminIdentity(request, adminTokenIdentity(token)))
+	}
+}
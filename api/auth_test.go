@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdminToken(t *testing.T) {
+	defer func(auth AdminAuthConfig) { AdminAuth = auth }(AdminAuth)
+	AdminAuth = AdminAuthConfig{Token: "secret"}
+
+	s := httptest.NewServer(requireAdminToken(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(200)
+	}))
+	defer s.Close()
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		statusCode    int
+	}{
+		{"Missing token", "", 401},
+		{"Wrong token", "Bearer wrong", 401},
+		{"Wrong scheme", "Basic secret", 401},
+		{"Correct token", "Bearer secret", 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", s.URL, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Expected request to succeed, but got error: %v", err)
+			}
+			r.Body.Close()
+			if r.StatusCode != tc.statusCode {
+				t.Fatalf("Expected StatusCode to be %d, but got %d", tc.statusCode, r.StatusCode)
+			}
+			if tc.statusCode == 401 && r.Header.Get("Content-Type") != "application/json" {
+				t.Fatalf("Expected JSON error response, but got '%s'", r.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestRequireAdminTokenNotConfigured(t *testing.T) {
+	defer func(auth AdminAuthConfig) { AdminAuth = auth }(AdminAuth)
+	AdminAuth = AdminAuthConfig{}
+
+	s := httptest.NewServer(requireAdminToken(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(200)
+	}))
+	defer s.Close()
+
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Authorization", "Bearer ")
+	r, _ := http.DefaultClient.Do(req)
+	if r.StatusCode != 401 {
+		t.Fatalf("Expected StatusCode to be 401 without configured token, but got %d", r.StatusCode)
+	}
+}
+
+func TestRequireAdminTokenAllowedNetworks(t *testing.T) {
+	defer func(auth AdminAuthConfig) { AdminAuth = auth }(AdminAuth)
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	AdminAuth = AdminAuthConfig{Token: "secret", AllowedNetworks: []*net.IPNet{network}}
+
+	handler := requireAdminToken(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(200)
+	})
+	for _, tc := range []struct {
+		remoteAddr string
+		statusCode int
+	}{
+		{"10.1.2.3:4567", 200},
+		{"192.0.2.1:4567", 403},
+	} {
+		req := httptest.NewRequest("GET", "/api/admin/subscribers", nil)
+		req.RemoteAddr = tc.remoteAddr
+		req.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		if recorder.Code != tc.statusCode {
+			t.Fatalf("Expected StatusCode to be %d for %s, but got %d", tc.statusCode, tc.remoteAddr, recorder.Code)
+		}
+	}
+}
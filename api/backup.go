@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// adminImportResult summarizes a restored relay state
+type adminImportResult struct {
+	Merge       bool   `json:"merge"`
+	Subscribers int    `json:"subscribers"`
+	Followers   int    `json:"followers"`
+	Removed     int    `json:"removed"`
+	Error       string `json:"error,omitempty"`
+}
+
+// relayConfigFlags pairs each config toggle with its value in state
+func relayConfigFlags(state models.RelayState) map[models.Config]bool {
+	return map[models.Config]bool{
+		models.PersonOnly:           state.RelayConfig.PersonOnly,
+		models.ManuallyAccept:       state.RelayConfig.ManuallyAccept,
+		models.RelayReactions:       state.RelayConfig.RelayReactions,
+		models.RequireSharedInbox:   state.RelayConfig.RequireSharedInbox,
+		models.ExcludeBotActors:     state.RelayConfig.ExcludeBotActors,
+		models.AllowlistOnly:        state.RelayConfig.AllowlistOnly,
+		models.RequirePublished:     state.RelayConfig.RequirePublished,
+		models.AllowUnsignedDeletes: state.RelayConfig.AllowUnsignedDeletes,
+		models.RequireLanguage:      state.RelayConfig.RequireLanguage,
+	}
+}
+
+// importRelayState restores data into RelayState. With merge, entries are only added and toggles only enabled,
+// otherwise everything missing from data is removed so the relay ends up with exactly data.
+func importRelayState(data models.RelayState, merge bool) adminImportResult {
+	result := adminImportResult{Merge: merge}
+	current := RelayState
+
+	if !merge {
+		for _, subscriber := range current.Subscribers {
+			if !contains(data.Subscribers, subscriber.Domain) {
+				RelayState.DelSubscriber(subscriber.Domain)
+				result.Removed++
+			}
+		}
+		for _, follower := range current.Followers {
+			if !contains(data.Followers, follower.Domain) {
+				RelayState.DelFollower(follower.Domain)
+				result.Removed++
+			}
+		}
+		for _, domain := range current.LimitedDomains {
+			if !contains(data.LimitedDomains, domain) {
+				RelayState.SetLimitedDomain(domain, false)
+			}
+		}
+		for _, domain := range current.BlockedDomains {
+			if !contains(data.BlockedDomains, domain) {
+				RelayState.SetBlockedDomain(domain, false)
+			}
+		}
+		for _, domain := range current.AllowedDomains {
+			if !contains(data.AllowedDomains, domain) {
+				RelayState.SetAllowedDomain(domain, false)
+			}
+		}
+		for _, domain := range current.BatchDomains {
+			if !contains(data.BatchDomains, domain) {
+				RelayState.SetBatchDomain(domain, false)
+			}
+		}
+		for _, tag := range current.TagFilters {
+			if !contains(data.TagFilters, tag) {
+				RelayState.SetTagFilter(tag, false)
+			}
+		}
+		for _, language := range current.LanguageFilters {
+			if !contains(data.LanguageFilters, language) {
+				RelayState.SetLanguageFilter(language, false)
+			}
+		}
+		for _, activityType := range current.DisabledActivityTypes {
+			if !contains(data.DisabledActivityTypes, activityType) {
+				RelayState.SetActivityTypeEnabled(activityType, true)
+			}
+		}
+		RelayState.SetMaxActivityAge(data.MaxActivityAge)
+	}
+
+	currentFlags := relayConfigFlags(current)
+	for key, value := range relayConfigFlags(data) {
+		if value != currentFlags[key] && (value || !merge) {
+			RelayState.SetConfig(key, value)
+		}
+	}
+	if merge && data.MaxActivityAge > 0 {
+		RelayState.SetMaxActivityAge(data.MaxActivityAge)
+	}
+	for _, domain := range data.LimitedDomains {
+		RelayState.SetLimitedDomain(domain, true)
+	}
+	for _, domain := range data.BlockedDomains {
+		if source, found := data.BlockedDomainSources[domain]; found {
+			RelayState.SetBlockedDomainSource(domain, source)
+		} else if _, found := current.BlockedDomainSources[domain]; !found {
+			// A block of a remote blocklist stays tagged, so it is lifted once the list drops it
+			RelayState.SetBlockedDomain(domain, true)
+		}
+	}
+	for _, domain := range data.AllowedDomains {
+		RelayState.SetAllowedDomain(domain, true)
+	}
+	for _, domain := range data.BatchDomains {
+		RelayState.SetBatchDomain(domain, true)
+	}
+	for _, tag := range data.TagFilters {
+		RelayState.SetTagFilter(tag, true)
+	}
+	for _, language := range data.LanguageFilters {
+		RelayState.SetLanguageFilter(language, true)
+	}
+	for _, activityType := range data.DisabledActivityTypes {
+		if contains(models.RelayActivityTypes, activityType) {
+			RelayState.SetActivityTypeEnabled(activityType, false)
+		}
+	}
+	for _, subscriber := range data.Subscribers {
+		if subscriber.Domain == "" || subscriber.InboxURL == "" {
+			continue
+		}
+		RelayState.AddSubscriber(subscriber)
+		result.Subscribers++
+	}
+	for _, follower := range data.Followers {
+		if follower.Domain == "" || follower.InboxURL == "" {
+			continue
+		}
+		RelayState.AddFollower(follower)
+		result.Followers++
+	}
+
+	return result
+}
+
+// handleAdminExport returns subscribers, followers, domain lists and config toggles for backup.
+// The actor key and other configuration from the environment are never included.
+// GET /api/admin/export
+// Response: {"relayConfig": {...}, "blockedDomains": [...], "subscriptions": [...], "followers": [...]}
+func handleAdminExport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	response, err := json.Marshal(&RelayState)
+	if err != nil {
+		writer.WriteHeader(500)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
+
+// handleAdminImport restores relay state from an export, merging into the current state unless merge=false
+// POST /api/admin/import?merge=true|false
+// Body: output of GET /api/admin/export
+// Response: {"merge": true, "subscribers": 10, "followers": 2, "removed": 0} or {"error": "..."}
+func handleAdminImport(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	merge := true
+	if mergeParam := request.URL.Query().Get("merge"); mergeParam != "" {
+		parsed, err := strconv.ParseBool(mergeParam)
+		if err != nil {
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(adminImportResult{Error: "merge must be true or false"})
+			return
+		}
+		merge = parsed
+	}
+	var data models.RelayState
+	if err := json.NewDecoder(request.Body).Decode(&data); err != nil {
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(adminImportResult{Error: "invalid request body"})
+		return
+	}
+
+	result := importRelayState(data, merge)
+	logger.WithFields(logrus.Fields{"merge": merge, "subscribers": result.Subscribers, "followers": result.Followers, "removed": result.Removed}).Info("Admin imported relay state")
+	recordAdminAction(request, "import", "", "merge="+strconv.FormatBool(merge))
+
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(result)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestAdminExportImportRoundTrip(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "a.example.com",
+		InboxURL:   "https://a.example.com/inbox",
+		ActivityID: "https://a.example.com/follows/1",
+		ActorID:    "https://a.example.com/actor",
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:         "b.example.com",
+		InboxURL:       "https://b.example.com/inbox",
+		ActorID:        "https://b.example.com/actor",
+		MutuallyFollow: true,
+	})
+	RelayState.SetBlockedDomain("blocked.example.com", true)
+	RelayState.SyncRemoteBlockedDomains(map[string][]string{"https://lists.example.com/blocklist.txt": {"remote.example.com"}})
+	RelayState.SetTagFilter("relay", true)
+	RelayState.SetActivityTypeEnabled("Update", false)
+	RelayState.SetMaxActivityAge(time.Hour)
+	RelayState.SetConfig(ManuallyAccept, true)
+
+	export := httptest.NewServer(http.HandlerFunc(handleAdminExport))
+	defer export.Close()
+	importer := httptest.NewServer(http.HandlerFunc(handleAdminImport))
+	defer importer.Close()
+
+	r, err := http.Get(export.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	backup, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+	if strings.Contains(string(backup), "PRIVATE KEY") {
+		t.Fatal("Expected export not to contain the actor key")
+	}
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "stale.example.com",
+		InboxURL: "https://stale.example.com/inbox",
+	})
+	RelayState.SetBlockedDomain("stale.example.com", true)
+
+	r, err = http.Post(importer.URL+"?merge=false", "application/json", bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var result adminImportResult
+	json.NewDecoder(r.Body).Decode(&result)
+	r.Body.Close()
+	if r.StatusCode != 200 || result.Subscribers != 1 || result.Followers != 1 || result.Removed != 1 {
+		t.Fatalf("Expected 1 subscriber and 1 follower restored with 1 removed, but got %d %+v", r.StatusCode, result)
+	}
+
+	RelayState.Load()
+	restored, _ := json.Marshal(&RelayState)
+	if string(restored) != string(backup) {
+		t.Fatalf("Expected restored state to match the export, but got\n%s\nwant\n%s", restored, backup)
+	}
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "kept.example.com",
+		InboxURL: "https://kept.example.com/inbox",
+	})
+	r, _ = http.Post(importer.URL+"?merge=true", "application/json", bytes.NewReader(backup))
+	r.Body.Close()
+	RelayState.Load()
+	if RelayState.SelectSubscriber("kept.example.com") == nil || len(RelayState.Subscribers) != 2 {
+		t.Fatalf("Expected merge to keep existing subscribers, but got %v", RelayState.Subscribers)
+	}
+	if source := RelayState.BlockedDomainSources["remote.example.com"]; source != "https://lists.example.com/blocklist.txt" {
+		t.Fatalf("Expected remote block to stay tagged with its source, but got %q", source)
+	}
+	// Still managed by the blocklist, the block is lifted once the list drops it
+	_, removed := RelayState.SyncRemoteBlockedDomains(map[string][]string{"https://lists.example.com/blocklist.txt": {}})
+	if len(removed) != 1 || removed[0] != "remote.example.com" {
+		t.Fatalf("Expected remote block to be lifted after the round trip, but got %v", removed)
+	}
+
+	// A backup without sources does not turn a remote block into a manual one
+	RelayState.SyncRemoteBlockedDomains(map[string][]string{"https://lists.example.com/blocklist.txt": {"remote.example.com"}})
+	legacy := strings.Replace(string(backup), `"blockedDomainSources":{"remote.example.com":"https://lists.example.com/blocklist.txt"},`, "", 1)
+	if legacy == string(backup) {
+		t.Fatalf("Expected export to carry the source of remote blocks, but got %s", backup)
+	}
+	r, _ = http.Post(importer.URL+"?merge=true", "application/json", strings.NewReader(legacy))
+	r.Body.Close()
+	blocked, _ := RelayState.RedisClient.HGet(context.TODO(), "relay:config:blockedDomain", "remote.example.com").Result()
+	if blocked != "https://lists.example.com/blocklist.txt" {
+		t.Fatalf("Expected remote block to keep its source on import, but got %q", blocked)
+	}
+
+	r, _ = http.Post(importer.URL+"?merge=maybe", "application/json", bytes.NewReader(backup))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400 for invalid merge, but got %d", r.StatusCode)
+	}
+	r, _ = http.Get(importer.URL)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405 for GET, but got %d", r.StatusCode)
+	}
+}
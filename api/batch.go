@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// batchMaxActivities is the number of activities buffered for one domain, older ones are dropped beyond it
+const batchMaxActivities = 500
+
+// batchCollection : Activities buffered for a subscriber in batch mode, delivered together.
+// Receivers must accept an OrderedCollection in their inbox. Mastodon, Misskey and Pleroma do not and drop it,
+// so batch mode is only for subscribers running software that understands these batches.
+type batchCollection struct {
+	Context      string            `json:"@context"`
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	TotalItems   int               `json:"totalItems"`
+	OrderedItems []json.RawMessage `json:"orderedItems"`
+}
+
+// isBatchDomain reports whether domain receives activities in batches instead of one delivery each
+func isBatchDomain(domain string) bool {
+	return contains(RelayState.BatchDomains, domain)
+}
+
+// bufferBatchActivity keeps body for the next batch delivery to domain
+func bufferBatchActivity(domain string, body []byte) {
+	key := models.RedisKey("relay:batch:activities:") + domain
+	pipe := RelayState.RedisClient.TxPipeline()
+	length := pipe.RPush(context.TODO(), key, body)
+	pipe.LTrim(context.TODO(), key, -batchMaxActivities, -1)
+	pipe.SAdd(context.TODO(), models.RedisKey("relay:batch:pending"), domain)
+	_, err := pipe.Exec(context.TODO())
+	if err != nil {
+		logger.WithError(err).WithField("domain", domain).Error("Failed to buffer activity for batch delivery")
+		return
+	}
+	if dropped := length.Val() - batchMaxActivities; dropped > 0 {
+		logger.WithField("domain", domain).WithField("dropped", dropped).Warn("Dropped oldest activity buffered for batch delivery")
+		countHeldDropped(heldBufferBatch, dropped)
+	}
+}
+
+// batchInboxURL returns the inbox of the subscription of domain, empty when it has none anymore
+func batchInboxURL(domain string) string {
+	for _, subscription := range RelayState.SubscribersAndFollowers {
+		if subscription.Domain == domain {
+			return subscription.InboxURL
+		}
+	}
+	return ""
+}
+
+// flushBatchActivities delivers the buffered activities of every domain as one collection each, returning the number of batches sent.
+// Buffers are taken atomically, so several API servers flushing at once never deliver an activity twice.
+func flushBatchActivities() int {
+	if RelayState.Paused {
+		// Buffered batches wait for delivery to resume like held activities
+		return 0
+	}
+	domains, err := RelayState.RedisClient.SMembers(context.TODO(), models.RedisKey("relay:batch:pending")).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to list batch delivery domains")
+		return 0
+	}
+	sort.Strings(domains)
+
+	takeBatchScript := "local items = redis.call('LRANGE', KEYS[1], 0, -1); redis.call('DEL', KEYS[1]); redis.call('SREM', KEYS[2], ARGV[1]); return items"
+	sent := 0
+	for _, domain := range domains {
+		items, err := RelayState.RedisClient.Eval(context.TODO(), takeBatchScript, []string{models.RedisKey("relay:batch:activities:") + domain, models.RedisKey("relay:batch:pending")}, domain).StringSlice()
+		if err != nil || len(items) == 0 {
+			continue
+		}
+		inboxURL := batchInboxURL(domain)
+		if inboxURL == "" {
+			logger.WithField("domain", domain).WithField("activities", len(items)).Debug("Dropped batch of unsubscribed domain")
+			continue
+		}
+
+		collection := batchCollection{
+			Context:    "https://www.w3.org/ns/activitystreams",
+			ID:         RelayActor().ID + "/batches/" + uuid.New().String(),
+			Type:       "OrderedCollection",
+			TotalItems: len(items),
+		}
+		for _, item := range items {
+			collection.OrderedItems = append(collection.OrderedItems, json.RawMessage(item))
+		}
+		body, err := json.Marshal(&collection)
+		if err != nil {
+			logger.WithError(err).WithField("domain", domain).Error("Failed to build batch delivery")
+			continue
+		}
+		enqueueActivityForInboxes(body, []string{inboxURL})
+		logger.WithField("domain", domain).WithField("activities", len(items)).Debug("Delivered batch")
+		sent++
+	}
+	return sent
+}
+
+// startBatchDelivery flushes buffered batches every interval until the returned function is called
+func startBatchDelivery(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				flushBatchActivities()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// handleAdminBatch manages subscribers receiving activities in batches every BATCH_DELIVERY_INTERVAL.
+// Only enable it for subscribers known to accept batchCollection, common servers drop batches silently.
+// GET /api/admin/batch
+// POST, DELETE /api/admin/batch
+// Body: {"domain": "example.com"}
+// Response: {"batch_domains": [...]}
+func handleAdminBatch(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+	case "POST", "DELETE":
+		var req struct {
+			Domain string `json:"domain"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+			return
+		}
+		if req.Domain == "" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "domain required"})
+			return
+		}
+		RelayState.SetBatchDomain(strings.ToLower(req.Domain), request.Method == "POST")
+		if request.Method == "POST" {
+			logger.WithField("domain", req.Domain).Warn("Admin enabled batch delivery, the subscriber must accept OrderedCollection batches in its inbox")
+			recordAdminAction(request, "enable_batch", strings.ToLower(req.Domain), "")
+		} else {
+			logger.WithField("domain", req.Domain).Info("Admin disabled batch delivery")
+			recordAdminAction(request, "disable_batch", strings.ToLower(req.Domain), "")
+		}
+	default:
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	batchDomains := append([]string{}, RelayState.BatchDomains...)
+	sort.Strings(batchDomains)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]string{"batch_domains": batchDomains})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestEnqueueActivityForBatchDomain(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "batch.example.com",
+		InboxURL: "https://batch.example.com/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "gone.example.com",
+		InboxURL: "https://gone.example.com/inbox",
+	})
+	RelayState.SetBatchDomain("batch.example.com", true)
+	RelayState.SetBatchDomain("gone.example.com", true)
+
+	enqueueActivityForSubscriber("source.example.com", []byte(`{"id":"https://source.example.com/1"}`))
+	enqueueActivityForSubscriber("source.example.com", []byte(`{"id":"https://source.example.com/2"}`))
+	if keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result(); len(keys) != 0 {
+		t.Fatalf("Expected no individual delivery to batch mode subscribers, but got %d", len(keys))
+	}
+	buffered, _ := RelayState.RedisClient.LLen(context.TODO(), "relay:batch:activities:batch.example.com").Result()
+	if buffered != 2 {
+		t.Fatalf("Expected 2 buffered activities, but got %d", buffered)
+	}
+
+	RelayState.DelSubscriber("gone.example.com")
+	if sent := flushBatchActivities(); sent != 1 {
+		t.Fatalf("Expected one batch to be sent, but got %d", sent)
+	}
+	keys := waitRelayActivityKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("Expected one stored batch, but got %d", len(keys))
+	}
+	body, _ := RelayState.RedisClient.HGet(context.TODO(), keys[0], "body").Result()
+	var collection batchCollection
+	json.Unmarshal([]byte(body), &collection)
+	if collection.Type != "OrderedCollection" || collection.TotalItems != 2 || !strings.Contains(string(collection.OrderedItems[1]), "/2") {
+		t.Fatalf("Expected collection of the 2 activities in order, but got %s", body)
+	}
+	if pending, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:batch:pending", "relay:batch:activities:batch.example.com", "relay:batch:activities:gone.example.com").Result(); pending != 0 {
+		t.Fatalf("Expected buffers to be emptied, but got %d keys", pending)
+	}
+	if sent := flushBatchActivities(); sent != 0 {
+		t.Fatalf("Expected nothing left to flush, but got %d", sent)
+	}
+}
+
+func TestBufferBatchActivityLimit(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	for i := 0; i <= batchMaxActivities; i++ {
+		bufferBatchActivity("batch.example.com", []byte(`{}`))
+	}
+	if buffered, _ := RelayState.RedisClient.LLen(context.TODO(), "relay:batch:activities:batch.example.com").Result(); buffered != batchMaxActivities {
+		t.Fatalf("Expected %d buffered activities, but got %d", batchMaxActivities, buffered)
+	}
+	if dropped := heldDroppedCount(heldBufferBatch); dropped != 1 {
+		t.Fatalf("Expected 1 dropped activity to be counted, but got %d", dropped)
+	}
+}
+
+func TestHandleAdminBatch(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	s := httptest.NewServer(http.HandlerFunc(handleAdminBatch))
+	defer s.Close()
+
+	r, err := http.Post(s.URL, "application/json", strings.NewReader(`{"domain":"Batch.example.com"}`))
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var response map[string][]string
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if len(response["batch_domains"]) != 1 || !isBatchDomain("batch.example.com") {
+		t.Fatalf("Expected batch.example.com in batch mode, but got %v", response["batch_domains"])
+	}
+
+	req, _ := http.NewRequest("DELETE", s.URL, strings.NewReader(`{"domain":"batch.example.com"}`))
+	r, _ = http.DefaultClient.Do(req)
+	r.Body.Close()
+	if isBatchDomain("batch.example.com") {
+		t.Fatal("Expected batch mode to be disabled")
+	}
+
+	req, _ = http.NewRequest("PUT", s.URL, nil)
+	r, _ = http.DefaultClient.Do(req)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405, but got %d", r.StatusCode)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// blocklistMaxSize is the largest remote blocklist read, longer ones are cut
+const blocklistMaxSize = 16 << 20
+
+// parseBlocklistCSV returns the domains of a blocklist in the Mastodon domain block export format, as shared by Oliphant.
+// Without a header row the first column holds the domain. Entries with a severity other than suspend, and obfuscated
+// domains, are skipped.
+func parseBlocklistCSV(reader io.Reader) ([]string, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	csvReader.TrimLeadingSpace = true
+
+	domainColumn, severityColumn := 0, -1
+	var domains []string
+	seen := map[string]bool{}
+	for row := 0; ; row++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row == 0 {
+			header := false
+			for i, field := range record {
+				switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(field)), "#") {
+				case "domain":
+					domainColumn = i
+					header = true
+				case "severity":
+					severityColumn = i
+				}
+			}
+			if header {
+				continue
+			}
+			severityColumn = -1
+		}
+
+		if domainColumn >= len(record) {
+			continue
+		}
+		domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(record[domainColumn])), ".")
+		if domain == "" || strings.HasPrefix(domain, "#") || strings.ContainsAny(domain, "*/ ") {
+			continue
+		}
+		if severityColumn >= 0 && severityColumn < len(record) {
+			if severity := strings.ToLower(strings.TrimSpace(record[severityColumn])); severity != "" && severity != "suspend" {
+				continue
+			}
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+// fetchBlocklist returns the domains of the remote blocklist at blocklistURL, or nil when it is unchanged since the last fetch
+func fetchBlocklist(blocklistURL string) ([]string, error) {
+	cacheKey := models.RedisKey("relay:blocklist:") + blocklistURL
+	cache, _ := RelayState.RedisClient.HGetAll(context.TODO(), cacheKey).Result()
+
+	req, err := http.NewRequest("GET", blocklistURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/csv")
+	if cache["etag"] != "" {
+		req.Header.Set("If-None-Match", cache["etag"])
+	}
+	if cache["last_modified"] != "" {
+		req.Header.Set("If-Modified-Since", cache["last_modified"])
+	}
+	resp, err := models.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, &models.HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	domains, err := parseBlocklistCSV(io.LimitReader(resp.Body, blocklistMaxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := RelayState.RedisClient.TxPipeline()
+	pipe.Del(context.TODO(), cacheKey)
+	pipe.HSet(context.TODO(), cacheKey, "etag", resp.Header.Get("ETag"), "last_modified", resp.Header.Get("Last-Modified"), "fetched_at", time.Now().Unix())
+	pipe.Exec(context.TODO())
+
+	if domains == nil {
+		// An empty list unblocks every domain of its source, unlike an unchanged one
+		domains = []string{}
+	}
+	return domains, nil
+}
+
+// refreshRemoteBlocklists fetches every configured blocklist and merges it into the blocked domains.
+// A blocklist which fails to fetch keeps its domains blocked until the next refresh.
+func refreshRemoteBlocklists() {
+	lists := map[string][]string{}
+	for _, blocklistURL := range GlobalConfig.BlocklistURLs() {
+		domains, err := fetchBlocklist(blocklistURL)
+		if err != nil {
+			logger.WithError(err).WithField("url", blocklistURL).Warn("Failed to fetch remote blocklist")
+		}
+		lists[blocklistURL] = domains
+	}
+
+	added, removed := RelayState.SyncRemoteBlockedDomains(lists)
+	if len(added) > 0 || len(removed) > 0 {
+		logger.WithField("blocked", len(added)).WithField("unblocked", len(removed)).Info("Applied remote blocklists")
+	}
+}
+
+// startBlocklistRefresh applies remote blocklists now and every interval until the returned function is called.
+// It runs without any blocklist configured too, so domains of a removed blocklist are unblocked.
+func startBlocklistRefresh(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		refreshRemoteBlocklists()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				refreshRemoteBlocklists()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
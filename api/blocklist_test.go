@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestParseBlocklistCSV(t *testing.T) {
+	sample := `#domain,#severity,#reject_media,#reject_reports,#public_comment,#obfuscate
+spam.example.com,suspend,true,true,"Spam, harassment",false
+Bad.Example.net.,suspend,false,false,,false
+quiet.example.org,silence,true,false,,false
+ex*mple.com,suspend,false,false,,true
+spam.example.com,suspend,true,true,duplicate,false
+`
+	domains, err := parseBlocklistCSV(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Expected sample to parse, but got error: %v", err)
+	}
+	expected := []string{"spam.example.com", "bad.example.net"}
+	if !reflect.DeepEqual(domains, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, domains)
+	}
+
+	domains, err = parseBlocklistCSV(strings.NewReader("spam.example.com\n# comment\nbad.example.net\n"))
+	if err != nil {
+		t.Fatalf("Expected list without header to parse, but got error: %v", err)
+	}
+	if !reflect.DeepEqual(domains, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, domains)
+	}
+}
+
+func TestRefreshRemoteBlocklists(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	blocklist := "#domain,#severity\nspam.example.com,suspend\nmanual.example.com,suspend\n"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + strconv.Itoa(len(blocklist)) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(304)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(blocklist))
+	}))
+	defer s.Close()
+
+	defer func(config *models.RelayConfig) { GlobalConfig = config }(GlobalConfig)
+	viper.Set("BLOCKLIST_URLS", s.URL)
+	defer viper.Set("BLOCKLIST_URLS", "")
+	GlobalConfig, _ = models.NewRelayConfig()
+
+	RelayState.SetBlockedDomain("manual.example.com", true)
+	refreshRemoteBlocklists()
+	blocked := append([]string{}, RelayState.BlockedDomains...)
+	sort.Strings(blocked)
+	if !reflect.DeepEqual(blocked, []string{"manual.example.com", "spam.example.com"}) {
+		t.Fatalf("Expected remote domains to be blocked, but got %v", blocked)
+	}
+	source, _ := RelayState.RedisClient.HGet(context.TODO(), "relay:config:blockedDomain", "spam.example.com").Result()
+	if source != s.URL {
+		t.Fatalf("Expected remote block to be tagged with its source, but got %s", source)
+	}
+
+	refreshRemoteBlocklists()
+	if len(RelayState.BlockedDomains) != 2 {
+		t.Fatalf("Expected unchanged blocklist to keep its blocks, but got %v", RelayState.BlockedDomains)
+	}
+
+	blocklist = "#domain,#severity\n"
+	refreshRemoteBlocklists()
+	if !reflect.DeepEqual(RelayState.BlockedDomains, []string{"manual.example.com"}) {
+		t.Fatalf("Expected only the manual block to remain, but got %v", RelayState.BlockedDomains)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+const (
+	catchUpSubscriberKey = "relay:catchup:subscriber"
+	catchUpFollowerKey   = "relay:catchup:follower"
+)
+
+type catchUpEntry struct {
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// recordCatchUpActivity keeps body in the capped list replayed to new subscribers or followers
+func recordCatchUpActivity(key string, activityType string, body []byte) {
+	count := GlobalConfig.CatchUpActivityCount()
+	if count < 1 || activityType == "Delete" {
+		return
+	}
+	data, _ := json.Marshal(catchUpEntry{activityType, string(body)})
+
+	ctx := context.TODO()
+	pipe := RelayState.RedisClient.TxPipeline()
+	pipe.LPush(ctx, models.RedisKey(key), data)
+	pipe.LTrim(ctx, models.RedisKey(key), 0, int64(count-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.WithError(err).Error("Failed to record catch-up activity")
+	}
+}
+
+// replayCatchUpActivities sends the recorded activities of key to inboxURL following the identity identityID, oldest first,
+// returning how many were sent. Announces of other relay actors are skipped.
+func replayCatchUpActivities(key string, inboxURL string, identityID string) int {
+	count := GlobalConfig.CatchUpActivityCount()
+	if count < 1 {
+		return 0
+	}
+	values, err := RelayState.RedisClient.LRange(context.TODO(), models.RedisKey(key), 0, int64(count-1)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read catch-up activities")
+		return 0
+	}
+	replayed := 0
+	for i := len(values) - 1; i >= 0; i-- {
+		var entry catchUpEntry
+		if json.Unmarshal([]byte(values[i]), &entry) != nil || entry.Type == "Delete" {
+			continue
+		}
+		if bodyIdentityID, byRelayActor := bodyIdentity([]byte(entry.Body)); byRelayActor && bodyIdentityID != identityID {
+			continue
+		}
+		enqueueRegisterActivity(inboxURL, []byte(entry.Body))
+		replayed++
+	}
+	if replayed > 0 {
+		logger.WithFields(logrus.Fields{"inbox_url": inboxURL, "count": replayed}).Info("Replayed recent activities")
+	}
+	return replayed
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func withCatchUpActivityCount(t *testing.T, count int) {
+	config := GlobalConfig
+	viper.Set("CATCHUP_ACTIVITY_COUNT", count)
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = relayConfig
+	t.Cleanup(func() {
+		viper.Set("CATCHUP_ACTIVITY_COUNT", 0)
+		GlobalConfig = config
+	})
+}
+
+func TestRecordCatchUpActivity(t *testing.T) {
+	withCatchUpActivityCount(t, 3)
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	for i := 0; i < 5; i++ {
+		recordCatchUpActivity(catchUpSubscriberKey, "Create", []byte(`{"id":"`+strconv.Itoa(i)+`"}`))
+	}
+	recordCatchUpActivity(catchUpSubscriberKey, "Delete", []byte(`{"id":"deleted"}`))
+
+	values, _ := RelayState.RedisClient.LRange(context.TODO(), catchUpSubscriberKey, 0, -1).Result()
+	if len(values) != 3 {
+		t.Fatalf("Expected 3 catch-up activities, but got %d", len(values))
+	}
+	var newest catchUpEntry
+	json.Unmarshal([]byte(values[0]), &newest)
+	if newest.Body != `{"id":"4"}` {
+		t.Fatalf("Expected newest Create to be kept first, but got %s", newest.Body)
+	}
+}
+
+func TestRecordCatchUpActivityDisabled(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	recordCatchUpActivity(catchUpSubscriberKey, "Create", []byte(`{}`))
+	if exists, _ := RelayState.RedisClient.Exists(context.TODO(), catchUpSubscriberKey).Result(); exists != 0 {
+		t.Fatal("Expected nothing to be recorded when catch-up is disabled, but it was")
+	}
+}
+
+func TestReplayCatchUpActivities(t *testing.T) {
+	withCatchUpActivityCount(t, 3)
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	recordCatchUpActivity(catchUpSubscriberKey, "Create", []byte(`{"id":"1"}`))
+	recordCatchUpActivity(catchUpSubscriberKey, "Announce", []byte(`{"id":"2"}`))
+	// Entries recorded before the guard are still never replayed
+	data, _ := json.Marshal(catchUpEntry{"Delete", `{"id":"3"}`})
+	RelayState.RedisClient.LPush(context.TODO(), catchUpSubscriberKey, data)
+
+	if replayed := replayCatchUpActivities(catchUpSubscriberKey, "https://new.example.com/inbox", ""); replayed != 2 {
+		t.Fatalf("Expected 2 replayed activities, but got %d", replayed)
+	}
+}
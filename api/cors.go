@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORSConfig : Cross-origin access allowed to JSON API
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to read responses, "*" allows any
+	AllowedOrigins []string
+}
+
+func (config CORSConfig) allowOrigin(origin string) string {
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// withCORS sets CORS headers and answers preflight requests before next runs
+func withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		allowOrigin := CORSPolicy.allowOrigin(request.Header.Get("Origin"))
+		if allowOrigin != "" {
+			writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		}
+		if allowOrigin != "*" {
+			writer.Header().Add("Vary", "Origin")
+		}
+		if request.Method == http.MethodOptions {
+			if allowOrigin != "" {
+				writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+				writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				writer.Header().Set("Access-Control-Max-Age", "86400")
+			}
+			writer.WriteHeader(204)
+			return
+		}
+		next(writer, request)
+	}
+}
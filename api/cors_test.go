@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithCORSPreflight(t *testing.T) {
+	called := false
+	s := httptest.NewServer(withCORS(requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})))
+	defer s.Close()
+
+	defer func(policy CORSConfig) { CORSPolicy = policy }(CORSPolicy)
+	CORSPolicy = CORSConfig{AllowedOrigins: []string{"https://dashboard.example.com"}}
+
+	req, _ := http.NewRequest("OPTIONS", s.URL, nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 204 {
+		t.Fatalf("Expected StatusCode to be 204, but got %d", r.StatusCode)
+	}
+	if called {
+		t.Fatal("Expected preflight not to reach the handler, but it did")
+	}
+	if r.Header.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" {
+		t.Fatalf("Expected allowed origin to be echoed, but got '%s'", r.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if r.Header.Get("Access-Control-Allow-Methods") == "" || r.Header.Get("Access-Control-Allow-Headers") == "" {
+		t.Fatal("Expected Access-Control-Allow-Methods and Access-Control-Allow-Headers, but got none")
+	}
+}
+
+func TestWithCORSOrigins(t *testing.T) {
+	s := httptest.NewServer(withCORS(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	defer func(policy CORSConfig) { CORSPolicy = policy }(CORSPolicy)
+	for _, tc := range []struct {
+		allowed  []string
+		origin   string
+		expected string
+	}{
+		{[]string{"*"}, "https://any.example.com", "*"},
+		{[]string{"https://dashboard.example.com"}, "https://dashboard.example.com", "https://dashboard.example.com"},
+		{[]string{"https://dashboard.example.com"}, "https://evil.example.com", ""},
+		{nil, "https://dashboard.example.com", ""},
+	} {
+		CORSPolicy = CORSConfig{AllowedOrigins: tc.allowed}
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		req.Header.Set("Origin", tc.origin)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.Header.Get("Access-Control-Allow-Origin") != tc.expected {
+			t.Fatalf("Expected origin %s allowed by %v to get '%s', but got '%s'", tc.origin, tc.allowed, tc.expected, r.Header.Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
@@ -1,77 +1,246 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
-	"github.com/go-fed/httpsig"
 	"github.com/yukimochi/Activity-Relay/models"
 )
 
-func decodeActivity(request *http.Request) (*models.Activity, *models.Actor, []byte, error) {
-	request.Header.Set("Host", request.Host)
-	body, err := io.ReadAll(request.Body)
+// SignaturePolicy : Restrict HTTP Signatures accepted on inbox.
+type SignaturePolicy struct {
+	// AllowedAlgorithms : Accepted algorithm parameters. Empty means accept all.
+	AllowedAlgorithms []string
+	// RequireDigest : Reject requests without Digest header.
+	RequireDigest bool
+	// ClockSkew : Accepted offset of signature created and expires from the relay's clock, widening the window of a signed Date header.
+	ClockSkew time.Duration
+}
 
-	// Verify HTTPSignature
-	verifier, err := httpsig.NewVerifier(request)
+func (policy *SignaturePolicy) allowsAlgorithm(algorithm string) bool {
+	if len(policy.AllowedAlgorithms) == 0 {
+		return true
+	}
+	for _, allowed := range policy.AllowedAlgorithms {
+		if strings.EqualFold(allowed, algorithm) {
+			return true
+		}
+	}
+	return false
+}
+
+// signaturePolicyError : Request rejected by SignaturePolicy.
+type signaturePolicyError struct {
+	message string
+}
+
+func (err *signaturePolicyError) Error() string {
+	return err.message
+}
+
+// signatureAlgorithmPattern matches the algorithm parameter of a Signature header
+var signatureAlgorithmPattern = regexp.MustCompile(`algorithm="([^"]*)"`)
+
+// signatureAlgorithm : Read algorithm parameter from Signature (or Authorization) header.
+func signatureAlgorithm(request *http.Request) string {
+	signature := request.Header.Get("Signature")
+	if signature == "" {
+		signature = request.Header.Get("Authorization")
+	}
+	matched := signatureAlgorithmPattern.FindStringSubmatch(signature)
+	if matched == nil {
+		// draft-cavage-http-signatures-12 : hs2019 is implied when algorithm is omitted.
+		return "hs2019"
+	}
+	return strings.ToLower(matched[1])
+}
+
+// verifyHTTPSignature verifies the HTTP Signature of request and returns the key owner
+func verifyHTTPSignature(request *http.Request) (*models.Actor, error) {
+	signature, err := parseHTTPSignature(request)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	KeyID := verifier.KeyId()
-	keyOwnerActor, err := models.NewActivityPubActorFromRemoteActor(KeyID, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", GlobalConfig.ServerServiceName(), version, GlobalConfig.ServerHostname().Host), ActorCache)
+	algorithm := signatureAlgorithm(request)
+	if !InboxSignaturePolicy.allowsAlgorithm(algorithm) {
+		return nil, &signaturePolicyError{"signature algorithm " + algorithm + " is not accepted by this relay (accepted: " + strings.Join(InboxSignaturePolicy.AllowedAlgorithms, ", ") + ")"}
+	}
+	keyOwnerActor, err := models.NewActivityPubActorFromRemoteActor(signature.keyID, GlobalConfig.UserAgent(version), ActorCache)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	PubKey, err := models.ReadPublicKeyRSAFromString(keyOwnerActor.PublicKey.PublicKeyPem)
-	if PubKey == nil {
-		return nil, nil, nil, errors.New("failed parse PublicKey from string")
+	PubKey, found := keyOwnerActor.VerificationKeyByID(signature.keyID)
+	if !found {
+		return nil, errors.New("failed parse PublicKey from string")
 	}
+	err = signature.verify(request, PubKey)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	err = verifier.Verify(PubKey, httpsig.RSA_SHA256)
+	// Times are only trusted once the signature covering them is valid
+	err = checkSignatureTime(signature, request.Header.Get("Date"), time.Now(), InboxSignaturePolicy.ClockSkew)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
+	return &keyOwnerActor, nil
+}
 
-	// Verify Digest
-	givenDigest := request.Header.Get("Digest")
-	hash := sha256.New()
-	hash.Write(body)
-	b := hash.Sum(nil)
-	calculatedDigest := "SHA-256=" + base64.StdEncoding.EncodeToString(b)
+// decodeActivity verifies request and returns its activity, the actor of the activity and the owner of the key which
+// signed the request. The key owner is nil for an accepted unsigned Delete.
+func decodeActivity(request *http.Request) (*models.Activity, *models.Actor, *models.Actor, []byte, error) {
+	request.Header.Set("Host", request.Host)
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 
-	if givenDigest != calculatedDigest {
-		return nil, nil, nil, errors.New("digest header is mismatch")
+	// Verify HTTPSignature
+	keyOwner, err := verifyHTTPSignature(request)
+	if err != nil {
+		var policyErr *signaturePolicyError
+		if errors.As(err, &policyErr) || !RelayState.RelayConfig.AllowUnsignedDeletes {
+			return nil, nil, nil, nil, err
+		}
+		return decodeUnsignedDelete(request, body, err)
+	}
+
+	// Verify Digest
+	err = verifyDigest(request, body)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
 	// Parse Activity
 	var activity models.Activity
 	err = json.Unmarshal(body, &activity)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	remoteActor, err := models.NewActivityPubActorFromRemoteActor(activity.Actor, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", GlobalConfig.ServerServiceName(), version, GlobalConfig.ServerHostname().Host), ActorCache)
+	remoteActor, err := models.NewActivityPubActorFromRemoteActor(activity.Actor, GlobalConfig.UserAgent(version), ActorCache)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	return &activity, &remoteActor, body, nil
+	return &activity, &remoteActor, keyOwner, body, nil
 }
 
-func fetchOriginalActivityFromURL(url string) (*models.Activity, *models.Actor, error) {
-	remoteActivity, err := models.NewActivityPubActivityFromRemoteActivity(url, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", GlobalConfig.ServerServiceName(), version, GlobalConfig.ServerHostname().Host))
+func verifyDigest(request *http.Request, body []byte) error {
+	givenDigest := request.Header.Get("Digest")
+	if givenDigest != "" || InboxSignaturePolicy.RequireDigest {
+		hash := sha256.New()
+		hash.Write(body)
+		b := hash.Sum(nil)
+		calculatedDigest := "SHA-256=" + base64.StdEncoding.EncodeToString(b)
+
+		if givenDigest != calculatedDigest {
+			return errors.New("digest header is mismatch")
+		}
+	}
+	return nil
+}
+
+// decodeUnsignedDelete accepts a Delete whose signature failed verification with signatureErr, when it deletes its own
+// actor and that actor is gone from its server. Anything else is rejected with signatureErr.
+func decodeUnsignedDelete(request *http.Request, body []byte, signatureErr error) (*models.Activity, *models.Actor, *models.Actor, []byte, error) {
+	var activity models.Activity
+	err := json.Unmarshal(body, &activity)
+	if err != nil || activity.Type != "Delete" || activity.Actor == "" || deletedObjectID(&activity) != activity.Actor {
+		return nil, nil, nil, nil, signatureErr
+	}
+	if verifyDigest(request, body) != nil || !isActorGone(activity.Actor) {
+		return nil, nil, nil, nil, signatureErr
+	}
+	activityLogger(&activity).WithError(signatureErr).Info("Accepted Unsigned Delete")
+
+	return &activity, &models.Actor{ID: activity.Actor}, nil, body, nil
+}
+
+// deletedObjectID returns the id of the object of a Delete, given as an id or an embedded object
+func deletedObjectID(activity *models.Activity) string {
+	switch object := activity.Object.(type) {
+	case string:
+		return object
+	case map[string]interface{}:
+		id, _ := object["id"].(string)
+		return id
+	}
+	return ""
+}
+
+// isActorGone reports whether the server of actorID no longer serves the actor
+func isActorGone(actorID string) bool {
+	req, err := http.NewRequest("GET", actorID, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Accept", "application/activity+json")
+	req.Header.Set("User-Agent", GlobalConfig.UserAgent(version))
+	resp, err := models.HTTPClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound
+}
+
+func fetchOriginalActivityFromURL(ctx context.Context, activityURL string) (*models.Activity, *models.Actor, error) {
+	remoteActivity, err := models.NewActivityPubActivityFromRemoteActivityWithContext(ctx, activityURL, GlobalConfig.UserAgent(version))
 	if err != nil {
 		return nil, nil, err
 	}
-	remoteActor, err := models.NewActivityPubActorFromRemoteActor(remoteActivity.Actor, fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", GlobalConfig.ServerServiceName(), version, GlobalConfig.ServerHostname().Host), ActorCache)
+	remoteActor, err := models.NewActivityPubActorFromRemoteActorWithContext(ctx, remoteActivity.Actor, GlobalConfig.UserAgent(version), ActorCache)
 	if err != nil {
 		return &remoteActivity, nil, err
 	}
 	return &remoteActivity, &remoteActor, err
 }
+
+// fetchAnnouncedActivity fetches the object of an Announce, counting the outcome for metrics
+func fetchAnnouncedActivity(ctx context.Context, objectURL string) (*models.Activity, *models.Actor, error) {
+	activity, actor, err := fetchOriginalActivityFromURL(ctx, objectURL)
+	recordAnnounceFetch(objectURL, err)
+	return activity, actor, err
+}
+
+// embeddedOriginalActivity resolves an Announce object inlined as a map, fetching it only when just an id is given.
+// signerID is the verified owner of the key which signed the Announce.
+func embeddedOriginalActivity(ctx context.Context, object map[string]interface{}, signerID string) (*models.Activity, *models.Actor, error) {
+	id, _ := object["id"].(string)
+	if id == "" {
+		return nil, nil, errors.New("embedded object has no id")
+	}
+	data, _ := json.Marshal(object)
+	var embeddedActivity models.Activity
+	if err := json.Unmarshal(data, &embeddedActivity); err != nil {
+		return nil, nil, err
+	}
+	if embeddedActivity.Actor == "" {
+		embeddedActivity.Actor, _ = object["attributedTo"].(string)
+	}
+	// Only trust an inlined object claiming an actor on its own host, when that host also signed the Announce.
+	// Actor and id are given by the sender, anything else is fetched from its origin.
+	objectURL, err := url.Parse(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	actorURL, err := url.Parse(embeddedActivity.Actor)
+	signerURL, signerErr := url.Parse(signerID)
+	if embeddedActivity.Type == "" || embeddedActivity.Actor == "" || err != nil || signerErr != nil || signerID == "" ||
+		actorURL.Host != objectURL.Host || !strings.EqualFold(signerURL.Host, objectURL.Host) {
+		return fetchAnnouncedActivity(ctx, id)
+	}
+	remoteActor, err := models.NewActivityPubActorFromRemoteActorWithContext(ctx, embeddedActivity.Actor, GlobalConfig.UserAgent(version), ActorCache)
+	if err != nil {
+		return &embeddedActivity, nil, err
+	}
+	return &embeddedActivity, &remoteActor, nil
+}
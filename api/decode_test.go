@@ -3,11 +3,16 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/yukimochi/Activity-Relay/models"
 )
@@ -32,7 +37,7 @@ func TestDecodeActivity(t *testing.T) {
 	req.Header.Add("digest", "SHA-256=mxgIzbPwBuNYxmjhQeH0vWeEedQGqR1R7zMwR/XTfX8=")
 	req.Header.Add("signature", `keyId="https://innocent.yukimochi.io/users/YUKIMOCHI#main-key",algorithm="rsa-sha256",headers="(request-target) host date digest content-type",signature="MhxXhL21RVp8VmALER2U/oJlWldJAB2COiU2QmwGopLD2pw1c32gQvg0PaBRHfMBBOsidZuRRnj43Kn488zW2xV3n3DYWcGscSh527/hhRzcpLVX2kBqbf/WeQzJmfJVuOX4SzivVhnnUB8PvlPj5LRHpw4n/ctMTq37strKDl9iZg9rej1op1YFJagDxm3iPzAhnv8lzO4RI9dstt2i/sN5EfjXai97oS7EgI//Kj1wJCRk9Pw1iTsGfPTkbk/aVZwDt7QGGvGDdO0JJjsCqtIyjojoyD9hFY9GzMqvTwVIYJrh54AUHq2i80veybaOBbCFcEaK0RpKoLs101r5Uw=="`)
 
-	activity, actor, _, err := decodeActivity(req)
+	activity, actor, keyOwner, _, err := decodeActivity(req)
 	if err != nil {
 		t.Fatalf("Expected decodeActivity to succeed, but got error: %v", err)
 	}
@@ -40,6 +45,9 @@ func TestDecodeActivity(t *testing.T) {
 	if activity.Actor != actor.ID {
 		t.Fatalf("Expected activity.Actor to be '%s', but got '%s'", actor.ID, activity.Actor)
 	}
+	if keyOwner == nil || keyOwner.ID != "https://innocent.yukimochi.io/users/YUKIMOCHI" {
+		t.Fatalf("Expected key owner to be the signer, but got %v", keyOwner)
+	}
 }
 
 func TestDecodeActivityWithNoSignature(t *testing.T) {
@@ -60,7 +68,7 @@ func TestDecodeActivityWithNoSignature(t *testing.T) {
 	req.Header.Add("date", "Sun, 23 Dec 2018 07:39:37 GMT")
 	req.Header.Add("digest", "SHA-256=mxgIzbPwBuNYxmjhQeH0vWeEedQGqR1R7zMwR/XTfX8=")
 
-	_, _, _, err := decodeActivity(req)
+	_, _, _, _, err := decodeActivity(req)
 	if err == nil || err.Error() != "neither \"Signature\" nor \"Authorization\" have signature parameters" {
 		t.Fatalf("Expected error 'neither \"Signature\" nor \"Authorization\" have signature parameters', but got '%v'", err)
 	}
@@ -86,7 +94,7 @@ func TestDecodeActivityWithNotFoundKeyId(t *testing.T) {
 	req.Header.Add("digest", "SHA-256=mxgIzbPwBuNYxmjhQeH0vWeEedQGqR1R7zMwR/XTfX8=")
 	req.Header.Add("signature", `keyId="https://innocent.yukimochi.io/users/admin#main-key",algorithm="rsa-sha256",headers="(request-target) host date digest content-type",signature="MhxXhL21RVp8VmALER2U/oJlWldJAB2COiU2QmwGopLD2pw1c32gQvg0PaBRHfMBBOsidZuRRnj43Kn488zW2xV3n3DYWcGscSh527/hhRzcpLVX2kBqbf/WeQzJmfJVuOX4SzivVhnnUB8PvlPj5LRHpw4n/ctMTq37strKDl9iZg9rej1op1YFJagDxm3iPzAhnv8lzO4RI9dstt2i/sN5EfjXai97oS7EgI//Kj1wJCRk9Pw1iTsGfPTkbk/aVZwDt7QGGvGDdO0JJjsCqtIyjojoyD9hFY9GzMqvTwVIYJrh54AUHq2i80veybaOBbCFcEaK0RpKoLs101r5Uw=="`)
 
-	_, _, _, err := decodeActivity(req)
+	_, _, _, _, err := decodeActivity(req)
 	if err == nil || err.Error() != "404 Not Found" {
 		t.Fatalf("Expected error '404 Not Found', but got '%v'", err)
 	}
@@ -112,8 +120,146 @@ func TestDecodeActivityWithInvalidDigest(t *testing.T) {
 	req.Header.Add("digest", "SHA-256=xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx")
 	req.Header.Add("signature", `keyId="https://innocent.yukimochi.io/users/YUKIMOCHI#main-key",algorithm="rsa-sha256",headers="(request-target) host date digest content-type",signature="MhxXhL21RVp8VmALER2U/oJlWldJAB2COiU2QmwGopLD2pw1c32gQvg0PaBRHfMBBOsidZuRRnj43Kn488zW2xV3n3DYWcGscSh527/hhRzcpLVX2kBqbf/WeQzJmfJVuOX4SzivVhnnUB8PvlPj5LRHpw4n/ctMTq37strKDl9iZg9rej1op1YFJagDxm3iPzAhnv8lzO4RI9dstt2i/sN5EfjXai97oS7EgI//Kj1wJCRk9Pw1iTsGfPTkbk/aVZwDt7QGGvGDdO0JJjsCqtIyjojoyD9hFY9GzMqvTwVIYJrh54AUHq2i80veybaOBbCFcEaK0RpKoLs101r5Uw=="`)
 
-	_, _, _, err := decodeActivity(req)
+	_, _, _, _, err := decodeActivity(req)
 	if err == nil || err.Error() != "crypto/rsa: verification error" {
 		t.Fatalf("Expected error 'crypto/rsa: verification error', but got '%v'", err)
 	}
 }
+
+func TestDecodeActivityWithDisallowedAlgorithm(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	InboxSignaturePolicy.AllowedAlgorithms = []string{"hs2019"}
+	defer func() { InboxSignaturePolicy.AllowedAlgorithms = nil }()
+
+	file, _ := os.Open("../misc/test/create.json")
+	body, _ := io.ReadAll(file)
+	req, _ := http.NewRequest("POST", "/inbox", bytes.NewReader(body))
+	req.Host = "relay.01.cloudgarage.yukimochi.io"
+	req.Header.Add("content-type", "application/activity+json")
+	req.Header.Add("date", "Sun, 23 Dec 2018 07:39:37 GMT")
+	req.Header.Add("digest", "SHA-256=mxgIzbPwBuNYxmjhQeH0vWeEedQGqR1R7zMwR/XTfX8=")
+	req.Header.Add("signature", `keyId="https://innocent.yukimochi.io/users/YUKIMOCHI#main-key",algorithm="rsa-sha256",headers="(request-target) host date digest content-type",signature="MhxXhL21RVp8VmALER2U/oJlWldJAB2COiU2QmwGopLD2pw1c32gQvg0PaBRHfMBBOsidZuRRnj43Kn488zW2xV3n3DYWcGscSh527/hhRzcpLVX2kBqbf/WeQzJmfJVuOX4SzivVhnnUB8PvlPj5LRHpw4n/ctMTq37strKDl9iZg9rej1op1YFJagDxm3iPzAhnv8lzO4RI9dstt2i/sN5EfjXai97oS7EgI//Kj1wJCRk9Pw1iTsGfPTkbk/aVZwDt7QGGvGDdO0JJjsCqtIyjojoyD9hFY9GzMqvTwVIYJrh54AUHq2i80veybaOBbCFcEaK0RpKoLs101r5Uw=="`)
+
+	_, _, _, _, err := decodeActivity(req)
+	if _, ok := err.(*signaturePolicyError); !ok {
+		t.Fatalf("Expected signaturePolicyError for rsa-sha256, but got '%v'", err)
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/inbox", nil)
+	if algorithm := signatureAlgorithm(req); algorithm != "hs2019" {
+		t.Fatalf("Expected omitted algorithm to be 'hs2019', but got '%s'", algorithm)
+	}
+
+	req.Header.Set("Signature", `keyId="https://example.com/actor#main-key",algorithm="RSA-SHA256",signature="xxx"`)
+	if algorithm := signatureAlgorithm(req); algorithm != "rsa-sha256" {
+		t.Fatalf("Expected algorithm to be 'rsa-sha256', but got '%s'", algorithm)
+	}
+}
+
+func TestDecodeActivityUnsignedDelete(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(410)
+	}))
+	defer s.Close()
+	actorID := s.URL + "/users/alice"
+
+	newRequest := func(activityType string, object string) *http.Request {
+		body := []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"` + actorID + `#delete","type":"` + activityType + `","actor":"` + actorID + `","object":"` + object + `","to":["https://www.w3.org/ns/activitystreams#Public"]}`)
+		req, _ := http.NewRequest("POST", "/inbox", bytes.NewReader(body))
+		req.Header.Add("content-type", "application/activity+json")
+		hash := sha256.Sum256(body)
+		req.Header.Add("digest", "SHA-256="+base64.StdEncoding.EncodeToString(hash[:]))
+		return req
+	}
+
+	_, _, _, _, err := decodeActivity(newRequest("Delete", actorID))
+	if err == nil {
+		t.Fatal("Expected unsigned Delete to be rejected while AllowUnsignedDeletes is disabled")
+	}
+
+	RelayState.SetConfig(AllowUnsignedDeletes, true)
+	defer RelayState.SetConfig(AllowUnsignedDeletes, false)
+
+	activity, actor, keyOwner, _, err := decodeActivity(newRequest("Delete", actorID))
+	if err != nil {
+		t.Fatalf("Expected unsigned Delete of a gone actor to be accepted, but got error: %v", err)
+	}
+	if activity.Type != "Delete" || actor.ID != actorID {
+		t.Fatalf("Expected Delete by %s, but got %s by %s", actorID, activity.Type, actor.ID)
+	}
+	if keyOwner != nil {
+		t.Fatalf("Expected unsigned Delete to have no key owner, but got %s", keyOwner.ID)
+	}
+
+	_, _, _, _, err = decodeActivity(newRequest("Delete", actorID+"/statuses/1"))
+	if err == nil {
+		t.Fatal("Expected unsigned Delete of another object to be rejected")
+	}
+	for _, activityType := range []string{"Create", "Update", "Announce", "Follow"} {
+		_, _, _, _, err = decodeActivity(newRequest(activityType, actorID))
+		if err == nil {
+			t.Fatalf("Expected unsigned %s to still require a signature", activityType)
+		}
+	}
+}
+
+func TestFetchAnnouncedActivityMetrics(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	person, _ := os.ReadFile("../misc/test/person.json")
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/notes/ok":
+			w.Write([]byte(`{"id": "` + s.URL + `/notes/ok", "type": "Note", "actor": "` + s.URL + `/actor"}`))
+		case "/actor":
+			w.Write(person)
+		case "/notes/gone":
+			w.WriteHeader(410)
+		case "/notes/error":
+			w.WriteHeader(503)
+		case "/notes/broken":
+			w.Write([]byte(`{"id": `))
+		case "/notes/slow":
+			<-r.Context().Done()
+		}
+	}))
+	defer s.Close()
+
+	for _, path := range []string{"/notes/ok", "/notes/gone", "/notes/error", "/notes/error", "/notes/broken"} {
+		fetchAnnouncedActivity(context.TODO(), s.URL+path)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := fetchAnnouncedActivity(ctx, s.URL+"/notes/slow"); err == nil {
+		t.Fatal("Expected slow fetch to time out")
+	}
+
+	metrics := httptest.NewServer(http.HandlerFunc(handleMetrics))
+	defer metrics.Close()
+	r, _ := http.Get(metrics.URL)
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+	for _, expected := range []string{
+		"relay_announce_fetch_attempts_total 6\n",
+		"relay_announce_fetch_successes_total 1\n",
+		`relay_announce_fetch_failures_total{reason="4xx"} 1` + "\n",
+		`relay_announce_fetch_failures_total{reason="5xx"} 2` + "\n",
+		`relay_announce_fetch_failures_total{reason="parse"} 1` + "\n",
+		`relay_announce_fetch_failures_total{reason="timeout"} 1` + "\n",
+		`relay_announce_fetch_failures_total{reason="other"} 0` + "\n",
+		`relay_announce_fetch_host_total{host="` + host + `",result="5xx"} 2` + "\n",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected metrics to contain %q, but got\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// dedupTTL : How long a relayed activity ID is remembered
+const dedupTTL = 10 * time.Minute
+
+// dedupActivityTypes : Activity types fanned out to subscribers, duplicates of them amplify traffic
+var dedupActivityTypes = []string{"Create", "Update", "Delete", "Move", "Like", "EmojiReact", "Announce"}
+
+// seenRecently : Mark activity ID as seen and report whether it was already seen. Empty ID is never seen.
+func seenRecently(ctx context.Context, activityID string) bool {
+	if activityID == "" {
+		return false
+	}
+	firstSeen, err := RelayState.RedisClient.SetNX(ctx, models.RedisKey("relay:seen:")+activityID, 1, dedupTTL).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to check duplicate activity")
+		return false
+	}
+	return !firstSeen
+}
+
+// forgetSeen : Release activity ID marked by seenRecently when processing failed, so a retry of the sender is relayed.
+func forgetSeen(activityID string) {
+	if activityID == "" {
+		return
+	}
+	// Not bound to the request, whose deadline may have passed already
+	err := RelayState.RedisClient.Del(context.TODO(), models.RedisKey("relay:seen:")+activityID).Err()
+	if err != nil {
+		logger.WithError(err).Error("Failed to forget duplicate activity")
+	}
+}
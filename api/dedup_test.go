@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestSeenRecently(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	if seenRecently(context.TODO(), "https://example.com/activities/1") {
+		t.Fatal("Expected first delivery not to be seen")
+	}
+	if !seenRecently(context.TODO(), "https://example.com/activities/1") {
+		t.Fatal("Expected second delivery to be seen")
+	}
+	ttl, _ := RelayState.RedisClient.TTL(context.TODO(), "relay:seen:https://example.com/activities/1").Result()
+	if ttl <= 0 || ttl > dedupTTL {
+		t.Fatalf("Expected TTL within %v, but got %v", dedupTTL, ttl)
+	}
+	if seenRecently(context.TODO(), "") || seenRecently(context.TODO(), "") {
+		t.Fatal("Expected empty activity ID never to be seen")
+	}
+}
+
+func TestHandleInboxDuplicateCreate(t *testing.T) {
+	activity := mockActivity("Create")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", s.URL, bytes.NewReader([]byte("CreateBody")))
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		r.Body.Close()
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+	if len(keys) != 1 {
+		t.Fatalf("Expected duplicate to be relayed once, but got %d activities", len(keys))
+	}
+}
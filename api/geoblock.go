@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// CountryResolver : Country lookup of an IP address, such as geoip.Reader.
+type CountryResolver interface {
+	Country(ip net.IP) (string, error)
+}
+
+// GeoBlockConfig : Inbox connections rejected by the country of their address.
+type GeoBlockConfig struct {
+	// Resolver : Country lookup. Nil disables geoblocking.
+	Resolver CountryResolver
+	// BlockedCountries : ISO 3166-1 alpha-2 codes of rejected countries.
+	BlockedCountries []string
+	// ClientIPHeader : Header holding the client address set by a trusted proxy. Empty means RemoteAddr.
+	ClientIPHeader string
+}
+
+// clientIP returns the address request came from. With ClientIPHeader, the last entry is used as the one
+// appended by the trusted proxy, earlier entries are supplied by the client.
+func (config *GeoBlockConfig) clientIP(request *http.Request) net.IP {
+	if config.ClientIPHeader != "" {
+		if value := request.Header.Get(config.ClientIPHeader); value != "" {
+			entries := strings.Split(value, ",")
+			return net.ParseIP(strings.TrimSpace(entries[len(entries)-1]))
+		}
+	}
+	return net.ParseIP(sourceIP(request.RemoteAddr))
+}
+
+// blockedCountry returns the country of request when it is blocked. Addresses without a known country are let through.
+func (config *GeoBlockConfig) blockedCountry(request *http.Request) (string, bool) {
+	if config.Resolver == nil || len(config.BlockedCountries) == 0 {
+		return "", false
+	}
+	ip := config.clientIP(request)
+	if ip == nil {
+		return "", false
+	}
+	country, err := config.Resolver.Country(ip)
+	if err != nil {
+		logger.WithError(err).WithField("ip", ip.String()).Debug("Failed GeoIP Lookup")
+		return "", false
+	}
+	country = strings.ToUpper(country)
+	if country == "" || !contains(config.BlockedCountries, country) {
+		return "", false
+	}
+	return country, true
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockCountryResolver map[string]string
+
+func (resolver mockCountryResolver) Country(ip net.IP) (string, error) {
+	return resolver[ip.String()], nil
+}
+
+func TestHandleInboxGeoBlock(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	geoBlock := InboxGeoBlock
+	defer func() { InboxGeoBlock = geoBlock }()
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	resolver := mockCountryResolver{"127.0.0.1": "XX", "198.51.100.7": "JP", "203.0.113.9": "xx"}
+	cases := []struct {
+		config        GeoBlockConfig
+		forwardedFor  string
+		expectedCode  int
+		expectedError string
+	}{
+		{GeoBlockConfig{BlockedCountries: []string{"XX"}}, "", 202, ""},
+		{GeoBlockConfig{Resolver: resolver}, "", 202, ""},
+		{GeoBlockConfig{Resolver: resolver, BlockedCountries: []string{"XX"}}, "", 403, "connections from XX are not accepted"},
+		{GeoBlockConfig{Resolver: resolver, BlockedCountries: []string{"XX"}}, "198.51.100.7", 403, "connections from XX are not accepted"},
+		{GeoBlockConfig{Resolver: resolver, BlockedCountries: []string{"XX"}, ClientIPHeader: "X-Forwarded-For"}, "203.0.113.9, 198.51.100.7", 202, ""},
+		{GeoBlockConfig{Resolver: resolver, BlockedCountries: []string{"XX"}, ClientIPHeader: "X-Forwarded-For"}, "198.51.100.7, 203.0.113.9", 403, "connections from XX are not accepted"},
+		{GeoBlockConfig{Resolver: resolver, BlockedCountries: []string{"XX"}, ClientIPHeader: "X-Forwarded-For"}, "192.0.2.1", 202, ""},
+	}
+	for i, c := range cases {
+		InboxGeoBlock = c.config
+		req, _ := http.NewRequest("POST", s.URL, nil)
+		if c.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", c.forwardedFor)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		body := make([]byte, 64)
+		n, _ := r.Body.Read(body)
+		r.Body.Close()
+		if r.StatusCode != c.expectedCode {
+			t.Fatalf("Expected StatusCode to be %d in case %d, but got %d", c.expectedCode, i, r.StatusCode)
+		}
+		if c.expectedError != "" && string(body[:n]) != c.expectedError {
+			t.Fatalf("Expected body '%s' in case %d, but got '%s'", c.expectedError, i, body[:n])
+		}
+	}
+}
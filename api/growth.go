@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// subscriberSnapshotInterval is how often subscriber and follower counts are recorded
+const subscriberSnapshotInterval = time.Minute
+
+// SubscriberStats holds the number of subscribers and followers at a time
+type SubscriberStats struct {
+	Timestamp   int64 `json:"timestamp"`
+	Subscribers int64 `json:"subscribers"`
+	Followers   int64 `json:"followers"`
+}
+
+// SubscriberStatsResponse is the API response format of subscriber counts
+type SubscriberStatsResponse struct {
+	Current SubscriberStats   `json:"current"`
+	History []SubscriberStats `json:"history"`
+}
+
+func getCurrentSubscriberStats(now time.Time) SubscriberStats {
+	return SubscriberStats{
+		Timestamp:   now.Unix(),
+		Subscribers: int64(len(RelayState.Subscribers)),
+		Followers:   int64(len(RelayState.Followers)),
+	}
+}
+
+// recordSubscriberSnapshot stores the current counts in the minute bucket of now
+func recordSubscriberSnapshot(now time.Time) {
+	ctx := context.TODO()
+	current := getCurrentSubscriberStats(now)
+	bucket := strconv.FormatInt(now.Unix()/60*60, 10)
+
+	RelayState.RedisClient.Set(ctx, models.RedisKey("relay:stats:subscribers:")+bucket, current.Subscribers, 25*time.Hour) // Keep for 25 hours
+	RelayState.RedisClient.Set(ctx, models.RedisKey("relay:stats:followers:")+bucket, current.Followers, 25*time.Hour)
+}
+
+// startSubscriberSnapshots records subscriber counts every interval until the returned function is called
+func startSubscriberSnapshots(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		recordSubscriberSnapshot(time.Now())
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				recordSubscriberSnapshot(now)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// GetSubscriberStatsRange retrieves subscriber counts between from and to unix time, keeping the
+// last snapshot of each bucket of resolution. Minutes without a snapshot are left out.
+func GetSubscriberStatsRange(from, to int64, resolution time.Duration) SubscriberStatsResponse {
+	ctx := context.TODO()
+	step := int64(resolution / time.Second)
+	current := getCurrentSubscriberStats(time.Now())
+
+	var buckets []int64
+	var subscriberKeys, followerKeys []string
+	for bucket := from / 60 * 60; bucket <= to; bucket += 60 {
+		buckets = append(buckets, bucket)
+		subscriberKeys = append(subscriberKeys, models.RedisKey("relay:stats:subscribers:")+strconv.FormatInt(bucket, 10))
+		followerKeys = append(followerKeys, models.RedisKey("relay:stats:followers:")+strconv.FormatInt(bucket, 10))
+	}
+	history := []SubscriberStats{}
+	if len(buckets) == 0 {
+		return SubscriberStatsResponse{Current: current, History: history}
+	}
+	subscribers, _ := RelayState.RedisClient.MGet(ctx, subscriberKeys...).Result()
+	followers, _ := RelayState.RedisClient.MGet(ctx, followerKeys...).Result()
+
+	for i, bucket := range buckets {
+		if i >= len(subscribers) || subscribers[i] == nil {
+			continue
+		}
+		snapshot := SubscriberStats{
+			Timestamp:   bucket / step * step,
+			Subscribers: statsCount(subscribers, i),
+			Followers:   statsCount(followers, i),
+		}
+		if len(history) > 0 && history[len(history)-1].Timestamp == snapshot.Timestamp {
+			history[len(history)-1] = snapshot
+		} else {
+			history = append(history, snapshot)
+		}
+	}
+
+	return SubscriberStatsResponse{
+		Current: current,
+		History: history,
+	}
+}
+
+// handleSubscriberStats returns current subscriber and follower counts with their history
+// GET /api/stats/subscribers?hours=1
+// GET /api/stats/subscribers?from=1700000000&to=1700003600&resolution=minute|hour
+func handleSubscriberStats(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	query := request.URL.Query()
+	var stats SubscriberStatsResponse
+	if query.Get("from") != "" || query.Get("to") != "" || query.Get("resolution") != "" {
+		from, to, resolution, err := parseStatsRange(query, time.Now())
+		if err != nil {
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		stats = GetSubscriberStatsRange(from, to, resolution)
+	} else {
+		hours := 1
+		if h, err := strconv.Atoi(query.Get("hours")); err == nil && h > 0 && h <= 24 {
+			hours = h
+		}
+		to := time.Now().Unix() / 60 * 60
+		stats = GetSubscriberStatsRange(to-int64(hours*60-1)*60, to, time.Minute)
+	}
+
+	response, err := json.Marshal(stats)
+	if err != nil {
+		writer.WriteHeader(500)
+		writer.Write(nil)
+		return
+	}
+
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestSubscriberSnapshots(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.com",
+		InboxURL: "https://example.com/inbox",
+	})
+	RelayState.Load()
+
+	stop := startSubscriberSnapshots(time.Hour)
+	stop()
+
+	bucket := strconv.FormatInt(time.Now().Unix()/60*60, 10)
+	subscribers, err := RelayState.RedisClient.Get(context.TODO(), "relay:stats:subscribers:"+bucket).Int64()
+	if err != nil || subscribers != 1 {
+		t.Fatalf("Expected a snapshot of 1 subscriber when started, but got %d (%v)", subscribers, err)
+	}
+}
+
+func TestHandleSubscriberStats(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.com",
+		InboxURL: "https://example.com/inbox",
+	})
+	RelayState.Load()
+
+	previousHour := time.Now().Unix()/3600*3600 - 3600
+	for offset, count := range map[int64]int{60: 1, 120: 2, 3600: 3} {
+		bucket := strconv.FormatInt(previousHour+offset, 10)
+		RelayState.RedisClient.Set(context.TODO(), "relay:stats:subscribers:"+bucket, count, 0)
+		RelayState.RedisClient.Set(context.TODO(), "relay:stats:followers:"+bucket, count*10, 0)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(handleSubscriberStats))
+	defer s.Close()
+
+	get := func(query string) (int, SubscriberStatsResponse) {
+		r, err := http.Get(s.URL + query)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var response SubscriberStatsResponse
+		json.NewDecoder(r.Body).Decode(&response)
+		r.Body.Close()
+		return r.StatusCode, response
+	}
+
+	status, response := get("")
+	if status != 200 || response.Current.Subscribers != 1 || response.Current.Followers != 0 {
+		t.Fatalf("Expected current counts of 1 subscriber and 0 followers, but got %d %+v", status, response.Current)
+	}
+
+	status, response = get("?from=" + strconv.FormatInt(previousHour, 10) + "&to=" + strconv.FormatInt(previousHour+180, 10))
+	expected := []SubscriberStats{{previousHour + 60, 1, 10}, {previousHour + 120, 2, 20}}
+	if status != 200 || len(response.History) != 2 || response.History[0] != expected[0] || response.History[1] != expected[1] {
+		t.Fatalf("Expected %v, but got %d %v", expected, status, response.History)
+	}
+
+	status, response = get("?from=" + strconv.FormatInt(previousHour, 10) + "&resolution=hour")
+	expected = []SubscriberStats{{previousHour, 2, 20}, {previousHour + 3600, 3, 30}}
+	if status != 200 || len(response.History) != 2 || response.History[0] != expected[0] || response.History[1] != expected[1] {
+		t.Fatalf("Expected last snapshot of each hour %v, but got %d %v", expected, status, response.History)
+	}
+
+	if status, _ := get("?resolution=day"); status != 400 {
+		t.Fatalf("Expected StatusCode to be 400 for invalid resolution, but got %d", status)
+	}
+}
@@ -1,14 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"mime"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/yukimochi/Activity-Relay/delaymetrics"
+	"github.com/yukimochi/Activity-Relay/discord"
 	"github.com/yukimochi/Activity-Relay/models"
 )
 
@@ -18,12 +26,12 @@ func handleWebfinger(writer http.ResponseWriter, request *http.Request) {
 		writer.WriteHeader(400)
 		writer.Write(nil)
 	} else {
-		queriedSubject := queriedResource[0]
+		queriedSubject := normalizeWebfingerSubject(queriedResource[0])
 		for _, webfingerResource := range WebfingerResources {
-			if queriedSubject == webfingerResource.Subject {
+			if matchesWebfingerResource(queriedSubject, webfingerResource) {
 				webfinger, err := json.Marshal(&webfingerResource)
 				if err != nil {
-					logrus.Fatal("Failed to marshal webfinger resource : ", err.Error())
+					logger.Fatal("Failed to marshal webfinger resource : ", err.Error())
 					writer.WriteHeader(500)
 					writer.Write(nil)
 					return
@@ -39,6 +47,107 @@ func handleWebfinger(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// normalizeWebfingerSubject trims a queried resource and lowercases its scheme and host
+func normalizeWebfingerSubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if len(subject) > 5 && strings.EqualFold(subject[:5], "acct:") {
+		account := subject[5:]
+		at := strings.LastIndex(account, "@")
+		if at < 0 {
+			return "acct:" + account
+		}
+		return "acct:" + account[:at] + "@" + strings.ToLower(account[at+1:])
+	}
+	resourceURL, err := url.Parse(subject)
+	if err != nil || resourceURL.Host == "" {
+		return subject
+	}
+	resourceURL.Scheme = strings.ToLower(resourceURL.Scheme)
+	resourceURL.Host = strings.ToLower(resourceURL.Host)
+	return resourceURL.String()
+}
+
+// matchesWebfingerResource reports whether a normalized subject names the resource by acct or by actor URL
+func matchesWebfingerResource(subject string, resource models.WebfingerResource) bool {
+	if subject == normalizeWebfingerSubject(resource.Subject) {
+		return true
+	}
+	for _, link := range resource.Links {
+		if link.Rel == "self" && subject == normalizeWebfingerSubject(link.Href) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleHostMeta(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+	} else if prefersJSON(request.Header.Get("Accept")) {
+		writeHostMetaJSON(writer)
+	} else {
+		hostMeta, err := xml.Marshal(&HostMeta)
+		if err != nil {
+			logger.Fatal("Failed to marshal host-meta : ", err.Error())
+			writer.WriteHeader(500)
+			writer.Write(nil)
+			return
+		}
+		writer.Header().Add("Content-Type", "application/xrd+xml")
+		writer.WriteHeader(200)
+		writer.Write(append([]byte(xml.Header), hostMeta...))
+	}
+}
+
+func handleHostMetaJSON(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+	} else {
+		writeHostMetaJSON(writer)
+	}
+}
+
+func writeHostMetaJSON(writer http.ResponseWriter) {
+	hostMeta, err := json.Marshal(&HostMeta)
+	if err != nil {
+		logger.Fatal("Failed to marshal host-meta : ", err.Error())
+		writer.WriteHeader(500)
+		writer.Write(nil)
+		return
+	}
+	writer.Header().Add("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	writer.Write(hostMeta)
+}
+
+// prefersJSON reports whether Accept ranks a JSON media type above XML
+func prefersJSON(accept string) bool {
+	var jsonQuality, xmlQuality float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		switch mediaType {
+		case "application/json", "application/jrd+json":
+			if quality > jsonQuality {
+				jsonQuality = quality
+			}
+		case "application/xrd+xml", "application/xml", "text/xml":
+			if quality > xmlQuality {
+				xmlQuality = quality
+			}
+		}
+	}
+	return jsonQuality > xmlQuality
+}
+
 func handleNodeinfoLink(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != "GET" {
 		writer.WriteHeader(400)
@@ -46,7 +155,7 @@ func handleNodeinfoLink(writer http.ResponseWriter, request *http.Request) {
 	} else {
 		nodeinfoLinks, err := json.Marshal(&Nodeinfo.NodeinfoLinks)
 		if err != nil {
-			logrus.Fatal("Failed to marshal nodeinfo links : ", err.Error())
+			logger.Fatal("Failed to marshal nodeinfo links : ", err.Error())
 			writer.WriteHeader(500)
 			writer.Write(nil)
 			return
@@ -58,18 +167,26 @@ func handleNodeinfoLink(writer http.ResponseWriter, request *http.Request) {
 }
 
 func handleNodeinfo(writer http.ResponseWriter, request *http.Request) {
+	writeNodeinfo(writer, request, &Nodeinfo.Nodeinfo)
+}
+
+func handleNodeinfo20(writer http.ResponseWriter, request *http.Request) {
+	writeNodeinfo(writer, request, &Nodeinfo.Nodeinfo20)
+}
+
+func writeNodeinfo(writer http.ResponseWriter, request *http.Request, resource *models.Nodeinfo) {
 	if request.Method != "GET" {
 		writer.WriteHeader(400)
 		writer.Write(nil)
 	} else {
-		// Count both subscribers and followers (Akkoma/Pleroma use follower style)
-		userTotal := len(RelayState.Subscribers) + len(RelayState.Followers)
-		Nodeinfo.Nodeinfo.Usage.Users.Total = userTotal
-		Nodeinfo.Nodeinfo.Usage.Users.ActiveMonth = userTotal
-		Nodeinfo.Nodeinfo.Usage.Users.ActiveHalfyear = userTotal
-		nodeinfo, err := json.Marshal(&Nodeinfo.Nodeinfo)
+		userTotal := nodeinfoUserTotal(GlobalConfig.NodeinfoUsageMode())
+		resource.Usage.Users.Total = userTotal
+		resource.Usage.Users.ActiveMonth = userTotal
+		resource.Usage.Users.ActiveHalfyear = userTotal
+		resource.Metadata = nodeinfoMetadata()
+		nodeinfo, err := json.Marshal(resource)
 		if err != nil {
-			logrus.Fatal("Failed to marshal nodeinfo : ", err.Error())
+			logger.Fatal("Failed to marshal nodeinfo : ", err.Error())
 			writer.WriteHeader(500)
 			writer.Write(nil)
 			return
@@ -80,41 +197,322 @@ func handleNodeinfo(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// nodeinfoUserTotal returns the user count reported in nodeinfo for mode
+func nodeinfoUserTotal(mode models.NodeinfoUsageMode) int {
+	switch mode {
+	case models.NodeinfoUsageZero:
+		return 0
+	case models.NodeinfoUsageInstances:
+		instances := map[string]bool{}
+		for _, subscriber := range RelayState.SubscribersAndFollowers {
+			instances[subscriber.Domain] = true
+		}
+		return len(instances)
+	default:
+		// Count both subscribers and followers (Akkoma/Pleroma use follower style)
+		return len(RelayState.Subscribers) + len(RelayState.Followers)
+	}
+}
+
+// nodeinfoMetadata returns the configured nodeinfo metadata, with relay capabilities when enabled
+func nodeinfoMetadata() models.NodeinfoMetadata {
+	metadata := models.NodeinfoMetadata{}
+	if GlobalConfig.NodeinfoRelayMetadata() {
+		metadata["features"] = []string{"relay"}
+		metadata["relayStyles"] = relayStyles()
+		metadata["manualApproval"] = RelayState.RelayConfig.ManuallyAccept
+		metadata["nodeName"] = GlobalConfig.ServerServiceName()
+		metadata["nodeDescription"] = GlobalConfig.ServerServiceSummary()
+	}
+	if GlobalConfig.ServerAdminEmail() != "" {
+		metadata["maintainer"] = map[string]string{"name": GlobalConfig.ServerServiceName(), "email": GlobalConfig.ServerAdminEmail()}
+	}
+	if GlobalConfig.ServerTermsURL() != nil {
+		metadata["tosUrl"] = GlobalConfig.ServerTermsURL().String()
+	}
+	for key, value := range GlobalConfig.NodeinfoMetadata() {
+		metadata[key] = value
+	}
+	return metadata
+}
+
 func handleRelayActor(writer http.ResponseWriter, request *http.Request) {
-	if request.Method == "GET" {
-		relayActor, err := json.Marshal(&RelayActor)
+	if request.Method == "GET" || request.Method == "HEAD" {
+		relayActor, err := relayActorDocument(relayActorForHost(request.Host))
 		if err != nil {
-			logrus.Fatal("Failed to marshal relay actor : ", err.Error())
+			logger.Error("Failed to marshal relay actor : ", err.Error())
 			writer.WriteHeader(500)
 			writer.Write(nil)
 			return
 		}
-		writer.Header().Add("Content-Type", "application/activity+json")
+		writer.Header().Add("Content-Type", actorContentType(request.Header.Get("Accept")))
+		writer.Header().Add("Vary", "Accept")
+		writer.Header().Set("Content-Length", strconv.Itoa(len(relayActor)))
 		writer.WriteHeader(200)
-		writer.Write(relayActor)
+		if request.Method == "GET" {
+			writer.Write(relayActor)
+		}
 	} else {
 		writer.WriteHeader(400)
 		writer.Write(nil)
 	}
 }
 
-func handleInbox(writer http.ResponseWriter, request *http.Request, activityDecoder func(*http.Request) (*models.Activity, *models.Actor, []byte, error)) {
+// followersPageSize is the number of actor IDs on one page of the followers collection
+var followersPageSize = 50
+
+// followerActorIDs returns actor IDs of subscribers and followers of the identity identityID in a stable order for paging
+func followerActorIDs(identityID string) []string {
+	actorIDs := make([]string, 0, len(RelayState.SubscribersAndFollowers))
+	for _, subscription := range RelayState.SubscribersAndFollowers {
+		if subscription.ActorID != "" && subscription.RelayActor == identityID {
+			actorIDs = append(actorIDs, subscription.ActorID)
+		}
+	}
+	sort.Strings(actorIDs)
+	return actorIDs
+}
+
+// handleFollowers serves the relay actor's followers collection, paged with ?page=1
+func handleFollowers(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+
+	relayActor := relayActorForHost(request.Host)
+	actorIDs := followerActorIDs(identityActorID(relayActor))
+	collectionID := relayActor.FollowersURL
+	collection := models.OrderedCollection{
+		Context:    "https://www.w3.org/ns/activitystreams",
+		ID:         collectionID,
+		Type:       "OrderedCollection",
+		TotalItems: len(actorIDs),
+	}
+	if pageParam := request.URL.Query().Get("page"); pageParam != "" && !GlobalConfig.HideFollowersCollection() {
+		page, err := strconv.Atoi(pageParam)
+		if err != nil || page < 1 {
+			writer.WriteHeader(400)
+			writer.Write(nil)
+			return
+		}
+		start := min((page-1)*followersPageSize, len(actorIDs))
+		end := min(start+followersPageSize, len(actorIDs))
+		collection.ID = collectionID + "?page=" + strconv.Itoa(page)
+		collection.Type = "OrderedCollectionPage"
+		collection.PartOf = collectionID
+		collection.OrderedItems = actorIDs[start:end]
+		if end < len(actorIDs) {
+			collection.Next = collectionID + "?page=" + strconv.Itoa(page+1)
+		}
+		if page > 1 {
+			collection.Prev = collectionID + "?page=" + strconv.Itoa(page-1)
+		}
+	} else if !GlobalConfig.HideFollowersCollection() {
+		collection.First = collectionID + "?page=1"
+	}
+
+	response, _ := json.Marshal(&collection)
+	writer.Header().Set("Content-Type", "application/activity+json")
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
+
+// handleOutbox serves the relay actor's outbox, which is always empty as the relay authors no posts
+func handleOutbox(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+
+	collection := models.OrderedCollection{
+		Context:    "https://www.w3.org/ns/activitystreams",
+		ID:         relayActorForHost(request.Host).OutboxURL,
+		Type:       "OrderedCollection",
+		TotalItems: 0,
+	}
+
+	response, _ := json.Marshal(&collection)
+	writer.Header().Set("Content-Type", "application/activity+json")
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
+
+// handleFollowersSynchronization serves the FEP-8fcf partial followers collection for the signing instance
+func handleFollowersSynchronization(writer http.ResponseWriter, request *http.Request) {
+	if !GlobalConfig.CollectionSynchronization() {
+		writer.WriteHeader(404)
+		writer.Write(nil)
+		return
+	}
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+	keyOwner, err := verifyHTTPSignature(request)
+	if err != nil {
+		logger.WithError(err).Debug("Rejected followers synchronization request")
+		writer.WriteHeader(401)
+		writer.Write(nil)
+		return
+	}
+
+	relayActor := relayActorForHost(request.Host)
+	actorIDs := RelayState.ActorIDsOnOrigin(models.Origin(keyOwner.ID), identityActorID(relayActor))
+	sort.Strings(actorIDs)
+	collection := models.OrderedCollection{
+		Context:      "https://www.w3.org/ns/activitystreams",
+		ID:           relayActor.FollowersSynchronization(),
+		Type:         "OrderedCollection",
+		TotalItems:   len(actorIDs),
+		OrderedItems: actorIDs,
+	}
+
+	response, _ := json.Marshal(&collection)
+	writer.Header().Set("Content-Type", "application/activity+json")
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
+
+const activityStreamsProfile = "https://www.w3.org/ns/activitystreams"
+
+// actorContentType selects ld+json with ActivityStreams profile when Accept ranks it at least as high as activity+json
+func actorContentType(accept string) string {
+	ldQuality, activityQuality := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		switch mediaType {
+		case "application/ld+json":
+			for _, profile := range strings.Fields(params["profile"]) {
+				if profile == activityStreamsProfile && quality > ldQuality {
+					ldQuality = quality
+				}
+			}
+		case "application/activity+json":
+			if quality > activityQuality {
+				activityQuality = quality
+			}
+		}
+	}
+	if ldQuality > 0 && ldQuality >= activityQuality {
+		return `application/ld+json; profile="` + activityStreamsProfile + `"`
+	}
+	return "application/activity+json"
+}
+
+// writeInboxAccepted answers an accepted inbox activity with 202, carrying the relay name and request id when INBOX_ACCEPT_BODY is enabled
+func writeInboxAccepted(writer http.ResponseWriter, requestID string) {
+	if !GlobalConfig.InboxAcceptBody() {
+		writer.WriteHeader(202)
+		writer.Write(nil)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(202)
+	json.NewEncoder(writer).Encode(struct {
+		Relay     string `json:"relay"`
+		RequestID string `json:"request_id"`
+	}{GlobalConfig.ServerServiceName(), requestID})
+}
+
+func handleInbox(writer http.ResponseWriter, request *http.Request, activityDecoder func(*http.Request) (*models.Activity, *models.Actor, *models.Actor, []byte, error)) {
 	switch request.Method {
 	case "POST":
 		receivedAt := time.Now()
+		requestID := uuid.New().String()
 		// Increment inbox counter for statistics
 		IncrementInboxCount()
 
-		activity, actor, body, err := activityDecoder(request)
-		if err != nil {
+		if country, blocked := InboxGeoBlock.blockedCountry(request); blocked {
+			logger.WithField("remote_addr", request.RemoteAddr).WithField("country", country).Debug("Blocked Connection (Country)")
+			writer.WriteHeader(403)
+			writer.Write([]byte("connections from " + country + " are not accepted"))
+
+			return
+		}
+
+		request.Body = http.MaxBytesReader(writer, request.Body, InboxMaxBodySize)
+		activity, actor, keyOwner, body, err := activityDecoder(request)
+		var policyErr *signaturePolicyError
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writer.WriteHeader(413)
+			writer.Write([]byte("activity body exceeds " + strconv.FormatInt(maxBytesErr.Limit, 10) + " bytes"))
+		} else if errors.As(err, &policyErr) {
+			writer.WriteHeader(401)
+			writer.Write([]byte(policyErr.Error()))
+		} else if err != nil {
 			writer.WriteHeader(400)
 			writer.Write(nil)
 		} else {
+			// Bound the work done while the sending instance waits, a slow remote must not hold the connection
+			ctx, cancel := context.WithTimeout(request.Context(), GlobalConfig.InboxProcessingTimeout())
+			defer cancel()
+
+			annotateAccessLog(writer, activity, requestID)
+			IncrementInboxTypeCount(activity.Type)
+			relayActor := relayActorForHost(request.Host)
 			actorID, _ := url.Parse(activity.Actor)
+			if isActorBlocked(actorID) {
+				activityLogger(activity).Debug("Blocked Activity")
+				discord.SendNotificationBatched(discord.NotifyBlocked, actorID.Host, activity.Actor)
+				if activity.Type == "Follow" {
+					// Let the blocked server know its follow request will never complete
+					executeRejectRequest(activity, actor, relayActor, errors.New(actorID.Host+" is blocked"))
+				}
+				writer.WriteHeader(403)
+				writer.Write([]byte(actorID.Host + " is blocked"))
+
+				return
+			}
+			if !checkInboxRateLimit(ctx, actorID.Host) {
+				activityLogger(activity).Debug("Rate limited Activity")
+				writer.WriteHeader(429)
+				writer.Write([]byte("too many activities from " + actorID.Host))
+
+				return
+			}
+
+			// Only connected instances are tracked, so the hash stays bounded by the subscription list
+			if isActorSubscribersOrFollowers(actorID) {
+				recordLastSeen(ctx, actorID.Host, receivedAt)
+			}
+
+			if contains(dedupActivityTypes, activity.Type) && isActorSubscribersOrFollowers(actorID) && seenRecently(ctx, activity.ID) {
+				activityLogger(activity).Debug("Skipped Duplicate Activity")
+				writeInboxAccepted(writer, requestID)
+
+				return
+			}
+
+			if activity.Type == "Flag" {
+				// Reports are for moderators and never relayed
+				executeFlag(activity, actor)
+				writeInboxAccepted(writer, requestID)
+
+				return
+			}
 
 			// Record delay metrics for federation delay analysis
 			recordDelayMetrics(activity, actorID, receivedAt)
 
+			if activity.Type == "Move" {
+				err = executeMove(activity)
+				if err != nil {
+					activityLogger(activity).WithError(err).Warn("Ignored Move")
+				}
+			}
+
 			switch {
 			case contains(activity.To, "https://www.w3.org/ns/activitystreams#Public"), contains(activity.Cc, "https://www.w3.org/ns/activitystreams#Public"):
 				// Mastodon Traditional Style (Activity Transfer)
@@ -122,84 +520,97 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 				case "Create", "Update", "Delete", "Move":
 					err = executeRelayActivity(activity, actor, body)
 					if err != nil {
+						forgetSeen(activity.ID)
 						writer.WriteHeader(401)
 						writer.Write([]byte(err.Error()))
 
 						return
 					}
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					if activity.Type == "Delete" {
+						// Relayed first, the subscription is gone afterwards
+						executeActorDelete(activity, keyOwner)
+					}
+					mirrorActivity(activity, actorID.Host, body, receivedAt)
+					writeInboxAccepted(writer, requestID)
+				case "Like", "EmojiReact":
+					if RelayState.RelayConfig.RelayReactions {
+						err = executeRelayActivity(activity, actor, body)
+						if err != nil {
+							forgetSeen(activity.ID)
+							writer.WriteHeader(401)
+							writer.Write([]byte(err.Error()))
+
+							return
+						}
+						mirrorActivity(activity, actorID.Host, body, receivedAt)
+					}
+					writeInboxAccepted(writer, requestID)
+				case "Undo":
+					// Retractions of boosts and of relayed reactions follow the original to the subscribers
+					innerActivity, err := activity.UnwrapInnerActivity()
+					if err == nil && isRelayableUndo(activity, innerActivity) {
+						err = executeRelayActivity(activity, actor, body)
+						if err != nil {
+							forgetSeen(activity.ID)
+							writer.WriteHeader(401)
+							writer.Write([]byte(err.Error()))
+
+							return
+						}
+						mirrorActivity(activity, actorID.Host, body, receivedAt)
+					}
+					writeInboxAccepted(writer, requestID)
 				default:
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					writeInboxAccepted(writer, requestID)
 				}
-			case contains(activity.To, RelayActor.ID), contains(activity.Cc, RelayActor.ID):
+			case contains(activity.To, relayActor.ID), contains(activity.Cc, relayActor.ID):
 				// LitePub Relay Style
 				fallthrough
 			case isToMyFollower(activity.To), isToMyFollower(activity.Cc):
 				// LitePub Relay Style
 				switch activity.Type {
 				case "Follow":
-					err = executeFollowing(activity, actor)
+					err = executeFollowing(activity, actor, relayActor)
 					if err != nil {
-						executeRejectRequest(activity, actor, err)
+						executeRejectRequest(activity, actor, relayActor, err)
 					}
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					writeInboxAccepted(writer, requestID)
 				case "Undo":
 					innerActivity, err := activity.UnwrapInnerActivity()
 					if err != nil {
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 
 						return
 					}
 					switch innerActivity.Type {
 					case "Follow":
-						err = executeUnfollowing(innerActivity, actor)
+						err = executeUnfollowing(innerActivity, actor, relayActor)
 						if err != nil {
-							executeRejectRequest(activity, actor, err)
+							executeRejectRequest(activity, actor, relayActor, err)
 						}
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 					default:
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 					}
 				case "Accept":
 					innerActivity, err := activity.UnwrapInnerActivity()
 					if err != nil {
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 
 						return
 					}
 					switch innerActivity.Type {
 					case "Follow":
 						finalizeMutuallyFollow(innerActivity, actor, activity.Type)
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 					default:
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 					}
 				case "Reject":
-					innerActivity, err := activity.UnwrapInnerActivity()
-					if err != nil {
-						writer.WriteHeader(202)
-						writer.Write(nil)
-
-						return
-					}
-					switch innerActivity.Type {
-					case "Follow":
-						finalizeMutuallyFollow(innerActivity, actor, activity.Type)
-						writer.WriteHeader(202)
-						writer.Write(nil)
-					default:
-						writer.WriteHeader(202)
-						writer.Write(nil)
+					if follow, found := rejectedFollow(activity); found {
+						finalizeMutuallyFollow(follow, actor, activity.Type)
 					}
+					writeInboxAccepted(writer, requestID)
 				case "Announce":
 					if !isActorSubscribersOrFollowers(actorID) {
 						err = errors.New("to use the relay service, please follow in advance")
@@ -210,57 +621,70 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 					}
 					switch innerObject := activity.Object.(type) {
 					case string:
-						origActivity, origActor, err := fetchOriginalActivityFromURL(innerObject)
+						err = executeAnnounceWithDeadline(ctx, activity, func(ctx context.Context) (*models.Activity, *models.Actor, error) {
+							return fetchAnnouncedActivity(ctx, innerObject)
+						})
+						if err != nil {
+							activityLogger(activity).Debug("Failed Announce Activity")
+							forgetSeen(activity.ID)
+							writer.WriteHeader(400)
+							writer.Write([]byte(err.Error()))
+
+							return
+						}
+						mirrorActivity(activity, actorID.Host, body, receivedAt)
+					case map[string]interface{}:
+						signerID := ""
+						if keyOwner != nil {
+							signerID = keyOwner.ID
+						}
+						err = executeAnnounceWithDeadline(ctx, activity, func(ctx context.Context) (*models.Activity, *models.Actor, error) {
+							return embeddedOriginalActivity(ctx, innerObject, signerID)
+						})
 						if err != nil {
-							logrus.Debug("Failed Announce Activity : ", activity.Actor)
+							activityLogger(activity).Debug("Failed Announce Activity")
+							forgetSeen(activity.ID)
 							writer.WriteHeader(400)
 							writer.Write([]byte(err.Error()))
 
 							return
 						}
-						executeAnnounceActivity(origActivity, origActor)
+						mirrorActivity(activity, actorID.Host, body, receivedAt)
 					default:
-						logrus.Debug("Skipped Announce Activity : ", activity.Actor)
+						activityLogger(activity).Debug("Skipped Announce Activity")
 					}
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					writeInboxAccepted(writer, requestID)
 				default:
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					writeInboxAccepted(writer, requestID)
 				}
 			default:
 				// Follow, Unfollow Only
 				switch activity.Type {
 				case "Follow":
-					err = executeFollowing(activity, actor)
+					err = executeFollowing(activity, actor, relayActor)
 					if err != nil {
-						executeRejectRequest(activity, actor, err)
+						executeRejectRequest(activity, actor, relayActor, err)
 					}
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					writeInboxAccepted(writer, requestID)
 				case "Undo":
 					innerActivity, err := activity.UnwrapInnerActivity()
 					if err != nil {
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 
 						return
 					}
 					switch innerActivity.Type {
 					case "Follow":
-						err = executeUnfollowing(innerActivity, actor)
+						err = executeUnfollowing(innerActivity, actor, relayActor)
 						if err != nil {
-							executeRejectRequest(activity, actor, err)
+							executeRejectRequest(activity, actor, relayActor, err)
 						}
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 					default:
-						writer.WriteHeader(202)
-						writer.Write(nil)
+						writeInboxAccepted(writer, requestID)
 					}
 				default:
-					writer.WriteHeader(202)
-					writer.Write(nil)
+					writeInboxAccepted(writer, requestID)
 				}
 			}
 		}
@@ -270,9 +694,64 @@ func handleInbox(writer http.ResponseWriter, request *http.Request, activityDeco
 	}
 }
 
+// adminUnfollowResult describes an admin unfollow, or what it would do in dry-run
+type adminUnfollowResult struct {
+	Success  bool             `json:"success"`
+	Type     string           `json:"type,omitempty"`
+	DryRun   bool             `json:"dryRun,omitempty"`
+	InboxURL string           `json:"inbox_url,omitempty"`
+	Activity *models.Activity `json:"activity,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// executeAdminUnfollow sends Reject to the domain's subscriber or follower and removes it unless dryRun
+func executeAdminUnfollow(domain string, dryRun bool) adminUnfollowResult {
+	var follow models.Activity
+	var inboxURL, relationType string
+	if subscriber := RelayState.SelectSubscriber(domain); subscriber != nil {
+		follow = models.Activity{
+			Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+			ID:      subscriber.ActivityID,
+			Actor:   subscriber.ActorID,
+			Type:    "Follow",
+			Object:  "https://www.w3.org/ns/activitystreams#Public",
+		}
+		inboxURL, relationType = subscriber.InboxURL, "subscriber"
+	} else if follower := RelayState.SelectFollower(domain); follower != nil {
+		follow = models.Activity{
+			Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+			ID:      follower.ActivityID,
+			Actor:   follower.ActorID,
+			Type:    "Follow",
+			Object:  RelayActor().ID,
+		}
+		inboxURL, relationType = follower.InboxURL, "follower"
+	} else {
+		return adminUnfollowResult{DryRun: dryRun, Error: "Domain not found in subscribers or followers"}
+	}
+
+	resp := follow.GenerateReply(RelayActor(), follow, "Reject")
+	if dryRun {
+		return adminUnfollowResult{Success: true, Type: relationType, DryRun: true, InboxURL: inboxURL, Activity: &resp}
+	}
+
+	jsonData, _ := json.Marshal(&resp)
+	enqueueRegisterActivity(inboxURL, jsonData)
+
+	// Remove from state
+	if relationType == "subscriber" {
+		RelayState.DelSubscriber(domain)
+	} else {
+		RelayState.DelFollower(domain)
+	}
+	logger.WithFields(logrus.Fields{"domain": domain, "type": relationType}).Info("Admin unfollow sent")
+
+	return adminUnfollowResult{Success: true, Type: relationType}
+}
+
 // handleAdminUnfollow handles unfollow requests from the admin API
-// POST /api/admin/unfollow
-// Body: {"domain": "example.com"}
+// POST /api/admin/unfollow[?dryRun=true]
+// Body: {"domain": "example.com", "dryRun": false}
 // Response: {"success": true, "type": "subscriber"|"follower"} or {"error": "..."}
 func handleAdminUnfollow(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != "POST" {
@@ -284,6 +763,7 @@ func handleAdminUnfollow(writer http.ResponseWriter, request *http.Request) {
 	// Parse request body
 	var req struct {
 		Domain string `json:"domain"`
+		DryRun bool   `json:"dryRun"`
 	}
 	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
 		writer.Header().Set("Content-Type", "application/json")
@@ -291,6 +771,9 @@ func handleAdminUnfollow(writer http.ResponseWriter, request *http.Request) {
 		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
 		return
 	}
+	if dryRun, err := strconv.ParseBool(request.URL.Query().Get("dryRun")); err == nil && dryRun {
+		req.DryRun = true
+	}
 
 	if req.Domain == "" {
 		writer.Header().Set("Content-Type", "application/json")
@@ -299,87 +782,422 @@ func handleAdminUnfollow(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Check if subscriber
-	subscriber := RelayState.SelectSubscriber(req.Domain)
-	if subscriber != nil {
-		// Send Reject activity to subscriber
-		activity := models.Activity{
-			Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
-			ID:      subscriber.ActivityID,
-			Actor:   subscriber.ActorID,
-			Type:    "Follow",
-			Object:  "https://www.w3.org/ns/activitystreams#Public",
+	result := executeAdminUnfollow(req.Domain, req.DryRun)
+	if result.Success && !result.DryRun {
+		recordAdminAction(request, "unfollow", req.Domain, "")
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if !result.Success {
+		writer.WriteHeader(404)
+	} else {
+		writer.WriteHeader(200)
+	}
+	json.NewEncoder(writer).Encode(result)
+}
+
+// adminBulkUnfollowResult is the outcome of one domain in a bulk unfollow
+type adminBulkUnfollowResult struct {
+	Domain string `json:"domain"`
+	adminUnfollowResult
+}
+
+// handleAdminBulkUnfollow unfollows several domains, continuing past the ones that fail
+// POST /api/admin/unfollow/bulk
+// Body: {"domains": ["a.example", "b.example"], "reason": "..."}
+// Response: {"results": [{"domain": "a.example", "success": true, "type": "subscriber"}, ...]}
+func handleAdminBulkUnfollow(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	var req struct {
+		Domains []string `json:"domains"`
+		Reason  string   `json:"reason"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+		return
+	}
+	if len(req.Domains) == 0 {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "domains required"})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{"count": len(req.Domains), "reason": req.Reason}).Info("Admin bulk unfollow")
+	results := make([]adminBulkUnfollowResult, 0, len(req.Domains))
+	for _, domain := range req.Domains {
+		result := adminBulkUnfollowResult{Domain: domain}
+		if domain == "" {
+			result.Error = "domain required"
+		} else {
+			result.adminUnfollowResult = executeAdminUnfollow(domain, false)
+			if result.Success {
+				recordAdminAction(request, "unfollow", domain, req.Reason)
+			}
 		}
-		resp := activity.GenerateReply(RelayActor, activity, "Reject")
-		jsonData, _ := json.Marshal(&resp)
-		enqueueRegisterActivity(subscriber.InboxURL, jsonData)
+		results = append(results, result)
+	}
 
-		// Remove from state
-		RelayState.DelSubscriber(subscriber.Domain)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]adminBulkUnfollowResult{"results": results})
+}
 
-		logrus.Info("Admin unfollow sent for subscriber: ", req.Domain)
+// adminListEntry is a subscriber or follower in the admin list response
+type adminListEntry struct {
+	Domain   string `json:"domain"`
+	ActorID  string `json:"actor_id"`
+	InboxURL string `json:"inbox_url"`
+	JoinedAt int64  `json:"joined_at"`
+	LastSeen int64  `json:"last_seen"`
+}
 
+// handleAdminList lists current subscribers and followers
+// GET /api/admin/subscribers?type=subscriber|follower
+// Response: {"subscribers": [...], "followers": [...]}
+func handleAdminList(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	listType := request.URL.Query().Get("type")
+	if listType != "" && listType != "subscriber" && listType != "follower" {
 		writer.Header().Set("Content-Type", "application/json")
-		writer.WriteHeader(200)
-		json.NewEncoder(writer).Encode(map[string]interface{}{"success": true, "type": "subscriber"})
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "type must be subscriber or follower"})
 		return
 	}
 
-	// Check if follower
-	follower := RelayState.SelectFollower(req.Domain)
-	if follower != nil {
-		// Send Reject activity to follower
-		activity := models.Activity{
-			Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
-			ID:      follower.ActivityID,
-			Actor:   follower.ActorID,
-			Type:    "Follow",
-			Object:  RelayActor.ID,
+	lastSeen := lastSeenTimes()
+	response := map[string][]adminListEntry{}
+	if listType == "" || listType == "subscriber" {
+		subscribers := []adminListEntry{}
+		for _, subscriber := range RelayState.Subscribers {
+			subscribers = append(subscribers, adminListEntry{
+				Domain:   subscriber.Domain,
+				ActorID:  subscriber.ActorID,
+				InboxURL: subscriber.InboxURL,
+				JoinedAt: subscriber.JoinedAt,
+				LastSeen: lastSeen[subscriber.Domain],
+			})
+		}
+		response["subscribers"] = subscribers
+	}
+	if listType == "" || listType == "follower" {
+		followers := []adminListEntry{}
+		for _, follower := range RelayState.Followers {
+			followers = append(followers, adminListEntry{
+				Domain:   follower.Domain,
+				ActorID:  follower.ActorID,
+				InboxURL: follower.InboxURL,
+				JoinedAt: follower.JoinedAt,
+				LastSeen: lastSeen[follower.Domain],
+			})
+		}
+		response["followers"] = followers
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(response)
+}
+
+// handleAdminBlock manages blocked domains
+// GET /api/admin/block
+// POST, DELETE /api/admin/block
+// Body: {"domain": "example.com"}
+// Response: {"blocked_domains": [...]}
+func handleAdminBlock(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+	case "POST", "DELETE":
+		var req struct {
+			Domain string `json:"domain"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+			return
+		}
+		if req.Domain == "" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "domain required"})
+			return
+		}
+		RelayState.SetBlockedDomain(strings.ToLower(req.Domain), request.Method == "POST")
+		if request.Method == "POST" {
+			logger.WithField("domain", req.Domain).Info("Admin blocked domain")
+			recordAdminAction(request, "block", strings.ToLower(req.Domain), "")
+		} else {
+			logger.WithField("domain", req.Domain).Info("Admin unblocked domain")
+			recordAdminAction(request, "unblock", strings.ToLower(req.Domain), "")
+		}
+	default:
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	blockedDomains := append([]string{}, RelayState.BlockedDomains...)
+	sort.Strings(blockedDomains)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]string{"blocked_domains": blockedDomains})
+}
+
+// handleAdminAllow manages domains allowed to follow in allow-list only mode
+// GET /api/admin/allow
+// POST, DELETE /api/admin/allow
+// Body: {"domain": "example.com"}
+// Response: {"allowlist_only": true, "allowed_domains": [...]}
+func handleAdminAllow(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+	case "POST", "DELETE":
+		var req struct {
+			Domain string `json:"domain"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+			return
+		}
+		if req.Domain == "" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "domain required"})
+			return
+		}
+		RelayState.SetAllowedDomain(strings.ToLower(req.Domain), request.Method == "POST")
+		if request.Method == "POST" {
+			logger.WithField("domain", req.Domain).Info("Admin allowed domain")
+			recordAdminAction(request, "allow", strings.ToLower(req.Domain), "")
+		} else {
+			logger.WithField("domain", req.Domain).Info("Admin disallowed domain")
+			recordAdminAction(request, "disallow", strings.ToLower(req.Domain), "")
+		}
+	default:
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	allowedDomains := append([]string{}, RelayState.AllowedDomains...)
+	sort.Strings(allowedDomains)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(struct {
+		AllowlistOnly  bool     `json:"allowlist_only"`
+		AllowedDomains []string `json:"allowed_domains"`
+	}{RelayState.RelayConfig.AllowlistOnly, allowedDomains})
+}
+
+// handleAdminActivityTypes enables or disables relaying of activity types
+// GET /api/admin/activity-types
+// POST /api/admin/activity-types
+// Body: {"type": "Delete", "enabled": false}
+// Response: {"activity_types": {"Create": true, ...}}
+func handleAdminActivityTypes(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+	case "POST":
+		var req struct {
+			Type    string `json:"type"`
+			Enabled *bool  `json:"enabled"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+			return
 		}
-		resp := activity.GenerateReply(RelayActor, activity, "Reject")
-		jsonData, _ := json.Marshal(&resp)
-		enqueueRegisterActivity(follower.InboxURL, jsonData)
+		if !contains(models.RelayActivityTypes, req.Type) || req.Enabled == nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "type must be one of " + strings.Join(models.RelayActivityTypes, ", ") + " with enabled"})
+			return
+		}
+		RelayState.SetActivityTypeEnabled(req.Type, *req.Enabled)
+		if *req.Enabled {
+			logger.WithField("type", req.Type).Info("Admin enabled relaying activity type")
+			recordAdminAction(request, "enable_activity_type", "", req.Type)
+		} else {
+			logger.WithField("type", req.Type).Info("Admin disabled relaying activity type")
+			recordAdminAction(request, "disable_activity_type", "", req.Type)
+		}
+	default:
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
 
-		// Remove from state
-		RelayState.DelFollower(follower.Domain)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string]map[string]bool{"activity_types": RelayState.EnabledActivityTypes})
+}
 
-		logrus.Info("Admin unfollow sent for follower: ", req.Domain)
+// adminValidateStateResult is a Redis state report, with the number of removed entries after a repair
+type adminValidateStateResult struct {
+	models.StateReport
+	Repaired int `json:"repaired"`
+}
 
+// handleAdminValidateState reports inconsistent Redis entries, POST with repair removes orphaned ones
+// GET /api/admin/state/validate
+// POST /api/admin/state/validate?repair=true
+// Response: {"checked_keys": 12, "anomalies": [{"key": "relay:subscription:example.com", "problem": "missing inbox_url", "orphaned": true}], "repaired": 0}
+func handleAdminValidateState(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" && request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+	repair, _ := strconv.ParseBool(request.URL.Query().Get("repair"))
+	if repair && request.Method != "POST" {
 		writer.Header().Set("Content-Type", "application/json")
-		writer.WriteHeader(200)
-		json.NewEncoder(writer).Encode(map[string]interface{}{"success": true, "type": "follower"})
+		writer.WriteHeader(405)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "repair requires POST"})
 		return
 	}
 
-	// Domain not found
+	result := adminValidateStateResult{StateReport: RelayState.Validate()}
+	if repair {
+		result.Repaired = RelayState.RepairOrphans(result.StateReport)
+		if result.Repaired > 0 {
+			logger.WithField("removed", result.Repaired).Info("Admin repaired Redis state")
+			recordAdminAction(request, "repair_state", "", "")
+		}
+	}
+
 	writer.Header().Set("Content-Type", "application/json")
-	writer.WriteHeader(404)
-	json.NewEncoder(writer).Encode(map[string]string{"error": "Domain not found in subscribers or followers"})
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(result)
 }
 
-// recordDelayMetrics extracts createdAt from activity and records the delay
-func recordDelayMetrics(activity *models.Activity, actorID *url.URL, receivedAt time.Time) {
-	if activity == nil || actorID == nil {
+type adminPendingEntry struct {
+	Domain     string `json:"domain"`
+	ActorID    string `json:"actor_id"`
+	InboxURL   string `json:"inbox_url"`
+	ActivityID string `json:"activity_id"`
+}
+
+// handleAdminPending lists follow requests waiting for manual approval
+// GET /api/admin/pending
+// Response: {"pending": [...]}
+func handleAdminPending(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	ctx := context.TODO()
+	keys, err := RelayState.RedisClient.Keys(ctx, models.RedisKey("relay:pending:*")).Result()
+	if err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(500)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "failed to list pending requests"})
 		return
 	}
+	sort.Strings(keys)
+
+	pending := []adminPendingEntry{}
+	for _, key := range keys {
+		data, err := RelayState.RedisClient.HGetAll(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+		pending = append(pending, adminPendingEntry{
+			Domain:     strings.TrimPrefix(key, models.RedisKey("relay:pending:")),
+			ActorID:    data["actor"],
+			InboxURL:   data["inbox_url"],
+			ActivityID: data["activity_id"],
+		})
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]adminPendingEntry{"pending": pending})
+}
 
-	// Extract createdAt from the activity or its object
-	var createdAtStr string
+// handleAdminApprove accepts a pending follow request
+// POST /api/admin/approve
+// Body: {"domain": "example.com"}
+func handleAdminApprove(writer http.ResponseWriter, request *http.Request) {
+	respondAdminPending(writer, request, "Accept")
+}
+
+// handleAdminReject rejects a pending follow request
+// POST /api/admin/reject
+// Body: {"domain": "example.com"}
+func handleAdminReject(writer http.ResponseWriter, request *http.Request) {
+	respondAdminPending(writer, request, "Reject")
+}
+
+func respondAdminPending(writer http.ResponseWriter, request *http.Request, response string) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	var req struct {
+		Domain string `json:"domain"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+		return
+	}
+	if req.Domain == "" {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "domain required"})
+		return
+	}
+
+	err := executePendingFollowResponse(req.Domain, response)
+	if err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(404)
+		json.NewEncoder(writer).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	recordAdminAction(request, strings.ToLower(response), req.Domain, "")
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string]interface{}{"success": true})
+}
+
+// activityPublished returns the published timestamp of the activity, or of its object, with the object ID
+func activityPublished(activity *models.Activity) (string, string) {
+	var published string
 	var objectID string
 
 	// First, try to get published from the activity itself
 	if activity.Published != "" {
-		createdAtStr = activity.Published
-		logrus.Debugf("DelayMetrics: Found published in activity: %s", createdAtStr)
+		published = activity.Published
 	}
 
 	// Then, try to get from the activity object
 	switch obj := activity.Object.(type) {
 	case map[string]interface{}:
-		if createdAtStr == "" {
-			if published, ok := obj["published"].(string); ok {
-				createdAtStr = published
-				logrus.Debugf("DelayMetrics: Found published in object: %s", createdAtStr)
+		if published == "" {
+			if objectPublished, ok := obj["published"].(string); ok {
+				published = objectPublished
 			}
 		}
 		if id, ok := obj["id"].(string); ok {
@@ -388,22 +1206,11 @@ func recordDelayMetrics(activity *models.Activity, actorID *url.URL, receivedAt
 	case string:
 		objectID = obj
 	}
+	return published, objectID
+}
 
-	// If still no createdAt, log and skip
-	if createdAtStr == "" {
-		logrus.Debugf("DelayMetrics: No published timestamp found for %s from %s (type: %s)", activity.ID, actorID.Host, activity.Type)
-		return
-	}
-
-	if objectID == "" {
-		objectID = activity.ID
-	}
-
-	// Parse createdAt
-	var createdAt time.Time
-	var err error
-
-	// Try common ActivityPub date formats
+// parsePublished parses a published timestamp in the common ActivityPub date formats
+func parsePublished(published string) (time.Time, error) {
 	formats := []string{
 		time.RFC3339,
 		time.RFC3339Nano,
@@ -411,15 +1218,38 @@ func recordDelayMetrics(activity *models.Activity, actorID *url.URL, receivedAt
 		"2006-01-02T15:04:05Z",
 	}
 
+	var createdAt time.Time
+	var err error
 	for _, format := range formats {
-		createdAt, err = time.Parse(format, createdAtStr)
+		createdAt, err = time.Parse(format, published)
 		if err == nil {
 			break
 		}
 	}
+	return createdAt, err
+}
+
+// recordDelayMetrics extracts createdAt from activity and records the delay
+func recordDelayMetrics(activity *models.Activity, actorID *url.URL, receivedAt time.Time) {
+	if activity == nil || actorID == nil {
+		return
+	}
+
+	createdAtStr, objectID := activityPublished(activity)
+
+	// If no createdAt, log and skip
+	if createdAtStr == "" {
+		activityLogger(activity).WithField("type", activity.Type).Debug("DelayMetrics: No published timestamp found")
+		return
+	}
+
+	if objectID == "" {
+		objectID = activity.ID
+	}
 
+	createdAt, err := parsePublished(createdAtStr)
 	if err != nil {
-		logrus.Debugf("Failed to parse createdAt: %s", createdAtStr)
+		activityLogger(activity).Debugf("Failed to parse createdAt: %s", createdAtStr)
 		return
 	}
 
@@ -431,17 +1261,20 @@ func recordDelayMetrics(activity *models.Activity, actorID *url.URL, receivedAt
 		return
 	}
 
-	// Record the delay
+	// Record the delay, software is empty until the background nodeinfo lookup completes
+	softwareName, softwareVersion := delaymetrics.LookupSoftware(actorID.Host)
 	record := delaymetrics.DelayRecord{
-		NoteID:       objectID,
-		CreatedAt:    createdAt,
-		ReceivedAt:   receivedAt,
-		DelaySeconds: delaySeconds,
-		InstanceHost: actorID.Host,
+		NoteID:          objectID,
+		CreatedAt:       createdAt,
+		ReceivedAt:      receivedAt,
+		DelaySeconds:    delaySeconds,
+		InstanceHost:    actorID.Host,
+		SoftwareName:    softwareName,
+		SoftwareVersion: softwareVersion,
 	}
 
 	err = delaymetrics.RecordDelay(record)
 	if err != nil {
-		logrus.Debugf("Failed to record delay metrics: %v", err)
+		activityLogger(activity).WithError(err).Debug("Failed to record delay metrics")
 	}
 }
@@ -1,22 +1,36 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"encoding/xml"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/discord"
 	"github.com/yukimochi/Activity-Relay/models"
 )
 
 const (
 	PersonOnly models.Config = iota
 	ManuallyAccept
+	RelayReactions
+	RequireSharedInbox
+	ExcludeBotActors
+	AllowlistOnly
+	RequirePublished
+	AllowUnsignedDeletes
+	RequireLanguage
 )
 
 func TestHandleWebfingerGet(t *testing.T) {
@@ -61,6 +75,41 @@ func TestHandleWebfingerGet(t *testing.T) {
 	})
 }
 
+func TestHandleWebfingerNormalizedResource(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleWebfinger))
+	defer s.Close()
+
+	host := GlobalConfig.ServerHostname().Host
+	for resource, expected := range map[string]int{
+		"acct:relay@" + strings.ToUpper(host):         200,
+		"  acct:relay@" + host + " ":                  200,
+		"ACCT:relay@" + host:                          200,
+		"https://" + host + "/actor":                  200,
+		"HTTPS://" + strings.ToUpper(host) + "/actor": 200,
+		"https://" + host + "/Actor":                  404,
+		"acct:RELAY@" + host + ".example":             404,
+		"acct:relay":                                  404,
+	} {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		q := req.URL.Query()
+		q.Add("resource", resource)
+		req.URL.RawQuery = q.Encode()
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var webfinger models.WebfingerResource
+		json.NewDecoder(r.Body).Decode(&webfinger)
+		r.Body.Close()
+		if r.StatusCode != expected {
+			t.Fatalf("Expected StatusCode %d for %q, but got %d", expected, resource, r.StatusCode)
+		}
+		if expected == 200 && webfinger.Subject != "acct:relay@"+host {
+			t.Fatalf("Expected canonical subject for %q, but got %s", resource, webfinger.Subject)
+		}
+	}
+}
+
 func TestHandleWebfingerGetBadResource(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(handleWebfinger))
 	defer s.Close()
@@ -79,6 +128,61 @@ func TestHandleWebfingerGetBadResource(t *testing.T) {
 	}
 }
 
+func TestHandleHostMeta(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleHostMeta))
+	defer s.Close()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.Header.Get("Content-Type") != "application/xrd+xml" {
+		t.Fatalf("Expected Content-Type to be 'application/xrd+xml', but got '%s'", r.Header.Get("Content-Type"))
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	var xrd models.HostMeta
+	err = xml.Unmarshal(data, &xrd)
+	if err != nil {
+		t.Fatalf("Expected valid XRD response, but got error: %v", err)
+	}
+	template := "https://" + GlobalConfig.ServerHostname().Host + "/.well-known/webfinger?resource={uri}"
+	if len(xrd.Links) != 1 || xrd.Links[0].Rel != "lrdd" || xrd.Links[0].Template != template {
+		t.Fatalf("Expected lrdd link to webfinger template, but got %+v", xrd.Links)
+	}
+
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Accept", "application/xrd+xml;q=0.5, application/json")
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected Content-Type to be 'application/json', but got '%s'", r.Header.Get("Content-Type"))
+	}
+	data, _ = io.ReadAll(r.Body)
+	r.Body.Close()
+	var jrd models.HostMeta
+	err = json.Unmarshal(data, &jrd)
+	if err != nil || len(jrd.Links) != 1 || jrd.Links[0].Template != template {
+		t.Fatalf("Expected JSON host-meta with webfinger template, but got %s (%v)", data, err)
+	}
+}
+
+func TestHandleHostMetaJSON(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleHostMetaJSON))
+	defer s.Close()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected Content-Type to be 'application/json', but got '%s'", r.Header.Get("Content-Type"))
+	}
+	r.Body.Close()
+}
+
 func TestHandleNodeinfoLinkGet(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(handleNodeinfoLink))
 	defer s.Close()
@@ -146,6 +250,124 @@ func TestHandleNodeinfoGet(t *testing.T) {
 	}
 }
 
+func TestHandleNodeinfoSchemaVersions(t *testing.T) {
+	for _, tc := range []struct {
+		handler       http.HandlerFunc
+		version       string
+		hasRepository bool
+	}{
+		{handleNodeinfo20, "2.0", false},
+		{handleNodeinfo, "2.1", true},
+	} {
+		s := httptest.NewServer(tc.handler)
+		r, err := http.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		data, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		s.Close()
+
+		var raw map[string]interface{}
+		json.Unmarshal(data, &raw)
+		if raw["version"] != tc.version {
+			t.Fatalf("Expected version %s, but got %v", tc.version, raw["version"])
+		}
+		_, hasRepository := raw["software"].(map[string]interface{})["repository"]
+		if hasRepository != tc.hasRepository {
+			t.Fatalf("Expected software.repository present=%v for %s, but got %v", tc.hasRepository, tc.version, hasRepository)
+		}
+		_, hasLocalPosts := raw["usage"].(map[string]interface{})["localPosts"]
+		if hasLocalPosts != tc.hasRepository {
+			t.Fatalf("Expected usage.localPosts present=%v for %s, but got %v", tc.hasRepository, tc.version, hasLocalPosts)
+		}
+	}
+}
+
+func TestNodeinfoUserTotal(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{Domain: "a.example.com", InboxURL: "https://a.example.com/inbox"})
+	RelayState.AddFollower(models.Follower{Domain: "a.example.com", InboxURL: "https://a.example.com/inbox"})
+	RelayState.AddFollower(models.Follower{Domain: "b.example.com", InboxURL: "https://b.example.com/inbox"})
+
+	for mode, expected := range map[models.NodeinfoUsageMode]int{
+		models.NodeinfoUsageConnections: 3,
+		models.NodeinfoUsageInstances:   2,
+		models.NodeinfoUsageZero:        0,
+	} {
+		if total := nodeinfoUserTotal(mode); total != expected {
+			t.Errorf("Expected %d users in %s mode, but got %d", expected, mode, total)
+		}
+	}
+}
+
+func TestHandleNodeinfoMetadata(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleNodeinfo))
+	defer s.Close()
+
+	getMetadata := func() map[string]interface{} {
+		r, err := http.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		var raw map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&raw)
+		if protocols := raw["protocols"].([]interface{}); len(protocols) != 1 || protocols[0] != "activitypub" {
+			t.Fatalf("Expected protocols to be [activitypub], but got %v", protocols)
+		}
+		return raw["metadata"].(map[string]interface{})
+	}
+
+	if metadata := getMetadata(); len(metadata) != 0 {
+		t.Fatalf("Expected empty metadata when unconfigured, but got %v", metadata)
+	}
+
+	defer func(config *models.RelayConfig) { GlobalConfig = config }(GlobalConfig)
+	viper.Set("NODEINFO_RELAY_METADATA", true)
+	viper.Set("NODEINFO_METADATA", `{"nodeName": "Test Relay"}`)
+	viper.Set("RELAY_ADMIN_EMAIL", "admin@example.com")
+	viper.Set("RELAY_TERMS_URL", "https://example.com/terms")
+	defer viper.Set("NODEINFO_RELAY_METADATA", false)
+	defer viper.Set("NODEINFO_METADATA", "")
+	defer viper.Set("RELAY_ADMIN_EMAIL", "")
+	defer viper.Set("RELAY_TERMS_URL", "")
+	config, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = config
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.SetConfig(ManuallyAccept, true)
+	defer RelayState.SetConfig(ManuallyAccept, false)
+
+	metadata := getMetadata()
+	if metadata["nodeName"] != "Test Relay" {
+		t.Fatalf("Expected operator metadata to be included, but got %v", metadata)
+	}
+	if metadata["manualApproval"] != true {
+		t.Fatalf("Expected manualApproval to be true, but got %v", metadata["manualApproval"])
+	}
+	if styles, _ := metadata["relayStyles"].([]interface{}); len(styles) != 2 {
+		t.Fatalf("Expected mastodon and litepub relay styles, but got %v", metadata["relayStyles"])
+	}
+	if features, _ := metadata["features"].([]interface{}); len(features) != 1 || features[0] != "relay" {
+		t.Fatalf("Expected features to be [relay], but got %v", metadata["features"])
+	}
+	if metadata["nodeDescription"] != GlobalConfig.ServerServiceSummary() {
+		t.Fatalf("Expected nodeDescription to be the relay summary, but got %v", metadata["nodeDescription"])
+	}
+	if maintainer, _ := metadata["maintainer"].(map[string]interface{}); maintainer["email"] != "admin@example.com" {
+		t.Fatalf("Expected maintainer email to be admin@example.com, but got %v", metadata["maintainer"])
+	}
+	if metadata["tosUrl"] != "https://example.com/terms" {
+		t.Fatalf("Expected tosUrl to be https://example.com/terms, but got %v", metadata["tosUrl"])
+	}
+}
+
 func TestHandleNodeinfoInvalidMethod(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(handleNodeinfo))
 	defer s.Close()
@@ -205,6 +427,169 @@ func TestHandleActorGet(t *testing.T) {
 	}
 }
 
+func TestHandleActorContentNegotiation(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleRelayActor))
+	defer s.Close()
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+	}{
+		{`application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`},
+		{`application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`},
+		{`application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"; q=0.9`, "application/activity+json"},
+		{"application/ld+json", "application/activity+json"},
+		{"", "application/activity+json"},
+	} {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		req.Header.Set("Accept", tc.accept)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		r.Body.Close()
+		if r.Header.Get("Content-Type") != tc.contentType {
+			t.Fatalf("Expected Content-Type to be '%s' for Accept '%s', but got '%s'", tc.contentType, tc.accept, r.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestHandleFollowers(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleFollowers))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func(size int) { followersPageSize = size }(followersPageSize)
+	followersPageSize = 2
+	for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		RelayState.AddSubscriber(models.Subscriber{
+			Domain:   domain,
+			InboxURL: "https://" + domain + "/inbox",
+			ActorID:  "https://" + domain + "/actor",
+		})
+	}
+
+	fetch := func(query string) models.OrderedCollection {
+		r, err := http.Get(s.URL + query)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		if r.Header.Get("Content-Type") != "application/activity+json" {
+			t.Fatalf("Expected Content-Type to be 'application/activity+json', but got '%s'", r.Header.Get("Content-Type"))
+		}
+		var collection models.OrderedCollection
+		json.NewDecoder(r.Body).Decode(&collection)
+		return collection
+	}
+
+	collection := fetch("")
+	if collection.Type != "OrderedCollection" || collection.TotalItems != 3 || collection.First != RelayActor().FollowersURL+"?page=1" || len(collection.OrderedItems) != 0 {
+		t.Fatalf("Expected collection summary of 3 items, but got %+v", collection)
+	}
+	page := fetch("?page=1")
+	if page.Type != "OrderedCollectionPage" || page.PartOf != RelayActor().FollowersURL || page.Next != RelayActor().FollowersURL+"?page=2" {
+		t.Fatalf("Expected first page linking to the next, but got %+v", page)
+	}
+	if len(page.OrderedItems) != 2 || page.OrderedItems[0] != "https://a.example.com/actor" {
+		t.Fatalf("Expected first 2 actor IDs, but got %v", page.OrderedItems)
+	}
+	page = fetch("?page=2")
+	if len(page.OrderedItems) != 1 || page.Next != "" {
+		t.Fatalf("Expected last page with 1 actor ID, but got %+v", page)
+	}
+}
+
+func TestHandleOutbox(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleOutbox))
+	defer s.Close()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+	if r.Header.Get("Content-Type") != "application/activity+json" {
+		t.Fatalf("Expected Content-Type to be 'application/activity+json', but got '%s'", r.Header.Get("Content-Type"))
+	}
+	var collection models.OrderedCollection
+	json.NewDecoder(r.Body).Decode(&collection)
+	if collection.Type != "OrderedCollection" || collection.ID != RelayActor().OutboxURL || collection.TotalItems != 0 {
+		t.Fatalf("Expected empty outbox collection, but got %+v", collection)
+	}
+
+	r, _ = http.Post(s.URL, "application/activity+json", nil)
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400 for POST, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleFollowersHidden(t *testing.T) {
+	config := GlobalConfig
+	viper.Set("HIDE_FOLLOWERS_COLLECTION", true)
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = relayConfig
+	defer func() {
+		viper.Set("HIDE_FOLLOWERS_COLLECTION", false)
+		GlobalConfig = config
+	}()
+
+	s := httptest.NewServer(http.HandlerFunc(handleFollowers))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "a.example.com",
+		InboxURL: "https://a.example.com/inbox",
+		ActorID:  "https://a.example.com/actor",
+	})
+
+	for _, query := range []string{"", "?page=1"} {
+		r, err := http.Get(s.URL + query)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var collection models.OrderedCollection
+		json.NewDecoder(r.Body).Decode(&collection)
+		r.Body.Close()
+		if collection.TotalItems != 1 || collection.First != "" || len(collection.OrderedItems) != 0 {
+			t.Fatalf("Expected only totalItems for hidden collection, but got %+v", collection)
+		}
+	}
+}
+
+func TestHandleActorHead(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleRelayActor))
+	defer s.Close()
+
+	r, err := http.Head(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+	if r.Header.Get("Content-Type") != "application/activity+json" {
+		t.Fatalf("Expected Content-Type to be 'application/activity+json', but got '%s'", r.Header.Get("Content-Type"))
+	}
+	if r.ContentLength <= 0 {
+		t.Fatalf("Expected Content-Length of actor document, but got %d", r.ContentLength)
+	}
+	data, _ := io.ReadAll(r.Body)
+	if len(data) != 0 {
+		t.Fatalf("Expected empty body for HEAD, but got %d bytes", len(data))
+	}
+}
+
 func TestHandleActorInvalidMethod(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(handleRelayActor))
 	defer s.Close()
@@ -260,14 +645,18 @@ func TestContainsFunction(t *testing.T) {
 	})
 }
 
-func mockActivityDecoderProvider(activity *models.Activity, actor *models.Actor) func(r *http.Request) (*models.Activity, *models.Actor, []byte, error) {
-	return func(r *http.Request) (*models.Activity, *models.Actor, []byte, error) {
+func mockActivityDecoderProvider(activity *models.Activity, actor *models.Actor) func(r *http.Request) (*models.Activity, *models.Actor, *models.Actor, []byte, error) {
+	return mockSignedActivityDecoderProvider(activity, actor, actor)
+}
+
+func mockSignedActivityDecoderProvider(activity *models.Activity, actor *models.Actor, keyOwner *models.Actor) func(r *http.Request) (*models.Activity, *models.Actor, *models.Actor, []byte, error) {
+	return func(r *http.Request) (*models.Activity, *models.Actor, *models.Actor, []byte, error) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		return activity, actor, body, nil
+		return activity, actor, keyOwner, body, nil
 	}
 }
 
@@ -314,12 +703,24 @@ func mockActivity(req string) models.Activity {
 		var activity models.Activity
 		json.Unmarshal(body, &activity)
 		return activity
+	case "Like":
+		file, _ := os.Open("../misc/test/like.json")
+		body, _ := io.ReadAll(file)
+		var activity models.Activity
+		json.Unmarshal(body, &activity)
+		return activity
 	case "Announce-LP":
 		file, _ := os.Open("../misc/test/announce-lp.json")
 		body, _ := io.ReadAll(file)
 		var activity models.Activity
 		json.Unmarshal(body, &activity)
 		return activity
+	case "Announce-Embedded-LP":
+		file, _ := os.Open("../misc/test/announce-embedded-lp.json")
+		body, _ := io.ReadAll(file)
+		var activity models.Activity
+		json.Unmarshal(body, &activity)
+		return activity
 	default:
 		panic("mock activity error: unsupported activity type requested: " + req)
 	}
@@ -496,8 +897,8 @@ func TestHandleInboxValidFollowBlocked(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Expected request to succeed, but got error: %v", err)
 	}
-	if r.StatusCode != 202 {
-		t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+	if r.StatusCode != 403 {
+		t.Fatalf("Expected StatusCode to be 403, but got %d", r.StatusCode)
 	}
 	res, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:subscription:"+domain.Host).Result()
 	if res != 0 {
@@ -507,6 +908,81 @@ func TestHandleInboxValidFollowBlocked(t *testing.T) {
 	RelayState.SetBlockedDomain(domain.Host, false)
 }
 
+func TestHandleInboxFlag(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	domain, _ := url.Parse(mockActor("Person").ID)
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+
+	received := make(chan []byte, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received <- data
+		w.WriteHeader(204)
+	}))
+	defer webhook.Close()
+	discord.Initialize(discord.WebhookDiscord, webhook.URL, "Test Relay", "")
+	defer discord.Initialize(discord.WebhookDiscord, "", "", "")
+
+	activity := mockActivity("Create")
+	activity.Type = "Flag"
+	activity.Object = []interface{}{"https://example.org/users/spammer", map[string]interface{}{"id": "https://example.org/notes/1"}}
+	activity.Content = "Spam"
+	actor := mockActor("Person")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	r, err := http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+	}
+	select {
+	case data := <-received:
+		if !strings.Contains(string(data), "https://example.org/notes/1") || !strings.Contains(string(data), "Spam") {
+			t.Fatalf("Expected reported objects and reason in notification, but got %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected moderators to be notified, but webhook was not called")
+	}
+	time.Sleep(100 * time.Millisecond)
+	keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+	if len(keys) != 0 {
+		t.Fatalf("Expected Flag never to be relayed, but got %d activities", len(keys))
+	}
+
+	// Content of instances not subscribed never passed through the relay
+	activity.Object = []interface{}{"https://spam.example.com/users/spammer"}
+	http.Post(s.URL, "application/activity+json", nil)
+	select {
+	case data := <-received:
+		t.Fatalf("Expected Flag about content not relayed to be ignored, but got %s", data)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	activity.To = []string{RelayActor().ID}
+	http.Post(s.URL, "application/activity+json", nil)
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Flag addressed to the relay to be notified, but webhook was not called")
+	}
+}
+
 func TestHandleInboxFollowLitePub(t *testing.T) {
 	activity := mockActivity("Follow-LP")
 	actor := mockActor("Person")
@@ -585,6 +1061,66 @@ func TestHandleInboxValidUnfollow(t *testing.T) {
 	RelayState.DelSubscriber(domain.Host)
 }
 
+func TestHandleInboxUnfollowGrace(t *testing.T) {
+	defer func(config *models.RelayConfig) { GlobalConfig = config }(GlobalConfig)
+	viper.Set("UNDO_FOLLOW_GRACE", "1h")
+	defer viper.Set("UNDO_FOLLOW_GRACE", "")
+	GlobalConfig, _ = models.NewRelayConfig()
+
+	activity := mockActivity("Unfollow")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+	defer RelayState.DelSubscriber(domain.Host)
+
+	r, err := http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+	}
+	if RelayState.SelectSubscriber(domain.Host) == nil {
+		t.Fatal("Expected subscriber to be kept during the grace period")
+	}
+
+	if pending, _ := RelayState.RedisClient.ZCard(context.TODO(), "relay:unfollow:pending").Result(); pending != 1 {
+		t.Fatalf("Expected removal to be kept in Redis, but got %d pending", pending)
+	}
+
+	activity = mockActivity("Follow")
+	http.Post(s.URL, "application/activity+json", nil)
+	if cancelDeferredUnfollowing(domain.Host) {
+		t.Fatal("Expected Follow to cancel the deferred removal")
+	}
+	if processDeferredUnfollows(time.Now().Add(2*time.Hour)) != 0 || RelayState.SelectSubscriber(domain.Host) == nil {
+		t.Fatal("Expected subscriber to stay registered after following again")
+	}
+
+	activity = mockActivity("Unfollow")
+	http.Post(s.URL, "application/activity+json", nil)
+	if removed := processDeferredUnfollows(time.Now()); removed != 0 {
+		t.Fatalf("Expected no removal during the grace period, but got %d", removed)
+	}
+	if removed := processDeferredUnfollows(time.Now().Add(2 * time.Hour)); removed != 1 {
+		t.Fatalf("Expected 1 removal after the grace period, but got %d", removed)
+	}
+	if RelayState.SelectSubscriber(domain.Host) != nil {
+		t.Fatal("Expected subscriber to be removed after the grace period")
+	}
+	if exists, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:unfollow:pending", "relay:unfollow:"+domain.Host).Result(); exists != 0 {
+		t.Fatalf("Expected pending removal to be cleared, but got %d keys", exists)
+	}
+}
+
 func TestHandleInboxValidManuallyUnFollow(t *testing.T) {
 	activity := mockActivity("Unfollow")
 	actor := mockActor("Person")
@@ -622,6 +1158,58 @@ func TestHandleInboxValidManuallyUnFollow(t *testing.T) {
 	RelayState.SetConfig(ManuallyAccept, false)
 }
 
+func TestHandleInboxRejectOwnFollow(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	actor := mockActor("Person")
+	domain, _ := url.Parse(actor.ID)
+	var activity models.Activity
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	cases := []struct {
+		object   interface{}
+		rejected bool
+	}{
+		{"https://innocent.yukimochi.io/activities/1", false},
+		{RelayActor().ID + "/activities/1", true},
+		{map[string]interface{}{"id": RelayActor().ID + "/activities/2", "type": "Follow", "actor": RelayActor().ID, "object": actor.ID}, true},
+		{map[string]interface{}{"id": "https://innocent.yukimochi.io/activities/2", "type": "Follow", "actor": actor.ID, "object": RelayActor().ID}, false},
+	}
+	for i, c := range cases {
+		RelayState.AddFollower(models.Follower{
+			Domain:         domain.Host,
+			InboxURL:       "https://innocent.yukimochi.io/inbox",
+			ActorID:        actor.ID,
+			MutuallyFollow: true,
+		})
+		activity = models.Activity{
+			ID:     "https://innocent.yukimochi.io/activities/reject",
+			Actor:  actor.ID,
+			Type:   "Reject",
+			To:     []string{RelayActor().ID},
+			Object: c.object,
+		}
+		r, err := http.Post(s.URL, "application/activity+json", nil)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202 in case %d, but got %d", i, r.StatusCode)
+		}
+		follower := RelayState.SelectFollower(domain.Host)
+		if follower == nil || follower.MutuallyFollow == c.rejected {
+			t.Fatalf("Expected our Follow to be rejected (%v) in case %d, but got %+v", c.rejected, i, follower)
+		}
+	}
+}
+
 func TestHandleInboxUnfollowAsActor(t *testing.T) {
 	activity := mockActivity("UnfollowAsActor")
 	actor := mockActor("Person")
@@ -794,3 +1382,1184 @@ func TestHandleInboxAnnounceLitePub(t *testing.T) {
 	RelayState.RedisClient.Del(context.TODO(), "relay:subscription:"+domain.Host).Result()
 	RelayState.RedisClient.Del(context.TODO(), "relay:subscription:example.org").Result()
 }
+
+func TestHandleInboxAnnounceEmbeddedLitePub(t *testing.T) {
+	activity := mockActivity("Announce-Embedded-LP")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	signer := &models.Actor{ID: activity.Actor}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockSignedActivityDecoderProvider(&activity, &actor, signer))
+	}))
+	defer s.Close()
+
+	originalActor := "https://carol-sol-coffee-shareware.trycloudflare.com/users/carol"
+	ActorCache.Set(originalActor, []byte(`{"id":"`+originalActor+`","type":"Person","inbox":"`+originalActor+`/inbox"}`), time.Minute)
+	defer ActorCache.Delete(originalActor)
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://" + domain.Host + "/inbox",
+	})
+	defer func() {
+		RelayState.DelSubscriber(domain.Host)
+		RelayState.RedisClient.Del(context.TODO(), "relay:subscription:"+domain.Host).Result()
+	}()
+
+	// The inlined activity is relayed without fetching it from the unreachable origin
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+	}
+
+	// An object inlined by a signer of another host has to be fetched from its origin
+	activity.ID += "-other-signer"
+	signer = &actor
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400, but got %d", r.StatusCode)
+	}
+
+	// An object carrying only its id still has to be fetched
+	activity.ID += "-id-only"
+	activity.Object = map[string]interface{}{"id": "https://carol-sol-coffee-shareware.trycloudflare.com/objects/b22bb689-3333-4390-9089-5a2597ee38ee"}
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleInboxDuplicateAnnounceRetry(t *testing.T) {
+	var available atomic.Bool
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.Write([]byte(`{"id":"` + origin.URL + `/notes/1","type":"Note","actor":"` + origin.URL + `/users/alice"}`))
+	}))
+	defer origin.Close()
+	ActorCache.Set(origin.URL+"/users/alice", []byte(`{"id":"`+origin.URL+`/users/alice","type":"Person","inbox":"`+origin.URL+`/users/alice/inbox"}`), time.Minute)
+	defer ActorCache.Delete(origin.URL + "/users/alice")
+
+	activity := mockActivity("Announce-LP")
+	activity.Object = origin.URL + "/notes/1"
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://" + domain.Host + "/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+
+	post := func() int {
+		r, err := http.Post(s.URL, "application/activity+json", nil)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		r.Body.Close()
+		return r.StatusCode
+	}
+	if status := post(); status != 400 {
+		t.Fatalf("Expected StatusCode to be 400 while the origin fails, but got %d", status)
+	}
+
+	// The retry of the sender is relayed, not taken for a duplicate
+	available.Store(true)
+	if status := post(); status != 202 {
+		t.Fatalf("Expected StatusCode to be 202, but got %d", status)
+	}
+	time.Sleep(100 * time.Millisecond)
+	keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+	if len(keys) != 1 {
+		t.Fatalf("Expected retried Announce to be relayed, but got %d activities", len(keys))
+	}
+}
+
+func TestHandleInboxAnnounceDeadline(t *testing.T) {
+	config := GlobalConfig
+	viper.Set("INBOX_PROCESSING_TIMEOUT", "50ms")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = relayConfig
+	defer func() {
+		viper.Set("INBOX_PROCESSING_TIMEOUT", "5s")
+		GlobalConfig = config
+	}()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.WriteHeader(404)
+	}))
+	defer origin.Close()
+
+	activity := mockActivity("Announce-LP")
+	activity.Object = origin.URL + "/notes/1"
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://" + domain.Host + "/inbox",
+	})
+	defer func() {
+		RelayState.DelSubscriber(domain.Host)
+		RelayState.RedisClient.Del(context.TODO(), "relay:subscription:"+domain.Host).Result()
+	}()
+
+	start := time.Now()
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Expected StatusCode to be 202 once the deadline passed, but got %d", r.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Fatalf("Expected response before the slow fetch completed, but took %v", elapsed)
+	}
+}
+
+func TestHandleInboxDisallowedSignatureAlgorithm(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, decodeActivity)
+	}))
+	defer s.Close()
+
+	InboxSignaturePolicy.AllowedAlgorithms = []string{"hs2019"}
+	defer func() { InboxSignaturePolicy.AllowedAlgorithms = nil }()
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	req.Header.Set("Signature", `keyId="https://innocent.yukimochi.io/users/YUKIMOCHI#main-key",algorithm="rsa-sha256",headers="(request-target) host date",signature="xxx"`)
+	req.Header.Set("Date", "Sun, 23 Dec 2018 07:39:37 GMT")
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 401 {
+		t.Fatalf("Expected StatusCode to be 401, but got %d", r.StatusCode)
+	}
+	data, _ := io.ReadAll(r.Body)
+	if len(data) == 0 {
+		t.Fatal("Expected descriptive response body, but got empty body")
+	}
+}
+
+func TestHandleInboxBodyTooLarge(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, decodeActivity)
+	}))
+	defer s.Close()
+
+	defer func(size int64) { InboxMaxBodySize = size }(InboxMaxBodySize)
+	InboxMaxBodySize = 16
+
+	req, _ := http.NewRequest("POST", s.URL, bytes.NewReader(bytes.Repeat([]byte("a"), 17)))
+	client := new(http.Client)
+	r, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 413 {
+		t.Fatalf("Expected StatusCode to be 413, but got %d", r.StatusCode)
+	}
+	data, _ := io.ReadAll(r.Body)
+	if string(data) != "activity body exceeds 16 bytes" {
+		t.Fatalf("Expected descriptive response body, but got '%s'", data)
+	}
+}
+
+func waitRelayActivityKeys(t *testing.T) []string {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) > 0 {
+			return keys
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestHandleInboxRelayLike(t *testing.T) {
+	activity := mockActivity("Like")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.net",
+		InboxURL: "https://example.net/inbox",
+	})
+	RelayState.SetConfig(RelayReactions, true)
+
+	t.Run("Like to Public is enqueued to all subscribers", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", s.URL, bytes.NewReader([]byte("LikeBody")))
+		client := new(http.Client)
+		r, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+		}
+		keys := waitRelayActivityKeys(t)
+		if len(keys) != 1 {
+			t.Fatalf("Expected one relayed activity, but got %d", len(keys))
+		}
+		data, _ := RelayState.RedisClient.HGetAll(context.TODO(), keys[0]).Result()
+		if data["body"] != "LikeBody" {
+			t.Fatalf("Expected body to be forwarded unmodified, but got '%s'", data["body"])
+		}
+		if data["remain_count"] != "2" {
+			t.Fatalf("Expected remain_count to be 2, but got '%s'", data["remain_count"])
+		}
+	})
+
+	t.Run("Like is not relayed when reactions are disabled", func(t *testing.T) {
+		RelayState.SetConfig(RelayReactions, false)
+		RelayState.RedisClient.Del(context.TODO(), waitRelayActivityKeys(t)...)
+
+		req, _ := http.NewRequest("POST", s.URL, bytes.NewReader([]byte("LikeBody")))
+		client := new(http.Client)
+		r, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) != 0 {
+			t.Fatalf("Expected no relayed activity, but got %d", len(keys))
+		}
+	})
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+}
+
+func TestHandleInboxRelayUndoLike(t *testing.T) {
+	like := mockActivity("Like")
+	activity := models.Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      like.ID + "/undo",
+		Type:    "Undo",
+		Actor:   like.Actor,
+		To:      like.To,
+		Object: map[string]interface{}{
+			"id":     like.ID,
+			"type":   "Like",
+			"actor":  like.Actor,
+			"object": like.Object,
+		},
+	}
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.SetConfig(RelayReactions, true)
+
+	post := func() {
+		req, _ := http.NewRequest("POST", s.URL, bytes.NewReader([]byte("UndoLikeBody")))
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+		}
+	}
+
+	post()
+	keys := waitRelayActivityKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("Expected Undo(Like) to be relayed once, but got %d", len(keys))
+	}
+	data, _ := RelayState.RedisClient.HGetAll(context.TODO(), keys[0]).Result()
+	if data["body"] != "UndoLikeBody" || data["remain_count"] != "1" {
+		t.Fatalf("Expected body forwarded unmodified to 1 subscriber, but got '%s' to %s", data["body"], data["remain_count"])
+	}
+	RelayState.RedisClient.Del(context.TODO(), keys...)
+
+	activity.Object.(map[string]interface{})["actor"] = "https://example.org/users/alice"
+	post()
+	RelayState.SetConfig(RelayReactions, false)
+	activity.Object.(map[string]interface{})["actor"] = like.Actor
+	post()
+	time.Sleep(100 * time.Millisecond)
+	keys, _ = RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+	if len(keys) != 0 {
+		t.Fatalf("Expected Undo of another actor's Like or with reactions disabled not to be relayed, but got %d", len(keys))
+	}
+}
+
+func TestHandleInboxRelayUndoAnnounce(t *testing.T) {
+	// A boost of the note the mocked Like refers to
+	announce := mockActivity("Like")
+	announce.ID += "/announce"
+	activity := models.Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      announce.ID + "/undo",
+		Type:    "Undo",
+		Actor:   announce.Actor,
+		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		Object: map[string]interface{}{
+			"id":     announce.ID,
+			"type":   "Announce",
+			"actor":  announce.Actor,
+			"object": announce.Object,
+		},
+	}
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+
+	req, _ := http.NewRequest("POST", s.URL, bytes.NewReader([]byte("UndoAnnounceBody")))
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 202 {
+		t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+	}
+	keys := waitRelayActivityKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("Expected Undo(Announce) to be relayed once, but got %d", len(keys))
+	}
+	data, _ := RelayState.RedisClient.HGetAll(context.TODO(), keys[0]).Result()
+	if data["body"] != "UndoAnnounceBody" || data["remain_count"] != "1" {
+		t.Fatalf("Expected body forwarded unmodified to 1 subscriber, but got '%s' to %s", data["body"], data["remain_count"])
+	}
+}
+
+func TestHandleInboxActorDelete(t *testing.T) {
+	actor := mockActor("Person")
+	activity := models.Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      actor.ID + "#delete",
+		Type:    "Delete",
+		Actor:   actor.ID,
+		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		Object:  actor.ID,
+	}
+	signer := &actor
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockSignedActivityDecoderProvider(&activity, &actor, signer))
+	}))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	subscribe := func() {
+		RelayState.AddSubscriber(models.Subscriber{
+			Domain:   "innocent.yukimochi.io",
+			InboxURL: "https://innocent.yukimochi.io/inbox",
+			ActorID:  actor.ID,
+		})
+		RelayState.AddFollower(models.Follower{
+			Domain:   "alias.yukimochi.io",
+			InboxURL: "https://alias.yukimochi.io/inbox",
+			ActorID:  actor.ID,
+		})
+		RelayState.AddSubscriber(models.Subscriber{
+			Domain:   "example.org",
+			InboxURL: "https://example.org/inbox",
+			ActorID:  "https://example.org/actor",
+		})
+	}
+	post := func() {
+		req, _ := http.NewRequest("POST", s.URL, nil)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202, but got %d", r.StatusCode)
+		}
+		RelayState.Load()
+	}
+
+	subscribe()
+	post()
+	if RelayState.SelectSubscriber("innocent.yukimochi.io") != nil || RelayState.SelectFollower("alias.yukimochi.io") != nil {
+		t.Fatal("Expected subscriber and follower of the deleted actor to be removed")
+	}
+	if RelayState.SelectSubscriber("example.org") == nil {
+		t.Fatal("Expected other subscribers to be kept")
+	}
+
+	subscribe()
+	signer = nil
+	post()
+	if RelayState.SelectSubscriber("innocent.yukimochi.io") == nil {
+		t.Fatal("Expected unsigned Delete not to remove the subscriber")
+	}
+
+	// A Delete naming another actor, signed by a key of the sender
+	signer = &models.Actor{ID: "https://example.org/actor"}
+	post()
+	if RelayState.SelectSubscriber("innocent.yukimochi.io") == nil || RelayState.SelectFollower("alias.yukimochi.io") == nil {
+		t.Fatal("Expected Delete signed by a different actor not to remove the subscriber or follower")
+	}
+}
+
+func TestHandleAdminList(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminList))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	t.Run("Empty arrays when none exist", func(t *testing.T) {
+		r, err := http.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		if r.StatusCode != 200 {
+			t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+		}
+		data, _ := io.ReadAll(r.Body)
+		if string(data) != `{"followers":[],"subscribers":[]}`+"\n" {
+			t.Fatalf("Expected empty arrays, but got %s", data)
+		}
+	})
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+		ActorID:  "https://example.org/actor",
+		JoinedAt: 1700000000,
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:   "example.net",
+		InboxURL: "https://example.net/inbox",
+		ActorID:  "https://example.net/relay",
+	})
+
+	recordLastSeen(context.TODO(), "example.org", time.Unix(1700000500, 0))
+
+	t.Run("Filter by type", func(t *testing.T) {
+		r, err := http.Get(s.URL + "?type=subscriber")
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		var response map[string][]adminListEntry
+		json.NewDecoder(r.Body).Decode(&response)
+		if _, ok := response["followers"]; ok {
+			t.Fatal("Expected followers to be filtered out, but present")
+		}
+		if len(response["subscribers"]) != 1 || response["subscribers"][0].JoinedAt != 1700000000 {
+			t.Fatalf("Expected one subscriber joined at 1700000000, but got %+v", response["subscribers"])
+		}
+		if response["subscribers"][0].LastSeen != 1700000500 {
+			t.Fatalf("Expected subscriber last seen at 1700000500, but got %d", response["subscribers"][0].LastSeen)
+		}
+	})
+
+	t.Run("Invalid type", func(t *testing.T) {
+		r, err := http.Get(s.URL + "?type=blocked")
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 400 {
+			t.Fatalf("Expected StatusCode to be 400, but got %d", r.StatusCode)
+		}
+	})
+
+	RelayState.DelSubscriber("example.org")
+	RelayState.DelFollower("example.net")
+}
+
+func TestHandleAdminPendingApproveReject(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	for _, domain := range []string{"approve.example.com", "reject.example.com"} {
+		RelayState.RedisClient.HMSet(context.TODO(), "relay:pending:"+domain, map[string]interface{}{
+			"inbox_url":   "https://" + domain + "/inbox",
+			"activity_id": "https://" + domain + "/UUID",
+			"type":        "Follow",
+			"actor":       "https://" + domain + "/actor",
+			"object":      "https://www.w3.org/ns/activitystreams#Public",
+		})
+	}
+
+	pending := httptest.NewServer(http.HandlerFunc(handleAdminPending))
+	defer pending.Close()
+	r, err := http.Get(pending.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var response map[string][]adminPendingEntry
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if len(response["pending"]) != 2 || response["pending"][0].Domain != "approve.example.com" {
+		t.Fatalf("Expected 2 pending requests, but got %+v", response["pending"])
+	}
+
+	approve := httptest.NewServer(http.HandlerFunc(handleAdminApprove))
+	defer approve.Close()
+	r, _ = http.Post(approve.URL, "application/json", strings.NewReader(`{"domain":"approve.example.com"}`))
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+	if RelayState.SelectSubscriber("approve.example.com") == nil {
+		t.Fatal("Expected approved domain to be subscribed")
+	}
+
+	reject := httptest.NewServer(http.HandlerFunc(handleAdminReject))
+	defer reject.Close()
+	r, _ = http.Post(reject.URL, "application/json", strings.NewReader(`{"domain":"reject.example.com"}`))
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+	if RelayState.SelectSubscriber("reject.example.com") != nil {
+		t.Fatal("Expected rejected domain not to be subscribed")
+	}
+
+	keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:pending:*").Result()
+	if len(keys) != 0 {
+		t.Fatalf("Expected pending requests to be cleared, but got %v", keys)
+	}
+
+	r, _ = http.Post(approve.URL, "application/json", strings.NewReader(`{"domain":"unknown.example.com"}`))
+	if r.StatusCode != 404 {
+		t.Fatalf("Expected StatusCode to be 404 for unknown domain, but got %d", r.StatusCode)
+	}
+}
+
+func TestExecuteRelayActivityTagFilters(t *testing.T) {
+	actor := mockActor("Person")
+	domain, _ := url.Parse(actor.ID)
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.SetTagFilter("#GameDev", true)
+	defer RelayState.SetTagFilter("gamedev", false)
+
+	createWithTags := func(names ...string) models.Activity {
+		activity := mockActivity("Create")
+		var tags []interface{}
+		for _, name := range names {
+			tags = append(tags, map[string]interface{}{"type": "Hashtag", "name": name})
+		}
+		tags = append(tags, map[string]interface{}{"type": "Mention", "name": "@gamedev"})
+		object := activity.Object.(map[string]interface{})
+		object["tag"] = tags
+		return activity
+	}
+
+	t.Run("Create without matching hashtag is not relayed", func(t *testing.T) {
+		activity := createWithTags("#cooking")
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) != 0 {
+			t.Fatalf("Expected nothing to be relayed, but got %d activities", len(keys))
+		}
+	})
+
+	t.Run("Create with matching hashtag is relayed", func(t *testing.T) {
+		activity := createWithTags("#cooking", "#gamedev")
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		keys := waitRelayActivityKeys(t)
+		if len(keys) != 1 {
+			t.Fatalf("Expected one relayed activity, but got %d", len(keys))
+		}
+	})
+}
+
+func TestExecuteRelayActivityLanguageFilters(t *testing.T) {
+	actor := mockActor("Person")
+	domain, _ := url.Parse(actor.ID)
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.SetLanguageFilter("JA", true)
+	defer RelayState.SetLanguageFilter("ja", false)
+
+	createInLanguage := func(languages ...string) models.Activity {
+		activity := mockActivity("Create")
+		object := activity.Object.(map[string]interface{})
+		contentMap := map[string]interface{}{}
+		for _, language := range languages {
+			contentMap[language] = object["content"]
+		}
+		object["contentMap"] = contentMap
+		return activity
+	}
+	relayedCount := func(activity models.Activity) int {
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) > 0 {
+			RelayState.RedisClient.Del(context.TODO(), keys...)
+		}
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys, _ = RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		return len(keys)
+	}
+
+	if count := relayedCount(createInLanguage("en")); count != 0 {
+		t.Fatalf("Expected Create in another language not to be relayed, but got %d activities", count)
+	}
+	if count := relayedCount(createInLanguage("ja-JP")); count != 1 {
+		t.Fatalf("Expected Create in a regional variant of a filtered language to be relayed, but got %d activities", count)
+	}
+	if count := relayedCount(createInLanguage("en", "ja")); count != 1 {
+		t.Fatalf("Expected Create with a filtered language among others to be relayed, but got %d activities", count)
+	}
+	if count := relayedCount(createInLanguage()); count != 1 {
+		t.Fatalf("Expected Create without language to be relayed, but got %d activities", count)
+	}
+
+	RelayState.SetConfig(RequireLanguage, true)
+	defer RelayState.SetConfig(RequireLanguage, false)
+	if count := relayedCount(createInLanguage()); count != 0 {
+		t.Fatalf("Expected Create without language not to be relayed when language is required, but got %d activities", count)
+	}
+}
+
+func TestExecuteRelayActivityMaxActivityAge(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	domain, _ := url.Parse(mockActor("Person").ID)
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.SetMaxActivityAge(time.Hour)
+	defer RelayState.SetMaxActivityAge(0)
+
+	t.Run("Old Create is not relayed", func(t *testing.T) {
+		actor := mockActor("Person")
+		activity := mockActivity("Create")
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) != 0 {
+			t.Fatalf("Expected nothing to be relayed, but got %d activities", len(keys))
+		}
+	})
+
+	t.Run("Fresh Create is relayed", func(t *testing.T) {
+		actor := mockActor("Person")
+		activity := mockActivity("Create")
+		activity.Published = time.Now().UTC().Format(time.RFC3339)
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		keys := waitRelayActivityKeys(t)
+		if len(keys) != 1 {
+			t.Fatalf("Expected one relayed activity, but got %d", len(keys))
+		}
+	})
+
+	t.Run("Undated Create is relayed unless published is required", func(t *testing.T) {
+		activity := mockActivity("Create")
+		activity.Published = ""
+		delete(activity.Object.(map[string]interface{}), "published")
+		if isActivityTooOld(&activity, time.Now()) {
+			t.Fatal("Expected undated activity to bypass the age check")
+		}
+		RelayState.SetConfig(RequirePublished, true)
+		defer RelayState.SetConfig(RequirePublished, false)
+		if !isActivityTooOld(&activity, time.Now()) {
+			t.Fatal("Expected undated activity to be rejected when published is required")
+		}
+	})
+}
+
+func TestExecuteRelayActivityDisabledType(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	domain, _ := url.Parse(mockActor("Person").ID)
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.SetActivityTypeEnabled("Delete", false)
+	defer RelayState.SetActivityTypeEnabled("Delete", true)
+
+	t.Run("Delete is not relayed", func(t *testing.T) {
+		actor := mockActor("Person")
+		activity := mockActivity("Create")
+		activity.Type = "Delete"
+		err := executeRelayActivity(&activity, &actor, []byte("DeleteBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) != 0 {
+			t.Fatalf("Expected nothing to be relayed, but got %d activities", len(keys))
+		}
+	})
+
+	t.Run("Create is still relayed", func(t *testing.T) {
+		actor := mockActor("Person")
+		activity := mockActivity("Create")
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		keys := waitRelayActivityKeys(t)
+		if len(keys) != 1 {
+			t.Fatalf("Expected one relayed activity, but got %d", len(keys))
+		}
+	})
+}
+
+func TestExecuteRelayActivityExcludeBotActors(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	domain, _ := url.Parse(mockActor("Service").ID)
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://innocent.yukimochi.io/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "example.org",
+		InboxURL: "https://example.org/inbox",
+	})
+	RelayState.SetConfig(ExcludeBotActors, true)
+	defer RelayState.SetConfig(ExcludeBotActors, false)
+
+	t.Run("Create by Service actor is not relayed", func(t *testing.T) {
+		actor := mockActor("Service")
+		activity := mockActivity("Create")
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) != 0 {
+			t.Fatalf("Expected nothing to be relayed, but got %d activities", len(keys))
+		}
+	})
+
+	t.Run("Create by Person actor is relayed", func(t *testing.T) {
+		actor := mockActor("Person")
+		activity := mockActivity("Create")
+		err := executeRelayActivity(&activity, &actor, []byte("CreateBody"))
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		keys := waitRelayActivityKeys(t)
+		if len(keys) != 1 {
+			t.Fatalf("Expected one relayed activity, but got %d", len(keys))
+		}
+	})
+}
+
+func TestHandleAdminBlock(t *testing.T) {
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	inbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer inbox.Close()
+	s := httptest.NewServer(http.HandlerFunc(handleAdminBlock))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	r, _ := http.Post(s.URL, "application/json", strings.NewReader(`{"domain":"`+domain.Host+`"}`))
+	var response map[string][]string
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if len(response["blocked_domains"]) != 1 || response["blocked_domains"][0] != domain.Host {
+		t.Fatalf("Expected %s to be blocked, but got %v", domain.Host, response["blocked_domains"])
+	}
+	res, _ := RelayState.RedisClient.HExists(context.TODO(), "relay:config:blockedDomain", domain.Host).Result()
+	if !res {
+		t.Fatal("Expected blocked domain to be persisted to Redis")
+	}
+
+	r, _ = http.Post(inbox.URL, "application/activity+json", nil)
+	if r.StatusCode != 403 {
+		t.Fatalf("Expected Follow from blocked domain to be rejected with 403, but got %d", r.StatusCode)
+	}
+	if RelayState.SelectSubscriber(domain.Host) != nil {
+		t.Fatal("Expected blocked domain not to be subscribed")
+	}
+
+	req, _ := http.NewRequest("DELETE", s.URL, strings.NewReader(`{"domain":"`+domain.Host+`"}`))
+	r, _ = http.DefaultClient.Do(req)
+	r.Body.Close()
+	if contains(RelayState.BlockedDomains, domain.Host) {
+		t.Fatal("Expected domain to be unblocked")
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{}`))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400 without domain, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleAdminAllow(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminAllow))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	var response struct {
+		AllowlistOnly  bool     `json:"allowlist_only"`
+		AllowedDomains []string `json:"allowed_domains"`
+	}
+	r, _ := http.Post(s.URL, "application/json", strings.NewReader(`{"domain":"Allowed.Example"}`))
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if len(response.AllowedDomains) != 1 || response.AllowedDomains[0] != "allowed.example" {
+		t.Fatalf("Expected allowed.example to be allowed, but got %v", response.AllowedDomains)
+	}
+	if response.AllowlistOnly {
+		t.Fatal("Expected allow-list only mode to stay disabled")
+	}
+	res, _ := RelayState.RedisClient.HExists(context.TODO(), "relay:config:allowedDomain", "allowed.example").Result()
+	if !res {
+		t.Fatal("Expected allowed domain to be persisted to Redis")
+	}
+
+	req, _ := http.NewRequest("DELETE", s.URL, strings.NewReader(`{"domain":"allowed.example"}`))
+	r, _ = http.DefaultClient.Do(req)
+	r.Body.Close()
+	if contains(RelayState.AllowedDomains, "allowed.example") {
+		t.Fatal("Expected domain to be removed from the allow-list")
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{}`))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400 without domain, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleAdminActivityTypes(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminActivityTypes))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	var response map[string]map[string]bool
+	r, _ := http.Get(s.URL)
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	for _, activityType := range models.RelayActivityTypes {
+		if !response["activity_types"][activityType] {
+			t.Fatalf("Expected %s to be enabled by default, but got %v", activityType, response["activity_types"])
+		}
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{"type":"Delete","enabled":false}`))
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if response["activity_types"]["Delete"] || !response["activity_types"]["Create"] {
+		t.Fatalf("Expected only Delete to be disabled, but got %v", response["activity_types"])
+	}
+	if isActivityTypeEnabled("Delete") {
+		t.Fatal("Expected Delete relaying to be disabled")
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{"type":"Follow","enabled":false}`))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400 for a type without toggle, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleAdminUnfollowDryRun(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminUnfollow))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "spam.example.com",
+		InboxURL:   "https://spam.example.com/inbox",
+		ActivityID: "https://spam.example.com/follow/1",
+		ActorID:    "https://spam.example.com/actor",
+	})
+
+	for _, tc := range []struct {
+		url  string
+		body string
+	}{
+		{s.URL + "?dryRun=true", `{"domain":"spam.example.com"}`},
+		{s.URL, `{"domain":"spam.example.com","dryRun":true}`},
+	} {
+		r, err := http.Post(tc.url, "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var response adminUnfollowResult
+		json.NewDecoder(r.Body).Decode(&response)
+		r.Body.Close()
+		if r.StatusCode != 200 || !response.DryRun || response.Type != "subscriber" {
+			t.Fatalf("Expected dry-run subscriber result, but got %d %+v", r.StatusCode, response)
+		}
+		if response.InboxURL != "https://spam.example.com/inbox" || response.Activity == nil || response.Activity.Type != "Reject" {
+			t.Fatalf("Expected preview of Reject to inbox, but got %+v", response)
+		}
+		if RelayState.SelectSubscriber("spam.example.com") == nil {
+			t.Fatal("Expected dry-run to keep subscriber, but it was removed")
+		}
+	}
+
+	r, _ := http.Post(s.URL+"?dryRun=true", "application/json", strings.NewReader(`{"domain":"unknown.example.com"}`))
+	var response map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if r.StatusCode != 404 || response["dryRun"] != true {
+		t.Fatalf("Expected 404 dry-run result for unknown domain, but got %d %v", r.StatusCode, response)
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{"domain":"spam.example.com"}`))
+	response = map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if r.StatusCode != 200 || response["dryRun"] != nil || response["type"] != "subscriber" {
+		t.Fatalf("Expected subscriber to be unfollowed, but got %d %v", r.StatusCode, response)
+	}
+	if RelayState.SelectSubscriber("spam.example.com") != nil {
+		t.Fatal("Expected subscriber to be removed, but it remains")
+	}
+}
+
+func TestHandleAdminBulkUnfollow(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminBulkUnfollow))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "a.example.com",
+		InboxURL:   "https://a.example.com/inbox",
+		ActivityID: "https://a.example.com/follow/1",
+		ActorID:    "https://a.example.com/actor",
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:     "b.example.com",
+		InboxURL:   "https://b.example.com/inbox",
+		ActivityID: "https://b.example.com/follow/1",
+		ActorID:    "https://b.example.com/actor",
+	})
+
+	body := `{"domains":["a.example.com","unknown.example.com","","b.example.com"],"reason":"spam wave"}`
+	r, err := http.Post(s.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected status 200, but got %d", r.StatusCode)
+	}
+	var response struct {
+		Results []adminBulkUnfollowResult `json:"results"`
+	}
+	json.NewDecoder(r.Body).Decode(&response)
+	if len(response.Results) != 4 {
+		t.Fatalf("Expected 4 results, but got %d", len(response.Results))
+	}
+	expected := []struct {
+		domain  string
+		success bool
+		kind    string
+	}{
+		{"a.example.com", true, "subscriber"},
+		{"unknown.example.com", false, ""},
+		{"", false, ""},
+		{"b.example.com", true, "follower"},
+	}
+	for i, want := range expected {
+		got := response.Results[i]
+		if got.Domain != want.domain || got.Success != want.success || got.Type != want.kind {
+			t.Errorf("Expected result %d to be %+v, but got %+v", i, want, got)
+		}
+		if !want.success && got.Error == "" {
+			t.Errorf("Expected result %d to carry an error, but got none", i)
+		}
+	}
+	if RelayState.SelectSubscriber("a.example.com") != nil || RelayState.SelectFollower("b.example.com") != nil {
+		t.Fatal("Expected known domains to be removed despite failures in between")
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{"domains":[]}`))
+	r.Body.Close()
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected status 400 for empty domains, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleAdminValidateState(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminValidateState))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.RedisClient.HSet(context.TODO(), "relay:subscription:orphan.example.com", "activity_id", "https://orphan.example.com/follow")
+
+	r, err := http.Get(s.URL + "?repair=true")
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	r.Body.Close()
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected repair over GET to be 405, but got %d", r.StatusCode)
+	}
+
+	r, err = http.Post(s.URL+"?repair=true", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var result adminValidateStateResult
+	json.NewDecoder(r.Body).Decode(&result)
+	r.Body.Close()
+	if len(result.Anomalies) != 1 || !result.Anomalies[0].Orphaned || result.Repaired != 1 {
+		t.Fatalf("Expected 1 orphaned entry repaired, but got %+v", result)
+	}
+	if exists, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:subscription:orphan.example.com").Result(); exists != 0 {
+		t.Fatal("Expected orphaned subscription to be removed, but it remains")
+	}
+}
+
+func TestHandleFollowersSynchronizationDisabled(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleFollowersSynchronization))
+	defer s.Close()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 404 {
+		t.Fatalf("Expected 404 while collection synchronization is disabled, but got %d", r.StatusCode)
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds Redis ping on health probes
+const healthCheckTimeout = 2 * time.Second
+
+func isRedisReachable(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	return RelayState.RedisClient.Ping(ctx).Err() == nil
+}
+
+func isActorKeyLoaded() bool {
+	return GlobalConfig != nil && GlobalConfig.ActorKey() != nil && RelayActor().PublicKey.PublicKeyPem != ""
+}
+
+func writeHealth(writer http.ResponseWriter, statusCode int, body map[string]string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(statusCode)
+	json.NewEncoder(writer).Encode(body)
+}
+
+// handleHealthz reports liveness, failing when Redis is unreachable
+func handleHealthz(writer http.ResponseWriter, request *http.Request) {
+	if !isRedisReachable(request.Context()) {
+		writeHealth(writer, 503, map[string]string{"redis": "down"})
+		return
+	}
+	writeHealth(writer, 200, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports readiness, additionally requiring the relay actor keypair
+func handleReadyz(writer http.ResponseWriter, request *http.Request) {
+	if !isRedisReachable(request.Context()) {
+		writeHealth(writer, 503, map[string]string{"redis": "down"})
+		return
+	}
+	if !isActorKeyLoaded() {
+		writeHealth(writer, 503, map[string]string{"keypair": "missing"})
+		return
+	}
+	writeHealth(writer, 200, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleHealthz))
+	defer s.Close()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != 200 || string(data) != `{"status":"ok"}`+"\n" {
+		t.Fatalf("Expected 200 with status ok, but got %d %s", r.StatusCode, data)
+	}
+
+	defer func(client *redis.Client) { RelayState.RedisClient = client }(RelayState.RedisClient)
+	RelayState.RedisClient = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+
+	r, err = http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	data, _ = io.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != 503 || string(data) != `{"redis":"down"}`+"\n" {
+		t.Fatalf("Expected 503 with redis down, but got %d %s", r.StatusCode, data)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleReadyz))
+	defer s.Close()
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	r.Body.Close()
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+
+	defer setRelayActor(RelayActor())
+	setRelayActor(models.Actor{})
+
+	r, err = http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != 503 || string(data) != `{"keypair":"missing"}`+"\n" {
+		t.Fatalf("Expected 503 with keypair missing, but got %d %s", r.StatusCode, data)
+	}
+}
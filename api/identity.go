@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// relayActorForHost returns the relay actor served on host, the main actor for unknown hosts
+func relayActorForHost(host string) models.Actor {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if actor, found := RelayIdentityActors[strings.ToLower(host)]; found {
+		return actor
+	}
+	return RelayActor()
+}
+
+// relayActorByID returns the main or additional relay actor with actorID
+func relayActorByID(actorID string) (models.Actor, bool) {
+	if actorID == RelayActor().ID {
+		return RelayActor(), true
+	}
+	if parsed, err := url.Parse(actorID); err == nil {
+		if actor, found := RelayIdentityActors[parsed.Host]; found && actor.ID == actorID {
+			return actor, true
+		}
+	}
+	return models.Actor{}, false
+}
+
+// relayActors returns the main relay actor followed by the additional identities
+func relayActors() []models.Actor {
+	actors := []models.Actor{RelayActor()}
+	for _, actor := range RelayIdentityActors {
+		actors = append(actors, actor)
+	}
+	return actors
+}
+
+// identityActorID returns the ID recorded on subscriptions following relayActor, empty for the main relay actor
+func identityActorID(relayActor models.Actor) string {
+	if relayActor.ID == RelayActor().ID {
+		return ""
+	}
+	return relayActor.ID
+}
+
+// subscriptionRelayActor returns the relay actor a subscription recorded with identityID follows
+func subscriptionRelayActor(identityID string) models.Actor {
+	if actor, found := relayActorByID(identityID); found {
+		return actor
+	}
+	return RelayActor()
+}
+
+// hasIdentitySubscriptions reports whether any subscriber or follower follows the identity identityID
+func hasIdentitySubscriptions(identityID string) bool {
+	for _, subscription := range RelayState.SubscribersAndFollowers {
+		if subscription.RelayActor == identityID {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyIdentity returns the identity ID of an activity sent by one of our relay actors, and whether body is one.
+// Activities of our actors only go to the subscriptions of that actor, relayed activities of others go to every subscription.
+func bodyIdentity(body []byte) (string, bool) {
+	var activity struct {
+		Actor string `json:"actor"`
+	}
+	if json.Unmarshal(body, &activity) != nil {
+		return "", false
+	}
+	actor, found := relayActorByID(activity.Actor)
+	if !found {
+		return "", false
+	}
+	return identityActorID(actor), true
+}
+
+// relayAnnounces returns an Announce of objectID by the main relay actor and by each identity followed by anyone
+func relayAnnounces(objectID string) [][]byte {
+	var announces [][]byte
+	for _, relayActor := range relayActors() {
+		if identityID := identityActorID(relayActor); identityID != "" && !hasIdentitySubscriptions(identityID) {
+			continue
+		}
+		announce := models.NewActivityPubActivity(relayActor, []string{relayActor.Followers()}, objectID, "Announce")
+		jsonData, _ := json.Marshal(&announce)
+		announces = append(announces, jsonData)
+	}
+	return announces
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// withRelayIdentity serves relay.example.net as an additional relay identity for the test
+func withRelayIdentity(t *testing.T) models.Actor {
+	viper.Set("RELAY_IDENTITIES", "relay.example.net=../misc/test/testKey.pem")
+	defer viper.Set("RELAY_IDENTITIES", "")
+	config, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityActor := models.NewActivityPubActorFromRelayIdentity(config, config.RelayIdentities()[0])
+
+	actors, resources := RelayIdentityActors, WebfingerResources
+	t.Cleanup(func() { RelayIdentityActors, WebfingerResources = actors, resources })
+	RelayIdentityActors = map[string]models.Actor{"relay.example.net": identityActor}
+	WebfingerResources = append(append([]models.WebfingerResource{}, resources...), identityActor.GenerateWebfingerResource(&url.URL{Scheme: "https", Host: "relay.example.net"}))
+	return identityActor
+}
+
+func TestRelayActorForHost(t *testing.T) {
+	identityActor := withRelayIdentity(t)
+
+	if actor := relayActorForHost("Relay.Example.Net:443"); actor.ID != "https://relay.example.net/actor" || actor.PublicKey.Owner != actor.ID {
+		t.Fatalf("Expected identity actor for its host, but got %s", actor.ID)
+	}
+	if actor := relayActorForHost("unknown.example.com"); actor.ID != RelayActor().ID {
+		t.Fatalf("Expected main actor for unknown host, but got %s", actor.ID)
+	}
+	if actor, found := relayActorByID(identityActor.ID); !found || actor.ID != identityActor.ID {
+		t.Fatalf("Expected identity actor to be found by ID, but got %s", actor.ID)
+	}
+	if _, found := relayActorByID("https://relay.example.net/users/relay"); found {
+		t.Fatal("Expected other actors on the identity host not to match")
+	}
+}
+
+func TestHandleRelayActorByHost(t *testing.T) {
+	withRelayIdentity(t)
+	s := httptest.NewServer(http.HandlerFunc(handleRelayActor))
+	defer s.Close()
+
+	for host, expected := range map[string]string{
+		"relay.example.net":                "https://relay.example.net/actor",
+		GlobalConfig.ServerHostname().Host: RelayActor().ID,
+	} {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		req.Host = host
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var actor models.Actor
+		json.NewDecoder(r.Body).Decode(&actor)
+		r.Body.Close()
+		if actor.ID != expected || actor.Inbox != expected[:len(expected)-len("/actor")]+"/inbox" {
+			t.Fatalf("Expected actor %s for host %s, but got %s", expected, host, actor.ID)
+		}
+	}
+}
+
+func TestHandleWebfingerIdentity(t *testing.T) {
+	withRelayIdentity(t)
+	s := httptest.NewServer(http.HandlerFunc(handleWebfinger))
+	defer s.Close()
+
+	r, err := http.Get(s.URL + "?resource=acct:relay@relay.example.net")
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	var webfinger models.WebfingerResource
+	json.NewDecoder(r.Body).Decode(&webfinger)
+	if r.StatusCode != 200 || webfinger.Links[0].Href != "https://relay.example.net/actor" {
+		t.Fatalf("Expected webfinger of the identity actor, but got %d %+v", r.StatusCode, webfinger)
+	}
+}
+
+func TestHandleInboxFollowIdentity(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	identityActor := withRelayIdentity(t)
+
+	activity := mockActivity("Follow-LP")
+	activity.Object = identityActor.ID
+	activity.To = []string{identityActor.ID}
+	actor := mockActor("Person")
+	actor.ID = activity.Actor
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	req.Host = GlobalConfig.ServerHostname().Host
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	r.Body.Close()
+	if res, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:follower:"+domain.Host).Result(); res != 0 {
+		t.Fatal("Expected follow of the identity actor not to be accepted on the main host")
+	}
+
+	// A new activity ID keeps inbox deduplication out of the way
+	activity.ID += "-identity"
+	req, _ = http.NewRequest("POST", s.URL, nil)
+	req.Host = "relay.example.net"
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	r.Body.Close()
+	if res, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:follower:"+domain.Host).Result(); res != 1 {
+		t.Fatal("Expected follow of the identity actor to be accepted on its host")
+	}
+	if follower := RelayState.SelectFollower(domain.Host); follower == nil || follower.RelayActor != identityActor.ID {
+		t.Fatalf("Expected follower to record the identity actor, but got %+v", follower)
+	}
+}
+
+func TestAnnounceByIdentity(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	identityActor := withRelayIdentity(t)
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "main.example.com",
+		InboxURL: "https://main.example.com/inbox",
+		ActorID:  "https://main.example.com/actor",
+	})
+	announces := relayAnnounces("https://origin.example.com/notes/1")
+	if len(announces) != 1 {
+		t.Fatalf("Expected only the main actor to announce without identity subscriptions, but got %d", len(announces))
+	}
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "vanity.example.com",
+		InboxURL:   "https://vanity.example.com/inbox",
+		ActorID:    "https://vanity.example.com/actor",
+		RelayActor: identityActor.ID,
+	})
+	announces = relayAnnounces("https://origin.example.com/notes/1")
+	if len(announces) != 2 {
+		t.Fatalf("Expected main and identity actor to announce, but got %d", len(announces))
+	}
+	for i, expected := range []string{RelayActor().ID, identityActor.ID} {
+		var announce models.Activity
+		json.Unmarshal(announces[i], &announce)
+		if announce.Actor != expected || announce.Type != "Announce" {
+			t.Fatalf("Expected Announce by %s, but got %s by %s", expected, announce.Type, announce.Actor)
+		}
+
+		enqueueActivityForAll("origin.example.com", announces[i])
+		keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result()
+		if len(keys) != 1 {
+			t.Fatalf("Expected 1 queued activity, but got %d", len(keys))
+		}
+		if remain, _ := RelayState.RedisClient.HGet(context.TODO(), keys[0], "remain_count").Result(); remain != "1" {
+			t.Fatalf("Expected Announce by %s to reach only its subscriber, but got %s deliveries", expected, remain)
+		}
+		RelayState.RedisClient.Del(context.TODO(), keys[0])
+	}
+}
+
+func TestHandleFollowersByIdentity(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	identityActor := withRelayIdentity(t)
+	s := httptest.NewServer(http.HandlerFunc(handleFollowers))
+	defer s.Close()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "main.example.com",
+		InboxURL: "https://main.example.com/inbox",
+		ActorID:  "https://main.example.com/actor",
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:     "vanity.example.com",
+		InboxURL:   "https://vanity.example.com/inbox",
+		ActorID:    "https://vanity.example.com/actor",
+		RelayActor: identityActor.ID,
+	})
+
+	for host, expected := range map[string]string{
+		"relay.example.net":                "https://vanity.example.com/actor",
+		GlobalConfig.ServerHostname().Host: "https://main.example.com/actor",
+	} {
+		req, _ := http.NewRequest("GET", s.URL+"?page=1", nil)
+		req.Host = host
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var page models.OrderedCollection
+		json.NewDecoder(r.Body).Decode(&page)
+		r.Body.Close()
+		if len(page.OrderedItems) != 1 || page.OrderedItems[0] != expected {
+			t.Fatalf("Expected followers of host %s to be [%s], but got %v", host, expected, page.OrderedItems)
+		}
+	}
+}
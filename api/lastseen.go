@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+const lastSeenKey = "relay:last_seen"
+
+// recordLastSeen stores when host last delivered an activity to our inbox, by our own clock
+func recordLastSeen(ctx context.Context, host string, receivedAt time.Time) {
+	err := RelayState.RedisClient.HSet(ctx, models.RedisKey(lastSeenKey), host, receivedAt.Unix()).Err()
+	if err != nil {
+		logger.WithField("domain", host).WithError(err).Error("Failed to record last seen")
+	}
+}
+
+// lastSeenTimes returns the last-seen unix time by host
+func lastSeenTimes() map[string]int64 {
+	values, _ := RelayState.RedisClient.HGetAll(context.TODO(), models.RedisKey(lastSeenKey)).Result()
+	lastSeen := make(map[string]int64, len(values))
+	for host, value := range values {
+		if seen, err := strconv.ParseInt(value, 10, 64); err == nil {
+			lastSeen[host] = seen
+		}
+	}
+	return lastSeen
+}
+
+// handleAdminUnfollowInactive unfollows subscribers and followers that sent nothing for days.
+// Instances never seen since joining count from joined_at, ones without either are skipped.
+// POST /api/admin/unfollow/inactive[?dryRun=true]
+// Body: {"days": 30, "dryRun": false}
+// Response: {"results": [{"domain": "a.example", "success": true, "type": "subscriber"}, ...], "skipped": ["b.example"]}
+func handleAdminUnfollowInactive(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	var req struct {
+		Days   int  `json:"days"`
+		DryRun bool `json:"dryRun"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+		return
+	}
+	if dryRun, err := strconv.ParseBool(request.URL.Query().Get("dryRun")); err == nil && dryRun {
+		req.DryRun = true
+	}
+	if req.Days < 1 {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "days must be a positive integer"})
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -req.Days).Unix()
+	lastSeen := lastSeenTimes()
+	var inactive []string
+	skipped := []string{}
+	for _, subscription := range RelayState.SubscribersAndFollowers {
+		seen := max(lastSeen[subscription.Domain], subscription.JoinedAt)
+		if seen == 0 {
+			skipped = append(skipped, subscription.Domain)
+		} else if seen < cutoff {
+			inactive = append(inactive, subscription.Domain)
+		}
+	}
+	sort.Strings(inactive)
+	sort.Strings(skipped)
+
+	reason := "inactive for " + strconv.Itoa(req.Days) + " days"
+	logger.WithFields(logrus.Fields{"count": len(inactive), "days": req.Days, "dry_run": req.DryRun}).Info("Admin unfollow inactive")
+	results := make([]adminBulkUnfollowResult, 0, len(inactive))
+	for _, domain := range inactive {
+		result := adminBulkUnfollowResult{Domain: domain, adminUnfollowResult: executeAdminUnfollow(domain, req.DryRun)}
+		if result.Success && !req.DryRun {
+			RelayState.RedisClient.HDel(context.TODO(), models.RedisKey(lastSeenKey), domain)
+			recordAdminAction(request, "unfollow", domain, reason)
+		}
+		results = append(results, result)
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string]interface{}{"results": results, "skipped": skipped})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleInboxRecordsLastSeen(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	activity := mockActivity("Create")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(activity.Actor)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+	}))
+	defer s.Close()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://" + domain.Host + "/inbox",
+	})
+
+	before := time.Now().Unix()
+	r, err := http.Post(s.URL, "application/activity+json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	r.Body.Close()
+
+	seen := lastSeenTimes()[domain.Host]
+	if seen < before || seen > time.Now().Unix() {
+		t.Fatalf("Expected last_seen to be the receipt time, but got %d", seen)
+	}
+}
+
+func TestHandleAdminUnfollowInactive(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminUnfollowInactive))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	now := time.Now()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "stale.example.com",
+		InboxURL: "https://stale.example.com/inbox",
+		JoinedAt: now.AddDate(-1, 0, 0).Unix(),
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:   "active.example.com",
+		InboxURL: "https://active.example.com/inbox",
+		JoinedAt: now.AddDate(-1, 0, 0).Unix(),
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "unknown.example.com",
+		InboxURL: "https://unknown.example.com/inbox",
+	})
+	recordLastSeen(context.TODO(), "stale.example.com", now.AddDate(0, 0, -60))
+	recordLastSeen(context.TODO(), "active.example.com", now.AddDate(0, 0, -1))
+
+	r, err := http.Post(s.URL, "application/json", strings.NewReader(`{"days":30}`))
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	var response struct {
+		Results []adminBulkUnfollowResult `json:"results"`
+		Skipped []string                  `json:"skipped"`
+	}
+	json.NewDecoder(r.Body).Decode(&response)
+	if len(response.Results) != 1 || response.Results[0].Domain != "stale.example.com" || !response.Results[0].Success {
+		t.Fatalf("Expected only stale.example.com to be unfollowed, but got %+v", response.Results)
+	}
+	if len(response.Skipped) != 1 || response.Skipped[0] != "unknown.example.com" {
+		t.Fatalf("Expected unknown.example.com to be skipped, but got %v", response.Skipped)
+	}
+	if RelayState.SelectSubscriber("stale.example.com") != nil || RelayState.SelectFollower("active.example.com") == nil {
+		t.Fatal("Expected only the stale subscriber to be removed")
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{"days":0}`))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400, but got %d", r.StatusCode)
+	}
+}
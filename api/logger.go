@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// logger tags API Server log entries with their component
+var logger = logrus.WithField("component", "api")
+
+// activityLogger returns logger with the domain, actor and id of an inbox activity as fields
+func activityLogger(activity *models.Activity) *logrus.Entry {
+	fields := logrus.Fields{"actor": activity.Actor, "activity_id": activity.ID}
+	if actorID, err := url.Parse(activity.Actor); err == nil {
+		fields["domain"] = actorID.Host
+	}
+	return logger.WithFields(fields)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestActivityLoggerFields(t *testing.T) {
+	activity := models.Activity{
+		ID:    "https://innocent.yukimochi.io/activities/1",
+		Actor: "https://innocent.yukimochi.io/users/YUKIMOCHI",
+	}
+	entry := activityLogger(&activity)
+	for field, expected := range map[string]string{
+		"component":   "api",
+		"domain":      "innocent.yukimochi.io",
+		"actor":       activity.Actor,
+		"activity_id": activity.ID,
+	} {
+		if entry.Data[field] != expected {
+			t.Errorf("Expected field %s to be %s, but got %v", field, expected, entry.Data[field])
+		}
+	}
+}
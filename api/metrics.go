@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yukimochi/Activity-Relay/delaymetrics"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// metricsLabelEscaper escapes label values for Prometheus text exposition format
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetric writes a single metric family in Prometheus text exposition format
+func writeMetric(buffer *bytes.Buffer, name string, metricType string, help string, samples map[string]float64) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buffer, "# TYPE %s %s\n", name, metricType)
+
+	labels := make([]string, 0, len(samples))
+	for label := range samples {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		if label == "" {
+			fmt.Fprintf(buffer, "%s %v\n", name, samples[label])
+		} else {
+			fmt.Fprintf(buffer, "%s{%s} %v\n", name, label, samples[label])
+		}
+	}
+}
+
+// metricsLabel builds a label pair with escaped value
+func metricsLabel(name string, value string) string {
+	return name + `="` + metricsLabelEscaper.Replace(value) + `"`
+}
+
+// handleMetrics exposes relay counters in Prometheus text exposition format
+func handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+
+	var buffer bytes.Buffer
+
+	current := getCurrentDeliveryStats()
+	writeMetric(&buffer, "relay_inbox_total", "counter", "Total activities received on inbox.", map[string]float64{"": float64(current.Inbox)})
+	writeMetric(&buffer, "relay_outbox_total", "counter", "Total activities delivered to subscribers.", map[string]float64{"": float64(current.Outbox)})
+	writeMetric(&buffer, "relay_outbox_failures_total", "counter", "Total failed deliveries to subscribers.", map[string]float64{"": float64(current.Failures)})
+
+	dropped, _ := RelayState.RedisClient.Get(context.TODO(), models.RedisKey("relay:stats:outbox:dropped:total")).Int64()
+	writeMetric(&buffer, "relay_outbox_dropped_total", "counter", "Total deliveries dropped after exhausting retries.", map[string]float64{"": float64(dropped)})
+
+	shortCircuited, _ := RelayState.RedisClient.Get(context.TODO(), models.RedisKey("relay:stats:outbox:short_circuited:total")).Int64()
+	writeMetric(&buffer, "relay_outbox_short_circuited_total", "counter", "Total deliveries skipped while the destination circuit was open.", map[string]float64{"": float64(shortCircuited)})
+
+	sharedInboxSaved, _ := RelayState.RedisClient.Get(context.TODO(), models.RedisKey("relay:stats:outbox:shared_inbox_saved:total")).Int64()
+	writeMetric(&buffer, "relay_outbox_shared_inbox_saved_total", "counter", "Total deliveries saved by sending once to inboxes shared by several subscriptions.", map[string]float64{"": float64(sharedInboxSaved)})
+
+	heldDropped := map[string]float64{}
+	for _, heldBuffer := range heldBuffers {
+		heldDropped[metricsLabel("buffer", heldBuffer)] = float64(heldDroppedCount(heldBuffer))
+	}
+	writeMetric(&buffer, "relay_held_dropped_total", "counter", "Total activities dropped from a full buffer awaiting delivery.", heldDropped)
+
+	queueDepth, _ := RelayState.RedisClient.LLen(context.TODO(), models.RedisKey(models.MachineryQueue)).Result()
+	writeMetric(&buffer, "relay_delivery_queue_depth", "gauge", "Delivery tasks waiting in queue.", map[string]float64{"": float64(queueDepth)})
+	retryDepth, _ := RelayState.RedisClient.ZCard(context.TODO(), models.RedisKey(models.RetryQueue)).Result()
+	writeMetric(&buffer, "relay_delivery_retry_queue_depth", "gauge", "Failed deliveries waiting for retry.", map[string]float64{"": float64(retryDepth)})
+	writeMetric(&buffer, "relay_delivery_delayed_queue_depth", "gauge", "Deliveries held until their delay elapses.", map[string]float64{"": float64(delayedDeliveryCount())})
+
+	var announceFetchAttempts, announceFetchSuccesses float64
+	announceFetchFailures := map[string]float64{}
+	announceFetchHosts := map[string]float64{}
+	for _, result := range announceFetchResults {
+		if result != "success" {
+			announceFetchFailures[metricsLabel("reason", result)] = 0
+		}
+		counts, _ := RelayState.RedisClient.HGetAll(context.TODO(), models.RedisKey("relay:stats:announce_fetch:")+result).Result()
+		for host, value := range counts {
+			count, _ := strconv.ParseFloat(value, 64)
+			announceFetchAttempts += count
+			if result == "success" {
+				announceFetchSuccesses += count
+			} else {
+				announceFetchFailures[metricsLabel("reason", result)] += count
+			}
+			announceFetchHosts[metricsLabel("host", host)+","+metricsLabel("result", result)] = count
+		}
+	}
+	writeMetric(&buffer, "relay_announce_fetch_attempts_total", "counter", "Total fetches of announced objects.", map[string]float64{"": announceFetchAttempts})
+	writeMetric(&buffer, "relay_announce_fetch_successes_total", "counter", "Total announced objects fetched successfully.", map[string]float64{"": announceFetchSuccesses})
+	writeMetric(&buffer, "relay_announce_fetch_failures_total", "counter", "Total failed fetches of announced objects by reason.", announceFetchFailures)
+	writeMetric(&buffer, "relay_announce_fetch_host_total", "counter", "Total fetches of announced objects by host of the object and result.", announceFetchHosts)
+
+	writeMetric(&buffer, "relay_redis_errors_total", "counter", "Total failed Redis operations of the API server.", map[string]float64{"": float64(models.RedisErrorCount())})
+
+	delays := map[string]float64{}
+	for _, instance := range delaymetrics.GetDelayMetrics(1, GlobalConfig.ServerHostname().Host).Summary {
+		delays[metricsLabel("instance", instance.Host)] = instance.AvgDelaySeconds
+	}
+	writeMetric(&buffer, "relay_federation_delay_seconds", "gauge", "Average federation delay per instance over the last hour.", delays)
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer.WriteHeader(200)
+	writer.Write(buffer.Bytes())
+}
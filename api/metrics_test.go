@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleMetrics))
+	defer s.Close()
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:inbox:total", 42, 0)
+	RelayState.RedisClient.RPush(context.TODO(), models.MachineryQueue, "task1", "task2")
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Expected Prometheus text content type, but got '%s'", ct)
+	}
+	data, _ := io.ReadAll(r.Body)
+	if !strings.Contains(string(data), "relay_inbox_total 42\n") {
+		t.Fatalf("Expected relay_inbox_total 42 in output, but got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "relay_delivery_queue_depth 2\n") {
+		t.Fatalf("Expected relay_delivery_queue_depth 2 in output, but got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "# TYPE relay_redis_errors_total counter") {
+		t.Fatalf("Expected relay_redis_errors_total metric family, but got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "# TYPE relay_federation_delay_seconds gauge") {
+		t.Fatalf("Expected relay_federation_delay_seconds metric family, but got:\n%s", data)
+	}
+}
+
+func TestMetricsLabel(t *testing.T) {
+	label := metricsLabel("instance", "a\"b\\c")
+	if label != `instance="a\"b\\c"` {
+		t.Fatalf("Expected escaped label, but got '%s'", label)
+	}
+}
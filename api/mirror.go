@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// mirrorInFlight bounds concurrent copies, further activities are dropped while the sink is slow
+var mirrorInFlight = make(chan struct{}, 16)
+
+// MirrorConfig : Copies of relayed activities posted to an internal endpoint.
+type MirrorConfig struct {
+	// URL : Endpoint receiving the copies. Empty disables mirroring.
+	URL string
+	// Types : Mirrored activity types. Empty means all.
+	Types []string
+	// SampleRate : Fraction of activities mirrored.
+	SampleRate float64
+}
+
+// mirrorEnvelope is the body posted to MirrorConfig.URL
+type mirrorEnvelope struct {
+	ReceivedAt   time.Time       `json:"received_at"`
+	ActorHost    string          `json:"actor_host"`
+	ActivityType string          `json:"activity_type"`
+	Activity     json.RawMessage `json:"activity"`
+}
+
+// accepts : Whether an activity of activityType is picked for mirroring.
+func (mirror *MirrorConfig) accepts(activityType string) bool {
+	if mirror.URL == "" || (len(mirror.Types) > 0 && !contains(mirror.Types, activityType)) {
+		return false
+	}
+	return mirror.SampleRate >= 1 || rand.Float64() < mirror.SampleRate
+}
+
+// mirrorActivity posts a copy of a relayed activity to InboxMirror in the background.
+// Failures are only logged, the relay never waits for the sink.
+func mirrorActivity(activity *models.Activity, actorHost string, body []byte, receivedAt time.Time) {
+	if !InboxMirror.accepts(activity.Type) {
+		return
+	}
+	select {
+	case mirrorInFlight <- struct{}{}:
+	default:
+		activityLogger(activity).Debug("Dropped Mirror Activity (Sink Busy)")
+		return
+	}
+
+	envelope, err := json.Marshal(mirrorEnvelope{
+		ReceivedAt:   receivedAt.UTC(),
+		ActorHost:    actorHost,
+		ActivityType: activity.Type,
+		Activity:     body,
+	})
+	if err != nil {
+		<-mirrorInFlight
+		return
+	}
+	go func() {
+		defer func() { <-mirrorInFlight }()
+		req, err := http.NewRequest("POST", InboxMirror.URL, bytes.NewReader(envelope))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", GlobalConfig.UserAgent(version))
+		resp, err := models.HTTPClient.Do(req)
+		if err != nil {
+			activityLogger(activity).WithError(err).Debug("Failed Mirror Activity")
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			activityLogger(activity).WithField("status", resp.StatusCode).Debug("Failed Mirror Activity")
+		}
+	}()
+}
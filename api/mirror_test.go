@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleInboxMirror(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	mirrored := make(chan mirrorEnvelope, 4)
+	release := make(chan struct{})
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var envelope mirrorEnvelope
+		json.NewDecoder(r.Body).Decode(&envelope)
+		mirrored <- envelope
+		<-release
+		w.WriteHeader(500)
+	}))
+	defer sink.Close()
+	defer close(release)
+
+	mirror := InboxMirror
+	InboxMirror = MirrorConfig{URL: sink.URL, Types: []string{"Create"}, SampleRate: 1}
+	defer func() { InboxMirror = mirror }()
+
+	create := mockActivity("Create")
+	like := mockActivity("Create")
+	like.Type = "Like"
+	actor := mockActor("Person")
+	domain, _ := url.Parse(create.Actor)
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   domain.Host,
+		InboxURL: "https://mastodon.test.yukimochi.io/inbox",
+	})
+	RelayState.SetConfig(RelayReactions, true)
+
+	for _, activity := range []models.Activity{create, like} {
+		activity := activity
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleInbox(w, r, mockActivityDecoderProvider(&activity, &actor))
+		}))
+		body, _ := json.Marshal(&activity)
+		startedAt := time.Now()
+		r, err := http.Post(s.URL, "application/activity+json", bytes.NewReader(body))
+		s.Close()
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 202 {
+			t.Fatalf("Expected StatusCode to be 202 for %s, but got %d", activity.Type, r.StatusCode)
+		}
+		if elapsed := time.Since(startedAt); elapsed > time.Second {
+			t.Fatalf("Expected inbox not to wait for the mirror sink, but took %s", elapsed)
+		}
+	}
+
+	select {
+	case envelope := <-mirrored:
+		if envelope.ActivityType != "Create" || envelope.ActorHost != domain.Host || envelope.ReceivedAt.IsZero() {
+			t.Fatalf("Expected mirrored Create of %s, but got %+v", domain.Host, envelope)
+		}
+		var activity models.Activity
+		if json.Unmarshal(envelope.Activity, &activity) != nil || activity.ID != create.ID {
+			t.Fatalf("Expected raw activity %s in the mirror, but got %s", create.ID, envelope.Activity)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Create to be mirrored")
+	}
+	select {
+	case envelope := <-mirrored:
+		t.Fatalf("Expected only Create to be mirrored, but got %+v", envelope)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// replayLockTTL bounds how long a replay interrupted by a crash keeps others from replaying, it is extended per activity
+const replayLockTTL = time.Minute
+
+// Buffers activities are held in before delivery, dropping the oldest when full
+const (
+	heldBufferPaused = "paused"
+	heldBufferBatch  = "batch"
+)
+
+// heldBuffers lists the buffers exposed in the held activity drop metric
+var heldBuffers = []string{heldBufferPaused, heldBufferBatch}
+
+// Audiences of a held activity, selecting the enqueue function it is replayed with
+const (
+	audienceAll        = "all"
+	audienceSubscriber = "subscriber"
+	audienceFollower   = "follower"
+)
+
+// heldActivity : Fan-out delivery postponed while the relay is paused.
+type heldActivity struct {
+	Audience     string          `json:"audience"`
+	SourceDomain string          `json:"source_domain"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// holdWhilePaused keeps body for replay when the relay is paused, returning false when it should be delivered now
+func holdWhilePaused(audience string, sourceDomain string, body []byte) bool {
+	if !RelayState.Paused {
+		return false
+	}
+	data, err := json.Marshal(&heldActivity{audience, sourceDomain, body})
+	if err != nil {
+		// Bodies which are not JSON are never held, they go out as usual
+		return false
+	}
+	maxActivities := int64(GlobalConfig.PausedMaxActivities())
+	pipe := RelayState.RedisClient.TxPipeline()
+	length := pipe.RPush(context.TODO(), models.RedisKey("relay:paused:activities"), data)
+	pipe.LTrim(context.TODO(), models.RedisKey("relay:paused:activities"), -maxActivities, -1)
+	_, err = pipe.Exec(context.TODO())
+	if err != nil {
+		logger.WithError(err).Error("Failed to hold activity while paused")
+		return false
+	}
+	if dropped := length.Val() - maxActivities; dropped > 0 {
+		logger.WithField("dropped", dropped).Warn("Dropped oldest activity held while paused (PAUSED_MAX_ACTIVITIES reached)")
+		countHeldDropped(heldBufferPaused, dropped)
+	}
+	return true
+}
+
+// countHeldDropped counts activities dropped from a full buffer for the metrics endpoint
+func countHeldDropped(buffer string, dropped int64) {
+	RelayState.RedisClient.IncrBy(context.TODO(), models.RedisKey("relay:stats:held_dropped:")+buffer, dropped)
+}
+
+// heldDroppedCount returns the number of activities dropped from a full buffer
+func heldDroppedCount(buffer string) int64 {
+	count, _ := RelayState.RedisClient.Get(context.TODO(), models.RedisKey("relay:stats:held_dropped:")+buffer).Int64()
+	return count
+}
+
+// heldActivityCount returns the number of activities waiting for the relay to resume
+func heldActivityCount() int64 {
+	count, _ := RelayState.RedisClient.LLen(context.TODO(), models.RedisKey("relay:paused:activities")).Result()
+	return count
+}
+
+// replayHeldActivities delivers the activities held while paused in the order they arrived, returning how many were replayed.
+// Each activity leaves the buffer only once it is queued, so a replay interrupted by a crash resumes with the rest.
+// A lock keeps API servers resuming at the same time from replaying an activity twice, replay stops when paused again.
+func replayHeldActivities() int {
+	lock := models.RedisKey("relay:paused:replaying")
+	acquired, err := RelayState.RedisClient.SetNX(context.TODO(), lock, 1, replayLockTTL).Result()
+	if err != nil || !acquired {
+		return 0
+	}
+	defer RelayState.RedisClient.Del(context.TODO(), lock)
+
+	replayed := 0
+	for !RelayState.Paused {
+		item, err := RelayState.RedisClient.LIndex(context.TODO(), models.RedisKey("relay:paused:activities"), 0).Result()
+		if err != nil {
+			// The buffer is empty or unreadable, what is left stays for the next replay
+			break
+		}
+		var held heldActivity
+		if json.Unmarshal([]byte(item), &held) == nil {
+			switch held.Audience {
+			case audienceAll:
+				enqueueActivityForAll(held.SourceDomain, held.Body)
+				replayed++
+			case audienceSubscriber:
+				enqueueActivityForSubscriber(held.SourceDomain, held.Body)
+				replayed++
+			case audienceFollower:
+				enqueueActivityForFollower(held.SourceDomain, held.Body)
+				replayed++
+			}
+		}
+		RelayState.RedisClient.LPop(context.TODO(), models.RedisKey("relay:paused:activities"))
+		RelayState.RedisClient.Expire(context.TODO(), lock, replayLockTTL)
+	}
+	return replayed
+}
+
+// handleAdminPause pauses fan-out delivery for maintenance. Inbox keeps accepting activities, they are held and
+// delivered when the relay resumes.
+// GET /api/admin/pause
+// POST /api/admin/pause
+// Body: {"paused": true}
+// Response: {"paused": true, "held": 10, "replayed": 0}
+func handleAdminPause(writer http.ResponseWriter, request *http.Request) {
+	replayed := 0
+	switch request.Method {
+	case "GET":
+	case "POST":
+		var req struct {
+			Paused *bool `json:"paused"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.Paused == nil {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "paused required"})
+			return
+		}
+		RelayState.SetPaused(*req.Paused)
+		if *req.Paused {
+			logger.Info("Admin paused relay delivery")
+			recordAdminAction(request, "pause", "", "")
+		} else {
+			replayed = replayHeldActivities()
+			logger.WithField("replayed", replayed).Info("Admin resumed relay delivery")
+			recordAdminAction(request, "resume", "", "")
+		}
+	default:
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(struct {
+		Paused   bool  `json:"paused"`
+		Held     int64 `json:"held"`
+		Replayed int   `json:"replayed"`
+	}{RelayState.Paused, heldActivityCount(), replayed})
+}
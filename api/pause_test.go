@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleAdminPause(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "subscriber.example.com",
+		InboxURL: "https://subscriber.example.com/inbox",
+	})
+
+	s := httptest.NewServer(http.HandlerFunc(handleAdminPause))
+	defer s.Close()
+
+	type pauseResponse struct {
+		Paused   bool  `json:"paused"`
+		Held     int64 `json:"held"`
+		Replayed int   `json:"replayed"`
+	}
+
+	r, err := http.Post(s.URL, "application/json", strings.NewReader(`{"paused":true}`))
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var response pauseResponse
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if !response.Paused || !RelayState.Paused {
+		t.Fatal("Expected relay to be paused")
+	}
+
+	enqueueActivityForSubscriber("source.example.com", []byte(`{"id":"https://source.example.com/1"}`))
+	if keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result(); len(keys) != 0 {
+		t.Fatalf("Expected no delivery while paused, but got %d", len(keys))
+	}
+	if held := heldActivityCount(); held != 1 {
+		t.Fatalf("Expected 1 held activity, but got %d", held)
+	}
+
+	r, _ = http.Get(s.URL)
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if !response.Paused || response.Held != 1 {
+		t.Fatalf("Expected paused with 1 held activity, but got %+v", response)
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{"paused":false}`))
+	response = pauseResponse{}
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if response.Paused || RelayState.Paused || response.Replayed != 1 || response.Held != 0 {
+		t.Fatalf("Expected resume to replay 1 activity, but got %+v", response)
+	}
+	keys := waitRelayActivityKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("Expected one replayed delivery, but got %d", len(keys))
+	}
+	body, _ := RelayState.RedisClient.HGet(context.TODO(), keys[0], "body").Result()
+	if body != `{"id":"https://source.example.com/1"}` {
+		t.Fatalf("Expected held activity to be delivered as received, but got %s", body)
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{}`))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400, but got %d", r.StatusCode)
+	}
+
+	req, _ := http.NewRequest("PUT", s.URL, nil)
+	r, _ = http.DefaultClient.Do(req)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405, but got %d", r.StatusCode)
+	}
+}
+
+func TestHoldWhilePausedLimit(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+	defer func(config *models.RelayConfig) { GlobalConfig = config }(GlobalConfig)
+	viper.Set("PAUSED_MAX_ACTIVITIES", 2)
+	defer viper.Set("PAUSED_MAX_ACTIVITIES", nil)
+	GlobalConfig, _ = models.NewRelayConfig()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "subscriber.example.com",
+		InboxURL: "https://subscriber.example.com/inbox",
+	})
+	RelayState.SetPaused(true)
+	for _, id := range []string{"1", "2", "3"} {
+		enqueueActivityForSubscriber("source.example.com", []byte(`{"id":"https://source.example.com/`+id+`"}`))
+	}
+	if held := heldActivityCount(); held != 2 {
+		t.Fatalf("Expected 2 held activities, but got %d", held)
+	}
+	if dropped := heldDroppedCount(heldBufferPaused); dropped != 1 {
+		t.Fatalf("Expected 1 dropped activity to be counted, but got %d", dropped)
+	}
+
+	bufferBatchActivity("batch.example.com", []byte(`{"id":"https://source.example.com/4"}`))
+	if sent := flushBatchActivities(); sent != 0 {
+		t.Fatalf("Expected no batch delivery while paused, but got %d", sent)
+	}
+
+	RelayState.SetPaused(false)
+	RelayState.RedisClient.Set(context.TODO(), "relay:paused:replaying", 1, 0)
+	if replayed := replayHeldActivities(); replayed != 0 || heldActivityCount() != 2 {
+		t.Fatalf("Expected replay in progress elsewhere to keep the buffer, but got %d replayed", replayed)
+	}
+	RelayState.RedisClient.Del(context.TODO(), "relay:paused:replaying")
+	if replayed := replayHeldActivities(); replayed != 2 || heldActivityCount() != 0 {
+		t.Fatalf("Expected 2 activities to be replayed, but got %d", replayed)
+	}
+}
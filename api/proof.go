@@ -0,0 +1,45 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// actorProofCache holds the last signed relay actor document, reused while the unsigned document is unchanged
+var actorProofCache struct {
+	mu       sync.Mutex
+	unsigned []byte
+	signed   []byte
+}
+
+// relayActorDocument returns the JSON document of actor, with an integrity proof when actor is the main relay actor
+// and ACTOR_INTEGRITY_PROOF is enabled. Additional identities have no Ed25519 key and are served unsigned.
+func relayActorDocument(actor models.Actor) ([]byte, error) {
+	if !GlobalConfig.ActorIntegrityProof() || actor.ID != RelayActor().ID {
+		return json.Marshal(&actor)
+	}
+
+	contexts, _ := actor.Context.([]string)
+	actor.Context = append(append([]string{}, contexts...), models.IntegrityProofContext)
+	unsigned, err := json.Marshal(&actor)
+	if err != nil {
+		return nil, err
+	}
+
+	actorProofCache.mu.Lock()
+	defer actorProofCache.mu.Unlock()
+	if actorProofCache.signed != nil && bytes.Equal(actorProofCache.unsigned, unsigned) {
+		return actorProofCache.signed, nil
+	}
+	signed, err := models.AddIntegrityProof(unsigned, GlobalConfig.ActorEd25519KeyID(), GlobalConfig.ActorEd25519Key(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	actorProofCache.unsigned = unsigned
+	actorProofCache.signed = signed
+	return signed, nil
+}
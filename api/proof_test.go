@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleActorIntegrityProof(t *testing.T) {
+	defer func(config *models.RelayConfig, actor models.Actor) {
+		GlobalConfig = config
+		setRelayActor(actor)
+	}(GlobalConfig, RelayActor())
+	viper.Set("ACTOR_ED25519_PEM", "../misc/test/testEd25519Key.pem")
+	defer viper.Set("ACTOR_ED25519_PEM", "")
+	viper.Set("ACTOR_INTEGRITY_PROOF", true)
+	defer viper.Set("ACTOR_INTEGRITY_PROOF", false)
+	config, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	GlobalConfig = config
+	setRelayActor(models.NewActivityPubActorFromRelayConfig(config))
+
+	s := httptest.NewServer(http.HandlerFunc(handleRelayActor))
+	defer s.Close()
+
+	fetch := func() []byte {
+		r, err := http.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		body, _ := io.ReadAll(r.Body)
+		return body
+	}
+	body := fetch()
+
+	var actor models.Actor
+	json.Unmarshal(body, &actor)
+	key, found := actor.VerificationKeyByID(config.ActorEd25519KeyID())
+	if !found {
+		t.Fatalf("Expected Ed25519 key to be published, but got %s", body)
+	}
+	if err := models.VerifyIntegrityProof(body, key.Key.(ed25519.PublicKey)); err != nil {
+		t.Fatalf("Expected proof to verify with the relay public key, but got error: %v", err)
+	}
+	if !bytes.Equal(fetch(), body) {
+		t.Fatal("Expected signed actor document to be reused")
+	}
+
+	tampered := bytes.Replace(body, []byte(`"Service"`), []byte(`"Person"`), 1)
+	if err := models.VerifyIntegrityProof(tampered, key.Key.(ed25519.PublicKey)); err == nil {
+		t.Fatal("Expected tampered actor document to fail verification")
+	}
+}
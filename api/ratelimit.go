@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// RateLimitConfig : Token bucket for inbox activities per instance.
+type RateLimitConfig struct {
+	// Rate : Refilled tokens per second. Zero or less disables the limiter.
+	Rate float64
+	// Burst : Bucket capacity.
+	Burst int
+}
+
+// Enabled : Whether inbox rate limiting is active.
+func (config *RateLimitConfig) Enabled() bool {
+	return config.Rate > 0 && config.Burst > 0
+}
+
+// takeTokenScript : Refill bucket by elapsed time then take one token. Returns 1 when allowed.
+var takeTokenScript = redis.NewScript(`
+	local rate = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+	local tokens = tonumber(bucket[1])
+	local updated = tonumber(bucket[2])
+	if tokens == nil or updated == nil then
+		tokens = burst
+		updated = now
+	end
+	tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+	local allowed = 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	end
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+	redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+	return allowed
+`)
+
+// checkInboxRateLimit : Take a token for host. Returns false when host exceeds InboxRateLimit.
+func checkInboxRateLimit(ctx context.Context, host string) bool {
+	if !InboxRateLimit.Enabled() {
+		return true
+	}
+
+	now := float64(time.Now().UnixMilli()) / 1000
+	allowed, err := takeTokenScript.Run(ctx, RelayState.RedisClient, []string{models.RedisKey("relay:ratelimit:inbox:") + host},
+		strconv.FormatFloat(InboxRateLimit.Rate, 'f', -1, 64),
+		InboxRateLimit.Burst,
+		strconv.FormatFloat(now, 'f', 3, 64),
+	).Int()
+	if err != nil {
+		// Fail open : Redis trouble should not stop federation.
+		logger.WithError(err).Debug("Failed to check inbox rate limit")
+		return true
+	}
+	return allowed == 1
+}
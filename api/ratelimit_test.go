@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckInboxRateLimit(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	InboxRateLimit = RateLimitConfig{Rate: 0.1, Burst: 5}
+	defer func() { InboxRateLimit = RateLimitConfig{} }()
+
+	t.Run("Burst from one host is throttled", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			if !checkInboxRateLimit(context.TODO(), "flood.example.com") {
+				t.Fatalf("Expected activity %d to be allowed within burst, but it was throttled", i+1)
+			}
+		}
+		if checkInboxRateLimit(context.TODO(), "flood.example.com") {
+			t.Fatal("Expected activity beyond burst to be throttled, but it was allowed")
+		}
+	})
+
+	t.Run("Other host stays unthrottled", func(t *testing.T) {
+		if !checkInboxRateLimit(context.TODO(), "calm.example.com") {
+			t.Fatal("Expected activity from other host to be allowed, but it was throttled")
+		}
+	})
+}
+
+func TestCheckInboxRateLimitDisabled(t *testing.T) {
+	InboxRateLimit = RateLimitConfig{}
+
+	for i := 0; i < 10; i++ {
+		if !checkInboxRateLimit(context.TODO(), "flood.example.com") {
+			t.Fatal("Expected disabled rate limit to allow every activity, but it throttled")
+		}
+	}
+}
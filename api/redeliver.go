@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// adminRedeliverResult is the outcome of a manual re-delivery
+type adminRedeliverResult struct {
+	Success  bool   `json:"success"`
+	JobID    string `json:"job_id,omitempty"`
+	InboxURL string `json:"inbox_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// verifyRedeliverActivity rejects a fetched activity the relay would not have relayed
+func verifyRedeliverActivity(activityURL string, activity *models.Activity, actor *models.Actor) error {
+	requested, _ := url.Parse(activityURL)
+	activityID, err := url.Parse(activity.ID)
+	if err != nil || activityID.Host != requested.Host {
+		return errors.New("activity id does not belong to " + requested.Host)
+	}
+	actorID, err := url.Parse(actor.ID)
+	if err != nil || actorID.Host != activityID.Host || activity.Actor != actor.ID {
+		return errors.New("activity actor does not match its origin")
+	}
+	if isActorBlocked(actorID) {
+		return errors.New("activity origin " + actorID.Host + " is blocked")
+	}
+	if !isActorAbleToRelay(actor) {
+		return errors.New("activity actor is not relayed")
+	}
+	return nil
+}
+
+// executeAdminRedeliver fetches activityURL and queues it for the inbox of domain alone, returning the response status
+func executeAdminRedeliver(domain, activityURL string) (adminRedeliverResult, int) {
+	var inboxURL, identityID string
+	subscriber := RelayState.SelectSubscriber(domain)
+	if subscriber != nil {
+		inboxURL = subscriber.InboxURL
+	} else if follower := RelayState.SelectFollower(domain); follower != nil {
+		inboxURL, identityID = follower.InboxURL, follower.RelayActor
+	} else {
+		return adminRedeliverResult{Error: "Domain not found in subscribers or followers"}, 404
+	}
+
+	activity, actor, err := fetchOriginalActivityFromURL(context.TODO(), activityURL)
+	if err != nil {
+		return adminRedeliverResult{InboxURL: inboxURL, Error: "failed to fetch activity: " + err.Error()}, 502
+	}
+	if err := verifyRedeliverActivity(activityURL, activity, actor); err != nil {
+		return adminRedeliverResult{InboxURL: inboxURL, Error: err.Error()}, 422
+	}
+
+	// Subscribers receive the activity itself, LitePub followers an Announce of its object
+	var body []byte
+	if subscriber != nil {
+		body, _ = json.Marshal(activity)
+	} else {
+		objectID, err := activity.UnwrapInnerObjectId()
+		if err != nil {
+			objectID = activity.ID
+		}
+		relayActor := subscriptionRelayActor(identityID)
+		announce := models.NewActivityPubActivity(relayActor, []string{relayActor.Followers()}, objectID, "Announce")
+		body, _ = json.Marshal(&announce)
+	}
+
+	jobID := enqueueRegisterActivity(inboxURL, body)
+	if jobID == "" {
+		return adminRedeliverResult{InboxURL: inboxURL, Error: "failed to enqueue delivery"}, 500
+	}
+	activityLogger(activity).WithFields(logrus.Fields{"inbox_url": inboxURL, "job_id": jobID}).Info("Admin redelivery queued")
+
+	return adminRedeliverResult{Success: true, JobID: jobID, InboxURL: inboxURL}, 200
+}
+
+// handleAdminRedeliver pushes one activity again to a single subscriber or follower
+// POST /api/admin/redeliver
+// Body: {"domain": "example.com", "activityUrl": "https://origin.example/activities/1"}
+// Response: {"success": true, "job_id": "task_...", "inbox_url": "https://example.com/inbox"} or {"error": "..."}
+func handleAdminRedeliver(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	var req struct {
+		Domain      string `json:"domain"`
+		ActivityURL string `json:"activityUrl"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+		return
+	}
+	if activityURL, err := url.Parse(req.ActivityURL); req.Domain == "" || err != nil || activityURL.Host == "" {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "domain and activityUrl required"})
+		return
+	}
+
+	result, status := executeAdminRedeliver(req.Domain, req.ActivityURL)
+	if result.Success {
+		recordAdminAction(request, "redeliver", req.Domain, "")
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(result)
+}
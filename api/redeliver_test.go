@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleAdminRedeliver(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	forgedID := "https://other.example.com/users/mallory"
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := origin.URL + "/users/alice"
+		if r.URL.Path == "/activities/forged" {
+			actor = forgedID
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.Write([]byte(`{"id":"` + origin.URL + r.URL.Path + `","type":"Create","actor":"` + actor + `","object":{"id":"` + origin.URL + `/notes/1","type":"Note"}}`))
+	}))
+	defer origin.Close()
+	actorID := origin.URL + "/users/alice"
+	ActorCache.Set(actorID, []byte(`{"id":"`+actorID+`","type":"Person","inbox":"`+actorID+`/inbox"}`), time.Minute)
+	defer ActorCache.Delete(actorID)
+	ActorCache.Set(forgedID, []byte(`{"id":"`+forgedID+`","type":"Person","inbox":"`+forgedID+`/inbox"}`), time.Minute)
+	defer ActorCache.Delete(forgedID)
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "a.example.com",
+		InboxURL: "https://a.example.com/inbox",
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:   "b.example.com",
+		InboxURL: "https://b.example.com/inbox",
+	})
+
+	s := httptest.NewServer(http.HandlerFunc(handleAdminRedeliver))
+	defer s.Close()
+
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"domain":"a.example.com","activityUrl":"` + origin.URL + `/activities/1"}`, 200},
+		{`{"domain":"b.example.com","activityUrl":"` + origin.URL + `/activities/1"}`, 200},
+		{`{"domain":"unknown.example.com","activityUrl":"` + origin.URL + `/activities/1"}`, 404},
+		{`{"domain":"a.example.com","activityUrl":"` + origin.URL + `/activities/forged"}`, 422},
+		{`{"domain":"a.example.com"}`, 400},
+	}
+	for _, c := range cases {
+		r, err := http.Post(s.URL, "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var result adminRedeliverResult
+		json.NewDecoder(r.Body).Decode(&result)
+		r.Body.Close()
+		if r.StatusCode != c.status {
+			t.Fatalf("Expected status %d for %s, but got %d (%s)", c.status, c.body, r.StatusCode, result.Error)
+		}
+		if c.status == 200 && (!result.Success || result.JobID == "" || result.InboxURL == "") {
+			t.Fatalf("Expected job id and inbox url, but got %+v", result)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// adminResendAcceptResult is the outcome of a manual Accept re-send
+type adminResendAcceptResult struct {
+	Success  bool   `json:"success"`
+	JobID    string `json:"job_id,omitempty"`
+	InboxURL string `json:"inbox_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// executeAdminResendAccept answers the stored Follow of domain with a new Accept, returning the response status
+func executeAdminResendAccept(domain string) (adminResendAcceptResult, int) {
+	var follow models.Activity
+	var inboxURL string
+	if subscriber := RelayState.SelectSubscriber(domain); subscriber != nil {
+		follow = models.Activity{ID: subscriber.ActivityID, Actor: subscriber.ActorID, Object: "https://www.w3.org/ns/activitystreams#Public"}
+		inboxURL = subscriber.InboxURL
+	} else if follower := RelayState.SelectFollower(domain); follower != nil {
+		follow = models.Activity{ID: follower.ActivityID, Actor: follower.ActorID, Object: RelayActor().ID}
+		inboxURL = follower.InboxURL
+	} else {
+		return adminResendAcceptResult{Error: "Domain not found in subscribers or followers"}, 404
+	}
+	if follow.ID == "" || follow.Actor == "" {
+		return adminResendAcceptResult{InboxURL: inboxURL, Error: "Follow of " + domain + " was not recorded, the instance has to follow again"}, 422
+	}
+	follow.Context = []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"}
+	follow.Type = "Follow"
+
+	// The Accept originally went to the inbox of the following actor, the recorded inbox may be shared
+	actor, err := models.NewActivityPubActorFromRemoteActor(follow.Actor, GlobalConfig.UserAgent(version), ActorCache)
+	if err == nil && isResolvableInboxURL(actor.Inbox) {
+		inboxURL = actor.Inbox
+	}
+
+	accept := follow.GenerateReply(RelayActor(), follow, "Accept")
+	body, _ := json.Marshal(&accept)
+	jobID := enqueueRegisterActivity(inboxURL, body)
+	if jobID == "" {
+		return adminResendAcceptResult{InboxURL: inboxURL, Error: "failed to enqueue delivery"}, 500
+	}
+	activityLogger(&follow).WithFields(logrus.Fields{"inbox_url": inboxURL, "job_id": jobID}).Info("Admin Accept resend queued")
+
+	return adminResendAcceptResult{Success: true, JobID: jobID, InboxURL: inboxURL}, 200
+}
+
+// handleAdminResendAccept sends Accept again to a subscriber or follower that missed it
+// POST /api/admin/resend-accept
+// Body: {"domain": "example.com"}
+// Response: {"success": true, "job_id": "task_...", "inbox_url": "https://example.com/users/relay/inbox"} or {"error": "..."}
+func handleAdminResendAccept(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	var req struct {
+		Domain string `json:"domain"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid request body"})
+		return
+	}
+	if req.Domain == "" {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "domain required"})
+		return
+	}
+
+	result, status := executeAdminResendAccept(req.Domain)
+	if result.Success {
+		recordAdminAction(request, "resend_accept", req.Domain, "")
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(result)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleAdminResendAccept(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	actorID := "https://a.example.com/actor"
+	ActorCache.Set(actorID, []byte(`{"id":"`+actorID+`","type":"Application","inbox":"`+actorID+`/inbox"}`), time.Minute)
+	defer ActorCache.Delete(actorID)
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "a.example.com",
+		InboxURL:   "https://a.example.com/inbox",
+		ActivityID: "https://a.example.com/follows/1",
+		ActorID:    actorID,
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:   "b.example.com",
+		InboxURL: "https://b.example.com/inbox",
+	})
+
+	s := httptest.NewServer(http.HandlerFunc(handleAdminResendAccept))
+	defer s.Close()
+
+	cases := []struct {
+		body     string
+		status   int
+		inboxURL string
+	}{
+		{`{"domain":"a.example.com"}`, 200, actorID + "/inbox"},
+		{`{"domain":"b.example.com"}`, 422, "https://b.example.com/inbox"},
+		{`{"domain":"unknown.example.com"}`, 404, ""},
+		{`{}`, 400, ""},
+	}
+	for _, c := range cases {
+		r, err := http.Post(s.URL, "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var result adminResendAcceptResult
+		json.NewDecoder(r.Body).Decode(&result)
+		r.Body.Close()
+		if r.StatusCode != c.status {
+			t.Fatalf("Expected status %d for %s, but got %d (%s)", c.status, c.body, r.StatusCode, result.Error)
+		}
+		if result.InboxURL != c.inboxURL {
+			t.Fatalf("Expected inbox url %q for %s, but got %q", c.inboxURL, c.body, result.InboxURL)
+		}
+		if c.status == 200 && (!result.Success || result.JobID == "") {
+			t.Fatalf("Expected job id of the queued Accept, but got %+v", result)
+		}
+	}
+
+	r, _ := http.Get(s.URL)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405 for GET, but got %d", r.StatusCode)
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"errors"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/delaymetrics"
 	"github.com/yukimochi/Activity-Relay/discord"
 	"github.com/yukimochi/Activity-Relay/models"
 	"github.com/yukimochi/machinery-v1/v1/tasks"
@@ -17,12 +21,101 @@ import (
 // getInboxURL returns the SharedInbox URL if available, otherwise falls back to Inbox.
 // This is needed for Akkoma/Pleroma compatibility as they may not set endpoints.sharedInbox.
 func getInboxURL(actor *models.Actor) string {
-	if actor.Endpoints != nil && actor.Endpoints.SharedInbox != "" {
+	if actor.Endpoints != nil && isResolvableInboxURL(actor.Endpoints.SharedInbox) {
 		return actor.Endpoints.SharedInbox
 	}
 	return actor.Inbox
 }
 
+func isResolvableInboxURL(inboxURL string) bool {
+	parsed, err := url.Parse(inboxURL)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "https" || parsed.Scheme == "http") && parsed.Host != ""
+}
+
+// rememberSigningAlgorithm records whether deliveries to the actor's inbox host may be signed with Ed25519
+func rememberSigningAlgorithm(actor *models.Actor) {
+	inboxURL, err := url.Parse(getInboxURL(actor))
+	if err != nil || inboxURL.Host == "" {
+		return
+	}
+	if actor.SupportsEd25519() {
+		RelayState.RedisClient.Set(context.TODO(), models.RedisKey("relay:signing:")+inboxURL.Host, "ed25519", 0)
+	} else {
+		RelayState.RedisClient.Del(context.TODO(), models.RedisKey("relay:signing:")+inboxURL.Host)
+	}
+}
+
+// validateFollowerInbox checks that deliveries to the following actor have an inbox to go to
+func validateFollowerInbox(actor *models.Actor) error {
+	if !isResolvableInboxURL(actor.Inbox) {
+		return errors.New(actor.ID + " has no resolvable inbox")
+	}
+	if RelayState.RelayConfig.RequireSharedInbox && (actor.Endpoints == nil || !isResolvableInboxURL(actor.Endpoints.SharedInbox)) {
+		return errors.New(actor.ID + " has no sharedInbox, which this relay requires")
+	}
+	return nil
+}
+
+// validateFollowerSoftware rejects following instances running software older than the configured minimum
+func validateFollowerSoftware(host string) error {
+	minimums := GlobalConfig.MinSoftwareVersions()
+	if len(minimums) == 0 {
+		return nil
+	}
+	name, version, err := delaymetrics.ResolveSoftware(host)
+	if err != nil {
+		if GlobalConfig.MinSoftwareVersionAllowUnreachable() {
+			return nil
+		}
+		return errors.New("software of " + host + " could not be verified: " + err.Error())
+	}
+	minimum, found := minimums[name]
+	if found && compareSoftwareVersions(version, minimum) < 0 {
+		return errors.New(name + " " + version + " is below the minimum version " + minimum + " required by this relay")
+	}
+	return nil
+}
+
+// compareSoftwareVersions compares the leading numeric components of two versions, ignoring suffixes like -beta
+func compareSoftwareVersions(a, b string) int {
+	left, right := versionComponents(a), versionComponents(b)
+	for i := 0; i < max(len(left), len(right)); i++ {
+		var l, r int
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		if l != r {
+			if l < r {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionComponents(version string) []int {
+	var components []int
+	for _, part := range strings.Split(version, ".") {
+		digits := len(part) - len(strings.TrimLeft(part, "0123456789"))
+		if digits == 0 {
+			break
+		}
+		component, _ := strconv.Atoi(part[:digits])
+		components = append(components, component)
+		if digits < len(part) {
+			break
+		}
+	}
+	return components
+}
+
 func contains(entries interface{}, key string) bool {
 	switch entry := entries.(type) {
 	case string:
@@ -52,8 +145,10 @@ func contains(entries interface{}, key string) bool {
 	return false
 }
 
-func enqueueRegisterActivity(inboxURL string, body []byte) {
+// enqueueRegisterActivity queues body for inboxURL and returns the job id, empty when queueing failed
+func enqueueRegisterActivity(inboxURL string, body []byte) string {
 	job := &tasks.Signature{
+		UUID:       "task_" + uuid.New().String(),
 		Name:       "register",
 		RetryCount: 2,
 		Args: []tasks.Arg{
@@ -71,8 +166,10 @@ func enqueueRegisterActivity(inboxURL string, body []byte) {
 	}
 	_, err := MachineryServer.SendTask(job)
 	if err != nil {
-		logrus.Error(err)
+		logger.Error(err)
+		return ""
 	}
+	return job.UUID
 }
 
 func enqueueRelayActivity(inboxURL string, activityID string) {
@@ -94,69 +191,156 @@ func enqueueRelayActivity(inboxURL string, activityID string) {
 	}
 	_, err := MachineryServer.SendTask(job)
 	if err != nil {
-		logrus.Error(err)
+		logger.Error(err)
 	}
 }
 
-func enqueueActivityForAll(sourceDomain string, body []byte) {
-	activityID := uuid.New()
-	remainCount := len(RelayState.SubscribersAndFollowers) - 1
+// enqueueOrderedActivity queues body behind the earlier deliveries to the domain of each of inboxURLs.
+// The delivery worker sends the queue of a domain one at a time, so the destination receives activities in enqueue order.
+func enqueueOrderedActivity(body []byte, inboxURLs []string) {
+	for _, inboxURL := range inboxURLs {
+		inbox, err := url.Parse(inboxURL)
+		if err != nil || inbox.Host == "" {
+			continue
+		}
+		job, _ := json.Marshal(map[string]string{"inbox_url": inboxURL, "body": string(body)})
+		err = RelayState.RedisClient.RPush(context.TODO(), models.RedisKey(models.OrderedQueue)+inbox.Host, job).Err()
+		if err != nil {
+			logger.WithError(err).WithField("inbox_url", inboxURL).Error("Failed to queue ordered delivery")
+			continue
+		}
+		enqueueOrderedDelivery(inbox.Host)
+	}
+}
+
+// enqueueOrderedDelivery wakes a delivery worker for the ordered queue of domain, a no-op when one is already sending it
+func enqueueOrderedDelivery(domain string) {
+	job := &tasks.Signature{
+		Name:       "relay-ordered",
+		RetryCount: 0,
+		Args: []tasks.Arg{
+			{
+				Name:  "domain",
+				Type:  "string",
+				Value: domain,
+			},
+		},
+	}
+	_, err := MachineryServer.SendTask(job)
+	if err != nil {
+		logger.Error(err)
+	}
+}
 
-	if remainCount < 1 {
+// isSourceSubscription reports whether the subscription of domain receiving at inboxURL belongs to sourceDomain,
+// which already has the activity and must not get it echoed back
+func isSourceSubscription(sourceDomain, domain, inboxURL string) bool {
+	if strings.EqualFold(sourceDomain, domain) {
+		return true
+	}
+	inbox, err := url.Parse(inboxURL)
+	return err == nil && strings.EqualFold(sourceDomain, inbox.Host)
+}
+
+// enqueueActivityForInboxes stores body once and queues one delivery per unique inbox of inboxURLs.
+// Subscriptions sharing an inbox get a single POST, their server distributes it by the addressing of body.
+func enqueueActivityForInboxes(body []byte, inboxURLs []string) {
+	inboxURLs = uniqueInboxURLs(inboxURLs)
+	if len(inboxURLs) < 1 {
 		return
 	}
+	if GlobalConfig.DeliveryOrdered() {
+		// Ordered deliveries carry their own body, they may wait longer than the shared activity lives
+		enqueueOrderedActivity(body, inboxURLs)
+		return
+	}
+	activityID := uuid.New()
 
 	pushActivityScript := "redis.call('HSET',KEYS[1], 'body', ARGV[1], 'remain_count', ARGV[2]); redis.call('EXPIRE', KEYS[1], ARGV[3]);"
-	RelayState.RedisClient.Eval(context.TODO(), pushActivityScript, []string{"relay:activity:" + activityID.String()}, body, remainCount, 2*60).Result()
+	RelayState.RedisClient.Eval(context.TODO(), pushActivityScript, []string{models.RedisKey("relay:activity:") + activityID.String()}, body, len(inboxURLs), 2*60).Result()
 
+	for _, inboxURL := range inboxURLs {
+		enqueueRelayActivity(inboxURL, activityID.String())
+	}
+}
+
+// uniqueInboxURLs drops repeated inboxes, counting the deliveries saved
+func uniqueInboxURLs(inboxURLs []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(inboxURLs))
+	for _, inboxURL := range inboxURLs {
+		if !seen[inboxURL] {
+			seen[inboxURL] = true
+			unique = append(unique, inboxURL)
+		}
+	}
+	if saved := len(inboxURLs) - len(unique); saved > 0 {
+		RelayState.RedisClient.IncrBy(context.TODO(), models.RedisKey("relay:stats:outbox:shared_inbox_saved:total"), int64(saved))
+	}
+	return unique
+}
+
+func enqueueActivityForAll(sourceDomain string, body []byte) {
+	if holdWhilePaused(audienceAll, sourceDomain, body) {
+		return
+	}
+	identityID, byRelayActor := bodyIdentity(body)
+	var inboxURLs []string
 	for _, subscription := range RelayState.SubscribersAndFollowers {
-		if sourceDomain == subscription.Domain {
-			continue
+		switch {
+		case byRelayActor && subscription.RelayActor != identityID:
+			// Sent by a relay actor this subscription does not follow
+		case isSourceSubscription(sourceDomain, subscription.Domain, subscription.InboxURL):
+			// The source already has the activity
+		case isBatchDomain(subscription.Domain):
+			bufferBatchActivity(subscription.Domain, body)
+		default:
+			inboxURLs = append(inboxURLs, subscription.InboxURL)
 		}
-		enqueueRelayActivity(subscription.InboxURL, activityID.String())
 	}
+	enqueueActivityForInboxes(body, inboxURLs)
 }
 
 func enqueueActivityForSubscriber(sourceDomain string, body []byte) {
-	activityID := uuid.New()
-	remainCount := len(RelayState.Subscribers)
-	if contains(RelayState.Subscribers, sourceDomain) {
-		remainCount = remainCount - 1
-	}
-	if remainCount < 1 {
+	if holdWhilePaused(audienceSubscriber, sourceDomain, body) {
 		return
 	}
-
-	pushActivityScript := "redis.call('HSET',KEYS[1], 'body', ARGV[1], 'remain_count', ARGV[2]); redis.call('EXPIRE', KEYS[1], ARGV[3]);"
-	RelayState.RedisClient.Eval(context.TODO(), pushActivityScript, []string{"relay:activity:" + activityID.String()}, body, remainCount, 2*60).Result()
-
+	identityID, byRelayActor := bodyIdentity(body)
+	var inboxURLs []string
 	for _, subscription := range RelayState.Subscribers {
-		if sourceDomain == subscription.Domain {
-			continue
+		switch {
+		case byRelayActor && subscription.RelayActor != identityID:
+			// Sent by a relay actor this subscription does not follow
+		case isSourceSubscription(sourceDomain, subscription.Domain, subscription.InboxURL):
+			// The source already has the activity
+		case isBatchDomain(subscription.Domain):
+			bufferBatchActivity(subscription.Domain, body)
+		default:
+			inboxURLs = append(inboxURLs, subscription.InboxURL)
 		}
-		enqueueRelayActivity(subscription.InboxURL, activityID.String())
 	}
+	enqueueActivityForInboxes(body, inboxURLs)
 }
 
 func enqueueActivityForFollower(sourceDomain string, body []byte) {
-	activityID := uuid.New()
-	remainCount := len(RelayState.Followers)
-	if contains(RelayState.Followers, sourceDomain) {
-		remainCount = remainCount - 1
-	}
-	if remainCount < 1 {
+	if holdWhilePaused(audienceFollower, sourceDomain, body) {
 		return
 	}
-
-	pushActivityScript := "redis.call('HSET',KEYS[1], 'body', ARGV[1], 'remain_count', ARGV[2]); redis.call('EXPIRE', KEYS[1], ARGV[3]);"
-	RelayState.RedisClient.Eval(context.TODO(), pushActivityScript, []string{"relay:activity:" + activityID.String()}, body, remainCount, 2*60).Result()
-
+	identityID, byRelayActor := bodyIdentity(body)
+	var inboxURLs []string
 	for _, subscription := range RelayState.Followers {
-		if sourceDomain == subscription.Domain {
-			continue
+		switch {
+		case byRelayActor && subscription.RelayActor != identityID:
+			// Sent by a relay actor this subscription does not follow
+		case isSourceSubscription(sourceDomain, subscription.Domain, subscription.InboxURL):
+			// The source already has the activity
+		case isBatchDomain(subscription.Domain):
+			bufferBatchActivity(subscription.Domain, body)
+		default:
+			inboxURLs = append(inboxURLs, subscription.InboxURL)
 		}
-		enqueueRelayActivity(subscription.InboxURL, activityID.String())
 	}
+	enqueueActivityForInboxes(body, inboxURLs)
 }
 
 func isActorLimited(actorID *url.URL) bool {
@@ -167,9 +351,35 @@ func isActorLimited(actorID *url.URL) bool {
 }
 
 func isActorBlocked(actorID *url.URL) bool {
-	if contains(RelayState.BlockedDomains, actorID.Host) {
+	return isDomainBlocked(actorID.Host)
+}
+
+// isDomainBlocked matches host against blocked domains
+func isDomainBlocked(host string) bool {
+	return matchDomainPatterns(host, RelayState.BlockedDomains)
+}
+
+// isDomainAllowed reports whether host may follow the relay, every domain is allowed unless allow-list only mode is enabled
+func isDomainAllowed(host string) bool {
+	if !RelayState.RelayConfig.AllowlistOnly {
 		return true
 	}
+	return matchDomainPatterns(host, RelayState.AllowedDomains)
+}
+
+// matchDomainPatterns matches host against patterns, "*.example.com" matches subdomains but not example.com itself
+func matchDomainPatterns(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
 	return false
 }
 
@@ -210,6 +420,35 @@ func isActorAbleToRelay(actor *models.Actor) bool {
 	return true
 }
 
+func isBotActor(actor *models.Actor) bool {
+	return actor.Type == "Service" || actor.Type == "Application"
+}
+
+// isActivityTypeEnabled reports whether activities of activityType are relayed, types without a toggle are
+func isActivityTypeEnabled(activityType string) bool {
+	enabled, found := RelayState.EnabledActivityTypes[activityType]
+	return !found || enabled
+}
+
+func isReactionActivity(activity *models.Activity) bool {
+	return activity.Type == "Like" || activity.Type == "EmojiReact"
+}
+
+// isRelayableUndo reports whether undo retracts an Announce, or a reaction the relay would have relayed, of its own actor
+func isRelayableUndo(undo *models.Activity, innerActivity *models.Activity) bool {
+	if innerActivity.Actor != undo.Actor {
+		return false
+	}
+	switch {
+	case innerActivity.Type == "Announce":
+		return true
+	case isReactionActivity(innerActivity):
+		return RelayState.RelayConfig.RelayReactions && isActivityTypeEnabled(innerActivity.Type)
+	default:
+		return false
+	}
+}
+
 func isToMyFollower(entries []string) bool {
 	for _, entry := range entries {
 		isToFollower := regexp.MustCompile(`/followers$`)
@@ -224,31 +463,51 @@ func isToMyFollower(entries []string) bool {
 	return false
 }
 
-func executeFollowing(activity *models.Activity, actor *models.Actor) error {
+func executeFollowing(activity *models.Activity, actor *models.Actor, relayActor models.Actor) error {
 	actorID, _ := url.Parse(actor.ID)
 	if isActorBlocked(actorID) {
 		// Send Discord notification for blocked server attempt
-		discord.SendNotification(discord.NotifyBlocked, actorID.Host, actor.ID)
+		discord.SendNotificationBatched(discord.NotifyBlocked, actorID.Host, actor.ID)
 		// Send Reject to the blocked server so they know they're blocked
 		err := errors.New(actorID.Host + " is blocked")
-		executeRejectRequest(activity, actor, err)
+		executeRejectRequest(activity, actor, relayActor, err)
 		return err
 	}
+	if !isDomainAllowed(actorID.Host) {
+		discord.SendNotificationBatched(discord.NotifyRejected, actorID.Host, actor.ID)
+		return errors.New(actorID.Host + " is not on the allow-list")
+	}
+	err := validateFollowerInbox(actor)
+	if err != nil {
+		return err
+	}
+	err = validateFollowerSoftware(actorID.Host)
+	if err != nil {
+		return err
+	}
+	rememberSigningAlgorithm(actor)
+	if cancelDeferredUnfollowing(actorID.Host) {
+		activityLogger(activity).Info("Cancelled deferred Unfollow Request")
+	}
+	if executeRepeatedFollowing(activity, actor, relayActor) {
+		return nil
+	}
 	switch {
 	case contains(activity.Object, "https://www.w3.org/ns/activitystreams#Public"):
 		if RelayState.RelayConfig.ManuallyAccept {
-			RelayState.RedisClient.HMSet(context.TODO(), "relay:pending:"+actorID.Host, map[string]interface{}{
+			RelayState.RedisClient.HMSet(context.TODO(), models.RedisKey("relay:pending:")+actorID.Host, map[string]interface{}{
 				"inbox_url":   getInboxURL(actor),
 				"activity_id": activity.ID,
 				"type":        "Follow",
 				"actor":       actor.ID,
 				"object":      activity.Object.(string),
+				"relay_actor": relayActor.ID,
 			})
-			logrus.Info("Pending Follow Request : ", activity.Actor)
+			activityLogger(activity).Info("Pending Follow Request")
 			// Send Discord notification for pending request
-			discord.SendNotification(discord.NotifyPendingRequest, actorID.Host, actor.ID)
+			discord.SendNotificationBatched(discord.NotifyPendingRequest, actorID.Host, actor.ID)
 		} else {
-			resp := activity.GenerateReply(RelayActor, activity, "Accept")
+			resp := activity.GenerateReply(relayActor, activity, "Accept")
 			jsonData, _ := json.Marshal(&resp)
 			go enqueueRegisterActivity(actor.Inbox, jsonData)
 			RelayState.AddSubscriber(models.Subscriber{
@@ -256,26 +515,30 @@ func executeFollowing(activity *models.Activity, actor *models.Actor) error {
 				InboxURL:   getInboxURL(actor),
 				ActivityID: activity.ID,
 				ActorID:    actor.ID,
+				JoinedAt:   time.Now().Unix(),
+				RelayActor: identityActorID(relayActor),
 			})
-			logrus.Info("Accepted Follow Request : ", activity.Actor)
+			go replayCatchUpActivities(catchUpSubscriberKey, getInboxURL(actor), identityActorID(relayActor))
+			activityLogger(activity).Info("Accepted Follow Request")
 			// Send Discord notification for new registration
-			discord.SendNotification(discord.NotifyFollow, actorID.Host, actor.ID)
+			discord.SendNotificationBatched(discord.NotifyFollow, actorID.Host, actor.ID)
 		}
-	case contains(activity.Object, RelayActor.ID):
+	case contains(activity.Object, relayActor.ID):
 		if isActorAbleToBeFollower(actorID) {
 			if RelayState.RelayConfig.ManuallyAccept {
-				RelayState.RedisClient.HMSet(context.TODO(), "relay:pending:"+actorID.Host, map[string]interface{}{
+				RelayState.RedisClient.HMSet(context.TODO(), models.RedisKey("relay:pending:")+actorID.Host, map[string]interface{}{
 					"inbox_url":   getInboxURL(actor),
 					"activity_id": activity.ID,
 					"type":        "Follow",
 					"actor":       actor.ID,
 					"object":      activity.Object.(string),
+					"relay_actor": relayActor.ID,
 				})
-				logrus.Info("Pending Follow Request : ", activity.Actor)
+				activityLogger(activity).Info("Pending Follow Request")
 				// Send Discord notification for pending request
-				discord.SendNotification(discord.NotifyPendingRequest, actorID.Host, actor.ID)
+				discord.SendNotificationBatched(discord.NotifyPendingRequest, actorID.Host, actor.ID)
 			} else {
-				resp := activity.GenerateReply(RelayActor, activity, "Accept")
+				resp := activity.GenerateReply(relayActor, activity, "Accept")
 				jsonData, _ := json.Marshal(&resp)
 				go enqueueRegisterActivity(actor.Inbox, jsonData)
 				follower := models.Follower{
@@ -284,13 +547,16 @@ func executeFollowing(activity *models.Activity, actor *models.Actor) error {
 					ActivityID:     activity.ID,
 					ActorID:        actor.ID,
 					MutuallyFollow: false,
+					JoinedAt:       time.Now().Unix(),
+					RelayActor:     identityActorID(relayActor),
 				}
 				RelayState.AddFollower(follower)
-				logrus.Info("Accepted Follow Request : ", activity.Actor)
+				go replayCatchUpActivities(catchUpFollowerKey, follower.InboxURL, follower.RelayActor)
+				activityLogger(activity).Info("Accepted Follow Request")
 				// Send Discord notification for new registration
-				discord.SendNotification(discord.NotifyFollow, actorID.Host, actor.ID)
+				discord.SendNotificationBatched(discord.NotifyFollow, actorID.Host, actor.ID)
 
-				executeMutuallyFollow(follower)
+				executeMutuallyFollow(follower, relayActor)
 			}
 			return nil
 		}
@@ -302,21 +568,54 @@ func executeFollowing(activity *models.Activity, actor *models.Actor) error {
 	return nil
 }
 
-func executeUnfollowing(activity *models.Activity, actor *models.Actor) error {
+// executeRepeatedFollowing answers a Follow from an already registered domain with Accept again, without a new record or notification.
+// The record is updated when the instance follows with another actor or inbox. It returns false for domains not registered yet.
+func executeRepeatedFollowing(activity *models.Activity, actor *models.Actor, relayActor models.Actor) bool {
+	actorID, _ := url.Parse(actor.ID)
+	var previousActorID, previousInboxURL, inboxURL string
+	switch {
+	case contains(activity.Object, "https://www.w3.org/ns/activitystreams#Public"):
+		subscriber := RelayState.SelectSubscriber(actorID.Host)
+		if subscriber == nil {
+			return false
+		}
+		previousActorID, previousInboxURL, inboxURL = subscriber.ActorID, subscriber.InboxURL, getInboxURL(actor)
+		subscriber.InboxURL, subscriber.ActivityID, subscriber.ActorID = inboxURL, activity.ID, actor.ID
+		subscriber.RelayActor = identityActorID(relayActor)
+		RelayState.AddSubscriber(*subscriber)
+	case contains(activity.Object, relayActor.ID) && isActorAbleToBeFollower(actorID):
+		follower := RelayState.SelectFollower(actorID.Host)
+		if follower == nil {
+			return false
+		}
+		previousActorID, previousInboxURL, inboxURL = follower.ActorID, follower.InboxURL, actor.Inbox
+		follower.InboxURL, follower.ActivityID, follower.ActorID = inboxURL, activity.ID, actor.ID
+		follower.RelayActor = identityActorID(relayActor)
+		RelayState.AddFollower(*follower)
+	default:
+		return false
+	}
+
+	resp := activity.GenerateReply(relayActor, activity, "Accept")
+	jsonData, _ := json.Marshal(&resp)
+	go enqueueRegisterActivity(actor.Inbox, jsonData)
+	if previousActorID != actor.ID || previousInboxURL != inboxURL {
+		activityLogger(activity).WithFields(logrus.Fields{"previous_actor": previousActorID, "previous_inbox_url": previousInboxURL}).Info("Updated Follow of re-keyed instance")
+	} else {
+		activityLogger(activity).Info("Accepted repeated Follow Request")
+	}
+	return true
+}
+
+func executeUnfollowing(activity *models.Activity, actor *models.Actor, relayActor models.Actor) error {
 	actorID, _ := url.Parse(actor.ID)
 	switch {
 	case contains(activity.Object, "https://www.w3.org/ns/activitystreams#Public"):
-		RelayState.DelSubscriber(actorID.Host)
-		logrus.Info("Accepted Unfollow Request : ", activity.Actor)
-		// Send Discord notification for unregistration
-		discord.SendNotification(discord.NotifyUnfollow, actorID.Host, actor.ID)
+		deferUnfollowing(activity, actorID.Host, unfollowSubscriber)
 		return nil
-	case contains(activity.Object, RelayActor.ID):
+	case contains(activity.Object, relayActor.ID):
 		if isActorAbleToBeFollower(actorID) {
-			RelayState.DelFollower(actorID.Host)
-			logrus.Info("Accepted Unfollow Request : ", activity.Actor)
-			// Send Discord notification for unregistration
-			discord.SendNotification(discord.NotifyUnfollow, actorID.Host, actor.ID)
+			deferUnfollowing(activity, actorID.Host, unfollowFollower)
 			return nil
 		}
 		fallthrough
@@ -326,30 +625,202 @@ func executeUnfollowing(activity *models.Activity, actor *models.Actor) error {
 	}
 }
 
-func executeMutuallyFollow(follower models.Follower) error {
+// executeActorDelete removes subscribers and followers tracking the actor of a Delete of itself, returning the number removed.
+// Only a Delete signed by a key of the deleted actor prunes state, an unsigned Delete has no keyOwner.
+func executeActorDelete(activity *models.Activity, keyOwner *models.Actor) int {
+	deletedID := deletedObjectID(activity)
+	if deletedID == "" || deletedID != activity.Actor || keyOwner == nil || keyOwner.ID != deletedID {
+		return 0
+	}
+
+	removed := 0
+	for _, subscriber := range RelayState.Subscribers {
+		if subscriber.ActorID == deletedID {
+			RelayState.DelSubscriber(subscriber.Domain)
+			discord.SendNotificationBatched(discord.NotifyUnfollow, subscriber.Domain, subscriber.ActorID)
+			removed++
+		}
+	}
+	for _, follower := range RelayState.Followers {
+		if follower.ActorID == deletedID {
+			RelayState.DelFollower(follower.Domain)
+			discord.SendNotificationBatched(discord.NotifyUnfollow, follower.Domain, follower.ActorID)
+			removed++
+		}
+	}
+	if removed > 0 {
+		activityLogger(activity).WithField("removed", removed).Info("Removed subscriptions of deleted actor")
+	}
+	return removed
+}
+
+func executeMutuallyFollow(follower models.Follower, relayActor models.Actor) error {
 	actorID, _ := url.Parse(follower.ActorID)
 	if !isActorLimited(actorID) {
-		followRequest := models.NewActivityPubActivity(RelayActor, []string{follower.ActorID}, follower.ActorID, "Follow")
+		followRequest := models.NewActivityPubActivity(relayActor, []string{follower.ActorID}, follower.ActorID, "Follow")
 		jsonData, _ := json.Marshal(&followRequest)
 		go enqueueRegisterActivity(follower.InboxURL, jsonData)
-		logrus.Info("Sent MutuallyFollow Request : ", follower.ActorID)
+		logger.WithFields(logrus.Fields{"domain": follower.Domain, "actor": follower.ActorID}).Info("Sent MutuallyFollow Request")
 	}
 	return nil
 }
 
+// rejectedFollow returns the Follow a Reject refers to. Besides an embedded Follow, a Reject may carry only the ID
+// of the Follow; IDs under one of our actors are Follows the relay sent, as the relay sends no other activity answered by Reject.
+func rejectedFollow(activity *models.Activity) (*models.Activity, bool) {
+	if innerActivity, err := activity.UnwrapInnerActivity(); err == nil {
+		return innerActivity, innerActivity.Type == "Follow"
+	}
+	followID, ok := activity.Object.(string)
+	if !ok {
+		return nil, false
+	}
+	relayActorIDs := []string{RelayActor().ID}
+	for _, identityActor := range RelayIdentityActors {
+		relayActorIDs = append(relayActorIDs, identityActor.ID)
+	}
+	for _, relayActorID := range relayActorIDs {
+		if strings.HasPrefix(followID, relayActorID+"/activities/") {
+			return &models.Activity{ID: followID, Type: "Follow", Actor: relayActorID, Object: activity.Actor}, true
+		}
+	}
+	return nil, false
+}
+
 func finalizeMutuallyFollow(activity *models.Activity, actor *models.Actor, activityType string) {
 	actorID, _ := url.Parse(actor.ID)
-	if contains(activity.Actor, RelayActor.ID) && contains(activity.Object, actor.ID) && isActorFollowers(actorID) {
+	if _, ours := relayActorByID(activity.Actor); ours && contains(activity.Object, actor.ID) && isActorFollowers(actorID) {
 		RelayState.UpdateFollowerStatus(actorID.Host, activityType == "Accept")
-		logrus.Info("Confirmed MutuallyFollow "+activityType+"ed : ", actor.ID)
+		logger.WithFields(logrus.Fields{"domain": actorID.Host, "actor": actor.ID}).Info("Confirmed MutuallyFollow " + activityType + "ed")
+	}
+}
+
+// executePendingFollowResponse answers a pending follow request with Accept or Reject
+func executePendingFollowResponse(domain string, response string) error {
+	data, err := RelayState.RedisClient.HGetAll(context.TODO(), models.RedisKey("relay:pending:")+domain).Result()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.New("follow request not found")
+	}
+	activity := models.Activity{
+		Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+		ID:      data["activity_id"],
+		Actor:   data["actor"],
+		Type:    data["type"],
+		Object:  data["object"],
+	}
+
+	relayActor, found := relayActorByID(data["relay_actor"])
+	if !found {
+		relayActor = RelayActor()
+	}
+	resp := activity.GenerateReply(relayActor, activity, response)
+	jsonData, err := json.Marshal(&resp)
+	if err != nil {
+		return err
 	}
+	enqueueRegisterActivity(data["inbox_url"], jsonData)
+	RelayState.RedisClient.Del(context.TODO(), models.RedisKey("relay:pending:")+domain)
+
+	if response != "Accept" {
+		logger.WithFields(logrus.Fields{"domain": domain, "actor": data["actor"], "activity_id": data["activity_id"]}).Info("Rejected Pending Follow Request")
+		discord.SendNotificationBatched(discord.NotifyRejected, domain, data["actor"])
+		return nil
+	}
+	logger.WithFields(logrus.Fields{"domain": domain, "actor": data["actor"], "activity_id": data["activity_id"]}).Info("Accepted Pending Follow Request")
+	discord.SendNotificationBatched(discord.NotifyAccepted, domain, data["actor"])
+
+	switch {
+	case contains(activity.Object, "https://www.w3.org/ns/activitystreams#Public"):
+		RelayState.AddSubscriber(models.Subscriber{
+			Domain:     domain,
+			InboxURL:   data["inbox_url"],
+			ActivityID: data["activity_id"],
+			ActorID:    data["actor"],
+			JoinedAt:   time.Now().Unix(),
+			RelayActor: identityActorID(relayActor),
+		})
+		go replayCatchUpActivities(catchUpSubscriberKey, data["inbox_url"], identityActorID(relayActor))
+	case contains(activity.Object, relayActor.ID):
+		follower := models.Follower{
+			Domain:     domain,
+			InboxURL:   data["inbox_url"],
+			ActivityID: data["activity_id"],
+			ActorID:    data["actor"],
+			JoinedAt:   time.Now().Unix(),
+			RelayActor: identityActorID(relayActor),
+		}
+		RelayState.AddFollower(follower)
+		go replayCatchUpActivities(catchUpFollowerKey, follower.InboxURL, follower.RelayActor)
+		executeMutuallyFollow(follower, relayActor)
+	}
+	return nil
 }
 
-func executeRejectRequest(activity *models.Activity, actor *models.Actor, err error) {
-	reject := activity.GenerateReply(RelayActor, activity, "Reject")
+func executeRejectRequest(activity *models.Activity, actor *models.Actor, relayActor models.Actor, err error) {
+	reject := activity.GenerateReply(relayActor, activity, "Reject")
+	reject.Summary = err.Error()
 	jsonData, _ := json.Marshal(&reject)
-	go enqueueRegisterActivity(actor.Inbox, jsonData)
-	logrus.Error("Rejected Follow, Unfollow Request : ", activity.Actor, " ", err.Error())
+	activityLogger(activity).WithError(err).Error("Rejected Follow, Unfollow Request")
+	inboxURL := actor.Inbox
+	if !isResolvableInboxURL(inboxURL) {
+		inboxURL = getInboxURL(actor)
+	}
+	if !isResolvableInboxURL(inboxURL) {
+		return
+	}
+	go enqueueRegisterActivity(inboxURL, jsonData)
+}
+
+func isActivityMatchingTagFilters(activity *models.Activity) bool {
+	if len(RelayState.TagFilters) == 0 {
+		return true
+	}
+	for _, hashtag := range activity.Hashtags() {
+		if contains(RelayState.TagFilters, hashtag) {
+			return true
+		}
+	}
+	return false
+}
+
+// isActivityMatchingLanguageFilters reports whether the activity is in a filtered language, "ja" also matching "ja-jp".
+// Activities without language information match unless RequireLanguage is enabled.
+func isActivityMatchingLanguageFilters(activity *models.Activity) bool {
+	if len(RelayState.LanguageFilters) == 0 {
+		return true
+	}
+	languages := activity.Languages()
+	if len(languages) == 0 {
+		return !RelayState.RelayConfig.RequireLanguage
+	}
+	for _, language := range languages {
+		for _, filter := range RelayState.LanguageFilters {
+			if language == filter || strings.HasPrefix(language, filter+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isActivityTooOld reports whether the activity was published longer than MaxActivityAge before now,
+// activities without a published timestamp are too old only when RequirePublished is enabled
+func isActivityTooOld(activity *models.Activity, now time.Time) bool {
+	if RelayState.MaxActivityAge <= 0 {
+		return false
+	}
+	published, _ := activityPublished(activity)
+	if published == "" {
+		return RelayState.RelayConfig.RequirePublished
+	}
+	createdAt, err := parsePublished(published)
+	if err != nil {
+		return RelayState.RelayConfig.RequirePublished
+	}
+	return now.Sub(createdAt) > RelayState.MaxActivityAge
 }
 
 func executeRelayActivity(activity *models.Activity, actor *models.Actor, body []byte) error {
@@ -358,20 +829,47 @@ func executeRelayActivity(activity *models.Activity, actor *models.Actor, body [
 		err := errors.New("to use the relay service, please follow in advance")
 		return err
 	}
+	if !isActivityTypeEnabled(activity.Type) {
+		activityLogger(activity).Debug("Skipped Relay Activity (Type Disabled)")
+		return nil
+	}
+	if activity.Type == "Create" && !isActivityMatchingTagFilters(activity) {
+		activityLogger(activity).Debug("Skipped Relay Activity (No Matching Hashtag)")
+		return nil
+	}
+	if activity.Type == "Create" && !isActivityMatchingLanguageFilters(activity) {
+		activityLogger(activity).Debug("Skipped Relay Activity (No Matching Language)")
+		return nil
+	}
+	if activity.Type == "Create" && RelayState.RelayConfig.ExcludeBotActors && isBotActor(actor) {
+		activityLogger(activity).Debug("Skipped Relay Activity (Bot Actor)")
+		return nil
+	}
+	if activity.Type == "Create" && isActivityTooOld(activity, time.Now()) {
+		activityLogger(activity).Debug("Skipped Relay Activity (Too Old)")
+		return nil
+	}
 	if isActorAbleToRelay(actor) {
 		go enqueueActivityForSubscriber(actorID.Host, body)
+		recordCatchUpActivity(catchUpSubscriberKey, activity.Type, body)
 
+		if isReactionActivity(activity) || activity.Type == "Undo" {
+			// Reactions and their retractions are not Announce-able, LitePub followers receive nothing.
+			activityLogger(activity).Debug("Accepted Relay Activity")
+			return nil
+		}
 		var innnerObjectId, err = activity.UnwrapInnerObjectId()
 		if err != nil {
-			logrus.Debug("Accepted Relay Activity (Announce Failed) : ", activity.Actor)
+			activityLogger(activity).Debug("Accepted Relay Activity (Announce Failed)")
 		} else {
-			announce := models.NewActivityPubActivity(RelayActor, []string{RelayActor.Followers()}, innnerObjectId, "Announce")
-			jsonData, _ := json.Marshal(&announce)
-			go enqueueActivityForFollower(actorID.Host, jsonData)
-			logrus.Debug("Accepted Relay Activity : ", activity.Actor)
+			for _, jsonData := range relayAnnounces(innnerObjectId) {
+				go enqueueActivityForFollower(actorID.Host, jsonData)
+				recordCatchUpActivity(catchUpFollowerKey, activity.Type, jsonData)
+			}
+			activityLogger(activity).Debug("Accepted Relay Activity")
 		}
 	} else {
-		logrus.Debug("Skipped Relay Activity : ", activity.Actor)
+		activityLogger(activity).Debug("Skipped Relay Activity")
 	}
 	return nil
 }
@@ -379,12 +877,155 @@ func executeRelayActivity(activity *models.Activity, actor *models.Actor, body [
 func executeAnnounceActivity(activity *models.Activity, actor *models.Actor) error {
 	actorID, _ := url.Parse(actor.ID)
 	if isActorAbleToRelay(actor) {
-		announce := models.NewActivityPubActivity(RelayActor, []string{RelayActor.Followers()}, activity.ID, "Announce")
-		jsonData, _ := json.Marshal(&announce)
-		go enqueueActivityForAll(actorID.Host, jsonData)
-		logrus.Debug("Accepted Announce Activity : ", activity.Actor)
+		for _, jsonData := range relayAnnounces(activity.ID) {
+			go enqueueActivityForAll(actorID.Host, jsonData)
+			recordCatchUpActivity(catchUpSubscriberKey, activity.Type, jsonData)
+			recordCatchUpActivity(catchUpFollowerKey, activity.Type, jsonData)
+		}
+		activityLogger(activity).Debug("Accepted Announce Activity")
 	} else {
-		logrus.Debug("Skipped Announce Activity : ", activity.Actor)
+		activityLogger(activity).Debug("Skipped Announce Activity")
+	}
+	return nil
+}
+
+// executeAnnounceWithDeadline resolves the announced object and relays it. When ctx ends first, nil is
+// returned so the Announce is accepted, and resolving continues in the background bounded by the HTTP timeout.
+func executeAnnounceWithDeadline(ctx context.Context, activity *models.Activity, resolve func(context.Context) (*models.Activity, *models.Actor, error)) error {
+	done := make(chan error, 1)
+	go func() {
+		origActivity, origActor, err := resolve(context.WithoutCancel(ctx))
+		if err == nil {
+			executeAnnounceActivity(origActivity, origActor)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		activityLogger(activity).WithError(ctx.Err()).Debug("Announce resolving continues in background")
+		go func() {
+			if err := <-done; err != nil {
+				activityLogger(activity).WithError(err).Debug("Failed Announce Activity")
+			}
+		}()
+		return nil
+	}
+}
+
+// executeFlag notifies moderators of a report concerning the relay, the Flag itself is never relayed
+func executeFlag(activity *models.Activity, actor *models.Actor) {
+	actorID, _ := url.Parse(actor.ID)
+	objects := flagObjects(activity)
+	if !isFlagForRelay(activity, objects) {
+		activityLogger(activity).WithField("reporter", actor.ID).Debug("Ignored Flag (neither addressed to the relay nor about relayed content)")
+		return
+	}
+	activityLogger(activity).WithField("reporter", actor.ID).WithField("objects", objects).WithField("reason", activity.Content).Info("Received Flag")
+	discord.SendFlag(actorID.Host, actor.ID, objects, activity.Content)
+}
+
+// isFlagForRelay reports whether a Flag is addressed to or reports a relay actor, or reports objects of a subscribed
+// instance, the only content the relay passes on
+func isFlagForRelay(activity *models.Activity, objects []string) bool {
+	for _, relayActor := range relayActors() {
+		if contains(activity.To, relayActor.ID) || contains(activity.Cc, relayActor.ID) || contains(objects, relayActor.ID) {
+			return true
+		}
+	}
+	for _, object := range objects {
+		objectID, err := url.Parse(object)
+		if err == nil && objectID.Host != "" && isActorSubscribersOrFollowers(objectID) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagObjects returns the IDs of reported actors and objects, given as IDs or embedded objects
+func flagObjects(activity *models.Activity) []string {
+	var entries []interface{}
+	switch object := activity.Object.(type) {
+	case []interface{}:
+		entries = object
+	default:
+		entries = []interface{}{object}
+	}
+	var objects []string
+	for _, entry := range entries {
+		switch entry := entry.(type) {
+		case string:
+			objects = append(objects, entry)
+		case map[string]interface{}:
+			if id, ok := entry["id"].(string); ok {
+				objects = append(objects, id)
+			}
+		}
+	}
+	return objects
+}
+
+// executeMove moves the subscriber or follower record of a migrated actor to its target
+func executeMove(activity *models.Activity) error {
+	oldActorID, ok := activity.Object.(string)
+	if !ok || oldActorID != activity.Actor {
+		return errors.New("Move object must be the actor itself")
+	}
+	var subscriber *models.Subscriber
+	for i := range RelayState.Subscribers {
+		if RelayState.Subscribers[i].ActorID == oldActorID {
+			subscriber = &RelayState.Subscribers[i]
+		}
+	}
+	var follower *models.Follower
+	for i := range RelayState.Followers {
+		if RelayState.Followers[i].ActorID == oldActorID {
+			follower = &RelayState.Followers[i]
+		}
+	}
+	if subscriber == nil && follower == nil {
+		return nil
+	}
+
+	targetID := activity.TargetID()
+	target, err := models.NewActivityPubActorFromRemoteActor(targetID, GlobalConfig.UserAgent(version), ActorCache)
+	if err != nil {
+		return errors.New("failed to resolve Move target " + targetID + ": " + err.Error())
+	}
+	if target.ID != targetID || !target.IsAlsoKnownAs(oldActorID) {
+		return errors.New("Move target " + targetID + " does not list " + oldActorID + " in alsoKnownAs")
+	}
+	targetURL, err := url.Parse(target.ID)
+	if err != nil || targetURL.Host == "" {
+		return errors.New("Move target " + targetID + " has invalid id")
+	}
+	if isDomainBlocked(targetURL.Host) {
+		return errors.New("Move target " + targetURL.Host + " is blocked")
+	}
+	err = validateFollowerInbox(&target)
+	if err != nil {
+		return err
+	}
+
+	rememberSigningAlgorithm(&target)
+	if subscriber != nil {
+		moved := *subscriber
+		moved.Domain = targetURL.Host
+		moved.InboxURL = getInboxURL(&target)
+		moved.ActorID = target.ID
+		RelayState.DelSubscriber(subscriber.Domain)
+		RelayState.AddSubscriber(moved)
+	}
+	if follower != nil {
+		moved := *follower
+		moved.Domain = targetURL.Host
+		moved.InboxURL = target.Inbox
+		moved.ActorID = target.ID
+		RelayState.DelFollower(follower.Domain)
+		RelayState.AddFollower(moved)
 	}
+	activityLogger(activity).WithField("target", target.ID).Info("Moved Subscription")
 	return nil
 }
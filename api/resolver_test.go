@@ -0,0 +1,392 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/discord"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestIsDomainBlocked(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.SetBlockedDomain("*.spam.example", true)
+	RelayState.SetBlockedDomain("exact.example", true)
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	for _, tc := range []struct {
+		host    string
+		blocked bool
+	}{
+		{"x.spam.example", true},
+		{"a.b.spam.example", true},
+		{"deep.a.b.spam.example", true},
+		{"X.Spam.Example", true},
+		{"spam.example", false},
+		{"notspam.example", false},
+		{"x.spam.example.org", false},
+		{"exact.example", true},
+		{"sub.exact.example", false},
+	} {
+		if isDomainBlocked(tc.host) != tc.blocked {
+			t.Fatalf("Expected isDomainBlocked(%s) to be %v, but got %v", tc.host, tc.blocked, !tc.blocked)
+		}
+	}
+
+	RelayState.SetBlockedDomain("spam.example", true)
+	if !isDomainBlocked("spam.example") {
+		t.Fatal("Expected spam.example to be blocked when listed explicitly")
+	}
+}
+
+func TestExecuteFollowingMissingInbox(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	actor.Inbox = ""
+	actor.Endpoints = nil
+
+	err := executeFollowing(&activity, &actor, RelayActor())
+	if err == nil {
+		t.Fatal("Expected Follow from actor without inbox to be rejected, but it was accepted")
+	}
+	if len(RelayState.Subscribers) != 0 {
+		t.Fatalf("Expected no subscriber, but got %d", len(RelayState.Subscribers))
+	}
+}
+
+func TestExecuteFollowingRequireSharedInbox(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	actor.Endpoints = nil
+
+	RelayState.SetConfig(RequireSharedInbox, true)
+	err := executeFollowing(&activity, &actor, RelayActor())
+	if err == nil {
+		t.Fatal("Expected Follow from actor without sharedInbox to be rejected, but it was accepted")
+	}
+	if len(RelayState.Subscribers) != 0 {
+		t.Fatalf("Expected no subscriber, but got %d", len(RelayState.Subscribers))
+	}
+
+	RelayState.SetConfig(RequireSharedInbox, false)
+	err = executeFollowing(&activity, &actor, RelayActor())
+	if err != nil {
+		t.Fatalf("Expected single-inbox actor to be accepted, but got error: %v", err)
+	}
+	if len(RelayState.Subscribers) != 1 || RelayState.Subscribers[0].InboxURL != actor.Inbox {
+		t.Fatalf("Expected subscriber with inbox %s, but got %v", actor.Inbox, RelayState.Subscribers)
+	}
+}
+
+func TestExecuteFollowingRepeated(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	var notifications int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&notifications, 1)
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+	discord.Initialize(discord.WebhookDiscord, s.URL, "Test Relay", "")
+	defer discord.Initialize(discord.WebhookDiscord, "", "", "")
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	for i := 0; i < 2; i++ {
+		if err := executeFollowing(&activity, &actor, RelayActor()); err != nil {
+			t.Fatalf("Expected Follow to be accepted, but got error: %v", err)
+		}
+	}
+	if len(RelayState.Subscribers) != 1 {
+		t.Fatalf("Expected a single subscriber, but got %v", RelayState.Subscribers)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if atomic.LoadInt32(&notifications) != 1 {
+		t.Fatalf("Expected one follow notification, but got %d", notifications)
+	}
+
+	// The instance was re-keyed and follows again with a new actor
+	domain, _ := url.Parse(actor.ID)
+	activity.ID += "-rekeyed"
+	actor.ID = "https://" + domain.Host + "/users/relay-new"
+	if err := executeFollowing(&activity, &actor, RelayActor()); err != nil {
+		t.Fatalf("Expected repeated Follow to be accepted, but got error: %v", err)
+	}
+	subscriber := RelayState.SelectSubscriber(domain.Host)
+	if len(RelayState.Subscribers) != 1 || subscriber.ActorID != actor.ID || subscriber.ActivityID != activity.ID {
+		t.Fatalf("Expected subscriber to be updated to the new actor, but got %+v", subscriber)
+	}
+}
+
+func TestExecuteFollowingAllowlistOnly(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.Load()
+
+	var notifications int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&notifications, 1)
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+	discord.Initialize(discord.WebhookDiscord, s.URL, "Test Relay", "")
+	defer discord.Initialize(discord.WebhookDiscord, "", "", "")
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	domain, _ := url.Parse(actor.ID)
+
+	RelayState.SetConfig(AllowlistOnly, true)
+	defer RelayState.SetConfig(AllowlistOnly, false)
+	RelayState.SetAllowedDomain("allowed.example", true)
+
+	if err := executeFollowing(&activity, &actor, RelayActor()); err == nil {
+		t.Fatal("Expected Follow from domain not on the allow-list to be rejected, but it was accepted")
+	}
+	if RelayState.SelectSubscriber(domain.Host) != nil {
+		t.Fatal("Expected domain not on the allow-list not to be subscribed")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if atomic.LoadInt32(&notifications) != 1 {
+		t.Fatalf("Expected one rejection notification, but got %d", notifications)
+	}
+
+	RelayState.SetAllowedDomain(domain.Host, true)
+	activity.ID += "-allowed"
+	if err := executeFollowing(&activity, &actor, RelayActor()); err != nil {
+		t.Fatalf("Expected Follow from allowed domain to be accepted, but got error: %v", err)
+	}
+	if RelayState.SelectSubscriber(domain.Host) == nil {
+		t.Fatal("Expected allowed domain to be subscribed")
+	}
+}
+
+func TestCompareSoftwareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"4.0.0", "4.0.0", 0},
+		{"3.5.3", "4.0.0", -1},
+		{"4.2.1+glitch", "4.2.0", 1},
+		{"4.2.0-beta1", "4.2.0", 0},
+		{"4.10", "4.9.9", 1},
+		{"4", "4.0.1", -1},
+		{"2024.11.0-misskey", "13.0.0", 1},
+	} {
+		if got := compareSoftwareVersions(tc.a, tc.b); got != tc.expected {
+			t.Fatalf("Expected compareSoftwareVersions(%s, %s) to be %d, but got %d", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+func TestExecuteFollowingMinSoftwareVersion(t *testing.T) {
+	config := GlobalConfig
+	viper.Set("MIN_SOFTWARE_VERSIONS", "Mastodon:4.0.0")
+	viper.Set("MIN_SOFTWARE_VERSION_ALLOW_UNREACHABLE", false)
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = relayConfig
+	defer func() {
+		viper.Set("MIN_SOFTWARE_VERSIONS", "")
+		viper.Set("MIN_SOFTWARE_VERSION_ALLOW_UNREACHABLE", true)
+		GlobalConfig = config
+	}()
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	activity := mockActivity("Follow")
+	actor := mockActor("Person")
+	actorID, _ := url.Parse(actor.ID)
+	softwareKey := "fdma:software:" + actorID.Host
+
+	RelayState.RedisClient.HSet(context.TODO(), softwareKey, "name", "mastodon", "version", "3.5.3")
+	err = executeFollowing(&activity, &actor, RelayActor())
+	if err == nil || !strings.Contains(err.Error(), "4.0.0") {
+		t.Fatalf("Expected Follow from outdated software to be rejected with the minimum, but got %v", err)
+	}
+
+	RelayState.RedisClient.HSet(context.TODO(), softwareKey, "name", "", "version", "")
+	if err = executeFollowing(&activity, &actor, RelayActor()); err == nil {
+		t.Fatal("Expected Follow with unreachable nodeinfo to be rejected, but it was accepted")
+	}
+
+	RelayState.RedisClient.HSet(context.TODO(), softwareKey, "name", "mastodon", "version", "4.2.1+glitch")
+	if err = executeFollowing(&activity, &actor, RelayActor()); err != nil {
+		t.Fatalf("Expected Follow from current software to be accepted, but got error: %v", err)
+	}
+	if len(RelayState.Subscribers) != 1 {
+		t.Fatalf("Expected 1 subscriber, but got %d", len(RelayState.Subscribers))
+	}
+}
+
+func TestExecuteMove(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	oldActor := "https://old.example.com/actor"
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "old.example.com",
+		InboxURL:   "https://old.example.com/inbox",
+		ActivityID: "https://old.example.com/follow/1",
+		ActorID:    oldActor,
+		JoinedAt:   1700000000,
+	})
+	move := func(target string) *models.Activity {
+		return &models.Activity{
+			ID:     oldActor + "#move",
+			Type:   "Move",
+			Actor:  oldActor,
+			Object: oldActor,
+			Target: target,
+		}
+	}
+
+	t.Run("unresolvable target keeps record", func(t *testing.T) {
+		err := executeMove(move("http://127.0.0.1:1/actor"))
+		if err == nil {
+			t.Fatal("Expected Move to unresolvable target to fail, but it succeeded")
+		}
+		if RelayState.SelectSubscriber("old.example.com") == nil {
+			t.Fatal("Expected old subscriber to remain, but it was removed")
+		}
+	})
+
+	t.Run("target without alsoKnownAs keeps record", func(t *testing.T) {
+		target := "https://impostor.example.com/actor"
+		ActorCache.Set(target, []byte(`{"id":"`+target+`","type":"Application","inbox":"https://impostor.example.com/inbox"}`), time.Minute)
+		err := executeMove(move(target))
+		if err == nil {
+			t.Fatal("Expected Move without alsoKnownAs to fail, but it succeeded")
+		}
+		if RelayState.SelectSubscriber("old.example.com") == nil {
+			t.Fatal("Expected old subscriber to remain, but it was removed")
+		}
+	})
+
+	t.Run("verified target updates record", func(t *testing.T) {
+		target := "https://new.example.com/actor"
+		ActorCache.Set(target, []byte(`{"id":"`+target+`","type":"Application","inbox":"https://new.example.com/actor/inbox","endpoints":{"sharedInbox":"https://new.example.com/inbox"},"alsoKnownAs":["`+oldActor+`"]}`), time.Minute)
+		err := executeMove(move(target))
+		if err != nil {
+			t.Fatalf("Expected Move to succeed, but got error: %v", err)
+		}
+		if RelayState.SelectSubscriber("old.example.com") != nil {
+			t.Fatal("Expected old subscriber to be removed, but it remains")
+		}
+		moved := RelayState.SelectSubscriber("new.example.com")
+		if moved == nil {
+			t.Fatal("Expected subscriber for new.example.com, but got none")
+		}
+		if moved.ActorID != target || moved.InboxURL != "https://new.example.com/inbox" || moved.ActivityID != "https://old.example.com/follow/1" || moved.JoinedAt != 1700000000 {
+			t.Fatalf("Expected moved subscriber to keep follow data with new actor, but got %+v", moved)
+		}
+	})
+}
+
+func TestEnqueueActivitySkipsSource(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "Source.example.com",
+		InboxURL: "https://source.example.com/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "alias.example.com",
+		InboxURL: "https://source.example.com/shared/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "a.example.com",
+		InboxURL: "https://a.example.com/inbox",
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:   "b.example.com",
+		InboxURL: "https://b.example.com/inbox",
+	})
+
+	for name, enqueue := range map[string]func(string, []byte){
+		"subscribers": enqueueActivityForSubscriber,
+		"all":         enqueueActivityForAll,
+	} {
+		RelayState.RedisClient.Del(context.TODO(), waitRelayActivityKeys(t)...)
+		enqueue("source.example.com", []byte("body"))
+		keys := waitRelayActivityKeys(t)
+		if len(keys) != 1 {
+			t.Fatalf("Expected one stored activity for %s, but got %d", name, len(keys))
+		}
+		remainCount, _ := RelayState.RedisClient.HGet(context.TODO(), keys[0], "remain_count").Int()
+		expected := map[string]int{"subscribers": 1, "all": 2}[name]
+		if remainCount != expected {
+			t.Fatalf("Expected %d deliveries for %s without the source instance, but got %d", expected, name, remainCount)
+		}
+	}
+
+	RelayState.RedisClient.Del(context.TODO(), waitRelayActivityKeys(t)...)
+	enqueueActivityForFollower("b.example.com", []byte("body"))
+	time.Sleep(50 * time.Millisecond)
+	if keys, _ := RelayState.RedisClient.Keys(context.TODO(), "relay:activity:*").Result(); len(keys) != 0 {
+		t.Fatalf("Expected nothing stored when the source is the only recipient, but got %d", len(keys))
+	}
+}
+
+func TestEnqueueActivitySharedInbox(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		RelayState.RedisClient.FlushAll(context.TODO()).Result()
+		RelayState.Load()
+	}()
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "a.example.com",
+		InboxURL: "https://shared.example.com/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "b.example.com",
+		InboxURL: "https://shared.example.com/inbox",
+	})
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:   "c.example.com",
+		InboxURL: "https://c.example.com/inbox",
+	})
+
+	enqueueActivityForSubscriber("source.example.com", []byte("body"))
+	keys := waitRelayActivityKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("Expected one stored activity, but got %d", len(keys))
+	}
+	remainCount, _ := RelayState.RedisClient.HGet(context.TODO(), keys[0], "remain_count").Int()
+	if remainCount != 2 {
+		t.Fatalf("Expected one delivery per unique inbox, but got %d", remainCount)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(handleMetrics))
+	defer s.Close()
+	r, _ := http.Get(s.URL)
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if !strings.Contains(string(body), "relay_outbox_shared_inbox_saved_total 1\n") {
+		t.Fatalf("Expected 1 saved delivery in metrics, but got\n%s", body)
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// httpSignature : Parameters of the HTTP Signature of an inbox request.
+// Parsing follows go-fed/httpsig, whose fixed 10 seconds clock offset is replaced by SignaturePolicy.ClockSkew.
+type httpSignature struct {
+	keyID     string
+	headers   []string
+	signature string
+	created   int64
+	expires   int64
+}
+
+// signatureHeaderValue returns the header of request carrying signature parameters
+func signatureHeaderValue(request *http.Request) (string, error) {
+	hasParameters := func(value string) bool {
+		return strings.Contains(value, "keyId") || strings.Contains(value, "headers") || strings.Contains(value, "signature")
+	}
+	signature := request.Header.Get("Signature")
+	authorization := request.Header.Get("Authorization")
+	switch {
+	case hasParameters(signature) && hasParameters(authorization):
+		return "", errors.New(`both "Signature" and "Authorization" have signature parameters`)
+	case hasParameters(signature):
+		return signature, nil
+	case hasParameters(authorization):
+		return strings.TrimPrefix(authorization, "Signature "), nil
+	}
+	return "", errors.New(`neither "Signature" nor "Authorization" have signature parameters`)
+}
+
+// parseHTTPSignature reads the signature parameters of request
+func parseHTTPSignature(request *http.Request) (*httpSignature, error) {
+	value, err := signatureHeaderValue(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature httpSignature
+	for _, parameter := range strings.Split(value, ",") {
+		kv := strings.SplitN(parameter, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed http signature parameter: %v", kv)
+		}
+		v := strings.Trim(kv[1], `"`)
+		switch kv[0] {
+		case "keyId":
+			signature.keyID = v
+		case "created":
+			if signature.created, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, err
+			}
+		case "expires":
+			if signature.expires, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, err
+			}
+		case "headers":
+			signature.headers = strings.Split(v, " ")
+		case "signature":
+			signature.signature = v
+		}
+	}
+	if signature.keyID == "" {
+		return nil, errors.New(`missing "keyId" parameter in http signature`)
+	}
+	if signature.signature == "" {
+		return nil, errors.New(`missing "signature" parameter in http signature`)
+	}
+	if len(signature.headers) == 0 {
+		signature.headers = []string{"date"}
+	}
+	return &signature, nil
+}
+
+// signingString rebuilds the string signed by the sender of request
+func (signature *httpSignature) signingString(request *http.Request) (string, error) {
+	var b bytes.Buffer
+	for n, name := range signature.headers {
+		name = strings.ToLower(name)
+		b.WriteString(name + ": ")
+		switch name {
+		case "(request-target)":
+			b.WriteString(strings.ToLower(request.Method) + " " + request.URL.Path)
+			if request.URL.RawQuery != "" {
+				b.WriteString("?" + request.URL.RawQuery)
+			}
+		case "(created)":
+			if signature.created == 0 {
+				return "", errors.New("missing created value")
+			}
+			b.WriteString(strconv.FormatInt(signature.created, 10))
+		case "(expires)":
+			if signature.expires == 0 {
+				return "", errors.New("missing expires value")
+			}
+			b.WriteString(strconv.FormatInt(signature.expires, 10))
+		default:
+			values, ok := request.Header[textproto.CanonicalMIMEHeaderKey(name)]
+			if !ok && name == "host" && request.Host != "" {
+				values, ok = []string{request.Host}, true
+			}
+			if !ok {
+				return "", fmt.Errorf("missing header %q", name)
+			}
+			for i, value := range values {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(strings.TrimSpace(value))
+			}
+		}
+		if n < len(signature.headers)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// verify checks the signature of request against key
+func (signature *httpSignature) verify(request *http.Request, key models.VerificationKey) error {
+	signingString, err := signature.signingString(request)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature.signature)
+	if err != nil {
+		return err
+	}
+	switch publicKey := key.Key.(type) {
+	case *rsa.PublicKey:
+		hashed := sha256.Sum256([]byte(signingString))
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], decoded)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(publicKey, []byte(signingString), decoded) {
+			return errors.New("ed25519 verify failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("no crypto implementation available for %q", key.Algorithm)
+}
+
+// signatureDateMaxAge and signatureDateMaxAhead bound a signed Date header before the clock skew is added, as Mastodon
+// does. The window is wide so senders with drifting clocks are not rejected, it only stops replays of old requests.
+const (
+	signatureDateMaxAge   = 12 * time.Hour
+	signatureDateMaxAhead = time.Hour
+)
+
+// covers reports whether the signature covers header
+func (signature *httpSignature) covers(header string) bool {
+	for _, name := range signature.headers {
+		if strings.EqualFold(name, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignatureTime rejects a signature created after now or expired before now by more than skew, and a signed
+// Date header outside of the Date window widened by skew. An unsigned Date proves nothing and is not checked.
+func checkSignatureTime(signature *httpSignature, date string, now time.Time, skew time.Duration) error {
+	if signature.created != 0 && time.Unix(signature.created, 0).Sub(now) > skew {
+		return errors.New("created is in the future")
+	}
+	if signature.expires != 0 && now.Sub(time.Unix(signature.expires, 0)) > skew {
+		return errors.New("signature expired")
+	}
+	if date != "" && signature.covers("date") {
+		signedAt, err := http.ParseTime(date)
+		if err != nil {
+			return errors.New("date header is malformed")
+		}
+		if now.Sub(signedAt) > signatureDateMaxAge+skew {
+			return errors.New("date header is older than " + (signatureDateMaxAge + skew).String())
+		}
+		if signedAt.Sub(now) > signatureDateMaxAhead+skew {
+			return errors.New("date header is more than " + (signatureDateMaxAhead + skew).String() + " in the future")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+)
+
+func TestCheckSignatureTime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	skew := 30 * time.Second
+	signedDate := httpSignature{headers: []string{"(request-target)", "host", "Date"}}
+
+	cases := []struct {
+		name      string
+		signature httpSignature
+		date      string
+		err       string
+	}{
+		{"created at the edge", httpSignature{created: now.Unix() + 30}, "", ""},
+		{"created beyond the edge", httpSignature{created: now.Unix() + 31}, "", "created is in the future"},
+		{"created long ago", httpSignature{created: now.Unix() - 3600}, "", ""},
+		{"expires at the edge", httpSignature{expires: now.Unix() - 30}, "", ""},
+		{"expires beyond the edge", httpSignature{expires: now.Unix() - 31}, "", "signature expired"},
+		{"date behind beyond the skew", signedDate, now.Add(-skew - time.Second).UTC().Format(http.TimeFormat), ""},
+		{"date ahead beyond the skew", signedDate, now.Add(skew + time.Second).UTC().Format(http.TimeFormat), ""},
+		{"date behind at the edge", signedDate, now.Add(-signatureDateMaxAge - skew).UTC().Format(http.TimeFormat), ""},
+		{"date behind beyond the edge", signedDate, now.Add(-signatureDateMaxAge - skew - time.Second).UTC().Format(http.TimeFormat), "date header is older than 12h0m30s"},
+		{"date ahead at the edge", signedDate, now.Add(signatureDateMaxAhead + skew).UTC().Format(http.TimeFormat), ""},
+		{"date ahead beyond the edge", signedDate, now.Add(signatureDateMaxAhead + skew + time.Second).UTC().Format(http.TimeFormat), "date header is more than 1h0m30s in the future"},
+		{"unsigned date far off", httpSignature{headers: []string{"(request-target)"}}, now.Add(-48 * time.Hour).UTC().Format(http.TimeFormat), ""},
+		{"malformed date", signedDate, "yesterday", "date header is malformed"},
+	}
+	for _, c := range cases {
+		err := checkSignatureTime(&c.signature, c.date, now, skew)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: Expected signature to be accepted, but got error: %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("%s: Expected error '%s', but got '%v'", c.name, c.err, err)
+		}
+	}
+}
+
+func TestVerifyHTTPSignatureClockSkew(t *testing.T) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	publicKeyDER, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	actorID := "https://skew.example.com/actor"
+	keyID := actorID + "#main-key"
+	actor, _ := json.Marshal(map[string]interface{}{
+		"id":    actorID,
+		"type":  "Application",
+		"inbox": actorID + "/inbox",
+		"publicKey": map[string]string{
+			"id":           keyID,
+			"owner":        actorID,
+			"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})),
+		},
+	})
+	ActorCache.Set(keyID, actor, time.Minute)
+	defer ActorCache.Delete(keyID)
+
+	policy := InboxSignaturePolicy
+	InboxSignaturePolicy.ClockSkew = 30 * time.Second
+	defer func() { InboxSignaturePolicy = policy }()
+
+	signedRequest := func(date time.Time) *http.Request {
+		req, _ := http.NewRequest("POST", "/inbox", strings.NewReader("{}"))
+		req.Host = "relay.example.com"
+		req.Header.Set("Host", req.Host)
+		req.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+		signer, _, _ := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{httpsig.RequestTarget, "Host", "Date"}, httpsig.Signature, 0)
+		signer.SignRequest(privateKey, keyID, req, nil)
+		return req
+	}
+
+	// Dates beyond the clock skew were never checked before, a drifting sender is still accepted
+	for _, offset := range []time.Duration{0, -20 * time.Second, 20 * time.Second, -40 * time.Second, 40 * time.Second, -6 * time.Hour, 30 * time.Minute} {
+		if _, err := verifyHTTPSignature(signedRequest(time.Now().Add(offset))); err != nil {
+			t.Fatalf("Expected signature dated %s away to be accepted, but got error: %v", offset, err)
+		}
+	}
+	for _, offset := range []time.Duration{-13 * time.Hour, 2 * time.Hour} {
+		if _, err := verifyHTTPSignature(signedRequest(time.Now().Add(offset))); err == nil || !strings.Contains(err.Error(), "date header") {
+			t.Fatalf("Expected signature dated %s away to be rejected, but got '%v'", offset, err)
+		}
+	}
+
+	tampered := signedRequest(time.Now())
+	tampered.Header.Set("Date", time.Now().Add(time.Second).UTC().Format(http.TimeFormat))
+	if _, err := verifyHTTPSignature(tampered); err == nil || err.Error() != rsa.ErrVerification.Error() {
+		t.Fatalf("Expected tampered Date to fail verification, but got '%v'", err)
+	}
+
+	// A created parameter beyond the fixed 10 seconds of httpsig is accepted within ClockSkew
+	created := strconv.FormatInt(time.Now().Unix()+20, 10)
+	req, _ := http.NewRequest("POST", "/inbox", nil)
+	signingString := "(request-target): post /inbox\n(created): " + created
+	hashed := crypto.SHA256.New()
+	hashed.Write([]byte(signingString))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed.Sum(nil))
+	req.Header.Set("Signature", `keyId="`+keyID+`",algorithm="hs2019",created=`+created+`,headers="(request-target) (created)",signature="`+base64.StdEncoding.EncodeToString(signature)+`"`)
+	if _, err := verifyHTTPSignature(req); err != nil {
+		t.Fatalf("Expected created 20s ahead to be accepted, but got error: %v", err)
+	}
+}
@@ -3,11 +3,18 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/yukimochi/Activity-Relay/delaymetrics"
+	"github.com/yukimochi/Activity-Relay/models"
 )
 
 // DeliveryStats holds inbox/outbox statistics
@@ -15,12 +22,15 @@ type DeliveryStats struct {
 	Timestamp int64 `json:"timestamp"`
 	Inbox     int64 `json:"inbox"`
 	Outbox    int64 `json:"outbox"`
+	Failures  int64 `json:"failures"`
 }
 
 // StatsResponse is the API response format
 type StatsResponse struct {
 	Current DeliveryStats   `json:"current"`
 	History []DeliveryStats `json:"history"`
+	// Delayed is the number of deliveries held by DELIVERY_DELAY and not sent yet
+	Delayed int64 `json:"delayed"`
 }
 
 // IncrementInboxCount increments the inbox counter
@@ -28,13 +38,70 @@ func IncrementInboxCount() {
 	ctx := context.TODO()
 	now := time.Now()
 	bucket := now.Unix() / 60 * 60 // Round to minute
-	key := "relay:stats:inbox:" + strconv.FormatInt(bucket, 10)
+	key := models.RedisKey("relay:stats:inbox:") + strconv.FormatInt(bucket, 10)
 
 	RelayState.RedisClient.Incr(ctx, key)
 	RelayState.RedisClient.Expire(ctx, key, 25*time.Hour) // Keep for 25 hours
 
 	// Also increment total counter
-	RelayState.RedisClient.Incr(ctx, "relay:stats:inbox:total")
+	RelayState.RedisClient.Incr(ctx, models.RedisKey("relay:stats:inbox:total"))
+}
+
+// inboxActivityTypePattern limits activity types counted under their own name
+var inboxActivityTypePattern = regexp.MustCompile(`^[A-Za-z]{1,32}$`)
+
+// IncrementInboxTypeCount increments the inbox counter of an activity type
+func IncrementInboxTypeCount(activityType string) {
+	ctx := context.TODO()
+	if !inboxActivityTypePattern.MatchString(activityType) {
+		activityType = "Unknown"
+	}
+	now := time.Now()
+	bucket := now.Unix() / 60 * 60 // Round to minute
+	key := models.RedisKey("relay:stats:inbox:type:") + activityType + ":" + strconv.FormatInt(bucket, 10)
+
+	RelayState.RedisClient.Incr(ctx, key)
+	RelayState.RedisClient.Expire(ctx, key, 25*time.Hour) // Keep for 25 hours
+
+	// Remember the type so the window can be summed without scanning keys
+	RelayState.RedisClient.SAdd(ctx, models.RedisKey("relay:stats:inbox:types"), activityType)
+}
+
+// announceFetchResults are the outcomes counted for fetches of announced objects, success first
+var announceFetchResults = []string{"success", "timeout", "4xx", "5xx", "parse", "other"}
+
+// announceFetchResult classifies the outcome of fetching an announced object
+func announceFetchResult(err error) string {
+	var statusErr *models.HTTPStatusError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+		return "5xx"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 400:
+		return "4xx"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return "parse"
+	}
+	return "other"
+}
+
+// recordAnnounceFetch counts the outcome of fetching the announced object at objectURL by its host
+func recordAnnounceFetch(objectURL string, err error) {
+	host := ""
+	if parsed, parseErr := url.Parse(objectURL); parseErr == nil {
+		host = strings.ToLower(parsed.Host)
+	}
+	result := announceFetchResult(err)
+	RelayState.RedisClient.HIncrBy(context.TODO(), models.RedisKey("relay:stats:announce_fetch:")+result, host, 1)
+	if err != nil {
+		logger.WithError(err).WithField("host", host).WithField("reason", result).Debug("Failed to fetch announced object")
+	}
 }
 
 // IncrementOutboxCount increments the outbox counter
@@ -42,77 +109,293 @@ func IncrementOutboxCount() {
 	ctx := context.TODO()
 	now := time.Now()
 	bucket := now.Unix() / 60 * 60 // Round to minute
-	key := "relay:stats:outbox:" + strconv.FormatInt(bucket, 10)
+	key := models.RedisKey("relay:stats:outbox:") + strconv.FormatInt(bucket, 10)
 
 	RelayState.RedisClient.Incr(ctx, key)
 	RelayState.RedisClient.Expire(ctx, key, 25*time.Hour) // Keep for 25 hours
 
 	// Also increment total counter
-	RelayState.RedisClient.Incr(ctx, "relay:stats:outbox:total")
+	RelayState.RedisClient.Incr(ctx, models.RedisKey("relay:stats:outbox:total"))
 }
 
-// GetDeliveryStats retrieves delivery statistics
-func GetDeliveryStats(hours int) StatsResponse {
+// getCurrentDeliveryStats retrieves total counters
+func getCurrentDeliveryStats() DeliveryStats {
 	ctx := context.TODO()
-	now := time.Now()
-	currentBucket := now.Unix() / 60 * 60
 
-	// Get total counts
-	inboxTotal, _ := RelayState.RedisClient.Get(ctx, "relay:stats:inbox:total").Int64()
-	outboxTotal, _ := RelayState.RedisClient.Get(ctx, "relay:stats:outbox:total").Int64()
+	inboxTotal, _ := RelayState.RedisClient.Get(ctx, models.RedisKey("relay:stats:inbox:total")).Int64()
+	outboxTotal, _ := RelayState.RedisClient.Get(ctx, models.RedisKey("relay:stats:outbox:total")).Int64()
+	failuresTotal, _ := RelayState.RedisClient.Get(ctx, models.RedisKey("relay:stats:outbox:failures:total")).Int64()
 
-	current := DeliveryStats{
-		Timestamp: now.Unix(),
+	return DeliveryStats{
+		Timestamp: time.Now().Unix(),
 		Inbox:     inboxTotal,
 		Outbox:    outboxTotal,
+		Failures:  failuresTotal,
 	}
+}
 
-	// Get historical data (per minute, up to specified hours)
-	var history []DeliveryStats
-	buckets := hours * 60 // Minutes in requested hours
+// statsHistoryLimit is the longest span of delivery stats history, minute buckets are kept for 25 hours
+const statsHistoryLimit = 24 * time.Hour
 
-	for i := buckets - 1; i >= 0; i-- {
-		bucket := currentBucket - int64(i*60)
-		inboxKey := "relay:stats:inbox:" + strconv.FormatInt(bucket, 10)
-		outboxKey := "relay:stats:outbox:" + strconv.FormatInt(bucket, 10)
+// GetDeliveryStats retrieves delivery statistics of the last hours at minute resolution
+func GetDeliveryStats(hours int) StatsResponse {
+	to := time.Now().Unix() / 60 * 60
+	return GetDeliveryStatsRange(to-int64(hours*60-1)*60, to, time.Minute)
+}
 
-		inbox, _ := RelayState.RedisClient.Get(ctx, inboxKey).Int64()
-		outbox, _ := RelayState.RedisClient.Get(ctx, outboxKey).Int64()
+// GetDeliveryStatsRange retrieves delivery statistics between from and to unix time,
+// summing minute buckets into buckets of resolution
+func GetDeliveryStatsRange(from, to int64, resolution time.Duration) StatsResponse {
+	ctx := context.TODO()
+	step := int64(resolution / time.Second)
+
+	// Get total counts
+	current := getCurrentDeliveryStats()
+
+	var buckets []int64
+	var inboxKeys, outboxKeys, failuresKeys []string
+	for bucket := from / 60 * 60; bucket <= to; bucket += 60 {
+		buckets = append(buckets, bucket)
+		inboxKeys = append(inboxKeys, models.RedisKey("relay:stats:inbox:")+strconv.FormatInt(bucket, 10))
+		outboxKeys = append(outboxKeys, models.RedisKey("relay:stats:outbox:")+strconv.FormatInt(bucket, 10))
+		failuresKeys = append(failuresKeys, models.RedisKey("relay:stats:outbox:failures:")+strconv.FormatInt(bucket, 10))
+	}
+	if len(buckets) == 0 {
+		return StatsResponse{Current: current, History: []DeliveryStats{}, Delayed: delayedDeliveryCount()}
+	}
+	inbox, _ := RelayState.RedisClient.MGet(ctx, inboxKeys...).Result()
+	outbox, _ := RelayState.RedisClient.MGet(ctx, outboxKeys...).Result()
+	failures, _ := RelayState.RedisClient.MGet(ctx, failuresKeys...).Result()
 
-		history = append(history, DeliveryStats{
-			Timestamp: bucket,
-			Inbox:     inbox,
-			Outbox:    outbox,
-		})
+	var history []DeliveryStats
+	for i, bucket := range buckets {
+		timestamp := bucket / step * step
+		if len(history) == 0 || history[len(history)-1].Timestamp != timestamp {
+			history = append(history, DeliveryStats{Timestamp: timestamp})
+		}
+		stats := &history[len(history)-1]
+		stats.Inbox += statsCount(inbox, i)
+		stats.Outbox += statsCount(outbox, i)
+		stats.Failures += statsCount(failures, i)
 	}
 
 	return StatsResponse{
 		Current: current,
 		History: history,
+		Delayed: delayedDeliveryCount(),
 	}
 }
 
-func handleDeliveryStats(writer http.ResponseWriter, request *http.Request) {
+// delayedDeliveryCount returns the number of deliveries waiting for their delay to elapse
+func delayedDeliveryCount() int64 {
+	count, _ := RelayState.RedisClient.ZCard(context.TODO(), models.RedisKey(models.DelayedQueue)).Result()
+	return count
+}
+
+// statsCount returns the counter at index i of an MGet result, zero when missing
+func statsCount(values []interface{}, i int) int64 {
+	if i >= len(values) {
+		return 0
+	}
+	value, ok := values[i].(string)
+	if !ok {
+		return 0
+	}
+	count, _ := strconv.ParseInt(value, 10, 64)
+	return count
+}
+
+// DomainDeliveryStats holds the delivery count of a destination host
+type DomainDeliveryStats struct {
+	Domain  string `json:"domain"`
+	Outbox  int64  `json:"outbox"`
+	Circuit string `json:"circuit"`
+}
+
+// circuitState returns the delivery circuit breaker state of a host: closed, open or half_open
+func circuitState(host string, now time.Time) string {
+	openedUntil, _ := RelayState.RedisClient.HGet(context.TODO(), models.RedisKey("relay:circuit:")+host, "opened_until").Int64()
+	switch {
+	case openedUntil == 0:
+		return "closed"
+	case now.Unix() < openedUntil:
+		return "open"
+	default:
+		return "half_open"
+	}
+}
+
+// GetDomainDeliveryStats retrieves delivery counts per subscriber host, busiest first
+func GetDomainDeliveryStats(hours int) []DomainDeliveryStats {
+	ctx := context.TODO()
+	currentBucket := time.Now().Unix() / 60 * 60
+
+	hosts := map[string]bool{}
+	for _, subscriber := range RelayState.SubscribersAndFollowers {
+		inboxURL, err := url.Parse(subscriber.InboxURL)
+		if err == nil && inboxURL.Host != "" {
+			hosts[inboxURL.Host] = true
+		}
+	}
+
+	stats := []DomainDeliveryStats{}
+	for host := range hosts {
+		var keys []string
+		for i := 0; i < hours*60; i++ {
+			bucket := currentBucket - int64(i*60)
+			keys = append(keys, models.RedisKey("relay:stats:outbox:domain:")+host+":"+strconv.FormatInt(bucket, 10))
+		}
+		values, _ := RelayState.RedisClient.MGet(ctx, keys...).Result()
+		var outbox int64
+		for _, value := range values {
+			if count, ok := value.(string); ok {
+				n, _ := strconv.ParseInt(count, 10, 64)
+				outbox += n
+			}
+		}
+		stats = append(stats, DomainDeliveryStats{Domain: host, Outbox: outbox, Circuit: circuitState(host, time.Now())})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Outbox != stats[j].Outbox {
+			return stats[i].Outbox > stats[j].Outbox
+		}
+		return stats[i].Domain < stats[j].Domain
+	})
+
+	return stats
+}
+
+// ActivityTypeStats holds the inbox count of an activity type
+type ActivityTypeStats struct {
+	Type  string `json:"type"`
+	Inbox int64  `json:"inbox"`
+}
+
+// GetActivityTypeStats retrieves inbox counts per activity type, most frequent first
+func GetActivityTypeStats(hours int) []ActivityTypeStats {
+	ctx := context.TODO()
+	currentBucket := time.Now().Unix() / 60 * 60
+
+	activityTypes, _ := RelayState.RedisClient.SMembers(ctx, models.RedisKey("relay:stats:inbox:types")).Result()
+	stats := []ActivityTypeStats{}
+	for _, activityType := range activityTypes {
+		var keys []string
+		for i := 0; i < hours*60; i++ {
+			bucket := currentBucket - int64(i*60)
+			keys = append(keys, models.RedisKey("relay:stats:inbox:type:")+activityType+":"+strconv.FormatInt(bucket, 10))
+		}
+		values, _ := RelayState.RedisClient.MGet(ctx, keys...).Result()
+		var inbox int64
+		for _, value := range values {
+			if count, ok := value.(string); ok {
+				n, _ := strconv.ParseInt(count, 10, 64)
+				inbox += n
+			}
+		}
+		if inbox > 0 {
+			stats = append(stats, ActivityTypeStats{Type: activityType, Inbox: inbox})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Inbox != stats[j].Inbox {
+			return stats[i].Inbox > stats[j].Inbox
+		}
+		return stats[i].Type < stats[j].Type
+	})
+
+	return stats
+}
+
+func handleActivityTypeStats(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != "GET" {
 		writer.WriteHeader(400)
 		writer.Write(nil)
 		return
 	}
 
-	// Allow CORS for frontend
-	writer.Header().Set("Access-Control-Allow-Origin", "*")
 	writer.Header().Set("Content-Type", "application/json")
 
-	// Get hours parameter, default to 1 hour
-	hoursStr := request.URL.Query().Get("hours")
 	hours := 1
-	if hoursStr != "" {
-		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 && h <= 24 {
-			hours = h
+	if h, err := strconv.Atoi(request.URL.Query().Get("hours")); err == nil && h > 0 && h <= 24 {
+		hours = h
+	}
+
+	response, err := json.Marshal(map[string]interface{}{
+		"hours": hours,
+		"types": GetActivityTypeStats(hours),
+	})
+	if err != nil {
+		writer.WriteHeader(500)
+		writer.Write(nil)
+		return
+	}
+
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
+
+func handleDomainDeliveryStats(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	hours := 1
+	if h, err := strconv.Atoi(request.URL.Query().Get("hours")); err == nil && h > 0 && h <= 24 {
+		hours = h
+	}
+
+	response, err := json.Marshal(map[string]interface{}{
+		"hours":   hours,
+		"domains": GetDomainDeliveryStats(hours),
+	})
+	if err != nil {
+		writer.WriteHeader(500)
+		writer.Write(nil)
+		return
+	}
+
+	writer.WriteHeader(200)
+	writer.Write(response)
+}
+
+// handleDeliveryStats returns delivery totals with their per-minute history
+// GET /api/stats?hours=1
+// GET /api/stats?from=1700000000&to=1700003600&resolution=minute|hour
+func handleDeliveryStats(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	query := request.URL.Query()
+	var stats StatsResponse
+	if query.Get("from") != "" || query.Get("to") != "" || query.Get("resolution") != "" {
+		from, to, resolution, err := parseStatsRange(query, time.Now())
+		if err != nil {
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		stats = GetDeliveryStatsRange(from, to, resolution)
+	} else {
+		// Get hours parameter, default to 1 hour
+		hoursStr := query.Get("hours")
+		hours := 1
+		if hoursStr != "" {
+			if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 && h <= 24 {
+				hours = h
+			}
 		}
+		stats = GetDeliveryStats(hours)
 	}
 
-	stats := GetDeliveryStats(hours)
 	response, err := json.Marshal(stats)
 	if err != nil {
 		writer.WriteHeader(500)
@@ -124,7 +407,44 @@ func handleDeliveryStats(writer http.ResponseWriter, request *http.Request) {
 	writer.Write(response)
 }
 
-// handleDelayMetrics handles requests for federation delay metrics
+// parseStatsRange reads from and to unix timestamps and resolution, defaulting to the hour before now at minute resolution
+func parseStatsRange(query url.Values, now time.Time) (int64, int64, time.Duration, error) {
+	to := now.Unix()
+	if value := query.Get("to"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, 0, 0, errors.New("to must be a unix timestamp")
+		}
+		to = min(parsed, to)
+	}
+	from := to - 59*60
+	if value := query.Get("from"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, 0, 0, errors.New("from must be a unix timestamp")
+		}
+		from = parsed
+	}
+	if from > to {
+		return 0, 0, 0, errors.New("from must not be after to")
+	}
+	if time.Duration(to-from)*time.Second >= statsHistoryLimit {
+		return 0, 0, 0, errors.New("range must be shorter than 24 hours")
+	}
+
+	resolution := time.Minute
+	switch query.Get("resolution") {
+	case "", "minute":
+	case "hour":
+		resolution = time.Hour
+	default:
+		return 0, 0, 0, errors.New("resolution must be minute or hour")
+	}
+	return from, to, resolution, nil
+}
+
+// handleDelayMetrics handles requests for federation delay metrics, as CSV with ?format=csv
+// or merged by software with ?groupBy=software
 func handleDelayMetrics(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != "GET" {
 		writer.WriteHeader(400)
@@ -132,10 +452,6 @@ func handleDelayMetrics(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	// Allow CORS for frontend
-	writer.Header().Set("Access-Control-Allow-Origin", "*")
-	writer.Header().Set("Content-Type", "application/json")
-
 	// Get hours parameter, default to 24 hours
 	hoursStr := request.URL.Query().Get("hours")
 	hours := 24
@@ -148,6 +464,37 @@ func handleDelayMetrics(writer http.ResponseWriter, request *http.Request) {
 	// Get source instance from config
 	sourceInstance := GlobalConfig.ServerHostname().Host
 
+	switch request.URL.Query().Get("groupBy") {
+	case "", "instance":
+	case "software":
+		if request.URL.Query().Get("format") == "csv" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "groupBy=software is only available as JSON"})
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(200)
+		json.NewEncoder(writer).Encode(delaymetrics.GetDelayMetricsBySoftware(hours, sourceInstance))
+		return
+	default:
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(400)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "groupBy must be instance or software"})
+		return
+	}
+
+	if request.URL.Query().Get("format") == "csv" {
+		filename := "delay-metrics-" + sourceInstance + "-" + time.Now().UTC().Format("20060102") + ".csv"
+		writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		writer.WriteHeader(200)
+		delaymetrics.WriteDelayMetricsCSV(writer, hours, sourceInstance)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
 	response, err := delaymetrics.GetDelayMetricsJSON(hours, sourceInstance)
 	if err != nil {
 		writer.WriteHeader(500)
@@ -158,3 +505,100 @@ func handleDelayMetrics(writer http.ResponseWriter, request *http.Request) {
 	writer.WriteHeader(200)
 	writer.Write(response)
 }
+
+// handleAdminDelayMetricsExcluded manages hosts excluded from delay metrics until restart
+// GET /api/admin/delay-metrics/excluded
+// POST, DELETE /api/admin/delay-metrics/excluded
+// Body: {"host": "example.com"}
+// Response: {"excluded_hosts": [...]}
+func handleAdminDelayMetricsExcluded(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case "GET":
+	case "POST", "DELETE":
+		var req struct {
+			Host string `json:"host"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil || req.Host == "" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(400)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "host required"})
+			return
+		}
+		if request.Method == "POST" {
+			delaymetrics.ExcludeHost(strings.ToLower(req.Host))
+			recordAdminAction(request, "exclude_delay_metrics", strings.ToLower(req.Host), "")
+		} else {
+			delaymetrics.IncludeHost(strings.ToLower(req.Host))
+			recordAdminAction(request, "include_delay_metrics", strings.ToLower(req.Host), "")
+		}
+	default:
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]string{"excluded_hosts": delaymetrics.GetExcludedHosts()})
+}
+
+// pruneDelayMetricsInstances drops instances without recent delay metrics, returning the removed hosts
+func pruneDelayMetricsInstances(now time.Time) []string {
+	pruned, err := delaymetrics.PruneInstances(now)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to prune delay metrics instances")
+		return nil
+	}
+	if len(pruned) > 0 {
+		logger.WithField("count", len(pruned)).Info("Pruned delay metrics instances")
+	}
+	return pruned
+}
+
+// startDelayMetricsPruning prunes delay metrics instances every interval until the returned function is called
+func startDelayMetricsPruning(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				pruneDelayMetricsInstances(now)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// handleAdminDelayMetricsPrune removes instances without delay metrics in the retention window right away
+// POST /api/admin/delay-metrics/prune
+// Response: {"pruned": ["example.com", ...]}
+func handleAdminDelayMetricsPrune(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	pruned := pruneDelayMetricsInstances(time.Now())
+	if pruned == nil {
+		pruned = []string{}
+	}
+	recordAdminAction(request, "prune_delay_metrics", "", strconv.Itoa(len(pruned))+" instances")
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(map[string][]string{"pruned": pruned})
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/delaymetrics"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestHandleDelayMetrics(t *testing.T) {
+	s := httptest.NewServer(withCORS(handleDelayMetrics))
+	defer s.Close()
+
+	for _, hours := range []string{"", "?hours=6", "?hours=100"} {
+		r, err := http.Get(s.URL + hours)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		if r.StatusCode != 200 {
+			t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("Expected Content-Type to be 'application/json', but got '%s'", r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Access-Control-Allow-Origin") != "*" {
+			t.Fatalf("Expected CORS header, but got '%s'", r.Header.Get("Access-Control-Allow-Origin"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		var response map[string]interface{}
+		if err := json.Unmarshal(data, &response); err != nil {
+			t.Fatalf("Expected valid JSON response, but got error: %v", err)
+		}
+	}
+}
+
+func TestHandleDelayMetricsCSV(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	delaymetrics.RecordDelay(delaymetrics.DelayRecord{
+		NoteID:          "https://comma.example.com/notes/1",
+		DelaySeconds:    1.5,
+		InstanceHost:    "comma.example.com",
+		SoftwareName:    "fork, edition",
+		SoftwareVersion: "1.0",
+	})
+
+	s := httptest.NewServer(http.HandlerFunc(handleDelayMetrics))
+	defer s.Close()
+
+	r, err := http.Get(s.URL + "?format=csv")
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	defer r.Body.Close()
+	if r.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("Expected Content-Type to be 'text/csv; charset=utf-8', but got '%s'", r.Header.Get("Content-Type"))
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Disposition"), "attachment; filename=") {
+		t.Fatalf("Expected attachment Content-Disposition, but got '%s'", r.Header.Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(r.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV response, but got error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected header and 1 row, but got %d records", len(records))
+	}
+	if strings.Join(records[0], ",") != "host,software,avg,min,max,sample_count,last_updated" {
+		t.Fatalf("Expected CSV header, but got %v", records[0])
+	}
+	if records[1][0] != "comma.example.com" || records[1][1] != "fork, edition 1.0" || records[1][5] != "1" {
+		t.Fatalf("Expected quoted instance row, but got %v", records[1])
+	}
+}
+
+func TestHandleDelayMetricsGroupBySoftware(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		delaymetrics.RecordDelay(delaymetrics.DelayRecord{
+			NoteID:       "https://" + host + "/notes/1",
+			DelaySeconds: 2,
+			InstanceHost: host,
+			SoftwareName: "misskey",
+		})
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(handleDelayMetrics))
+	defer s.Close()
+
+	r, err := http.Get(s.URL + "?groupBy=software")
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var response delaymetrics.SoftwareMetricsResponse
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if r.StatusCode != 200 || len(response.Software) != 1 || response.Software[0].InstanceCount != 2 {
+		t.Fatalf("Expected one software group of 2 instances, but got %d %+v", r.StatusCode, response.Software)
+	}
+
+	for _, query := range []string{"?groupBy=version", "?groupBy=software&format=csv"} {
+		r, _ = http.Get(s.URL + query)
+		if r.StatusCode != 400 {
+			t.Fatalf("Expected StatusCode to be 400 for %s, but got %d", query, r.StatusCode)
+		}
+	}
+}
+
+func TestHandleDelayMetricsInvalidMethod(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleDelayMetrics))
+	defer s.Close()
+
+	r, err := http.Post(s.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleAdminDelayMetricsExcluded(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleAdminDelayMetricsExcluded))
+	defer s.Close()
+	defer delaymetrics.IncludeHost("skewed.example.com")
+
+	r, err := http.Post(s.URL, "application/json", strings.NewReader(`{"host":"Skewed.example.com"}`))
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var response map[string][]string
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if len(response["excluded_hosts"]) != 1 || response["excluded_hosts"][0] != "skewed.example.com" {
+		t.Fatalf("Expected skewed.example.com to be excluded, but got %v", response["excluded_hosts"])
+	}
+	if !delaymetrics.IsHostExcluded("skewed.example.com") {
+		t.Fatal("Expected host to be excluded from delay metrics")
+	}
+
+	req, _ := http.NewRequest("DELETE", s.URL, strings.NewReader(`{"host":"skewed.example.com"}`))
+	r, _ = http.DefaultClient.Do(req)
+	r.Body.Close()
+	if delaymetrics.IsHostExcluded("skewed.example.com") {
+		t.Fatal("Expected host to be included again")
+	}
+
+	r, _ = http.Post(s.URL, "application/json", strings.NewReader(`{}`))
+	if r.StatusCode != 400 {
+		t.Fatalf("Expected StatusCode to be 400 without host, but got %d", r.StatusCode)
+	}
+}
+
+func TestHandleAdminDelayMetricsPrune(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	RelayState.RedisClient.SAdd(context.TODO(), "fdma:all_instances", "gone.example.com")
+	delaymetrics.RecordDelay(delaymetrics.DelayRecord{
+		NoteID:       "https://active.example.com/notes/1",
+		DelaySeconds: 2,
+		InstanceHost: "active.example.com",
+	})
+
+	s := httptest.NewServer(http.HandlerFunc(handleAdminDelayMetricsPrune))
+	defer s.Close()
+
+	r, _ := http.Get(s.URL)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405, but got %d", r.StatusCode)
+	}
+
+	r, err := http.Post(s.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var response map[string][]string
+	json.NewDecoder(r.Body).Decode(&response)
+	r.Body.Close()
+	if len(response["pruned"]) != 1 || response["pruned"][0] != "gone.example.com" {
+		t.Fatalf("Expected gone.example.com to be pruned, but got %v", response["pruned"])
+	}
+}
+
+func TestHandleDomainDeliveryStats(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	for _, domain := range []string{"light.example.com", "heavy.example.com", "idle.example.com"} {
+		RelayState.AddSubscriber(models.Subscriber{
+			Domain:   domain,
+			InboxURL: "https://" + domain + "/inbox",
+		})
+	}
+	bucket := strconv.FormatInt(time.Now().Unix()/60*60, 10)
+	lastHour := strconv.FormatInt(time.Now().Unix()/60*60-3600, 10)
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:outbox:domain:heavy.example.com:"+bucket, 10, 0)
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:outbox:domain:heavy.example.com:"+lastHour, 5, 0)
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:outbox:domain:light.example.com:"+bucket, 3, 0)
+	RelayState.RedisClient.HSet(context.TODO(), "relay:circuit:light.example.com", "opened_until", time.Now().Unix()+300)
+	RelayState.RedisClient.HSet(context.TODO(), "relay:circuit:idle.example.com", "opened_until", time.Now().Unix()-1)
+
+	s := httptest.NewServer(http.HandlerFunc(handleDomainDeliveryStats))
+	defer s.Close()
+
+	for query, expected := range map[string][]DomainDeliveryStats{
+		"":         {{"heavy.example.com", 10, "closed"}, {"light.example.com", 3, "open"}, {"idle.example.com", 0, "half_open"}},
+		"?hours=2": {{"heavy.example.com", 15, "closed"}, {"light.example.com", 3, "open"}, {"idle.example.com", 0, "half_open"}},
+	} {
+		r, err := http.Get(s.URL + query)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		data, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		var response struct {
+			Domains []DomainDeliveryStats `json:"domains"`
+		}
+		json.Unmarshal(data, &response)
+		if len(response.Domains) != len(expected) {
+			t.Fatalf("Expected %d domains, but got %s", len(expected), data)
+		}
+		for i := range expected {
+			if response.Domains[i] != expected[i] {
+				t.Fatalf("Expected %v at %d for %q, but got %v", expected[i], i, query, response.Domains[i])
+			}
+		}
+	}
+}
+
+func TestHandleActivityTypeStats(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	for _, activityType := range []string{"Create", "Create", "Create", "Announce", "Follow", "", "Bad:Type"} {
+		IncrementInboxTypeCount(activityType)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(handleActivityTypeStats))
+	defer s.Close()
+
+	r, err := http.Get(s.URL + "?hours=3")
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	var response struct {
+		Hours int                 `json:"hours"`
+		Types []ActivityTypeStats `json:"types"`
+	}
+	json.Unmarshal(data, &response)
+
+	expected := []ActivityTypeStats{{"Create", 3}, {"Unknown", 2}, {"Announce", 1}, {"Follow", 1}}
+	if response.Hours != 3 || len(response.Types) != len(expected) {
+		t.Fatalf("Expected %d types over 3 hours, but got %s", len(expected), data)
+	}
+	for i := range expected {
+		if response.Types[i] != expected[i] {
+			t.Fatalf("Expected %v at %d, but got %v", expected[i], i, response.Types[i])
+		}
+	}
+}
+
+func TestHandleDeliveryStatsRange(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	previousHour := time.Now().Unix()/3600*3600 - 3600
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:inbox:"+strconv.FormatInt(previousHour+60, 10), 2, 0)
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:inbox:"+strconv.FormatInt(previousHour+120, 10), 3, 0)
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:outbox:"+strconv.FormatInt(previousHour+120, 10), 7, 0)
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:inbox:"+strconv.FormatInt(previousHour+3600, 10), 4, 0)
+
+	s := httptest.NewServer(http.HandlerFunc(handleDeliveryStats))
+	defer s.Close()
+
+	get := func(query string) (int, StatsResponse) {
+		r, err := http.Get(s.URL + query)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		var response StatsResponse
+		json.NewDecoder(r.Body).Decode(&response)
+		r.Body.Close()
+		return r.StatusCode, response
+	}
+
+	status, response := get("")
+	if status != 200 || len(response.History) != 60 {
+		t.Fatalf("Expected last hour at minute resolution by default, but got %d %d buckets", status, len(response.History))
+	}
+
+	from, to := strconv.FormatInt(previousHour+60, 10), strconv.FormatInt(previousHour+120, 10)
+	status, response = get("?from=" + from + "&to=" + to)
+	expected := []DeliveryStats{{previousHour + 60, 2, 0, 0}, {previousHour + 120, 3, 7, 0}}
+	if status != 200 || len(response.History) != 2 || response.History[0] != expected[0] || response.History[1] != expected[1] {
+		t.Fatalf("Expected %v, but got %d %v", expected, status, response.History)
+	}
+
+	status, response = get("?from=" + strconv.FormatInt(previousHour, 10) + "&resolution=hour")
+	expected = []DeliveryStats{{previousHour, 5, 7, 0}, {previousHour + 3600, 4, 0, 0}}
+	if status != 200 || len(response.History) != 2 || response.History[0] != expected[0] || response.History[1] != expected[1] {
+		t.Fatalf("Expected %v, but got %d %v", expected, status, response.History)
+	}
+
+	for _, query := range []string{"?from=" + to + "&to=" + from, "?resolution=day", "?from=abc", "?from=" + strconv.FormatInt(previousHour-86400, 10)} {
+		if status, _ := get(query); status != 400 {
+			t.Fatalf("Expected StatusCode to be 400 for %s, but got %d", query, status)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statsStreamInterval is how often the shared poller reads the counters while clients are connected
+var statsStreamInterval = 2 * time.Second
+
+// statsStreamKeepAlive is how often an idle stream sends a comment to keep proxies from closing it
+const statsStreamKeepAlive = 15 * time.Second
+
+// statsHub fans one counter poller out to every connected stats stream
+type statsHub struct {
+	mu      sync.Mutex
+	clients map[chan DeliveryStats]struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var statsStreams = &statsHub{clients: map[chan DeliveryStats]struct{}{}}
+
+// subscribe registers a client, starting the poller for the first one
+func (hub *statsHub) subscribe() chan DeliveryStats {
+	client := make(chan DeliveryStats, 1)
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.clients[client] = struct{}{}
+	if hub.stop == nil {
+		hub.stop = make(chan struct{})
+		hub.done = make(chan struct{})
+		go hub.poll(hub.stop, hub.done)
+	}
+	return client
+}
+
+// unsubscribe removes a client, stopping the poller after the last one
+func (hub *statsHub) unsubscribe(client chan DeliveryStats) {
+	hub.mu.Lock()
+	delete(hub.clients, client)
+	var stop, done chan struct{}
+	if len(hub.clients) == 0 && hub.stop != nil {
+		stop, done = hub.stop, hub.done
+		hub.stop, hub.done = nil, nil
+	}
+	hub.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (hub *statsHub) clientCount() int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return len(hub.clients)
+}
+
+func (hub *statsHub) poll(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(statsStreamInterval)
+	defer ticker.Stop()
+
+	last := getCurrentDeliveryStats()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			current := getCurrentDeliveryStats()
+			if current.Inbox == last.Inbox && current.Outbox == last.Outbox && current.Failures == last.Failures {
+				continue
+			}
+			last = current
+			hub.broadcast(current)
+		}
+	}
+}
+
+// broadcast hands stats to every client, replacing an update a slow client has not read yet
+func (hub *statsHub) broadcast(stats DeliveryStats) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for client := range hub.clients {
+		select {
+		case <-client:
+		default:
+		}
+		client <- stats
+	}
+}
+
+func writeStatsEvent(writer http.ResponseWriter, stats DeliveryStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "event: stats\ndata: %s\n\n", data)
+	return err
+}
+
+// handleStatsStream pushes DeliveryStats as Server-Sent Events whenever the counters change
+// GET /api/stats/stream
+func handleStatsStream(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(400)
+		writer.Write(nil)
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writer.WriteHeader(500)
+		writer.Write(nil)
+		return
+	}
+
+	client := statsStreams.subscribe()
+	defer statsStreams.unsubscribe(client)
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(200)
+	if writeStatsEvent(writer, getCurrentDeliveryStats()) != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(statsStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case stats := <-client:
+			if writeStatsEvent(writer, stats) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readStatsEvent(t *testing.T, reader *bufio.Reader) DeliveryStats {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected stats event, but got error: %v", err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var stats DeliveryStats
+			json.Unmarshal([]byte(data), &stats)
+			return stats
+		}
+	}
+}
+
+func TestHandleStatsStream(t *testing.T) {
+	defer func(interval time.Duration) { statsStreamInterval = interval }(statsStreamInterval)
+	statsStreamInterval = 20 * time.Millisecond
+
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.RedisClient.Set(context.TODO(), "relay:stats:inbox:total", 3, 0)
+
+	s := httptest.NewServer(http.HandlerFunc(handleStatsStream))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	clients := make([]*bufio.Reader, 3)
+	for i := range clients {
+		req, _ := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected request to succeed, but got error: %v", err)
+		}
+		defer r.Body.Close()
+		if r.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected Content-Type to be text/event-stream, but got %s", r.Header.Get("Content-Type"))
+		}
+		clients[i] = bufio.NewReader(r.Body)
+		if stats := readStatsEvent(t, clients[i]); stats.Inbox != 3 {
+			t.Fatalf("Expected initial inbox count 3, but got %d", stats.Inbox)
+		}
+	}
+
+	IncrementInboxCount()
+	for _, client := range clients {
+		if stats := readStatsEvent(t, client); stats.Inbox != 4 {
+			t.Fatalf("Expected pushed inbox count 4, but got %d", stats.Inbox)
+		}
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for statsStreams.clientCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected disconnected clients to unsubscribe, but %d remain", statsStreams.clientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	statsStreams.mu.Lock()
+	running := statsStreams.stop != nil
+	statsStreams.mu.Unlock()
+	if running {
+		t.Fatal("Expected poller to stop after the last client, but it is running")
+	}
+}
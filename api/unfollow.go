@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yukimochi/Activity-Relay/discord"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// unfollowPollInterval is how often removals past UNDO_FOLLOW_GRACE are carried out
+const unfollowPollInterval = 5 * time.Second
+
+// Subscription kinds removed by a deferred Undo(Follow)
+const (
+	unfollowSubscriber = "subscriber"
+	unfollowFollower   = "follower"
+)
+
+// deferUnfollowing removes the subscription of kind of domain once the Undo(Follow) grace period passes without a new
+// Follow from domain. Without a grace period it is removed immediately. The domain keeps receiving activities while waiting.
+// Pending removals are kept in Redis, so they survive a restart and are cancelled by a Follow handled by any API server.
+func deferUnfollowing(activity *models.Activity, domain string, kind string) {
+	grace := GlobalConfig.UndoFollowGrace()
+	if grace <= 0 {
+		removeUnfollowed(domain, kind, activity.Actor, activity.ID)
+		return
+	}
+
+	pipe := RelayState.RedisClient.TxPipeline()
+	pipe.HSet(context.TODO(), models.RedisKey("relay:unfollow:")+domain, "kind", kind, "actor", activity.Actor, "activity_id", activity.ID)
+	pipe.ZAdd(context.TODO(), models.RedisKey("relay:unfollow:pending"), redis.Z{Score: float64(time.Now().Add(grace).Unix()), Member: domain})
+	_, err := pipe.Exec(context.TODO())
+	if err != nil {
+		activityLogger(activity).WithError(err).Error("Failed to defer Unfollow Request, removing now")
+		removeUnfollowed(domain, kind, activity.Actor, activity.ID)
+		return
+	}
+	activityLogger(activity).WithField("grace", grace.String()).Info("Deferred Unfollow Request")
+}
+
+// cancelDeferredUnfollowing keeps domain registered when it follows again within the grace period, returning whether a removal was pending
+func cancelDeferredUnfollowing(domain string) bool {
+	cancelScript := "local removed = redis.call('ZREM', KEYS[1], ARGV[1]); redis.call('DEL', KEYS[2]); return removed"
+	removed, _ := RelayState.RedisClient.Eval(context.TODO(), cancelScript, []string{models.RedisKey("relay:unfollow:pending"), models.RedisKey("relay:unfollow:") + domain}, domain).Int()
+	return removed > 0
+}
+
+// processDeferredUnfollows removes the subscriptions whose grace period ended by now, returning the number removed.
+// Each removal is claimed atomically, so several API servers never carry it out twice.
+func processDeferredUnfollows(now time.Time) int {
+	domains, err := RelayState.RedisClient.ZRangeByScore(context.TODO(), models.RedisKey("relay:unfollow:pending"), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read deferred Unfollow Requests")
+		return 0
+	}
+
+	claimScript := "if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then return {} end; local fields = redis.call('HGETALL', KEYS[2]); redis.call('DEL', KEYS[2]); return fields"
+	removed := 0
+	for _, domain := range domains {
+		fields, err := RelayState.RedisClient.Eval(context.TODO(), claimScript, []string{models.RedisKey("relay:unfollow:pending"), models.RedisKey("relay:unfollow:") + domain}, domain).StringSlice()
+		if err != nil || len(fields) == 0 {
+			continue
+		}
+		pending := map[string]string{}
+		for i := 0; i+1 < len(fields); i += 2 {
+			pending[fields[i]] = fields[i+1]
+		}
+		removeUnfollowed(domain, pending["kind"], pending["actor"], pending["activity_id"])
+		removed++
+	}
+	return removed
+}
+
+// removeUnfollowed removes the subscription of kind of domain, left by the Undo(Follow) activityID of actorID
+func removeUnfollowed(domain string, kind string, actorID string, activityID string) {
+	switch kind {
+	case unfollowSubscriber:
+		RelayState.DelSubscriber(domain)
+	case unfollowFollower:
+		RelayState.DelFollower(domain)
+	default:
+		return
+	}
+	activityLogger(&models.Activity{ID: activityID, Actor: actorID}).Info("Accepted Unfollow Request")
+	// Send Discord notification for unregistration
+	discord.SendNotificationBatched(discord.NotifyUnfollow, domain, actorID)
+}
+
+// startDeferredUnfollows carries out due removals every interval until the returned function is called.
+// It runs without a grace period configured too, so removals pending before a restart are carried out.
+func startDeferredUnfollows(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				processDeferredUnfollows(now)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
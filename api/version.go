@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// versionInfo is the build information of a running relay
+type versionInfo struct {
+	Version     string   `json:"version"`
+	Commit      string   `json:"commit"`
+	BuildDate   string   `json:"build_date"`
+	GoVersion   string   `json:"go_version"`
+	RelayStyles []string `json:"relay_styles"`
+}
+
+// relayStyles returns the relay protocols served, Mastodon subscriptions and LitePub follows
+func relayStyles() []string {
+	return []string{"mastodon", "litepub"}
+}
+
+// handleVersion reports the build information of the relay
+// GET /api/version
+// Response: {"version": "...", "commit": "...", "build_date": "...", "go_version": "...", "relay_styles": [...]}
+func handleVersion(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		writer.WriteHeader(405)
+		writer.Write(nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	json.NewEncoder(writer).Encode(versionInfo{
+		Version:     version,
+		Commit:      BuildCommit,
+		BuildDate:   BuildDate,
+		GoVersion:   runtime.Version(),
+		RelayStyles: relayStyles(),
+	})
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestHandleVersion(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(handleVersion))
+	defer s.Close()
+
+	defer func(commit, date string) { BuildCommit, BuildDate = commit, date }(BuildCommit, BuildDate)
+	BuildCommit, BuildDate = "0123abc", "2024-01-01T00:00:00Z"
+
+	r, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed, but got error: %v", err)
+	}
+	var info versionInfo
+	json.NewDecoder(r.Body).Decode(&info)
+	r.Body.Close()
+	if r.StatusCode != 200 {
+		t.Fatalf("Expected StatusCode to be 200, but got %d", r.StatusCode)
+	}
+	if info.Commit != "0123abc" || info.BuildDate != "2024-01-01T00:00:00Z" || info.GoVersion != runtime.Version() {
+		t.Fatalf("Expected build information to be reported, but got %+v", info)
+	}
+	if len(info.RelayStyles) != 2 {
+		t.Fatalf("Expected relay styles to be reported, but got %v", info.RelayStyles)
+	}
+
+	r, _ = http.Post(s.URL, "application/json", nil)
+	if r.StatusCode != 405 {
+		t.Fatalf("Expected StatusCode to be 405 for POST, but got %d", r.StatusCode)
+	}
+}
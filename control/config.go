@@ -2,6 +2,7 @@ package control
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -11,6 +12,13 @@ import (
 const (
 	PersonOnly models.Config = iota
 	ManuallyAccept
+	RelayReactions
+	RequireSharedInbox
+	ExcludeBotActors
+	AllowlistOnly
+	RequirePublished
+	AllowUnsignedDeletes
+	RequireLanguage
 )
 
 func configCmdInit() *cobra.Command {
@@ -52,6 +60,17 @@ func configCmdInit() *cobra.Command {
 	configImport.MarkFlagRequired("data")
 	config.AddCommand(configImport)
 
+	var configValidate = &cobra.Command{
+		Use:   "validate [flags]",
+		Short: "Validate relay database",
+		Long:  "Report inconsistent entries in relay database, optionally removing orphaned ones.",
+		Run: func(cmd *cobra.Command, args []string) {
+			InitProxy(validateConfig, cmd, args)
+		},
+	}
+	configValidate.Flags().Bool("repair", false, "Remove orphaned entries")
+	config.AddCommand(configValidate)
+
 	var configEnable = &cobra.Command{
 		Use:   "enable",
 		Short: "Enable relay configuration",
@@ -59,7 +78,21 @@ func configCmdInit() *cobra.Command {
  - person-only
 	Blocking feature for service-type actor.
  - manually-accept
-	Enable manually accept follow request.`,
+	Enable manually accept follow request.
+ - relay-reactions
+	Relay Like and EmojiReact activities.
+ - require-shared-inbox
+	Reject follow request from actor without sharedInbox.
+ - exclude-bot-actors
+	Do not relay posts by Service or Application actors.
+ - allowlist-only
+	Reject follow request from domains not set as allowed.
+ - require-published
+	Do not relay posts without published timestamp while max-activity-age is set.
+ - allow-unsigned-deletes
+	Relay actor self-deletions whose signature cannot be verified.
+ - require-language
+	Do not relay posts without language while language filters are set.`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return InitProxyE(configEnable, cmd, args)
@@ -74,7 +107,21 @@ func configCmdInit() *cobra.Command {
  - person-only
 	Blocking feature for service-type actor.
  - manually-accept
-	Enable manually accept follow request.`,
+	Enable manually accept follow request.
+ - relay-reactions
+	Relay Like and EmojiReact activities.
+ - require-shared-inbox
+	Reject follow request from actor without sharedInbox.
+ - exclude-bot-actors
+	Do not relay posts by Service or Application actors.
+ - allowlist-only
+	Reject follow request from domains not set as allowed.
+ - require-published
+	Do not relay posts without published timestamp while max-activity-age is set.
+ - allow-unsigned-deletes
+	Relay actor self-deletions whose signature cannot be verified.
+ - require-language
+	Do not relay posts without language while language filters are set.`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return InitProxyE(configDisable, cmd, args)
@@ -82,6 +129,19 @@ func configCmdInit() *cobra.Command {
 	}
 	config.AddCommand(configDisable)
 
+	var configSet = &cobra.Command{
+		Use:   "set [key] [value]",
+		Short: "Set relay configuration value",
+		Long: `Set relay configuration value.
+ - max-activity-age
+	Do not relay posts published longer ago than the duration (e.g. 1h), 0 disables.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(configSetValue, cmd, args)
+		},
+	}
+	config.AddCommand(configSet)
+
 	return config
 }
 
@@ -99,6 +159,27 @@ func editConfig(key string, value bool) string {
 	case "manually-accept":
 		RelayState.SetConfig(ManuallyAccept, value)
 		return "Manual follow request acceptance is " + statement + "."
+	case "relay-reactions":
+		RelayState.SetConfig(RelayReactions, value)
+		return "Reaction relaying is " + statement + "."
+	case "require-shared-inbox":
+		RelayState.SetConfig(RequireSharedInbox, value)
+		return "sharedInbox requirement is " + statement + "."
+	case "exclude-bot-actors":
+		RelayState.SetConfig(ExcludeBotActors, value)
+		return "Bot actor exclusion is " + statement + "."
+	case "allowlist-only":
+		RelayState.SetConfig(AllowlistOnly, value)
+		return "Allow-list only mode is " + statement + "."
+	case "require-published":
+		RelayState.SetConfig(RequirePublished, value)
+		return "Published timestamp requirement is " + statement + "."
+	case "allow-unsigned-deletes":
+		RelayState.SetConfig(AllowUnsignedDeletes, value)
+		return "Unsigned Delete acceptance is " + statement + "."
+	case "require-language":
+		RelayState.SetConfig(RequireLanguage, value)
+		return "Language requirement is " + statement + "."
 	}
 	return "Invalid configuration provided: " + key
 }
@@ -119,9 +200,33 @@ func configDisable(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func configSetValue(cmd *cobra.Command, args []string) error {
+	switch args[0] {
+	case "max-activity-age":
+		age, err := time.ParseDuration(args[1])
+		if err != nil || age < 0 {
+			cmd.Println("Invalid duration provided: " + args[1])
+			return nil
+		}
+		RelayState.SetMaxActivityAge(age)
+		cmd.Println("Max activity age is set to " + age.String() + ".")
+	default:
+		cmd.Println("Invalid configuration provided: " + args[0])
+	}
+	return nil
+}
+
 func listConfig(cmd *cobra.Command, _ []string) {
 	cmd.Println("Person-Type Actor limitation:", RelayState.RelayConfig.PersonOnly)
 	cmd.Println("Manual follow request acceptance:", RelayState.RelayConfig.ManuallyAccept)
+	cmd.Println("Reaction relaying:", RelayState.RelayConfig.RelayReactions)
+	cmd.Println("sharedInbox requirement:", RelayState.RelayConfig.RequireSharedInbox)
+	cmd.Println("Bot actor exclusion:", RelayState.RelayConfig.ExcludeBotActors)
+	cmd.Println("Allow-list only mode:", RelayState.RelayConfig.AllowlistOnly)
+	cmd.Println("Published timestamp requirement:", RelayState.RelayConfig.RequirePublished)
+	cmd.Println("Unsigned Delete acceptance:", RelayState.RelayConfig.AllowUnsignedDeletes)
+	cmd.Println("Language requirement:", RelayState.RelayConfig.RequireLanguage)
+	cmd.Println("Max activity age:", RelayState.MaxActivityAge)
 }
 
 func exportConfig(cmd *cobra.Command, _ []string) {
@@ -129,6 +234,19 @@ func exportConfig(cmd *cobra.Command, _ []string) {
 	cmd.Println(string(jsonData))
 }
 
+func validateConfig(cmd *cobra.Command, _ []string) {
+	report := RelayState.Validate()
+	for _, anomaly := range report.Anomalies {
+		cmd.Println(anomaly.Key+":", anomaly.Problem)
+	}
+	cmd.Println("Checked", report.CheckedKeys, "keys, found", len(report.Anomalies), "anomalies")
+
+	repair, _ := cmd.Flags().GetBool("repair")
+	if repair {
+		cmd.Println("Removed", RelayState.RepairOrphans(report), "orphaned entries")
+	}
+}
+
 func importConfig(cmd *cobra.Command, _ []string) {
 	jsonData := cmd.Flag("data").Value.String()
 	var data models.RelayState
@@ -146,6 +264,38 @@ func importConfig(cmd *cobra.Command, _ []string) {
 		RelayState.SetConfig(ManuallyAccept, true)
 		cmd.Println("Manual follow request acceptance is enabled.")
 	}
+	if data.RelayConfig.RelayReactions {
+		RelayState.SetConfig(RelayReactions, true)
+		cmd.Println("Reaction relaying is enabled.")
+	}
+	if data.RelayConfig.RequireSharedInbox {
+		RelayState.SetConfig(RequireSharedInbox, true)
+		cmd.Println("sharedInbox requirement is enabled.")
+	}
+	if data.RelayConfig.ExcludeBotActors {
+		RelayState.SetConfig(ExcludeBotActors, true)
+		cmd.Println("Bot actor exclusion is enabled.")
+	}
+	if data.RelayConfig.AllowlistOnly {
+		RelayState.SetConfig(AllowlistOnly, true)
+		cmd.Println("Allow-list only mode is enabled.")
+	}
+	if data.RelayConfig.RequirePublished {
+		RelayState.SetConfig(RequirePublished, true)
+		cmd.Println("Published timestamp requirement is enabled.")
+	}
+	if data.RelayConfig.AllowUnsignedDeletes {
+		RelayState.SetConfig(AllowUnsignedDeletes, true)
+		cmd.Println("Unsigned Delete acceptance is enabled.")
+	}
+	if data.RelayConfig.RequireLanguage {
+		RelayState.SetConfig(RequireLanguage, true)
+		cmd.Println("Language requirement is enabled.")
+	}
+	if data.MaxActivityAge > 0 {
+		RelayState.SetMaxActivityAge(data.MaxActivityAge)
+		cmd.Println("Max activity age is set to " + data.MaxActivityAge.String() + ".")
+	}
 	for _, LimitedDomain := range data.LimitedDomains {
 		RelayState.SetLimitedDomain(LimitedDomain, true)
 		cmd.Println("Set [" + LimitedDomain + "] as limited domain")
@@ -154,12 +304,33 @@ func importConfig(cmd *cobra.Command, _ []string) {
 		RelayState.SetBlockedDomain(BlockedDomain, true)
 		cmd.Println("Set [" + BlockedDomain + "] as blocked domain")
 	}
+	for _, AllowedDomain := range data.AllowedDomains {
+		RelayState.SetAllowedDomain(AllowedDomain, true)
+		cmd.Println("Set [" + AllowedDomain + "] as allowed domain")
+	}
+	for _, BatchDomain := range data.BatchDomains {
+		RelayState.SetBatchDomain(BatchDomain, true)
+		cmd.Println("Set [" + BatchDomain + "] as batch delivery domain")
+	}
+	for _, ActivityType := range data.DisabledActivityTypes {
+		RelayState.SetActivityTypeEnabled(ActivityType, false)
+		cmd.Println("Disabled relaying [" + ActivityType + "] activities")
+	}
+	for _, TagFilter := range data.TagFilters {
+		RelayState.SetTagFilter(TagFilter, true)
+		cmd.Println("Set [#" + TagFilter + "] as hashtag filter")
+	}
+	for _, LanguageFilter := range data.LanguageFilters {
+		RelayState.SetLanguageFilter(LanguageFilter, true)
+		cmd.Println("Set [" + LanguageFilter + "] as language filter")
+	}
 	for _, Subscription := range data.Subscribers {
 		RelayState.AddSubscriber(models.Subscriber{
 			Domain:     Subscription.Domain,
 			InboxURL:   Subscription.InboxURL,
 			ActivityID: Subscription.ActivityID,
 			ActorID:    Subscription.ActorID,
+			JoinedAt:   Subscription.JoinedAt,
 		})
 		cmd.Println("Register [" + Subscription.Domain + "] as subscriber")
 	}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestPersonOnlyConfiguration(t *testing.T) {
@@ -57,6 +58,30 @@ func TestManuallyAcceptConfiguration(t *testing.T) {
 	})
 }
 
+func TestMaxActivityAgeConfiguration(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	app := configCmdInit()
+
+	t.Run("Set max-activity-age configuration", func(t *testing.T) {
+		app.SetArgs([]string{"set", "max-activity-age", "1h"})
+		app.Execute()
+		RelayState.Load()
+		if RelayState.MaxActivityAge != time.Hour {
+			t.Fatalf("Expected MaxActivityAge to be 1h, but got %v", RelayState.MaxActivityAge)
+		}
+	})
+
+	t.Run("Unset max-activity-age configuration", func(t *testing.T) {
+		app.SetArgs([]string{"set", "max-activity-age", "0"})
+		app.Execute()
+		RelayState.Load()
+		if RelayState.MaxActivityAge != 0 {
+			t.Fatalf("Expected MaxActivityAge to be disabled, but got %v", RelayState.MaxActivityAge)
+		}
+	})
+}
+
 func TestInvalidConfig(t *testing.T) {
 	RelayState.RedisClient.FlushAll(context.TODO()).Result()
 
@@ -98,6 +123,27 @@ func TestListConfig(t *testing.T) {
 	}
 }
 
+func TestValidateConfig(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer RelayState.RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.RedisClient.HSet(context.TODO(), "relay:subscription:orphan.example.com", "activity_id", "https://orphan.example.com/follow")
+
+	app := configCmdInit()
+	buffer := new(bytes.Buffer)
+	app.SetOut(buffer)
+
+	app.SetArgs([]string{"validate", "--repair"})
+	app.Execute()
+
+	output := buffer.String()
+	if !strings.Contains(output, "relay:subscription:orphan.example.com: missing inbox_url") || !strings.Contains(output, "Removed 1 orphaned entries") {
+		t.Fatalf("Expected orphaned subscription to be reported and removed, but got: %s", output)
+	}
+	if exists, _ := RelayState.RedisClient.Exists(context.TODO(), "relay:subscription:orphan.example.com").Result(); exists != 0 {
+		t.Fatal("Expected orphaned subscription to be removed, but it remains")
+	}
+}
+
 func TestExportConfig(t *testing.T) {
 	RelayState.RedisClient.FlushAll(context.TODO()).Result()
 
@@ -12,7 +12,7 @@ func domainCmdInit() *cobra.Command {
 	var domain = &cobra.Command{
 		Use:   "domain",
 		Short: "Manage subscriber domains",
-		Long:  "List all subscribers, set/unset domains as limited or blocked and unfollow domains.",
+		Long:  "List all subscribers, set/unset domains as limited, blocked or allowed and unfollow domains.",
 	}
 
 	var domainList = &cobra.Command{
@@ -23,32 +23,32 @@ func domainCmdInit() *cobra.Command {
 			return InitProxyE(listDomains, cmd, args)
 		},
 	}
-	domainList.Flags().StringP("type", "t", "subscriber", "domain type [subscriber,limited,blocked]")
+	domainList.Flags().StringP("type", "t", "subscriber", "domain type [subscriber,limited,blocked,allowed]")
 	domain.AddCommand(domainList)
 
 	var domainSet = &cobra.Command{
 		Use:   "set [flags]",
-		Short: "Set domains as limited or blocked",
-		Long:  "Set domains as limited or blocked.",
+		Short: "Set domains as limited, blocked or allowed",
+		Long:  "Set domains as limited, blocked or allowed. Blocked and allowed domains accept wildcard such as *.example.com to match all subdomains.",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return InitProxyE(setDomainType, cmd, args)
 		},
 	}
-	domainSet.Flags().StringP("type", "t", "", "Apply domain type [limited,blocked]")
+	domainSet.Flags().StringP("type", "t", "", "Apply domain type [limited,blocked,allowed]")
 	domainSet.MarkFlagRequired("type")
 	domain.AddCommand(domainSet)
 
 	var domainUnset = &cobra.Command{
 		Use:   "unset [flags]",
-		Short: "Unset domains as limited or blocked",
-		Long:  "Unset domains as limited or blocked.",
+		Short: "Unset domains as limited, blocked or allowed",
+		Long:  "Unset domains as limited, blocked or allowed.",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return InitProxyE(unsetDomainType, cmd, args)
 		},
 	}
-	domainUnset.Flags().StringP("type", "t", "", "Apply domain type [limited,blocked]")
+	domainUnset.Flags().StringP("type", "t", "", "Apply domain type [limited,blocked,allowed]")
 	domainUnset.MarkFlagRequired("type")
 	domain.AddCommand(domainUnset)
 
@@ -74,7 +74,7 @@ func createUnfollowToSubscriberRequest(subscriber models.Subscriber) error {
 		Object:  "https://www.w3.org/ns/activitystreams#Public",
 	}
 
-	resp := activity.GenerateReply(RelayActor, activity, "Reject")
+	resp := activity.GenerateReply(relayActorFor(subscriber.RelayActor), activity, "Reject")
 	jsonData, _ := json.Marshal(&resp)
 	enqueueRegisterActivity(subscriber.InboxURL, jsonData)
 
@@ -82,15 +82,16 @@ func createUnfollowToSubscriberRequest(subscriber models.Subscriber) error {
 }
 
 func createUnfollowToFollowerRequest(follower models.Follower) error {
+	relayActor := relayActorFor(follower.RelayActor)
 	activity := models.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
 		ID:      follower.ActivityID,
 		Actor:   follower.ActorID,
 		Type:    "Follow",
-		Object:  RelayActor.ID,
+		Object:  relayActor.ID,
 	}
 
-	resp := activity.GenerateReply(RelayActor, activity, "Reject")
+	resp := activity.GenerateReply(relayActor, activity, "Reject")
 	jsonData, _ := json.Marshal(&resp)
 	enqueueRegisterActivity(follower.InboxURL, jsonData)
 
@@ -112,6 +113,12 @@ func listDomains(cmd *cobra.Command, _ []string) error {
 			count = count + 1
 			cmd.Println(domain)
 		}
+	case "allowed":
+		cmd.Println(" - Allowed domains:")
+		for _, domain := range RelayState.AllowedDomains {
+			count = count + 1
+			cmd.Println(domain)
+		}
 	default:
 		cmd.Println(" - Subscriber list:")
 		subscribers := RelayState.Subscribers
@@ -147,6 +154,11 @@ func setDomainType(cmd *cobra.Command, args []string) error {
 			RelayState.SetBlockedDomain(domain, true)
 			cmd.Println("Set [" + domain + "] as blocked domain")
 		}
+	case "allowed":
+		for _, domain := range args {
+			RelayState.SetAllowedDomain(domain, true)
+			cmd.Println("Set [" + domain + "] as allowed domain")
+		}
 	default:
 		cmd.Println("Invalid type provided: " + cmd.Flag("type").Value.String())
 	}
@@ -166,6 +178,11 @@ func unsetDomainType(cmd *cobra.Command, args []string) error {
 			RelayState.SetBlockedDomain(domain, false)
 			cmd.Println("Unset [" + domain + "] as blocked domain")
 		}
+	case "allowed":
+		for _, domain := range args {
+			RelayState.SetAllowedDomain(domain, false)
+			cmd.Println("Unset [" + domain + "] as allowed domain")
+		}
 	default:
 		cmd.Println("Invalid type provided: " + cmd.Flag("type").Value.String())
 	}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -90,8 +91,24 @@ func enqueueRegisterActivity(inboxURL string, body []byte) {
 	}
 }
 
+// relayActorFor returns the relay actor of the identity identityID recorded on a subscription, the main actor when empty or unknown
+func relayActorFor(identityID string) models.Actor {
+	if identity, found := GlobalConfig.RelayIdentityByActorID(identityID); found {
+		return models.NewActivityPubActorFromRelayIdentity(GlobalConfig, identity)
+	}
+	return RelayActor
+}
+
+// identityActorID returns the ID recorded on subscriptions following relayActor, empty for the main relay actor
+func identityActorID(relayActor models.Actor) string {
+	if relayActor.ID == RelayActor.ID {
+		return ""
+	}
+	return relayActor.ID
+}
+
 func createFollowRequestResponse(domain string, response string) error {
-	data, err := RelayState.RedisClient.HGetAll(context.TODO(), "relay:pending:"+domain).Result()
+	data, err := RelayState.RedisClient.HGetAll(context.TODO(), models.RedisKey("relay:pending:")+domain).Result()
 	if err != nil {
 		return err
 	}
@@ -103,13 +120,14 @@ func createFollowRequestResponse(domain string, response string) error {
 		Object:  data["object"],
 	}
 
-	resp := activity.GenerateReply(RelayActor, activity, response)
+	relayActor := relayActorFor(data["relay_actor"])
+	resp := activity.GenerateReply(relayActor, activity, response)
 	jsonData, err := json.Marshal(&resp)
 	if err != nil {
 		return err
 	}
 	enqueueRegisterActivity(data["inbox_url"], jsonData)
-	RelayState.RedisClient.Del(context.TODO(), "relay:pending:"+domain)
+	RelayState.RedisClient.Del(context.TODO(), models.RedisKey("relay:pending:")+domain)
 
 	// Send Discord notification for admin action
 	if response == "Accept" {
@@ -126,19 +144,23 @@ func createFollowRequestResponse(domain string, response string) error {
 				InboxURL:   data["inbox_url"],
 				ActivityID: data["activity_id"],
 				ActorID:    data["actor"],
+				JoinedAt:   time.Now().Unix(),
+				RelayActor: identityActorID(relayActor),
 			})
 		}
-	case contains(activity.Object, RelayActor.ID):
+	case contains(activity.Object, relayActor.ID):
 		if response == "Accept" {
 			RelayState.AddFollower(models.Follower{
 				Domain:     domain,
 				InboxURL:   data["inbox_url"],
 				ActivityID: data["activity_id"],
 				ActorID:    data["actor"],
+				JoinedAt:   time.Now().Unix(),
+				RelayActor: identityActorID(relayActor),
 			})
 			actorID, _ := url.Parse(data["actor"])
 			if !contains(RelayState.LimitedDomains, actorID.Host) {
-				followRequest := models.NewActivityPubActivity(RelayActor, []string{data["actor"]}, data["actor"], "Follow")
+				followRequest := models.NewActivityPubActivity(relayActor, []string{data["actor"]}, data["actor"], "Follow")
 				jsonData, _ := json.Marshal(&followRequest)
 				enqueueRegisterActivity(data["inbox_url"], jsonData)
 			}
@@ -148,13 +170,14 @@ func createFollowRequestResponse(domain string, response string) error {
 }
 
 func createUpdateActorActivity(subscription models.Subscriber) error {
+	relayActor := relayActorFor(subscription.RelayActor)
 	activity := models.Activity{
 		Context: []string{"https://www.w3.org/ns/activitystreams"},
-		ID:      GlobalConfig.ServerHostname().String() + "/activities/" + uuid.New().String(),
-		Actor:   GlobalConfig.ServerHostname().String() + "/actor",
+		ID:      relayActor.ID + "/activities/" + uuid.New().String(),
+		Actor:   relayActor.ID,
 		Type:    "Update",
 		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
-		Object:  RelayActor,
+		Object:  relayActor,
 	}
 
 	jsonData, err := json.Marshal(&activity)
@@ -169,12 +192,12 @@ func createUpdateActorActivity(subscription models.Subscriber) error {
 func listFollows(cmd *cobra.Command, _ []string) error {
 	var domains []string
 	cmd.Println(" - Follow requests:")
-	follows, err := RelayState.RedisClient.Keys(context.TODO(), "relay:pending:*").Result()
+	follows, err := RelayState.RedisClient.Keys(context.TODO(), models.RedisKey("relay:pending:*")).Result()
 	if err != nil {
 		return err
 	}
 	for _, follow := range follows {
-		domains = append(domains, strings.Replace(follow, "relay:pending:", "", 1))
+		domains = append(domains, strings.Replace(follow, models.RedisKey("relay:pending:"), "", 1))
 	}
 	for _, domain := range domains {
 		cmd.Println(domain)
@@ -187,12 +210,12 @@ func listFollows(cmd *cobra.Command, _ []string) error {
 func acceptFollow(cmd *cobra.Command, args []string) error {
 	var err error
 	var domains []string
-	follows, err := RelayState.RedisClient.Keys(context.TODO(), "relay:pending:*").Result()
+	follows, err := RelayState.RedisClient.Keys(context.TODO(), models.RedisKey("relay:pending:*")).Result()
 	if err != nil {
 		return err
 	}
 	for _, follow := range follows {
-		domains = append(domains, strings.Replace(follow, "relay:pending:", "", 1))
+		domains = append(domains, strings.Replace(follow, models.RedisKey("relay:pending:"), "", 1))
 	}
 
 	for _, domain := range args {
@@ -210,12 +233,12 @@ func acceptFollow(cmd *cobra.Command, args []string) error {
 func rejectFollow(cmd *cobra.Command, args []string) error {
 	var err error
 	var domains []string
-	follows, err := RelayState.RedisClient.Keys(context.TODO(), "relay:pending:*").Result()
+	follows, err := RelayState.RedisClient.Keys(context.TODO(), models.RedisKey("relay:pending:*")).Result()
 	if err != nil {
 		return err
 	}
 	for _, follow := range follows {
-		domains = append(domains, strings.Replace(follow, "relay:pending:", "", 1))
+		domains = append(domains, strings.Replace(follow, models.RedisKey("relay:pending:"), "", 1))
 	}
 
 	for _, domain := range args {
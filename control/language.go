@@ -0,0 +1,78 @@
+package control
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func languageCmdInit() *cobra.Command {
+	var language = &cobra.Command{
+		Use:   "language",
+		Short: "Manage language filters",
+		Long:  "List language filters and set/unset languages required for relaying posts, e.g. ja or zh-hant. Relay everything when no filter is set.",
+	}
+
+	var languageList = &cobra.Command{
+		Use:   "list",
+		Short: "List language filters",
+		Long:  "List language filters.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(listLanguages, cmd, args)
+		},
+	}
+	language.AddCommand(languageList)
+
+	var languageSet = &cobra.Command{
+		Use:   "set",
+		Short: "Set language filters",
+		Long:  "Set languages required for relaying posts.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(setLanguages, cmd, args)
+		},
+	}
+	language.AddCommand(languageSet)
+
+	var languageUnset = &cobra.Command{
+		Use:   "unset",
+		Short: "Unset language filters",
+		Long:  "Unset languages required for relaying posts.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(unsetLanguages, cmd, args)
+		},
+	}
+	language.AddCommand(languageUnset)
+
+	return language
+}
+
+func listLanguages(cmd *cobra.Command, _ []string) error {
+	cmd.Println(" - Language filters:")
+	for _, language := range RelayState.LanguageFilters {
+		cmd.Println(language)
+	}
+	cmd.Println(fmt.Sprintf("Total: %d", len(RelayState.LanguageFilters)))
+
+	return nil
+}
+
+func setLanguages(cmd *cobra.Command, args []string) error {
+	for _, language := range args {
+		RelayState.SetLanguageFilter(language, true)
+		cmd.Println("Set [" + models.NormalizeLanguage(language) + "] as language filter")
+	}
+
+	return nil
+}
+
+func unsetLanguages(cmd *cobra.Command, args []string) error {
+	for _, language := range args {
+		RelayState.SetLanguageFilter(language, false)
+		cmd.Println("Unset [" + models.NormalizeLanguage(language) + "] as language filter")
+	}
+
+	return nil
+}
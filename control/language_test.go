@@ -0,0 +1,40 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestSetAndUnsetLanguages(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	app := languageCmdInit()
+	app.SetArgs([]string{"set", "JA", "zh_Hant"})
+	app.Execute()
+	RelayState.Load()
+
+	if !contains(RelayState.LanguageFilters, "ja") || !contains(RelayState.LanguageFilters, "zh-hant") {
+		t.Fatalf("Expected language filters to be set, but got %v", RelayState.LanguageFilters)
+	}
+
+	app = languageCmdInit()
+	app.SetArgs([]string{"unset", "zh-hant"})
+	app.Execute()
+	RelayState.Load()
+
+	buffer := new(bytes.Buffer)
+	app = languageCmdInit()
+	app.SetOut(buffer)
+	app.SetArgs([]string{"list"})
+	app.Execute()
+
+	output := buffer.String()
+	valid := ` - Language filters:
+ja
+Total: 1
+`
+	if output != valid {
+		t.Fatalf("Expected output to be '%s', but got '%s'", valid, output)
+	}
+}
@@ -0,0 +1,78 @@
+package control
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func tagCmdInit() *cobra.Command {
+	var tag = &cobra.Command{
+		Use:   "tag",
+		Short: "Manage hashtag filters",
+		Long:  "List hashtag filters and set/unset hashtags required for relaying posts. Relay everything when no filter is set.",
+	}
+
+	var tagList = &cobra.Command{
+		Use:   "list",
+		Short: "List hashtag filters",
+		Long:  "List hashtag filters.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(listTags, cmd, args)
+		},
+	}
+	tag.AddCommand(tagList)
+
+	var tagSet = &cobra.Command{
+		Use:   "set",
+		Short: "Set hashtag filters",
+		Long:  "Set hashtags required for relaying posts.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(setTags, cmd, args)
+		},
+	}
+	tag.AddCommand(tagSet)
+
+	var tagUnset = &cobra.Command{
+		Use:   "unset",
+		Short: "Unset hashtag filters",
+		Long:  "Unset hashtags required for relaying posts.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return InitProxyE(unsetTags, cmd, args)
+		},
+	}
+	tag.AddCommand(tagUnset)
+
+	return tag
+}
+
+func listTags(cmd *cobra.Command, _ []string) error {
+	cmd.Println(" - Hashtag filters:")
+	for _, tag := range RelayState.TagFilters {
+		cmd.Println("#" + tag)
+	}
+	cmd.Println(fmt.Sprintf("Total: %d", len(RelayState.TagFilters)))
+
+	return nil
+}
+
+func setTags(cmd *cobra.Command, args []string) error {
+	for _, tag := range args {
+		RelayState.SetTagFilter(tag, true)
+		cmd.Println("Set [#" + models.NormalizeHashtag(tag) + "] as hashtag filter")
+	}
+
+	return nil
+}
+
+func unsetTags(cmd *cobra.Command, args []string) error {
+	for _, tag := range args {
+		RelayState.SetTagFilter(tag, false)
+		cmd.Println("Unset [#" + models.NormalizeHashtag(tag) + "] as hashtag filter")
+	}
+
+	return nil
+}
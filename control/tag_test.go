@@ -0,0 +1,40 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestSetAndUnsetTags(t *testing.T) {
+	RelayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	app := tagCmdInit()
+	app.SetArgs([]string{"set", "#GameDev", "indiedev"})
+	app.Execute()
+	RelayState.Load()
+
+	if !contains(RelayState.TagFilters, "gamedev") || !contains(RelayState.TagFilters, "indiedev") {
+		t.Fatalf("Expected hashtag filters to be set, but got %v", RelayState.TagFilters)
+	}
+
+	app = tagCmdInit()
+	app.SetArgs([]string{"unset", "#indiedev"})
+	app.Execute()
+	RelayState.Load()
+
+	buffer := new(bytes.Buffer)
+	app = tagCmdInit()
+	app.SetOut(buffer)
+	app.SetArgs([]string{"list"})
+	app.Execute()
+
+	output := buffer.String()
+	valid := ` - Hashtag filters:
+#gamedev
+Total: 1
+`
+	if output != valid {
+		t.Fatalf("Expected output to be '%s', but got '%s'", valid, output)
+	}
+}
@@ -2,12 +2,20 @@ package delaymetrics
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
 )
 
 // DelayRecord represents a single delay measurement
@@ -31,8 +39,19 @@ type InstanceStats struct {
 	AvgDelaySeconds float64 `json:"avg_delay_seconds"`
 	MinDelaySeconds float64 `json:"min_delay_seconds"`
 	MaxDelaySeconds float64 `json:"max_delay_seconds"`
+	P50DelaySeconds float64 `json:"p50_delay_seconds"`
+	P95DelaySeconds float64 `json:"p95_delay_seconds"`
+	P99DelaySeconds float64 `json:"p99_delay_seconds"`
 	SampleCount     int64   `json:"sample_count"`
 	LastUpdated     int64   `json:"last_updated"`
+	// Histogram counts delays in the buckets of SetHistogramBuckets, in ascending order
+	Histogram []HistogramBucket `json:"histogram,omitempty"`
+}
+
+// HistogramBucket counts delays at least the bound of the previous bucket and below the bound of this one
+type HistogramBucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
 }
 
 // HourlyStats represents stats for a specific hour
@@ -49,16 +68,138 @@ type DelayMetricsResponse struct {
 	Hourly         []HourlyStats   `json:"hourly,omitempty"`
 }
 
+// SoftwareStats represents stats of all instances running a software
+type SoftwareStats struct {
+	SoftwareName    string  `json:"software_name"`
+	InstanceCount   int     `json:"instance_count"`
+	AvgDelaySeconds float64 `json:"avg_delay_seconds"`
+	MinDelaySeconds float64 `json:"min_delay_seconds"`
+	MaxDelaySeconds float64 `json:"max_delay_seconds"`
+	SampleCount     int64   `json:"sample_count"`
+	LastUpdated     int64   `json:"last_updated"`
+}
+
+// SoftwareMetricsResponse is the API response format grouped by software
+type SoftwareMetricsResponse struct {
+	LastUpdated    int64           `json:"last_updated"`
+	SourceInstance string          `json:"source_instance"`
+	Software       []SoftwareStats `json:"software"`
+}
+
+// unknownSoftware groups instances whose software could not be resolved
+const unknownSoftware = "unknown"
+
+// maxDelaySamples bounds the per-hour, per-instance sorted set used for percentiles
+const maxDelaySamples = 1000
+
 var redisClient *redis.Client
 
-// Initialize sets up the Redis client for delay metrics
-func Initialize(client *redis.Client) {
+// retention is how long hourly delay data is kept
+const retention = 25 * time.Hour
+
+// histogramBounds are the upper bounds of histogram buckets, a last bucket holds longer delays
+var histogramBounds = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 5 * time.Minute}
+
+// ExcludedHosts lists instances whose delays are not recorded, guard with excludedHostsMutex
+var ExcludedHosts = map[string]bool{}
+var excludedHostsMutex sync.RWMutex
+
+// trimDelaySamplesScript removes one random-ranked sample when the set exceeds its cap
+var trimDelaySamplesScript = redis.NewScript(`
+	if redis.call('ZCARD', KEYS[1]) > tonumber(ARGV[1]) then
+		redis.call('ZREMRANGEBYRANK', KEYS[1], ARGV[2], ARGV[2])
+	end
+	return 1
+`)
+
+// Initialize sets up the Redis client and excluded hosts for delay metrics
+func Initialize(client *redis.Client, excludedHosts ...string) {
 	redisClient = client
+
+	excludedHostsMutex.Lock()
+	ExcludedHosts = map[string]bool{}
+	for _, host := range excludedHosts {
+		ExcludedHosts[host] = true
+	}
+	excludedHostsMutex.Unlock()
+}
+
+// SetHistogramBuckets sets ascending upper bounds of delay histogram buckets, empty disables the histogram
+func SetHistogramBuckets(bounds []time.Duration) {
+	histogramBounds = bounds
+}
+
+// formatBound writes a bucket bound without zero units, e.g. 5m instead of 5m0s
+func formatBound(bound time.Duration) string {
+	label := bound.String()
+	if strings.HasSuffix(label, "m0s") {
+		label = strings.TrimSuffix(label, "0s")
+	}
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
+
+// histogramLabels returns the labels of histogram buckets in ascending order, e.g. <1s, 1s-5s, >=5s
+func histogramLabels() []string {
+	if len(histogramBounds) == 0 {
+		return nil
+	}
+	labels := []string{"<" + formatBound(histogramBounds[0])}
+	for i := 1; i < len(histogramBounds); i++ {
+		labels = append(labels, formatBound(histogramBounds[i-1])+"-"+formatBound(histogramBounds[i]))
+	}
+	return append(labels, ">="+formatBound(histogramBounds[len(histogramBounds)-1]))
+}
+
+// histogramLabel returns the label of the bucket holding delaySeconds
+func histogramLabel(delaySeconds float64) string {
+	labels := histogramLabels()
+	for i, bound := range histogramBounds {
+		if delaySeconds < bound.Seconds() {
+			return labels[i]
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// ExcludeHost stops recording delays from the host until restart or IncludeHost
+func ExcludeHost(host string) {
+	excludedHostsMutex.Lock()
+	defer excludedHostsMutex.Unlock()
+	ExcludedHosts[host] = true
+}
+
+// IncludeHost resumes recording delays from the host
+func IncludeHost(host string) {
+	excludedHostsMutex.Lock()
+	defer excludedHostsMutex.Unlock()
+	delete(ExcludedHosts, host)
+}
+
+// IsHostExcluded returns whether delays from the host are ignored
+func IsHostExcluded(host string) bool {
+	excludedHostsMutex.RLock()
+	defer excludedHostsMutex.RUnlock()
+	return ExcludedHosts[host]
+}
+
+// GetExcludedHosts returns excluded hosts in sorted order
+func GetExcludedHosts() []string {
+	excludedHostsMutex.RLock()
+	defer excludedHostsMutex.RUnlock()
+	hosts := []string{}
+	for host := range ExcludedHosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
 }
 
 // RecordDelay records a federation delay measurement
 func RecordDelay(record DelayRecord) error {
-	if redisClient == nil {
+	if redisClient == nil || IsHostExcluded(record.InstanceHost) {
 		return nil
 	}
 
@@ -67,10 +208,10 @@ func RecordDelay(record DelayRecord) error {
 	hourBucket := now.Unix() / 3600 * 3600 // Round to hour
 
 	// Key for hourly instance data
-	hourKey := "fdma:hour:" + strconv.FormatInt(hourBucket, 10) + ":" + record.InstanceHost
+	hourKey := models.RedisKey("fdma:hour:") + strconv.FormatInt(hourBucket, 10) + ":" + record.InstanceHost
 
 	// Store the delay value in a sorted set for calculating percentiles
-	delayKey := "fdma:delays:" + strconv.FormatInt(hourBucket, 10) + ":" + record.InstanceHost
+	delayKey := models.RedisKey("fdma:delays:") + strconv.FormatInt(hourBucket, 10) + ":" + record.InstanceHost
 
 	pipe := redisClient.Pipeline()
 
@@ -94,16 +235,29 @@ func RecordDelay(record DelayRecord) error {
 	pipe.HSetNX(ctx, hourKey, "min_delay", record.DelaySeconds)
 	pipe.HSetNX(ctx, hourKey, "max_delay", record.DelaySeconds)
 
-	// Set expiration (keep for 25 hours)
-	pipe.Expire(ctx, hourKey, 25*time.Hour)
-	pipe.Expire(ctx, delayKey, 25*time.Hour)
+	// Count the delay in its histogram bucket
+	histogramKey := models.RedisKey("fdma:histogram:") + strconv.FormatInt(hourBucket, 10) + ":" + record.InstanceHost
+	if len(histogramBounds) > 0 {
+		pipe.HIncrBy(ctx, histogramKey, histogramLabel(record.DelaySeconds), 1)
+		pipe.Expire(ctx, histogramKey, retention)
+	}
+
+	// Store the individual sample, member is unique per measurement
+	pipe.ZAdd(ctx, delayKey, redis.Z{
+		Score:  record.DelaySeconds,
+		Member: strconv.FormatInt(record.ReceivedAt.UnixNano(), 10) + ":" + record.NoteID,
+	})
+
+	// Set expiration
+	pipe.Expire(ctx, hourKey, retention)
+	pipe.Expire(ctx, delayKey, retention)
 
 	// Track which instances were seen in this hour
-	pipe.SAdd(ctx, "fdma:instances:"+strconv.FormatInt(hourBucket, 10), record.InstanceHost)
-	pipe.Expire(ctx, "fdma:instances:"+strconv.FormatInt(hourBucket, 10), 25*time.Hour)
+	pipe.SAdd(ctx, models.RedisKey("fdma:instances:")+strconv.FormatInt(hourBucket, 10), record.InstanceHost)
+	pipe.Expire(ctx, models.RedisKey("fdma:instances:")+strconv.FormatInt(hourBucket, 10), retention)
 
 	// Track all known instances
-	pipe.SAdd(ctx, "fdma:all_instances", record.InstanceHost)
+	pipe.SAdd(ctx, models.RedisKey("fdma:all_instances"), record.InstanceHost)
 
 	_, err := pipe.Exec(ctx)
 	if err != nil {
@@ -127,27 +281,119 @@ func RecordDelay(record DelayRecord) error {
 	`)
 	updateMinMaxScript.Run(ctx, redisClient, []string{hourKey}, record.DelaySeconds)
 
+	// Bound memory by dropping a random sample once over the cap. Every later sample gives each kept one another chance
+	// to be dropped, so this is not reservoir sampling: percentiles of a busy hour lean towards its recent delays.
+	trimDelaySamplesScript.Run(ctx, redisClient, []string{delayKey}, maxDelaySamples, rand.Intn(maxDelaySamples+1))
+
 	return nil
 }
 
-// GetInstanceStats retrieves stats for a specific instance and hour
-func getInstanceStats(ctx context.Context, hourBucket int64, host string) (*InstanceStats, error) {
-	hourKey := "fdma:hour:" + strconv.FormatInt(hourBucket, 10) + ":" + host
+// PruneInstances removes hosts without hour buckets within the retention window from fdma:all_instances,
+// returning the removed hosts. A host recording again is added back.
+func PruneInstances(now time.Time) ([]string, error) {
+	if redisClient == nil {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	currentHour := now.Unix() / 3600 * 3600
+	keys := []string{models.RedisKey("fdma:all_instances")}
+	for hourBucket := currentHour; hourBucket > now.Add(-retention).Unix(); hourBucket -= 3600 {
+		keys = append(keys, models.RedisKey("fdma:instances:")+strconv.FormatInt(hourBucket, 10))
+	}
+	stale, err := redisClient.SDiff(ctx, keys...).Result()
+	if err != nil || len(stale) == 0 {
+		return nil, err
+	}
+
+	members := make([]interface{}, len(stale))
+	for i, host := range stale {
+		members[i] = host
+	}
+	if err := redisClient.SRem(ctx, keys[0], members...).Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// getDelaySamples retrieves the delay samples of an instance in an hour, sorted ascending
+func getDelaySamples(ctx context.Context, hourBucket int64, host string) ([]float64, error) {
+	delayKey := models.RedisKey("fdma:delays:") + strconv.FormatInt(hourBucket, 10) + ":" + host
+
+	samples, err := redisClient.ZRangeWithScores(ctx, delayKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Score)
+	}
+	return values, nil
+}
+
+// getHistogram retrieves the delay histogram of an instance in an hour, buckets of other bounds are left out
+func getHistogram(ctx context.Context, hourBucket int64, host string) []HistogramBucket {
+	labels := histogramLabels()
+	if len(labels) == 0 {
+		return nil
+	}
+	histogramKey := models.RedisKey("fdma:histogram:") + strconv.FormatInt(hourBucket, 10) + ":" + host
+	counts, _ := redisClient.HGetAll(ctx, histogramKey).Result()
+
+	histogram := make([]HistogramBucket, 0, len(labels))
+	for _, label := range labels {
+		count, _ := strconv.ParseInt(counts[label], 10, 64)
+		histogram = append(histogram, HistogramBucket{Label: label, Count: count})
+	}
+	return histogram
+}
+
+// mergeHistogram adds the counts of histogram to total, both having the buckets of histogramLabels
+func mergeHistogram(total []HistogramBucket, histogram []HistogramBucket) []HistogramBucket {
+	if total == nil {
+		return append([]HistogramBucket(nil), histogram...)
+	}
+	for i := range total {
+		if i < len(histogram) {
+			total[i].Count += histogram[i].Count
+		}
+	}
+	return total
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// getInstanceStats retrieves stats for a specific instance and hour, along with its delay samples sorted ascending
+func getInstanceStats(ctx context.Context, hourBucket int64, host string) (*InstanceStats, []float64, error) {
+	hourKey := models.RedisKey("fdma:hour:") + strconv.FormatInt(hourBucket, 10) + ":" + host
 
 	data, err := redisClient.HGetAll(ctx, hourKey).Result()
 	if err != nil || len(data) == 0 {
-		return nil, err
+		return nil, nil, err
 	}
 
 	count, _ := strconv.ParseInt(data["count"], 10, 64)
 	if count == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	totalDelay, _ := strconv.ParseFloat(data["total_delay"], 64)
 	minDelay, _ := strconv.ParseFloat(data["min_delay"], 64)
 	maxDelay, _ := strconv.ParseFloat(data["max_delay"], 64)
 	lastUpdated, _ := strconv.ParseInt(data["last_updated"], 10, 64)
+	samples, _ := getDelaySamples(ctx, hourBucket, host)
 
 	return &InstanceStats{
 		Host:            data["host"],
@@ -157,9 +403,13 @@ func getInstanceStats(ctx context.Context, hourBucket int64, host string) (*Inst
 		AvgDelaySeconds: totalDelay / float64(count),
 		MinDelaySeconds: minDelay,
 		MaxDelaySeconds: maxDelay,
+		P50DelaySeconds: percentile(samples, 50),
+		P95DelaySeconds: percentile(samples, 95),
+		P99DelaySeconds: percentile(samples, 99),
 		SampleCount:     count,
 		LastUpdated:     lastUpdated,
-	}, nil
+		Histogram:       getHistogram(ctx, hourBucket, host),
+	}, samples, nil
 }
 
 // GetDelayMetrics retrieves delay metrics for the specified number of hours
@@ -192,12 +442,14 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 		Software    string
 		Version     string
 		LastUpdated int64
+		Samples     []float64
+		Histogram   []HistogramBucket
 	})
 
 	// Collect hourly data
 	for i := 0; i < hours; i++ {
 		hourBucket := currentHour - int64(i*3600)
-		instancesKey := "fdma:instances:" + strconv.FormatInt(hourBucket, 10)
+		instancesKey := models.RedisKey("fdma:instances:") + strconv.FormatInt(hourBucket, 10)
 
 		instances, err := redisClient.SMembers(ctx, instancesKey).Result()
 		if err != nil {
@@ -210,7 +462,7 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 		}
 
 		for _, host := range instances {
-			stats, err := getInstanceStats(ctx, hourBucket, host)
+			stats, samples, err := getInstanceStats(ctx, hourBucket, host)
 			if err != nil || stats == nil {
 				continue
 			}
@@ -228,6 +480,8 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 					Software    string
 					Version     string
 					LastUpdated int64
+					Samples     []float64
+					Histogram   []HistogramBucket
 				}{
 					MinDelay: stats.MinDelaySeconds,
 					MaxDelay: stats.MaxDelaySeconds,
@@ -254,6 +508,8 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 			if stats.LastUpdated > s.LastUpdated {
 				s.LastUpdated = stats.LastUpdated
 			}
+			s.Samples = append(s.Samples, samples...)
+			s.Histogram = mergeHistogram(s.Histogram, stats.Histogram)
 		}
 
 		response.Hourly = append(response.Hourly, hourlyStats)
@@ -262,6 +518,7 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 	// Build summary
 	for host, data := range summaryMap {
 		if data.TotalCount > 0 {
+			sort.Float64s(data.Samples)
 			response.Summary = append(response.Summary, InstanceStats{
 				Host:            host,
 				Name:            data.Name,
@@ -270,8 +527,12 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 				AvgDelaySeconds: data.TotalDelay / float64(data.TotalCount),
 				MinDelaySeconds: data.MinDelay,
 				MaxDelaySeconds: data.MaxDelay,
+				P50DelaySeconds: percentile(data.Samples, 50),
+				P95DelaySeconds: percentile(data.Samples, 95),
+				P99DelaySeconds: percentile(data.Samples, 99),
 				SampleCount:     data.TotalCount,
 				LastUpdated:     data.LastUpdated,
+				Histogram:       data.Histogram,
 			})
 		}
 	}
@@ -279,8 +540,83 @@ func GetDelayMetrics(hours int, sourceInstance string) DelayMetricsResponse {
 	return response
 }
 
+// GetDelayMetricsBySoftware merges the instance summary of the specified number of hours by software name,
+// averages are weighted by sample count
+func GetDelayMetricsBySoftware(hours int, sourceInstance string) SoftwareMetricsResponse {
+	metrics := GetDelayMetrics(hours, sourceInstance)
+	response := SoftwareMetricsResponse{
+		LastUpdated:    metrics.LastUpdated,
+		SourceInstance: sourceInstance,
+		Software:       []SoftwareStats{},
+	}
+
+	softwareMap := make(map[string]*SoftwareStats)
+	totalDelay := make(map[string]float64)
+	for _, instance := range metrics.Summary {
+		name := strings.ToLower(strings.TrimSpace(instance.SoftwareName))
+		if name == "" {
+			name = unknownSoftware
+		}
+		s := softwareMap[name]
+		if s == nil {
+			s = &SoftwareStats{
+				SoftwareName:    name,
+				MinDelaySeconds: instance.MinDelaySeconds,
+				MaxDelaySeconds: instance.MaxDelaySeconds,
+			}
+			softwareMap[name] = s
+		}
+		s.InstanceCount++
+		s.SampleCount += instance.SampleCount
+		totalDelay[name] += instance.AvgDelaySeconds * float64(instance.SampleCount)
+		s.MinDelaySeconds = math.Min(s.MinDelaySeconds, instance.MinDelaySeconds)
+		s.MaxDelaySeconds = math.Max(s.MaxDelaySeconds, instance.MaxDelaySeconds)
+		if instance.LastUpdated > s.LastUpdated {
+			s.LastUpdated = instance.LastUpdated
+		}
+	}
+
+	for name, s := range softwareMap {
+		s.AvgDelaySeconds = totalDelay[name] / float64(s.SampleCount)
+		response.Software = append(response.Software, *s)
+	}
+	sort.Slice(response.Software, func(i, j int) bool {
+		if response.Software[i].SampleCount != response.Software[j].SampleCount {
+			return response.Software[i].SampleCount > response.Software[j].SampleCount
+		}
+		return response.Software[i].SoftwareName < response.Software[j].SoftwareName
+	})
+
+	return response
+}
+
 // GetDelayMetricsJSON returns the delay metrics as JSON bytes
 func GetDelayMetricsJSON(hours int, sourceInstance string) ([]byte, error) {
 	metrics := GetDelayMetrics(hours, sourceInstance)
 	return json.Marshal(metrics)
 }
+
+// WriteDelayMetricsCSV writes the per-instance summary as CSV
+func WriteDelayMetricsCSV(w io.Writer, hours int, sourceInstance string) error {
+	metrics := GetDelayMetrics(hours, sourceInstance)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"host", "software", "avg", "min", "max", "sample_count", "last_updated"})
+	for _, instance := range metrics.Summary {
+		software := strings.TrimSpace(instance.SoftwareName + " " + instance.SoftwareVersion)
+		lastUpdated := ""
+		if instance.LastUpdated > 0 {
+			lastUpdated = time.Unix(instance.LastUpdated, 0).UTC().Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			instance.Host,
+			software,
+			strconv.FormatFloat(instance.AvgDelaySeconds, 'f', 3, 64),
+			strconv.FormatFloat(instance.MinDelaySeconds, 'f', 3, 64),
+			strconv.FormatFloat(instance.MaxDelaySeconds, 'f', 3, 64),
+			strconv.FormatInt(instance.SampleCount, 10),
+			lastUpdated,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,141 @@
+package delaymetrics
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGetDelayMetricsBySoftware(t *testing.T) {
+	redisOption, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	if err != nil {
+		t.Skip("REDIS_URL is not set")
+	}
+	Initialize(redis.NewClient(redisOption))
+	defer Initialize(nil)
+	redisClient.FlushAll(context.TODO())
+	defer redisClient.FlushAll(context.TODO())
+
+	records := []DelayRecord{
+		{NoteID: "https://a.example.com/notes/1", DelaySeconds: 1, InstanceHost: "a.example.com", SoftwareName: "mastodon"},
+		{NoteID: "https://a.example.com/notes/2", DelaySeconds: 1, InstanceHost: "a.example.com", SoftwareName: "mastodon"},
+		{NoteID: "https://a.example.com/notes/3", DelaySeconds: 1, InstanceHost: "a.example.com", SoftwareName: "mastodon"},
+		{NoteID: "https://b.example.com/notes/1", DelaySeconds: 5, InstanceHost: "b.example.com", SoftwareName: "Mastodon"},
+		{NoteID: "https://c.example.com/notes/1", DelaySeconds: 3, InstanceHost: "c.example.com"},
+	}
+	for i, record := range records {
+		record.ReceivedAt = time.Unix(int64(i), 0)
+		RecordDelay(record)
+	}
+
+	metrics := GetDelayMetricsBySoftware(1, "relay.example.com")
+	if len(metrics.Software) != 2 {
+		t.Fatalf("Expected 2 software groups, but got %+v", metrics.Software)
+	}
+	mastodon := metrics.Software[0]
+	if mastodon.SoftwareName != "mastodon" || mastodon.InstanceCount != 2 || mastodon.SampleCount != 4 {
+		t.Fatalf("Expected 2 mastodon instances with 4 samples, but got %+v", mastodon)
+	}
+	if mastodon.AvgDelaySeconds != 2 || mastodon.MinDelaySeconds != 1 || mastodon.MaxDelaySeconds != 5 {
+		t.Fatalf("Expected average weighted by sample count of 2 between 1 and 5, but got %+v", mastodon)
+	}
+	unknown := metrics.Software[1]
+	if unknown.SoftwareName != unknownSoftware || unknown.InstanceCount != 1 || unknown.AvgDelaySeconds != 3 {
+		t.Fatalf("Expected instance without software to be grouped as unknown, but got %+v", unknown)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, c := range []struct {
+		p        float64
+		expected float64
+	}{
+		{0, 1},
+		{10, 1},
+		{11, 2},
+		{50, 5},
+		{95, 10},
+		{99, 10},
+		{100, 10},
+	} {
+		if actual := percentile(sorted, c.p); actual != c.expected {
+			t.Fatalf("Expected p%v of 1..10 to be %v, but got %v", c.p, c.expected, actual)
+		}
+	}
+	if actual := percentile([]float64{0.5, 2.5, 7}, 50); actual != 2.5 {
+		t.Fatalf("Expected p50 of 3 samples to be the middle one, but got %v", actual)
+	}
+	if actual := percentile(nil, 50); actual != 0 {
+		t.Fatalf("Expected 0 without samples, but got %v", actual)
+	}
+}
+
+func TestDelayHistogram(t *testing.T) {
+	redisOption, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	if err != nil {
+		t.Skip("REDIS_URL is not set")
+	}
+	Initialize(redis.NewClient(redisOption))
+	defer Initialize(nil)
+	redisClient.FlushAll(context.TODO())
+	defer redisClient.FlushAll(context.TODO())
+
+	for i, delay := range []float64{0.5, 1, 4.9, 10, 400} {
+		RecordDelay(DelayRecord{NoteID: "https://a.example.com/notes/" + strconv.Itoa(i), DelaySeconds: delay, InstanceHost: "a.example.com", ReceivedAt: time.Unix(int64(i), 0)})
+	}
+
+	summary := GetDelayMetrics(1, "relay.example.com").Summary
+	if len(summary) != 1 {
+		t.Fatalf("Expected 1 instance, but got %d", len(summary))
+	}
+	expected := []HistogramBucket{{"<1s", 1}, {"1s-5s", 2}, {"5s-30s", 1}, {"30s-5m", 0}, {">=5m", 1}}
+	if !reflect.DeepEqual(summary[0].Histogram, expected) {
+		t.Fatalf("Expected histogram %v, but got %v", expected, summary[0].Histogram)
+	}
+
+	SetHistogramBuckets([]time.Duration{2 * time.Second, time.Hour})
+	defer SetHistogramBuckets([]time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 5 * time.Minute})
+	if labels := histogramLabels(); !reflect.DeepEqual(labels, []string{"<2s", "2s-1h", ">=1h"}) {
+		t.Fatalf("Expected labels of configured buckets, but got %v", labels)
+	}
+	if label := histogramLabel(2); label != "2s-1h" {
+		t.Fatalf("Expected a delay on a bound to land in the bucket above it, but got %s", label)
+	}
+}
+
+func TestPruneInstances(t *testing.T) {
+	redisOption, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	if err != nil {
+		t.Skip("REDIS_URL is not set")
+	}
+	Initialize(redis.NewClient(redisOption))
+	defer Initialize(nil)
+	redisClient.FlushAll(context.TODO())
+	defer redisClient.FlushAll(context.TODO())
+
+	RecordDelay(DelayRecord{NoteID: "https://a.example.com/notes/1", DelaySeconds: 1, InstanceHost: "a.example.com", ReceivedAt: time.Now()})
+	staleBucket := time.Now().Add(-2*retention).Unix() / 3600 * 3600
+	redisClient.SAdd(context.TODO(), "fdma:all_instances", "b.example.com")
+	redisClient.SAdd(context.TODO(), "fdma:instances:"+strconv.FormatInt(staleBucket, 10), "b.example.com")
+
+	pruned, err := PruneInstances(time.Now())
+	if err != nil {
+		t.Fatalf("Expected pruning to succeed, but got error: %v", err)
+	}
+	if !reflect.DeepEqual(pruned, []string{"b.example.com"}) {
+		t.Fatalf("Expected b.example.com to be pruned, but got %v", pruned)
+	}
+	instances, _ := redisClient.SMembers(context.TODO(), "fdma:all_instances").Result()
+	if !reflect.DeepEqual(instances, []string{"a.example.com"}) {
+		t.Fatalf("Expected only a.example.com to remain, but got %v", instances)
+	}
+	if pruned, _ := PruneInstances(time.Now()); len(pruned) != 0 {
+		t.Fatalf("Expected nothing left to prune, but got %v", pruned)
+	}
+}
@@ -0,0 +1,154 @@
+package delaymetrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// softwareCacheTTL is how long resolved software is kept per instance
+const softwareCacheTTL = 24 * time.Hour
+
+// softwareFailureTTL delays the next lookup after a failed nodeinfo fetch
+const softwareFailureTTL = time.Hour
+
+// softwareBodyLimit bounds nodeinfo documents read from remote instances
+const softwareBodyLimit = 1 << 20
+
+var softwareClient = models.HTTPClient
+
+// softwareFetching holds hosts with a nodeinfo fetch in flight
+var softwareFetching sync.Map
+
+type nodeinfoLinks struct {
+	Links []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+type nodeinfoSoftware struct {
+	Software struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"software"`
+}
+
+// LookupSoftware returns cached software name/version of the host.
+// Unknown hosts are resolved in background and return empty strings until cached.
+func LookupSoftware(host string) (string, string) {
+	if redisClient == nil || host == "" {
+		return "", ""
+	}
+
+	data, err := redisClient.HGetAll(context.Background(), models.RedisKey("fdma:software:")+host).Result()
+	if err == nil && len(data) > 0 {
+		return data["name"], data["version"]
+	}
+
+	if _, fetching := softwareFetching.LoadOrStore(host, true); !fetching {
+		go func() {
+			defer softwareFetching.Delete(host)
+			fetchSoftware(host)
+		}()
+	}
+	return "", ""
+}
+
+// ResolveSoftware returns software name/version of the host, fetching nodeinfo when not cached.
+// A cached failure is returned as an error until it expires.
+func ResolveSoftware(host string) (string, string, error) {
+	if redisClient == nil || host == "" {
+		return resolveNodeinfoSoftware(host)
+	}
+
+	data, err := redisClient.HGetAll(context.Background(), models.RedisKey("fdma:software:")+host).Result()
+	if err == nil && len(data) > 0 {
+		if data["name"] == "" {
+			return "", "", errors.New("nodeinfo of " + host + " is unavailable")
+		}
+		return data["name"], data["version"], nil
+	}
+	return fetchSoftware(host)
+}
+
+// fetchSoftware resolves software via nodeinfo and caches the result
+func fetchSoftware(host string) (string, string, error) {
+	ctx := context.Background()
+	key := models.RedisKey("fdma:software:") + host
+
+	name, version, err := resolveNodeinfoSoftware(host)
+	if err != nil {
+		logrus.Debugf("DelayMetrics: Failed to resolve software for %s: %v", host, err)
+		// Cache the failure to avoid fetching on every activity
+		redisClient.HSet(ctx, key, "name", "", "version", "")
+		redisClient.Expire(ctx, key, softwareFailureTTL)
+		return "", "", err
+	}
+
+	redisClient.HSet(ctx, key, "name", name, "version", version)
+	redisClient.Expire(ctx, key, softwareCacheTTL)
+	return name, version, nil
+}
+
+func resolveNodeinfoSoftware(host string) (string, string, error) {
+	var links nodeinfoLinks
+	err := getJSON("https://"+host+"/.well-known/nodeinfo", &links)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Prefer the newest schema advertised
+	href := ""
+	bestRel := ""
+	for _, link := range links.Links {
+		if strings.HasPrefix(link.Rel, "http://nodeinfo.diaspora.software/ns/schema/") && link.Rel > bestRel {
+			bestRel = link.Rel
+			href = link.Href
+		}
+	}
+	if href == "" {
+		return "", "", errors.New("nodeinfo link not found")
+	}
+	// The link is supplied by the remote, following it elsewhere would let it point the relay at any address
+	target, err := url.Parse(href)
+	if err != nil || target.Scheme != "https" || target.Host != host {
+		return "", "", errors.New("nodeinfo link " + href + " is not on " + host)
+	}
+
+	var nodeinfo nodeinfoSoftware
+	err = getJSON(href, &nodeinfo)
+	if err != nil {
+		return "", "", err
+	}
+	if nodeinfo.Software.Name == "" {
+		return "", "", errors.New("software name not found")
+	}
+	return strings.ToLower(nodeinfo.Software.Name), nodeinfo.Software.Version, nil
+}
+
+func getJSON(location string, target interface{}) error {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := softwareClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(location + ": " + resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, softwareBodyLimit)).Decode(target)
+}
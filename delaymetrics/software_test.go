@@ -0,0 +1,116 @@
+package delaymetrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLookupSoftware(t *testing.T) {
+	redisOption, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	if err != nil {
+		t.Skip("REDIS_URL is not set")
+	}
+	Initialize(redis.NewClient(redisOption))
+	defer Initialize(nil)
+	redisClient.FlushAll(context.TODO())
+
+	var s *httptest.Server
+	s = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/nodeinfo":
+			w.Write([]byte(`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"` + s.URL + `/nodeinfo/2.0"},{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"` + s.URL + `/nodeinfo/2.1"}]}`))
+		case "/nodeinfo/2.1":
+			w.Write([]byte(`{"version":"2.1","software":{"name":"Mastodon","version":"4.3.0"}}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+	defer func(client *http.Client) { softwareClient = client }(softwareClient)
+	softwareClient = s.Client()
+
+	host, _ := url.Parse(s.URL)
+	name, version := LookupSoftware(host.Host)
+	if name != "" || version != "" {
+		t.Fatalf("Expected empty software before background fetch, but got %s %s", name, version)
+	}
+
+	for i := 0; i < 50 && name == ""; i++ {
+		time.Sleep(20 * time.Millisecond)
+		name, version = LookupSoftware(host.Host)
+	}
+	if name != "mastodon" || version != "4.3.0" {
+		t.Fatalf("Expected mastodon 4.3.0, but got '%s' '%s'", name, version)
+	}
+	ttl, _ := redisClient.TTL(context.TODO(), "fdma:software:"+host.Host).Result()
+	if ttl <= time.Hour || ttl > softwareCacheTTL {
+		t.Fatalf("Expected software to be cached for 24h, but got TTL %v", ttl)
+	}
+}
+
+func TestLookupSoftwareFailure(t *testing.T) {
+	redisOption, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	if err != nil {
+		t.Skip("REDIS_URL is not set")
+	}
+	Initialize(redis.NewClient(redisOption))
+	defer Initialize(nil)
+	redisClient.FlushAll(context.TODO())
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer s.Close()
+	defer func(client *http.Client) { softwareClient = client }(softwareClient)
+	softwareClient = s.Client()
+
+	host, _ := url.Parse(s.URL)
+	LookupSoftware(host.Host)
+	for i := 0; i < 50; i++ {
+		if _, fetching := softwareFetching.Load(host.Host); !fetching {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	name, version := LookupSoftware(host.Host)
+	if name != "" || version != "" {
+		t.Fatalf("Expected empty software after failed fetch, but got '%s' '%s'", name, version)
+	}
+	ttl, _ := redisClient.TTL(context.TODO(), "fdma:software:"+host.Host).Result()
+	if ttl <= 0 || ttl > softwareFailureTTL {
+		t.Fatalf("Expected failure to be cached for 1h, but got TTL %v", ttl)
+	}
+}
+
+func TestResolveSoftwareOtherHost(t *testing.T) {
+	defer Initialize(nil)
+	Initialize(nil)
+
+	var fetched bool
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		w.Write([]byte(`{"version":"2.1","software":{"name":"Mastodon","version":"4.3.0"}}`))
+	}))
+	defer other.Close()
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"` + other.URL + `/nodeinfo/2.1"}]}`))
+	}))
+	defer s.Close()
+	defer func(client *http.Client) { softwareClient = client }(softwareClient)
+	softwareClient = s.Client()
+
+	host, _ := url.Parse(s.URL)
+	if _, _, err := ResolveSoftware(host.Host); err == nil {
+		t.Fatal("Expected nodeinfo link to another host to be rejected")
+	}
+	if fetched {
+		t.Fatal("Expected nodeinfo link to another host not to be followed")
+	}
+}
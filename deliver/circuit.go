@@ -0,0 +1,83 @@
+package deliver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// circuitAllowScript lets a delivery through unless the circuit is open.
+// Once the cooldown has passed the first caller claims a new cooldown and probes the domain (half-open).
+const circuitAllowScript = `
+local opened_until = tonumber(redis.call('HGET', KEYS[1], 'opened_until') or '0')
+if opened_until == 0 then return 1 end
+if tonumber(ARGV[1]) < opened_until then return 0 end
+redis.call('HSET', KEYS[1], 'opened_until', ARGV[2])
+return 1`
+
+// circuitFailureScript counts a consecutive failure and opens the circuit at the threshold.
+const circuitFailureScript = `
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+if failures >= tonumber(ARGV[1]) then redis.call('HSET', KEYS[1], 'opened_until', ARGV[2]) end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return failures`
+
+func circuitKey(domain string) string {
+	return models.RedisKey("relay:circuit:") + domain
+}
+
+// circuitAllows reports whether deliveries to domain may be attempted
+func circuitAllows(domain string) bool {
+	if GlobalConfig.CircuitBreakerThreshold() < 1 {
+		return true
+	}
+	now := time.Now()
+	probeUntil := now.Add(GlobalConfig.CircuitBreakerCooldown()).Unix()
+	allowed, err := RedisClient.Eval(context.TODO(), circuitAllowScript, []string{circuitKey(domain)}, now.Unix(), probeUntil).Int()
+	if err != nil {
+		logger.WithField("domain", domain).WithError(err).Error("Failed to read circuit state")
+		return true
+	}
+	return allowed == 1
+}
+
+// recordCircuitResult closes the circuit of domain once its server answers, even with a rejection, and counts failures
+// of an unreachable domain
+func recordCircuitResult(domain string, err error) {
+	threshold := GlobalConfig.CircuitBreakerThreshold()
+	if threshold < 1 {
+		return
+	}
+	ctx := context.TODO()
+	var statusErr *statusError
+	if err == nil || (errors.As(err, &statusErr) && !isRetryableDeliveryError(err)) {
+		RedisClient.Del(ctx, circuitKey(domain))
+		return
+	}
+	if !isRetryableDeliveryError(err) {
+		return
+	}
+	cooldown := GlobalConfig.CircuitBreakerCooldown()
+	openedUntil := time.Now().Add(cooldown).Unix()
+	failures, scriptErr := RedisClient.Eval(ctx, circuitFailureScript, []string{circuitKey(domain)}, threshold, openedUntil, int64((cooldown + 24*time.Hour).Seconds())).Int()
+	if scriptErr != nil {
+		logger.WithField("domain", domain).WithError(scriptErr).Error("Failed to record circuit failure")
+		return
+	}
+	if failures == threshold {
+		logger.WithFields(logrus.Fields{"domain": domain, "failures": failures}).Warn("Circuit opened")
+	}
+}
+
+// inboxDomain returns the host deliveries to inboxURL are tracked under
+func inboxDomain(inboxURL string) string {
+	inbox, err := url.Parse(inboxURL)
+	if err != nil {
+		return inboxURL
+	}
+	return inbox.Host
+}
@@ -0,0 +1,106 @@
+package deliver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func withCircuitBreaker(t *testing.T, threshold int, cooldown time.Duration) {
+	config := GlobalConfig
+	viper.Set("CIRCUIT_BREAKER_THRESHOLD", threshold)
+	viper.Set("CIRCUIT_BREAKER_COOLDOWN", cooldown)
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, but got error: %v", err)
+	}
+	GlobalConfig = relayConfig
+	t.Cleanup(func() {
+		viper.Set("CIRCUIT_BREAKER_THRESHOLD", 0)
+		viper.Set("CIRCUIT_BREAKER_COOLDOWN", 5*time.Minute)
+		GlobalConfig = config
+	})
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	for i := 0; i < 10; i++ {
+		recordCircuitResult("down.example.com", errors.New("connection refused"))
+	}
+	if !circuitAllows("down.example.com") {
+		t.Fatal("Expected disabled circuit breaker to allow deliveries, but it did not")
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	withCircuitBreaker(t, 3, time.Minute)
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	domain := "down.example.com"
+	for i := 0; i < 2; i++ {
+		recordCircuitResult(domain, errors.New("connection refused"))
+	}
+	// A rejection is still an answer, the failure streak starts over
+	recordCircuitResult(domain, &statusError{"https://" + domain + "/inbox", "401 Unauthorized", 401})
+	for i := 0; i < 2; i++ {
+		recordCircuitResult(domain, errors.New("connection refused"))
+	}
+	if !circuitAllows(domain) {
+		t.Fatal("Expected circuit to stay closed below the threshold, but it opened")
+	}
+	recordCircuitResult(domain, &statusError{"https://" + domain + "/inbox", "503 Service Unavailable", 503})
+	if circuitAllows(domain) {
+		t.Fatal("Expected circuit to open after 3 consecutive failures, but it allowed delivery")
+	}
+
+	// Cooldown elapsed: exactly one probe passes while the circuit is half-open
+	RedisClient.HSet(context.TODO(), circuitKey(domain), "opened_until", time.Now().Unix()-1)
+	if !circuitAllows(domain) {
+		t.Fatal("Expected half-open circuit to allow a probe, but it did not")
+	}
+	if circuitAllows(domain) {
+		t.Fatal("Expected only one probe while half-open, but another was allowed")
+	}
+
+	recordCircuitResult(domain, nil)
+	if !circuitAllows(domain) {
+		t.Fatal("Expected successful probe to close the circuit, but it stayed open")
+	}
+}
+
+func TestRelayActivitySkipsOpenCircuit(t *testing.T) {
+	withCircuitBreaker(t, 1, time.Minute)
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	delivered := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+		w.WriteHeader(503)
+	}))
+	defer s.Close()
+
+	RedisClient.HSet(context.TODO(), "relay:activity:0000000000000000000000000000000000000000", "body", "data", "remain_count", 2)
+	relayActivityV2(s.URL, "0000000000000000000000000000000000000000")
+	relayActivityV2(s.URL, "0000000000000000000000000000000000000000")
+	if delivered != 1 {
+		t.Fatalf("Expected 1 delivery before the circuit opened, but got %d", delivered)
+	}
+	skipped, _ := RedisClient.Get(context.TODO(), "relay:stats:outbox:short_circuited:total").Int()
+	if skipped != 1 {
+		t.Fatalf("Expected 1 short-circuited delivery, but got %d", skipped)
+	}
+	exists, _ := RedisClient.Exists(context.TODO(), "relay:activity:0000000000000000000000000000000000000000").Result()
+	if exists != 0 {
+		t.Fatal("Expected skipped delivery to release the activity, but it remains")
+	}
+}
@@ -0,0 +1,72 @@
+package deliver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// gzipRefusedExpiry retries compressed deliveries to a domain that refused one after this long
+const gzipRefusedExpiry = 7 * 24 * time.Hour
+
+// acceptsGzip reports whether body is large enough to compress and the destination of inboxURL is known to accept gzip
+func acceptsGzip(inboxURL string, body []byte) bool {
+	minSize := GlobalConfig.DeliveryGzipMinSize()
+	if minSize < 1 || len(body) < minSize {
+		return false
+	}
+	domain := strings.ToLower(inboxDomain(inboxURL))
+	if !matchGzipDomain(domain, GlobalConfig.DeliveryGzipDomains()) {
+		return false
+	}
+	refused, _ := RedisClient.Exists(context.TODO(), models.RedisKey("relay:gzip:refused:")+domain).Result()
+	return refused == 0
+}
+
+// matchGzipDomain matches domain against patterns, "*" matches every domain and "*.example.com" its subdomains
+func matchGzipDomain(domain string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == domain {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok && strings.HasSuffix(domain, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGzipRefusal reports whether a response status refuses the gzip Content-Encoding itself
+func isGzipRefusal(statusCode int) bool {
+	return statusCode == http.StatusUnsupportedMediaType
+}
+
+// mayBeGzipRefusal reports whether a response status may come from a destination failing to decode a gzip body,
+// which only a successful uncompressed resend confirms
+func mayBeGzipRefusal(statusCode int) bool {
+	return statusCode == http.StatusBadRequest
+}
+
+// rememberGzipRefused stops compressing deliveries to the destination of inboxURL for gzipRefusedExpiry
+func rememberGzipRefused(inboxURL string) {
+	RedisClient.Set(context.TODO(), models.RedisKey("relay:gzip:refused:")+strings.ToLower(inboxDomain(inboxURL)), "1", gzipRefusedExpiry)
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
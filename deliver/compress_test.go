@@ -0,0 +1,140 @@
+package deliver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestMatchGzipDomain(t *testing.T) {
+	for _, tc := range []struct {
+		domain   string
+		patterns []string
+		expected bool
+	}{
+		{"example.com", nil, false},
+		{"example.com", []string{"*"}, true},
+		{"example.com", []string{"example.com"}, true},
+		{"sub.example.com", []string{"*.example.com"}, true},
+		{"example.com", []string{"*.example.com"}, false},
+		{"example.org", []string{"example.com", "*.example.com"}, false},
+	} {
+		if got := matchGzipDomain(tc.domain, tc.patterns); got != tc.expected {
+			t.Fatalf("Expected matchGzipDomain(%s, %v) to be %v, but got %v", tc.domain, tc.patterns, tc.expected, got)
+		}
+	}
+}
+
+func TestSendActivityGzip(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	var encoding string
+	var received []byte
+	refuse := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		raw, _ := io.ReadAll(r.Body)
+		hash := sha256.Sum256(raw)
+		if r.Header.Get("Digest") != "SHA-256="+base64.StdEncoding.EncodeToString(hash[:]) {
+			t.Errorf("Expected Digest to cover the body as sent, but got %s", r.Header.Get("Digest"))
+		}
+		received = raw
+		if encoding == "gzip" {
+			if refuse {
+				w.WriteHeader(415)
+				return
+			}
+			reader, err := gzip.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				t.Errorf("Expected gzip body, but got error: %v", err)
+			}
+			received, _ = io.ReadAll(reader)
+		}
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+	inbox, _ := url.Parse(s.URL)
+
+	viper.Set("DELIVERY_GZIP_MIN_SIZE", 64)
+	viper.Set("DELIVERY_GZIP_DOMAINS", inbox.Host)
+	defer viper.Set("DELIVERY_GZIP_MIN_SIZE", 0)
+	defer viper.Set("DELIVERY_GZIP_DOMAINS", "")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(globalConfig *models.RelayConfig) { GlobalConfig = globalConfig }(GlobalConfig)
+	GlobalConfig = relayConfig
+
+	small := []byte(`{"type":"Create"}`)
+	sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, small, GlobalConfig.ActorKey())
+	if encoding != "" || !bytes.Equal(received, small) {
+		t.Fatalf("Expected body below threshold to be sent uncompressed, but got encoding %q", encoding)
+	}
+
+	large := bytes.Repeat([]byte(`{"type":"Create"}`), 16)
+	err = sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, large, GlobalConfig.ActorKey())
+	if err != nil || encoding != "gzip" || !bytes.Equal(received, large) {
+		t.Fatalf("Expected large body to be delivered gzip compressed, but got encoding %q, error %v", encoding, err)
+	}
+
+	refuse = true
+	err = sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, large, GlobalConfig.ActorKey())
+	if err != nil || encoding != "" || !bytes.Equal(received, large) {
+		t.Fatalf("Expected refused gzip delivery to be resent uncompressed, but got encoding %q, error %v", encoding, err)
+	}
+	if acceptsGzip(s.URL+"/inbox", large) {
+		t.Fatal("Expected gzip to be disabled for a destination that refused it")
+	}
+}
+
+func TestSendActivityGzipBadRequest(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	var posts int
+	status := 400
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+	inbox, _ := url.Parse(s.URL)
+
+	viper.Set("DELIVERY_GZIP_MIN_SIZE", 64)
+	viper.Set("DELIVERY_GZIP_DOMAINS", inbox.Host)
+	defer viper.Set("DELIVERY_GZIP_MIN_SIZE", 0)
+	defer viper.Set("DELIVERY_GZIP_DOMAINS", "")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(globalConfig *models.RelayConfig) { GlobalConfig = globalConfig }(GlobalConfig)
+	GlobalConfig = relayConfig
+
+	large := bytes.Repeat([]byte(`{"type":"Create"}`), 16)
+	sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, large, GlobalConfig.ActorKey())
+	if posts != 2 {
+		t.Fatalf("Expected a 400 to gzip to be resent uncompressed, but got %d POSTs", posts)
+	}
+	if !acceptsGzip(s.URL+"/inbox", large) {
+		t.Fatal("Expected gzip to stay enabled when the uncompressed resend is rejected too")
+	}
+
+	status = 415
+	sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, large, GlobalConfig.ActorKey())
+	if acceptsGzip(s.URL+"/inbox", large) {
+		t.Fatal("Expected gzip to be disabled for a destination answering 415")
+	}
+}
@@ -0,0 +1,128 @@
+package deliver
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yukimochi/Activity-Relay/models"
+	"github.com/yukimochi/machinery-v1/v1/tasks"
+)
+
+// delayPollInterval is how often due delayed deliveries are picked from the queue
+const delayPollInterval = 500 * time.Millisecond
+
+// delayBatchSize limits delayed deliveries started per poll
+const delayBatchSize = 500
+
+// deliveryDelay returns how long a relayed activity is held before sending, the fixed delay plus a random jitter
+func deliveryDelay() time.Duration {
+	delay := GlobalConfig.DeliveryDelay()
+	if jitter := GlobalConfig.DeliveryDelayJitter(); jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+	return delay
+}
+
+// enqueueDelayed holds job until dueAt, keeping its body so it outlives the shared activity
+func enqueueDelayed(job DeliveryJob, dueAt time.Time) {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	member, err := json.Marshal(&job)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	err = RedisClient.ZAdd(context.TODO(), models.RedisKey(models.DelayedQueue), redis.Z{Score: float64(dueAt.UnixMilli()), Member: member}).Err()
+	if err != nil {
+		deliveryLogger(job.InboxURL).WithError(err).Error("Failed to enqueue delayed delivery")
+	}
+}
+
+// processDelayedQueue hands due jobs to the delivery workers, claiming each so concurrent processes do not repeat it.
+// Sending through the worker queue keeps delayed deliveries within JOB_CONCURRENCY after a burst.
+func processDelayedQueue(now time.Time) int {
+	ctx := context.TODO()
+	members, err := RedisClient.ZRangeByScore(ctx, models.RedisKey(models.DelayedQueue), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: delayBatchSize,
+	}).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read delayed queue")
+		return 0
+	}
+
+	started := 0
+	for _, member := range members {
+		claimed, err := RedisClient.ZRem(ctx, models.RedisKey(models.DelayedQueue), member).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		var job DeliveryJob
+		err = json.Unmarshal([]byte(member), &job)
+		if err != nil {
+			logger.WithError(err).Error("Discarded malformed delayed job")
+			continue
+		}
+		task := &tasks.Signature{
+			Name:       "relay-delayed",
+			RetryCount: 0,
+			Args: []tasks.Arg{
+				{
+					Name:  "job",
+					Type:  "string",
+					Value: member,
+				},
+			},
+		}
+		_, err = MachineryServer.SendTask(task)
+		if err != nil {
+			// Put back, the next poll tries again
+			deliveryLogger(job.InboxURL).WithError(err).Error("Failed to queue delayed delivery")
+			RedisClient.ZAdd(ctx, models.RedisKey(models.DelayedQueue), redis.Z{Score: float64(now.UnixMilli()), Member: member})
+			continue
+		}
+		started++
+	}
+	return started
+}
+
+// relayDelayedActivity sends a delayed job handed over by processDelayedQueue
+func relayDelayedActivity(args ...string) error {
+	var job DeliveryJob
+	err := json.Unmarshal([]byte(args[0]), &job)
+	if err != nil {
+		return err
+	}
+	return deliverRelayedBody(job.InboxURL, job.Body)
+}
+
+// startDelayedQueue polls the delayed queue every interval until the returned function is called
+func startDelayedQueue(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				processDelayedQueue(now)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
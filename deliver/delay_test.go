@@ -0,0 +1,104 @@
+package deliver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestDelayedDelivery(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	config := GlobalConfig
+	viper.Set("DELIVERY_DELAY", "2s")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	GlobalConfig = relayConfig
+	defer func() {
+		viper.Set("DELIVERY_DELAY", "0s")
+		GlobalConfig = config
+	}()
+
+	var delivered int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&delivered, 1)
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+
+	activityID := uuid.New().String()
+	RedisClient.HMSet(context.TODO(), "relay:activity:"+activityID, "body", "ExampleData", "remain_count", 1)
+
+	start := time.Now()
+	err = relayActivityV2(s.URL, activityID)
+	end := time.Now()
+	if err != nil {
+		t.Fatalf("Expected delayed delivery to be queued, but got error: %v", err)
+	}
+	if exists, _ := RedisClient.Exists(context.TODO(), "relay:activity:"+activityID).Result(); exists != 0 {
+		t.Fatal("Expected shared activity to be released once the delayed job holds its body")
+	}
+	queued, _ := RedisClient.ZRangeWithScores(context.TODO(), models.DelayedQueue, 0, -1).Result()
+	if len(queued) != 1 {
+		t.Fatalf("Expected 1 delayed job, but got %d", len(queued))
+	}
+	member := queued[0].Member.(string)
+	dueAt := time.UnixMilli(int64(queued[0].Score))
+	if dueAt.Before(start.Add(2*time.Second).Truncate(time.Millisecond)) || dueAt.After(end.Add(2*time.Second)) {
+		t.Fatalf("Expected job due 2s after it was queued, but due at %v (queued %v)", dueAt, start)
+	}
+
+	if started := processDelayedQueue(dueAt.Add(-time.Millisecond)); started != 0 {
+		t.Fatalf("Expected no delivery before the delay elapsed, but started %d", started)
+	}
+	if started := processDelayedQueue(dueAt); started != 1 {
+		t.Fatalf("Expected 1 delivery after the delay elapsed, but started %d", started)
+	}
+	if count, _ := RedisClient.ZCard(context.TODO(), models.DelayedQueue).Result(); count != 0 {
+		t.Fatalf("Expected delayed queue to be empty, but has %d", count)
+	}
+	if atomic.LoadInt32(&delivered) != 0 {
+		t.Fatal("Expected due job to be handed to the workers, not sent by the poller")
+	}
+
+	// The worker receives the claimed job
+	err = relayDelayedActivity(member)
+	if err != nil {
+		t.Fatalf("Expected delayed delivery to succeed, but got error: %v", err)
+	}
+	if atomic.LoadInt32(&delivered) != 1 {
+		t.Fatalf("Expected 1 delivery after the delay elapsed, but got %d", atomic.LoadInt32(&delivered))
+	}
+}
+
+func TestDeliveryDelayJitter(t *testing.T) {
+	config := GlobalConfig
+	viper.Set("DELIVERY_DELAY", "1s")
+	viper.Set("DELIVERY_DELAY_JITTER", "500ms")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	GlobalConfig = relayConfig
+	defer func() {
+		viper.Set("DELIVERY_DELAY", "0s")
+		viper.Set("DELIVERY_DELAY_JITTER", "0s")
+		GlobalConfig = config
+	}()
+
+	for i := 0; i < 100; i++ {
+		if delay := deliveryDelay(); delay < time.Second || delay > 1500*time.Millisecond {
+			t.Fatalf("Expected delay between 1s and 1.5s, but got %v", delay)
+		}
+	}
+}
@@ -2,14 +2,15 @@ package deliver
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net/http"
-	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
-	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/discord"
 	"github.com/yukimochi/Activity-Relay/models"
 	"github.com/yukimochi/machinery-v1/v1"
 	"github.com/yukimochi/machinery-v1/v1/log"
@@ -19,40 +20,67 @@ var (
 	version      string
 	GlobalConfig *models.RelayConfig
 
-	// RelayActor : Relay's Actor
-	RelayActor models.Actor
+	// currentRelayActor : Relay's Actor, replaced by the actor key reload while handlers read it
+	currentRelayActor atomic.Pointer[models.Actor]
 
 	HttpClient      *http.Client
 	MachineryServer *machinery.Server
 	RedisClient     *redis.Client
+	RelayState      models.RelayState
+
+	// deliverySemaphore bounds concurrent outbound deliveries
+	deliverySemaphore chan struct{}
 )
 
+// RelayActor returns Relay's Actor
+func RelayActor() models.Actor {
+	return *currentRelayActor.Load()
+}
+
+// setRelayActor replaces Relay's Actor, safe while it is read
+func setRelayActor(actor models.Actor) {
+	currentRelayActor.Store(&actor)
+}
+
 func relayActivityV2(args ...string) error {
 	inboxURL := args[0]
 	activityID := args[1]
-	body, err := RedisClient.HGet(context.TODO(), "relay:activity:"+activityID, "body").Result()
+	body, err := RedisClient.HGet(context.TODO(), models.RedisKey("relay:activity:")+activityID, "body").Result()
 	if err != nil {
 		return errors.New("activity ttl expired")
 	}
 
-	err = sendActivity(inboxURL, RelayActor.PublicKey.ID, []byte(body), GlobalConfig.ActorKey())
-	if err != nil {
-		domain, _ := url.Parse(inboxURL)
-		pushErrorLogScript := "local change = redis.call('HSETNX', KEYS[1], 'last_error', ARGV[1]); if change == 1 then redis.call('EXPIRE', KEYS[1], ARGV[2]) end;"
-		RedisClient.Eval(context.TODO(), pushErrorLogScript, []string{"relay:statistics:" + domain.Host}, err.Error(), 60).Result()
+	if delay := deliveryDelay(); delay > 0 {
+		enqueueDelayed(DeliveryJob{InboxURL: inboxURL, Body: body}, time.Now().Add(delay))
 	} else {
-		// Increment outbox counter on successful delivery
-		IncrementOutboxCount()
+		err = deliverRelayedBody(inboxURL, body)
 	}
 	reductionRemainCountScript := "local remain_count = redis.call('HINCRBY', KEYS[1], 'remain_count', -1); if remain_count < 1 then redis.call('DEL', KEYS[1]) end;"
-	RedisClient.Eval(context.TODO(), reductionRemainCountScript, []string{"relay:activity:" + activityID}).Result()
+	RedisClient.Eval(context.TODO(), reductionRemainCountScript, []string{models.RedisKey("relay:activity:") + activityID}).Result()
+	return err
+}
+
+// deliverRelayedBody sends a relayed activity unless the circuit of its destination is open, queueing a retry on failure
+func deliverRelayedBody(inboxURL string, body string) error {
+	if !circuitAllows(inboxDomain(inboxURL)) {
+		deliveryLogger(inboxURL).Debug("Skipped delivery (circuit open)")
+		IncrementOutboxShortCircuitCount()
+		return nil
+	}
+	keyID, privateKey := signingKeyForActivity(inboxURL, []byte(body))
+	err := sendActivity(inboxURL, keyID, []byte(body), privateKey)
+	recordDelivery(inboxURL, err)
+	if isRetryableDeliveryError(err) {
+		enqueueRetry(DeliveryJob{InboxURL: inboxURL, Body: body}, 1)
+	}
 	return err
 }
 
 func registerActivity(args ...string) error {
 	inboxURL := args[0]
 	body := args[1]
-	err := sendActivity(inboxURL, RelayActor.PublicKey.ID, []byte(body), GlobalConfig.ActorKey())
+	keyID, privateKey := signingKeyForActivity(inboxURL, []byte(body))
+	err := sendActivity(inboxURL, keyID, []byte(body), privateKey)
 	return err
 }
 
@@ -75,29 +103,92 @@ func Entrypoint(g *models.RelayConfig, v string) error {
 	if err != nil {
 		return err
 	}
+	err = MachineryServer.RegisterTask("relay-ordered", relayOrderedActivity)
+	if err != nil {
+		return err
+	}
+	err = MachineryServer.RegisterTask("relay-delayed", relayDelayedActivity)
+	if err != nil {
+		return err
+	}
+
+	GlobalConfig.ReloadActorKeyOnSignal(func() {
+		setRelayActor(models.NewActivityPubActorFromRelayConfig(GlobalConfig))
+	})
+
+	if GlobalConfig.DeliveryRetryMaxAttempts() > 0 {
+		go runRetryQueue()
+	}
+	// Polled even without a delay configured, so jobs held before a restart are still sent
+	stopDelayedQueue := startDelayedQueue(delayPollInterval)
+	defer stopDelayedQueue()
+	if GlobalConfig.DeliveryOrdered() {
+		stopOrderedWakeups := startOrderedWakeups(orderedWakeupPollInterval)
+		defer stopOrderedWakeups()
+	}
 
+	return StartWorkers(GlobalConfig.JobConcurrency())
+}
+
+// StartWorkers consumes the delivery queue with n concurrent workers, blocking until the worker stops
+func StartWorkers(n int) error {
 	workerID := uuid.New()
-	worker := MachineryServer.NewWorker(workerID.String(), GlobalConfig.JobConcurrency())
-	err = worker.Launch()
+	worker := MachineryServer.NewWorker(workerID.String(), n)
+	err := worker.Launch()
 	if err != nil {
-		logrus.Error(err)
+		logger.Error(err)
 	}
 
 	return nil
 }
 
+// newDeliveryClient returns the shared delivery client, reusing connections across deliveries bounded by the in-flight limit
+func newDeliveryClient(maxInFlight int, tlsMinVersion uint16) *http.Client {
+	return &http.Client{
+		Timeout: time.Duration(5) * time.Second,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        maxInFlight,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 5 * time.Second,
+			TLSClientConfig:     &tls.Config{MinVersion: tlsMinVersion},
+		},
+	}
+}
+
 func initialize(globalConfig *models.RelayConfig) error {
 	var err error
 
 	RedisClient = globalConfig.RedisClient()
+	RelayState = models.NewState(RedisClient, true)
+	if globalConfig.CollectionSynchronization() || len(globalConfig.RelayIdentities()) > 0 {
+		// Follower digests and identity signing need the subscription list kept current
+		RelayState.ListenNotify(nil)
+	}
 
 	MachineryServer, err = models.NewMachineryServer(globalConfig)
 	if err != nil {
 		return err
 	}
-	HttpClient = &http.Client{Timeout: time.Duration(5) * time.Second}
+	maxInFlight := globalConfig.DeliveryMaxInFlight()
+	deliverySemaphore = make(chan struct{}, maxInFlight)
+	HttpClient = newDeliveryClient(maxInFlight, globalConfig.OutboundTLSMinVersion())
+
+	setRelayActor(models.NewActivityPubActorFromRelayConfig(globalConfig))
+	models.ConfigureHTTPClient(globalConfig.HTTPTimeout(), globalConfig.UserAgent(version), globalConfig.OutboundTLSMinVersion())
+	discord.SetHTTPClient(models.HTTPClient)
+	discord.Initialize(
+		globalConfig.WebhookType(),
+		globalConfig.DiscordWebhookURL(),
+		globalConfig.ServerServiceName(),
+		globalConfig.ServiceIconURL(),
+	)
+	for _, webhook := range globalConfig.DiscordWebhooks() {
+		discord.AddWebhook(webhook)
+	}
+	discord.EnableBatching(globalConfig.DiscordBatchWindow())
 
-	RelayActor = models.NewActivityPubActorFromRelayConfig(globalConfig)
 	newNullLogger := NewNullLogger()
 	log.DEBUG = newNullLogger
 
@@ -104,10 +104,15 @@ func TestRelayActivityResp500(t *testing.T) {
 	pushActivityScript := "redis.call('HSET',KEYS[1], 'body', ARGV[1], 'remain_count', ARGV[2]); redis.call('EXPIRE', KEYS[1], ARGV[3]);"
 	RedisClient.Eval(context.TODO(), pushActivityScript, []string{"relay:activity:" + activityID.String()}, "ExampleData", remainCount, 10).Result()
 
+	failuresBefore, _ := RedisClient.Get(context.TODO(), "relay:stats:outbox:failures:total").Int64()
 	err := relayActivityV2(s.URL, activityID.String())
 	if err == nil {
 		t.Fatal("Expected error to be reported for 500 response, but got nil")
 	}
+	failuresAfter, _ := RedisClient.Get(context.TODO(), "relay:stats:outbox:failures:total").Int64()
+	if failuresAfter != failuresBefore+1 {
+		t.Fatalf("Expected failure total to be incremented, but got %d -> %d", failuresBefore, failuresAfter)
+	}
 	domain, _ := url.Parse(s.URL)
 	data, _ := RedisClient.HGet(context.TODO(), "relay:statistics:"+domain.Host, "last_error").Result()
 	if data == "" {
@@ -1,5 +1,17 @@
 package deliver
 
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// logger tags Job Worker log entries with their component
+var logger = logrus.WithField("component", "deliver")
+
+// deliveryLogger returns logger with the destination of a delivery as fields
+func deliveryLogger(inboxURL string) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{"domain": inboxDomain(inboxURL), "inbox_url": inboxURL})
+}
+
 // NullLogger : Null logger for debug output
 type NullLogger struct {
 }
@@ -0,0 +1,171 @@
+package deliver
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yukimochi/Activity-Relay/models"
+	"github.com/yukimochi/machinery-v1/v1/tasks"
+)
+
+// orderedLockTTL is how long a worker keeps the queue of a domain without progress, so a crashed worker does not stall it
+const orderedLockTTL = time.Minute
+
+// orderedWakeupPollInterval is how often domains due to resume their ordered queue are picked
+const orderedWakeupPollInterval = 10 * time.Second
+
+// relayOrderedActivity sends the queued deliveries to a domain one at a time, oldest first.
+// Only one worker sends a domain at a time, others return at once and leave their job to it.
+// A failed delivery stays at the head of the queue and the domain waits for its retry, later activities are never sent
+// before it. A domain is woken from OrderedWakeups when the retry is due or its worker stopped without finishing.
+func relayOrderedActivity(args ...string) error {
+	domain := args[0]
+	queue := models.RedisKey(models.OrderedQueue) + domain
+	lock := queue + ":lock"
+
+	releaseLockScript := "if redis.call('GET', KEYS[1]) == ARGV[1] then redis.call('DEL', KEYS[1]) end;"
+	for {
+		token := uuid.New().String()
+		acquired, err := RedisClient.SetNX(context.TODO(), lock, token, orderedLockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			return nil
+		}
+		retryAt, parked := sendOrderedQueue(domain, queue, lock)
+		if parked {
+			// The lock is kept until the retry is due, so no worker sends the jobs queued behind it
+			RedisClient.ExpireAt(context.TODO(), lock, retryAt)
+			RedisClient.ZAdd(context.TODO(), models.RedisKey(models.OrderedWakeups), redis.Z{Score: float64(retryAt.Unix()), Member: domain})
+			return nil
+		}
+		RedisClient.ZRem(context.TODO(), models.RedisKey(models.OrderedWakeups), domain)
+		RedisClient.Eval(context.TODO(), releaseLockScript, []string{lock}, token).Result()
+
+		// A job queued while the lock was being released found it held, pick it up here
+		remaining, err := RedisClient.LLen(context.TODO(), queue).Result()
+		if err != nil || remaining == 0 {
+			return err
+		}
+	}
+}
+
+// sendOrderedQueue delivers the jobs of queue until it is empty, extending lock after each.
+// A job is removed once sent, so one in flight when the worker stops is sent again. When a job has to be retried,
+// it is kept at the head of queue and the time of its retry is returned.
+func sendOrderedQueue(domain string, queue string, lock string) (time.Time, bool) {
+	for {
+		member, err := RedisClient.LIndex(context.TODO(), queue, 0).Result()
+		if err != nil {
+			return time.Time{}, false
+		}
+		var job DeliveryJob
+		err = json.Unmarshal([]byte(member), &job)
+		if err != nil {
+			logger.WithError(err).Error("Discarded malformed ordered job")
+			RedisClient.LPop(context.TODO(), queue)
+			continue
+		}
+
+		// Wakes the domain again should this worker stop before the job is done
+		RedisClient.ZAdd(context.TODO(), models.RedisKey(models.OrderedWakeups), redis.Z{Score: float64(time.Now().Add(orderedLockTTL).Unix()), Member: domain})
+		if !sendOrderedJob(job) {
+			attempt := job.Attempt + 1
+			if attempt <= GlobalConfig.DeliveryRetryMaxAttempts() {
+				job.Attempt = attempt
+				retried, _ := json.Marshal(&job)
+				RedisClient.LSet(context.TODO(), queue, 0, retried)
+				return time.Now().Add(retryBackoff(attempt)), true
+			}
+			if GlobalConfig.DeliveryRetryMaxAttempts() > 0 {
+				deliveryLogger(job.InboxURL).WithField("attempts", attempt).Warn("Dropped delivery after failed attempts")
+				IncrementOutboxDroppedCount()
+			}
+		}
+		RedisClient.LPop(context.TODO(), queue)
+		RedisClient.Expire(context.TODO(), lock, orderedLockTTL)
+	}
+}
+
+// sendOrderedJob sends job, returning false when it has to be attempted again
+func sendOrderedJob(job DeliveryJob) bool {
+	if !circuitAllows(inboxDomain(job.InboxURL)) {
+		// Spend the attempt without touching the network, the domain is known to be failing
+		deliveryLogger(job.InboxURL).Debug("Postponed ordered delivery (circuit open)")
+		IncrementOutboxShortCircuitCount()
+		return false
+	}
+	keyID, privateKey := signingKeyForActivity(job.InboxURL, []byte(job.Body))
+	err := sendActivity(job.InboxURL, keyID, []byte(job.Body), privateKey)
+	recordDelivery(job.InboxURL, err)
+	return !isRetryableDeliveryError(err)
+}
+
+// processOrderedWakeups queues a worker for each domain due to resume its ordered queue, claiming each so concurrent
+// processes do not repeat it
+func processOrderedWakeups(now time.Time) int {
+	ctx := context.TODO()
+	domains, err := RedisClient.ZRangeByScore(ctx, models.RedisKey(models.OrderedWakeups), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read ordered queue wakeups")
+		return 0
+	}
+
+	woken := 0
+	for _, domain := range domains {
+		claimed, err := RedisClient.ZRem(ctx, models.RedisKey(models.OrderedWakeups), domain).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		job := &tasks.Signature{
+			Name:       "relay-ordered",
+			RetryCount: 0,
+			Args: []tasks.Arg{
+				{
+					Name:  "domain",
+					Type:  "string",
+					Value: domain,
+				},
+			},
+		}
+		_, err = MachineryServer.SendTask(job)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		woken++
+	}
+	return woken
+}
+
+// startOrderedWakeups resumes due ordered queues every interval until the returned function is called
+func startOrderedWakeups(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				processOrderedWakeups(now)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
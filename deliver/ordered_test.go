@@ -0,0 +1,136 @@
+package deliver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestRelayOrderedActivity(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	var mu sync.Mutex
+	var received []string
+	var inFlight, maxInFlight int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if current := atomic.AddInt32(&inFlight, 1); current > atomic.LoadInt32(&maxInFlight) {
+			atomic.StoreInt32(&maxInFlight, current)
+		}
+		data, _ := io.ReadAll(r.Body)
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		received = append(received, string(data))
+		mu.Unlock()
+		atomic.AddInt32(&inFlight, -1)
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+
+	domain, _ := url.Parse(s.URL)
+	queue := models.RedisKey(models.OrderedQueue) + domain.Host
+	for i := 0; i < 10; i++ {
+		job, _ := json.Marshal(&DeliveryJob{InboxURL: s.URL, Body: strconv.Itoa(i)})
+		RedisClient.RPush(context.TODO(), queue, job)
+	}
+
+	// Every queued job wakes a worker, all of them race for the same domain
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			relayOrderedActivity(domain.Host)
+		}()
+	}
+	wg.Wait()
+
+	if len(received) != 10 {
+		t.Fatalf("Expected 10 deliveries, but got %d", len(received))
+	}
+	for i, body := range received {
+		if body != strconv.Itoa(i) {
+			t.Fatalf("Expected deliveries in enqueue order, but got %v", received)
+		}
+	}
+	if maxInFlight != 1 {
+		t.Fatalf("Expected one delivery in flight at a time, but got %d", maxInFlight)
+	}
+	if exists, _ := RedisClient.Exists(context.TODO(), queue, queue+":lock").Result(); exists != 0 {
+		t.Fatalf("Expected queue and lock to be cleared, but got %d keys", exists)
+	}
+}
+
+func TestRelayOrderedActivityRetry(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	var mu sync.Mutex
+	var received []string
+	failed := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if string(data) == "1" && !failed {
+			failed = true
+			w.WriteHeader(503)
+			return
+		}
+		received = append(received, string(data))
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+
+	domain, _ := url.Parse(s.URL)
+	queue := models.RedisKey(models.OrderedQueue) + domain.Host
+	for i := 0; i < 3; i++ {
+		job, _ := json.Marshal(&DeliveryJob{InboxURL: s.URL, Body: strconv.Itoa(i)})
+		RedisClient.RPush(context.TODO(), queue, job)
+	}
+
+	relayOrderedActivity(domain.Host)
+	if len(received) != 1 || received[0] != "0" {
+		t.Fatalf("Expected deliveries to stop at the failed one, but got %v", received)
+	}
+	head, _ := RedisClient.LIndex(context.TODO(), queue, 0).Result()
+	var job DeliveryJob
+	json.Unmarshal([]byte(head), &job)
+	if job.Body != "1" || job.Attempt != 1 {
+		t.Fatalf("Expected failed job kept at the head of the queue, but got %+v", job)
+	}
+	wakeup, err := RedisClient.ZScore(context.TODO(), models.RedisKey(models.OrderedWakeups), domain.Host).Result()
+	if err != nil || int64(wakeup) < time.Now().Add(retryBackoff(1)).Unix()-1 {
+		t.Fatalf("Expected domain to be woken after the retry backoff, but got %v (%v)", wakeup, err)
+	}
+
+	// Jobs queued meanwhile wait for the retry
+	relayOrderedActivity(domain.Host)
+	if len(received) != 1 {
+		t.Fatalf("Expected no delivery before the retry is due, but got %v", received)
+	}
+
+	// The retry is due once the lock expires
+	RedisClient.Del(context.TODO(), queue+":lock")
+	relayOrderedActivity(domain.Host)
+	if !reflect.DeepEqual(received, []string{"0", "1", "2"}) {
+		t.Fatalf("Expected deliveries in enqueue order after the retry, but got %v", received)
+	}
+	if exists, _ := RedisClient.Exists(context.TODO(), queue, queue+":lock").Result(); exists != 0 {
+		t.Fatalf("Expected queue and lock to be cleared, but got %d keys", exists)
+	}
+	if wakeups, _ := RedisClient.ZCard(context.TODO(), models.RedisKey(models.OrderedWakeups)).Result(); wakeups != 0 {
+		t.Fatalf("Expected no pending wakeup, but got %d", wakeups)
+	}
+}
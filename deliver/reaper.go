@@ -0,0 +1,93 @@
+package deliver
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/discord"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// recordDeliveryResult tracks consecutive 404/410 responses and unfollows dead instances
+func recordDeliveryResult(domain string, statusCode int) {
+	threshold := GlobalConfig.DeadInstanceThreshold()
+	if threshold < 1 {
+		return
+	}
+	ctx := context.TODO()
+	key := models.RedisKey("relay:gone:") + domain
+
+	switch {
+	case statusCode/100 == 2:
+		RedisClient.Del(ctx, key)
+	case statusCode == http.StatusGone || statusCode == http.StatusNotFound:
+		count, err := RedisClient.Incr(ctx, key).Result()
+		if err != nil {
+			logger.WithField("domain", domain).WithError(err).Error("Failed to record delivery result")
+			return
+		}
+		if count >= int64(threshold) {
+			RedisClient.Del(ctx, key)
+			reapDeadInstance(domain)
+		}
+	}
+}
+
+// degradedKeyExpiry forgets a failure streak of a domain not delivered to for this long
+const degradedKeyExpiry = 24 * time.Hour
+
+// recordDegradation counts consecutive failed deliveries to domain and notifies once when the streak reaches the threshold
+func recordDegradation(domain string, err error) {
+	threshold := GlobalConfig.DeliveryDegradedThreshold()
+	if threshold < 1 {
+		return
+	}
+	ctx := context.TODO()
+	key := models.RedisKey("relay:degraded:") + domain
+	if err == nil {
+		RedisClient.Del(ctx, key)
+		return
+	}
+
+	pipe := RedisClient.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, degradedKeyExpiry)
+	if _, pipeErr := pipe.Exec(ctx); pipeErr != nil {
+		logger.WithField("domain", domain).WithError(pipeErr).Error("Failed to record delivery failure")
+		return
+	}
+	if failures := incr.Val(); failures == int64(threshold) {
+		logger.WithFields(logrus.Fields{"domain": domain, "failures": failures}).Warn("Delivery degraded")
+		discord.SendDeliveryDegraded(domain, int(failures), err.Error())
+	}
+}
+
+// reapDeadInstance removes subscribers and followers delivered through the domain
+func reapDeadInstance(domain string) {
+	RelayState.Load()
+	for _, subscriber := range RelayState.Subscribers {
+		if matchesDeliveryDomain(subscriber.Domain, subscriber.InboxURL, domain) {
+			logger.WithField("domain", subscriber.Domain).Info("Unsubscribe dead instance")
+			RelayState.DelSubscriber(subscriber.Domain)
+			discord.SendNotificationBatched(discord.NotifyUnfollow, subscriber.Domain, subscriber.ActorID)
+		}
+	}
+	for _, follower := range RelayState.Followers {
+		if matchesDeliveryDomain(follower.Domain, follower.InboxURL, domain) {
+			logger.WithField("domain", follower.Domain).Info("Unfollow dead instance")
+			RelayState.DelFollower(follower.Domain)
+			discord.SendNotificationBatched(discord.NotifyUnfollow, follower.Domain, follower.ActorID)
+		}
+	}
+}
+
+func matchesDeliveryDomain(registeredDomain string, inboxURL string, domain string) bool {
+	if registeredDomain == domain {
+		return true
+	}
+	inbox, err := url.Parse(inboxURL)
+	return err == nil && inbox.Host == domain
+}
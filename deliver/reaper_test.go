@@ -0,0 +1,99 @@
+package deliver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yukimochi/Activity-Relay/discord"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestRecordDeliveryResult(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "gone.example.com",
+		InboxURL:   "https://gone.example.com/inbox",
+		ActivityID: "https://gone.example.com/UUID",
+		ActorID:    "https://gone.example.com/user/example",
+	})
+	RelayState.AddFollower(models.Follower{
+		Domain:     "alive.example.com",
+		InboxURL:   "https://alive.example.com/inbox",
+		ActivityID: "https://alive.example.com/UUID",
+		ActorID:    "https://alive.example.com/user/example",
+	})
+	threshold := GlobalConfig.DeadInstanceThreshold()
+
+	for i := 0; i < threshold-1; i++ {
+		recordDeliveryResult("gone.example.com", 410)
+		recordDeliveryResult("alive.example.com", 404)
+	}
+	recordDeliveryResult("alive.example.com", 202)
+	RelayState.Load()
+	if RelayState.SelectSubscriber("gone.example.com") == nil {
+		t.Fatal("Expected subscriber to remain before reaching threshold")
+	}
+
+	recordDeliveryResult("gone.example.com", 410)
+	recordDeliveryResult("alive.example.com", 404)
+	RelayState.Load()
+	if RelayState.SelectSubscriber("gone.example.com") != nil {
+		t.Fatalf("Expected subscriber to be removed after %d consecutive 410", threshold)
+	}
+	if RelayState.SelectFollower("alive.example.com") == nil {
+		t.Fatal("Expected follower to remain since 2xx resets the counter")
+	}
+}
+
+func TestRecordDegradation(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	received := make(chan discord.WebhookPayload, 4)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload discord.WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+	discord.Initialize(discord.WebhookDiscord, s.URL, "Test Relay", "")
+	defer discord.Initialize(discord.WebhookDiscord, "", "", "")
+
+	threshold := GlobalConfig.DeliveryDegradedThreshold()
+	for i := 0; i < threshold-1; i++ {
+		recordDegradation("down.example.com", errors.New("connection refused"))
+	}
+	recordDegradation("down.example.com", nil)
+	for i := 0; i < threshold-1; i++ {
+		recordDegradation("down.example.com", errors.New("connection refused"))
+	}
+	select {
+	case payload := <-received:
+		t.Fatalf("Expected no notification before reaching threshold, but got %+v", payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	recordDegradation("down.example.com", errors.New("https://down.example.com/inbox: 503 Service Unavailable"))
+	recordDegradation("down.example.com", errors.New("connection refused"))
+	select {
+	case payload := <-received:
+		fields := payload.Embeds[0].Fields
+		if len(fields) != 3 || fields[0].Value != "down.example.com" || fields[1].Value != strconv.Itoa(threshold) || fields[2].Value != "https://down.example.com/inbox: 503 Service Unavailable" {
+			t.Fatalf("Expected domain, failure count and last error, but got %+v", fields)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected degraded notification, but got none")
+	}
+	select {
+	case payload := <-received:
+		t.Fatalf("Expected a single notification per failure streak, but got %+v", payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
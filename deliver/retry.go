@@ -0,0 +1,165 @@
+package deliver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+// retryBackoffSchedule is the wait before each retry, the last entry repeats
+var retryBackoffSchedule = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	6 * time.Hour,
+}
+
+// retryPollInterval is how often due retries are picked from the queue
+const retryPollInterval = 10 * time.Second
+
+// retryBatchSize limits retries started per poll
+const retryBatchSize = 100
+
+// DeliveryJob : Activity body waiting for delivery to an inbox
+type DeliveryJob struct {
+	ID       string `json:"id"`
+	InboxURL string `json:"inbox_url"`
+	Body     string `json:"body"`
+	Attempt  int    `json:"attempt"`
+}
+
+// retryBackoff returns the wait before retrying a job that failed attempt times
+func retryBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > len(retryBackoffSchedule) {
+		attempt = len(retryBackoffSchedule)
+	}
+	return retryBackoffSchedule[attempt-1]
+}
+
+// isRetryableDeliveryError reports whether a failed delivery may succeed later
+func isRetryableDeliveryError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= 500 || statusErr.statusCode == 429
+	}
+	var tlsErr *tlsVersionError
+	return !errors.As(err, &tlsErr)
+}
+
+// enqueueRetry schedules job after its attempt-th failure, dropping it past the max attempt count.
+// With retries disabled nothing is scheduled nor counted as dropped.
+func enqueueRetry(job DeliveryJob, attempt int) {
+	if GlobalConfig.DeliveryRetryMaxAttempts() <= 0 {
+		return
+	}
+	if attempt > GlobalConfig.DeliveryRetryMaxAttempts() {
+		deliveryLogger(job.InboxURL).WithField("attempts", attempt).Warn("Dropped delivery after failed attempts")
+		IncrementOutboxDroppedCount()
+		return
+	}
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	job.Attempt = attempt
+	member, err := json.Marshal(&job)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	dueAt := time.Now().Add(retryBackoff(attempt))
+	err = RedisClient.ZAdd(context.TODO(), models.RedisKey(models.RetryQueue), redis.Z{Score: float64(dueAt.Unix()), Member: member}).Err()
+	if err != nil {
+		deliveryLogger(job.InboxURL).WithError(err).Error("Failed to enqueue retry")
+	}
+}
+
+// processRetryQueue delivers due jobs, claiming each so concurrent workers do not repeat it
+func processRetryQueue(now time.Time) int {
+	ctx := context.TODO()
+	members, err := RedisClient.ZRangeByScore(ctx, models.RedisKey(models.RetryQueue), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: retryBatchSize,
+	}).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read retry queue")
+		return 0
+	}
+
+	started := 0
+	for _, member := range members {
+		claimed, err := RedisClient.ZRem(ctx, models.RedisKey(models.RetryQueue), member).Result()
+		if err != nil || claimed == 0 {
+			continue
+		}
+		var job DeliveryJob
+		err = json.Unmarshal([]byte(member), &job)
+		if err != nil {
+			logger.WithError(err).Error("Discarded malformed retry job")
+			continue
+		}
+		started++
+		go retryDelivery(job)
+	}
+	return started
+}
+
+func retryDelivery(job DeliveryJob) {
+	if !circuitAllows(inboxDomain(job.InboxURL)) {
+		// Spend the attempt without touching the network, the domain is known to be failing
+		IncrementOutboxShortCircuitCount()
+		enqueueRetry(job, job.Attempt+1)
+		return
+	}
+	keyID, privateKey := signingKeyForActivity(job.InboxURL, []byte(job.Body))
+	err := sendActivity(job.InboxURL, keyID, []byte(job.Body), privateKey)
+	recordDelivery(job.InboxURL, err)
+	if isRetryableDeliveryError(err) {
+		enqueueRetry(job, job.Attempt+1)
+	}
+}
+
+// runRetryQueue polls the retry queue until the process exits
+func runRetryQueue() {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		processRetryQueue(now)
+	}
+}
+
+// recordDelivery updates statistics and dead instance tracking for a delivery result
+func recordDelivery(inboxURL string, err error) {
+	domain, _ := url.Parse(inboxURL)
+	var statusErr *statusError
+	if err == nil {
+		recordDeliveryResult(domain.Host, 200)
+	} else if errors.As(err, &statusErr) {
+		recordDeliveryResult(domain.Host, statusErr.statusCode)
+	}
+	recordCircuitResult(domain.Host, err)
+	recordDegradation(domain.Host, err)
+	if err != nil {
+		pushErrorLogScript := "local change = redis.call('HSETNX', KEYS[1], 'last_error', ARGV[1]); if change == 1 then redis.call('EXPIRE', KEYS[1], ARGV[2]) end;"
+		RedisClient.Eval(context.TODO(), pushErrorLogScript, []string{models.RedisKey("relay:statistics:") + domain.Host}, err.Error(), 60).Result()
+		IncrementOutboxFailureCount()
+	} else {
+		// Increment outbox counter on successful delivery
+		IncrementOutboxCount()
+		IncrementOutboxDomainCount(domain.Host)
+	}
+}
@@ -0,0 +1,144 @@
+package deliver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
+)
+
+func TestRetryBackoffSchedule(t *testing.T) {
+	for attempt, expected := range map[int]time.Duration{
+		1: time.Minute,
+		2: 5 * time.Minute,
+		3: 30 * time.Minute,
+		4: 2 * time.Hour,
+		5: 6 * time.Hour,
+		9: 6 * time.Hour,
+	} {
+		if backoff := retryBackoff(attempt); backoff != expected {
+			t.Fatalf("Expected backoff after attempt %d to be %v, but got %v", attempt, expected, backoff)
+		}
+	}
+}
+
+func TestIsRetryableDeliveryError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), true},
+		{&statusError{"https://example.com/inbox", "500 Internal Server Error", 500}, true},
+		{&statusError{"https://example.com/inbox", "503 Service Unavailable", 503}, true},
+		{&statusError{"https://example.com/inbox", "429 Too Many Requests", 429}, true},
+		{&statusError{"https://example.com/inbox", "400 Bad Request", 400}, false},
+		{&statusError{"https://example.com/inbox", "401 Unauthorized", 401}, false},
+		{&statusError{"https://example.com/inbox", "410 Gone", 410}, false},
+	} {
+		if isRetryableDeliveryError(tc.err) != tc.retryable {
+			t.Fatalf("Expected %v retryable to be %v, but it was not", tc.err, tc.retryable)
+		}
+	}
+}
+
+func TestEnqueueRetry(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	before := time.Now()
+	enqueueRetry(DeliveryJob{InboxURL: "https://example.com/inbox", Body: "ExampleData"}, 2)
+	entries, _ := RedisClient.ZRangeWithScores(context.TODO(), models.RetryQueue, 0, -1).Result()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 queued retry, but got %d", len(entries))
+	}
+	dueAt := time.Unix(int64(entries[0].Score), 0)
+	if dueAt.Before(before.Add(5*time.Minute-time.Second)) || dueAt.After(time.Now().Add(5*time.Minute)) {
+		t.Fatalf("Expected retry due in 5 minutes, but got %v", dueAt.Sub(before))
+	}
+	var job DeliveryJob
+	json.Unmarshal([]byte(entries[0].Member.(string)), &job)
+	if job.Attempt != 2 || job.Body != "ExampleData" {
+		t.Fatalf("Expected queued job for attempt 2, but got %+v", job)
+	}
+
+	enqueueRetry(DeliveryJob{InboxURL: "https://example.com/inbox", Body: "ExampleData"}, GlobalConfig.DeliveryRetryMaxAttempts()+1)
+	queued, _ := RedisClient.ZCard(context.TODO(), models.RetryQueue).Result()
+	if queued != 1 {
+		t.Fatalf("Expected job past max attempts to be dropped, but queue has %d", queued)
+	}
+	dropped, _ := RedisClient.Get(context.TODO(), "relay:stats:outbox:dropped:total").Int()
+	if dropped != 1 {
+		t.Fatalf("Expected dropped counter to be 1, but got %d", dropped)
+	}
+}
+
+func TestEnqueueRetryDisabled(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	viper.Set("DELIVERY_RETRY_MAX_ATTEMPTS", 0)
+	defer viper.Set("DELIVERY_RETRY_MAX_ATTEMPTS", nil)
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(globalConfig *models.RelayConfig) { GlobalConfig = globalConfig }(GlobalConfig)
+	GlobalConfig = relayConfig
+
+	enqueueRetry(DeliveryJob{InboxURL: "https://example.com/inbox", Body: "ExampleData"}, 1)
+	queued, _ := RedisClient.ZCard(context.TODO(), models.RetryQueue).Result()
+	if queued != 0 {
+		t.Fatalf("Expected no retry with retries disabled, but queue has %d", queued)
+	}
+	dropped, _ := RedisClient.Get(context.TODO(), "relay:stats:outbox:dropped:total").Int()
+	if dropped != 0 {
+		t.Fatalf("Expected no dropped delivery with retries disabled, but got %d", dropped)
+	}
+}
+
+func TestProcessRetryQueue(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	status := 503
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+
+	enqueueRetry(DeliveryJob{InboxURL: s.URL, Body: "ExampleData"}, 1)
+	if started := processRetryQueue(time.Now()); started != 0 {
+		t.Fatalf("Expected no retry before backoff elapsed, but started %d", started)
+	}
+	if started := processRetryQueue(time.Now().Add(time.Minute)); started != 1 {
+		t.Fatalf("Expected 1 retry after backoff elapsed, but started %d", started)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	entries, _ := RedisClient.ZRange(context.TODO(), models.RetryQueue, 0, -1).Result()
+	if len(entries) != 1 {
+		t.Fatalf("Expected failed retry to be queued again, but got %d", len(entries))
+	}
+	var job DeliveryJob
+	json.Unmarshal([]byte(entries[0]), &job)
+	if job.Attempt != 2 {
+		t.Fatalf("Expected requeued job for attempt 2, but got %d", job.Attempt)
+	}
+
+	status = 202
+	if started := processRetryQueue(time.Now().Add(5 * time.Minute)); started != 1 {
+		t.Fatalf("Expected 1 retry after backoff elapsed, but started %d", started)
+	}
+	time.Sleep(500 * time.Millisecond)
+	queued, _ := RedisClient.ZCard(context.TODO(), models.RetryQueue).Result()
+	if queued != 0 {
+		t.Fatalf("Expected successful retry to leave queue, but queue has %d", queued)
+	}
+}
@@ -2,19 +2,92 @@ package deliver
 
 import (
 	"bytes"
-	"crypto/rsa"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/Songmu/go-httpdate"
 	"github.com/go-fed/httpsig"
-	"github.com/sirupsen/logrus"
+	"github.com/yukimochi/Activity-Relay/models"
 )
 
+// statusError reports a non-2xx response from a remote inbox
+type statusError struct {
+	inboxURL   string
+	status     string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return e.inboxURL + ": " + e.status
+}
+
+// tlsVersionError reports a remote inbox unable to negotiate the configured minimum TLS version
+type tlsVersionError struct {
+	inboxURL string
+}
+
+func (e *tlsVersionError) Error() string {
+	return e.inboxURL + ": TLS version below the configured minimum"
+}
+
+// tlsCertificateError reports a remote inbox presenting a certificate that does not verify, retried as it may be renewed
+type tlsCertificateError struct {
+	inboxURL string
+	err      error
+}
+
+func (e *tlsCertificateError) Error() string {
+	return e.inboxURL + ": " + e.err.Error()
+}
+
+func (e *tlsCertificateError) Unwrap() error {
+	return e.err
+}
+
+// tlsAlertProtocolVersion is the protocol_version alert of RFC 8446, sent by a server refusing every offered version
+const tlsAlertProtocolVersion = tls.AlertError(70)
+
+// isTLSVersionError reports whether err is a TLS handshake failing on the protocol version, refused by either side.
+// crypto/tls has no error type for either: the server refusal arrives as a remote alert and the client refusal is
+// a plain handshake error.
+func isTLSVersionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		// The remote alert has an unexported type, printed the same as AlertError
+		return opErr.Err.Error() == tlsAlertProtocolVersion.Error()
+	}
+	var alertErr tls.AlertError
+	if errors.As(err, &alertErr) {
+		return alertErr == tlsAlertProtocolVersion
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if strings.HasPrefix(err.Error(), "tls: server selected unsupported protocol version") {
+			return true
+		}
+	}
+	return false
+}
+
+// isTLSCertificateError reports whether err is a TLS handshake rejecting the certificate of the remote
+func isTLSCertificateError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verificationErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
 func compatibilityForHTTPSignature11(request *http.Request, algorithm httpsig.Algorithm) {
 	signature := request.Header.Get("Signature")
 	targetString := regexp.MustCompile("algorithm=\"hs2019\"")
@@ -22,10 +95,19 @@ func compatibilityForHTTPSignature11(request *http.Request, algorithm httpsig.Al
 	request.Header.Set("Signature", signature)
 }
 
-func appendSignature(request *http.Request, body *[]byte, KeyID string, privateKey *rsa.PrivateKey) error {
+func appendSignature(request *http.Request, body *[]byte, KeyID string, privateKey crypto.PrivateKey) error {
 	request.Header.Set("Host", request.Host)
 
-	signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{httpsig.RequestTarget, "Host", "Date", "Digest", "Content-Type"}, httpsig.Signature, 60*60)
+	algorithm := httpsig.RSA_SHA256
+	if _, ok := privateKey.(ed25519.PrivateKey); ok {
+		algorithm = httpsig.ED25519
+	}
+	headers := []string{httpsig.RequestTarget, "Host", "Date", "Digest", "Content-Type"}
+	if request.Header.Get("Collection-Synchronization") != "" {
+		// FEP-8fcf: receivers ignore the header unless it is signed
+		headers = append(headers, "Collection-Synchronization")
+	}
+	signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{algorithm}, httpsig.DigestSha256, headers, httpsig.Signature, 60*60)
 	if err != nil {
 		return err
 	}
@@ -33,18 +115,120 @@ func appendSignature(request *http.Request, body *[]byte, KeyID string, privateK
 	if err != nil {
 		return err
 	}
-	compatibilityForHTTPSignature11(request, httpsig.RSA_SHA256) // Compatibility for Misskey <12.111.0
+	compatibilityForHTTPSignature11(request, algorithm) // Compatibility for Misskey <12.111.0
 	return nil
 }
 
-func sendActivity(inboxURL string, KeyID string, body []byte, privateKey *rsa.PrivateKey) error {
+// signingKeyFor returns the key to sign deliveries to inboxURL, Ed25519 when the destination advertises it
+func signingKeyFor(inboxURL string) (string, crypto.PrivateKey) {
+	if GlobalConfig.ActorEd25519Key() != nil {
+		destination, err := url.Parse(inboxURL)
+		if err == nil {
+			algorithm, _ := RedisClient.Get(context.TODO(), models.RedisKey("relay:signing:")+destination.Host).Result()
+			if algorithm == "ed25519" {
+				return GlobalConfig.ActorEd25519KeyID(), GlobalConfig.ActorEd25519Key()
+			}
+		}
+	}
+	return GlobalConfig.SigningKey()
+}
+
+// signingKeyForActivity returns the key of the relay identity acting in body, falling back to signingKeyFor.
+// Activities relayed from others are signed by the relay identity the destination follows.
+func signingKeyForActivity(inboxURL string, body []byte) (string, crypto.PrivateKey) {
+	var activity struct {
+		Actor string `json:"actor"`
+	}
+	if json.Unmarshal(body, &activity) == nil {
+		if identity, found := GlobalConfig.RelayIdentityByActorID(activity.Actor); found {
+			return identity.KeyID(), identity.Key()
+		}
+		if activity.Actor != RelayActor().ID {
+			if identity, found := GlobalConfig.RelayIdentityByActorID(subscriptionIdentity(inboxURL)); found {
+				return identity.KeyID(), identity.Key()
+			}
+		}
+	}
+	return signingKeyFor(inboxURL)
+}
+
+// subscriptionIdentity returns the relay identity followed by the subscription delivered to inboxURL, empty for the main actor
+func subscriptionIdentity(inboxURL string) string {
+	for _, subscription := range RelayState.SubscribersAndFollowers {
+		if subscription.InboxURL == inboxURL {
+			return subscription.RelayActor
+		}
+	}
+	return ""
+}
+
+// collectionSynchronizationHeader returns the FEP-8fcf digest of the followers on the origin of inboxURL of the relay actor
+// signing with keyID, empty when there are none
+func collectionSynchronizationHeader(inboxURL string, keyID string) string {
+	relayActor, identityID := RelayActor(), ""
+	if identity, found := GlobalConfig.RelayIdentityByActorID(strings.SplitN(keyID, "#", 2)[0]); found {
+		relayActor, identityID = models.NewActivityPubActorFromRelayIdentity(GlobalConfig, identity), identity.ActorID()
+	}
+	actorIDs := RelayState.ActorIDsOnOrigin(models.Origin(inboxURL), identityID)
+	if len(actorIDs) == 0 {
+		return ""
+	}
+	return models.CollectionSynchronizationHeader(relayActor.FollowersURL, relayActor.FollowersSynchronization(), models.CollectionDigest(actorIDs))
+}
+
+func sendActivity(inboxURL string, KeyID string, body []byte, privateKey crypto.PrivateKey) error {
+	if acceptsGzip(inboxURL, body) {
+		compressed, err := gzipBody(body)
+		if err == nil {
+			err = postActivity(inboxURL, KeyID, compressed, "gzip", privateKey)
+			var statusErr *statusError
+			if !errors.As(err, &statusErr) {
+				return err
+			}
+			refused := isGzipRefusal(statusErr.statusCode)
+			if !refused && !mayBeGzipRefusal(statusErr.statusCode) {
+				return err
+			}
+			// Retry uncompressed, a 400 is only taken for a refusal of gzip when that succeeds
+			err = postActivity(inboxURL, KeyID, body, "", privateKey)
+			if refused || err == nil {
+				deliveryLogger(inboxURL).WithField("status", statusErr.statusCode).Info("Disabled gzip delivery (refused by destination)")
+				rememberGzipRefused(inboxURL)
+			}
+			return err
+		}
+		deliveryLogger(inboxURL).WithError(err).Warn("Failed to compress delivery")
+	}
+	return postActivity(inboxURL, KeyID, body, "", privateKey)
+}
+
+// postActivity delivers body with contentEncoding, the Digest covers body exactly as sent
+func postActivity(inboxURL string, KeyID string, body []byte, contentEncoding string, privateKey crypto.PrivateKey) error {
 	req, _ := http.NewRequest("POST", inboxURL, bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/activity+json")
-	req.Header.Set("User-Agent", fmt.Sprintf("%s (golang net/http; Activity-Relay %s; %s)", GlobalConfig.ServerServiceName(), version, GlobalConfig.ServerHostname().Host))
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	req.Header.Set("User-Agent", GlobalConfig.UserAgent(version))
 	req.Header.Set("Date", httpdate.Time2Str(time.Now()))
+	if GlobalConfig.CollectionSynchronization() {
+		if header := collectionSynchronizationHeader(inboxURL, KeyID); header != "" {
+			req.Header.Set("Collection-Synchronization", header)
+		}
+	}
 	appendSignature(req, &body, KeyID, privateKey)
+	deliverySemaphore <- struct{}{}
+	defer func() { <-deliverySemaphore }()
 	resp, err := HttpClient.Do(req)
 	if err != nil {
+		if isTLSVersionError(err) {
+			deliveryLogger(inboxURL).WithError(err).Warn("Skipped delivery (TLS version below minimum)")
+			return &tlsVersionError{inboxURL}
+		}
+		if isTLSCertificateError(err) {
+			deliveryLogger(inboxURL).WithError(err).Warn("Skipped delivery (TLS certificate rejected)")
+			return &tlsCertificateError{inboxURL, errors.Unwrap(err)}
+		}
 		urlErr := err.(*url.Error)
 		errMsg := ""
 
@@ -57,9 +241,9 @@ func sendActivity(inboxURL string, KeyID string, body []byte, privateKey *rsa.Pr
 	}
 	defer resp.Body.Close()
 
-	logrus.Debug(inboxURL, " ", resp.StatusCode)
+	deliveryLogger(inboxURL).WithField("status", resp.StatusCode).Debug("Delivery response")
 	if resp.StatusCode/100 != 2 {
-		return errors.New(inboxURL + ": " + resp.Status)
+		return &statusError{inboxURL, resp.Status, resp.StatusCode}
 	}
 
 	return nil
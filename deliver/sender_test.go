@@ -2,17 +2,27 @@ package deliver
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"regexp"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Songmu/go-httpdate"
 	"github.com/go-fed/httpsig"
+	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/models"
 )
 
 func TestAppendSignature(t *testing.T) {
@@ -51,3 +61,224 @@ func TestAppendSignature(t *testing.T) {
 		t.Fatalf("Expected Digest header to be '%s', but got '%s'", calculatedDigest, givenDigest)
 	}
 }
+
+func TestSendActivityMaxInFlight(t *testing.T) {
+	var inFlight, maxInFlight int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			observed := atomic.LoadInt32(&maxInFlight)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+
+	defer func(semaphore chan struct{}) { deliverySemaphore = semaphore }(deliverySemaphore)
+	deliverySemaphore = make(chan struct{}, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sendActivity(s.URL, RelayActor().PublicKey.ID, []byte("{}"), GlobalConfig.ActorKey())
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 2 {
+		t.Fatalf("Expected at most 2 deliveries in flight, but got %d", maxInFlight)
+	}
+}
+
+func TestAppendSignatureEd25519(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(nil)
+	body := []byte("{}")
+	req, _ := http.NewRequest("POST", "https://localhost/inbox", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/activity+json")
+	req.Header.Set("Date", httpdate.Time2Str(time.Now()))
+	err := appendSignature(req, &body, "https://relay.example.com/actor#ed25519-key", privateKey)
+	if err != nil {
+		t.Fatalf("Expected signing to succeed, but got error: %v", err)
+	}
+
+	sign := req.Header.Get("Signature")
+	format := regexp.MustCompile(`^keyId="https://relay\.example\.com/actor#ed25519-key",algorithm="ed25519",headers="\(request-target\) host date digest content-type",signature="[A-Za-z0-9+/=]+"$`)
+	if !format.MatchString(sign) {
+		t.Fatalf("Expected Ed25519 Signature header, but got: %s", sign)
+	}
+
+	verifier, err := httpsig.NewVerifier(req)
+	if err != nil {
+		t.Fatalf("Failed to create HTTPSignature verifier: %v", err)
+	}
+	err = verifier.Verify(privateKey.Public(), httpsig.ED25519)
+	if err != nil {
+		t.Fatalf("HTTPSignature verification failed: %v", err)
+	}
+}
+
+func TestAppendSignatureRSAFormat(t *testing.T) {
+	body := []byte("{}")
+	req, _ := http.NewRequest("POST", "https://localhost/inbox", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/activity+json")
+	req.Header.Set("Date", httpdate.Time2Str(time.Now()))
+	appendSignature(req, &body, "https://relay.example.com/actor#main-key", GlobalConfig.ActorKey())
+
+	format := regexp.MustCompile(`^keyId="https://relay\.example\.com/actor#main-key",algorithm="rsa-sha256",headers="\(request-target\) host date digest content-type",signature="[A-Za-z0-9+/=]+"$`)
+	if !format.MatchString(req.Header.Get("Signature")) {
+		t.Fatalf("Expected RSA Signature header, but got: %s", req.Header.Get("Signature"))
+	}
+}
+
+func TestSigningKeyFor(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	viper.Set("ACTOR_ED25519_PEM", "../misc/test/testEd25519Key.pem")
+	defer viper.Set("ACTOR_ED25519_PEM", "")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(globalConfig *models.RelayConfig) { GlobalConfig = globalConfig }(GlobalConfig)
+	GlobalConfig = relayConfig
+
+	RedisClient.Set(context.TODO(), "relay:signing:modern.example.com", "ed25519", 0)
+
+	keyID, privateKey := signingKeyFor("https://modern.example.com/inbox")
+	if _, ok := privateKey.(ed25519.PrivateKey); !ok || keyID != relayConfig.ActorEd25519KeyID() {
+		t.Fatalf("Expected Ed25519 key for destination advertising it, but got %s", keyID)
+	}
+	keyID, privateKey = signingKeyFor("https://legacy.example.com/inbox")
+	if _, ok := privateKey.(*rsa.PrivateKey); !ok || keyID != relayConfig.ActorKeyID() {
+		t.Fatalf("Expected RSA fallback for other destinations, but got %s", keyID)
+	}
+}
+
+func TestSendActivityCollectionSynchronization(t *testing.T) {
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+
+	var header, signature string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Collection-Synchronization")
+		signature = r.Header.Get("Signature")
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+
+	viper.Set("COLLECTION_SYNCHRONIZATION", true)
+	defer viper.Set("COLLECTION_SYNCHRONIZATION", false)
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(globalConfig *models.RelayConfig) { GlobalConfig = globalConfig }(GlobalConfig)
+	GlobalConfig = relayConfig
+
+	sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, []byte("{}"), GlobalConfig.ActorKey())
+	if header != "" {
+		t.Fatalf("Expected no Collection-Synchronization header without followers on origin, but got %s", header)
+	}
+
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "sync.example.com",
+		InboxURL:   s.URL + "/inbox",
+		ActivityID: s.URL + "/UUID",
+		ActorID:    s.URL + "/actor",
+	})
+	RelayState.Load()
+	sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, []byte("{}"), GlobalConfig.ActorKey())
+	relayActor := RelayActor()
+	expected := models.CollectionSynchronizationHeader(relayActor.FollowersURL, relayActor.FollowersSynchronization(), models.CollectionDigest([]string{s.URL + "/actor"}))
+	if header != expected {
+		t.Fatalf("Expected Collection-Synchronization header %s, but got %s", expected, header)
+	}
+	if !regexp.MustCompile(`headers="[^"]*collection-synchronization`).MatchString(signature) {
+		t.Fatalf("Expected Collection-Synchronization to be signed, but got %s", signature)
+	}
+}
+
+func TestSendActivityTLSMinVersion(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+	}))
+	s.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	s.StartTLS()
+	defer s.Close()
+
+	defer func(client *http.Client) { HttpClient = client }(HttpClient)
+	HttpClient = newDeliveryClient(1, tls.VersionTLS13)
+
+	err := sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, []byte("{}"), GlobalConfig.ActorKey())
+	var tlsErr *tlsVersionError
+	if !errors.As(err, &tlsErr) {
+		t.Fatalf("Expected TLS version error, but got %v", err)
+	}
+	if isRetryableDeliveryError(err) {
+		t.Fatal("Expected TLS version error not to be retried")
+	}
+}
+
+func TestSendActivityTLSCertificate(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+	}))
+	defer s.Close()
+
+	defer func(client *http.Client) { HttpClient = client }(HttpClient)
+	HttpClient = newDeliveryClient(1, tls.VersionTLS12)
+
+	err := sendActivity(s.URL+"/inbox", RelayActor().PublicKey.ID, []byte("{}"), GlobalConfig.ActorKey())
+	var certificateErr *tlsCertificateError
+	if !errors.As(err, &certificateErr) {
+		t.Fatalf("Expected TLS certificate error for an untrusted certificate, but got %v", err)
+	}
+	var tlsErr *tlsVersionError
+	if errors.As(err, &tlsErr) {
+		t.Fatal("Expected untrusted certificate not to be taken for a TLS version error")
+	}
+}
+
+func TestSigningKeyForActivity(t *testing.T) {
+	viper.Set("RELAY_IDENTITIES", "relay.example.net=../misc/test/testKey.pem")
+	defer viper.Set("RELAY_IDENTITIES", "")
+	relayConfig, err := models.NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(globalConfig *models.RelayConfig) { GlobalConfig = globalConfig }(GlobalConfig)
+	GlobalConfig = relayConfig
+
+	keyID, _ := signingKeyForActivity("https://example.com/inbox", []byte(`{"type":"Accept","actor":"https://relay.example.net/actor"}`))
+	if keyID != "https://relay.example.net/actor#main-key" {
+		t.Fatalf("Expected identity key for its activities, but got %s", keyID)
+	}
+	keyID, _ = signingKeyForActivity("https://example.com/inbox", []byte(`{"type":"Accept","actor":"`+RelayActor().ID+`"}`))
+	if keyID != relayConfig.ActorKeyID() {
+		t.Fatalf("Expected main key for main actor activities, but got %s", keyID)
+	}
+
+	RedisClient.FlushAll(context.TODO()).Result()
+	defer RedisClient.FlushAll(context.TODO()).Result()
+	RelayState.AddSubscriber(models.Subscriber{
+		Domain:     "vanity.example.com",
+		InboxURL:   "https://vanity.example.com/inbox",
+		ActorID:    "https://vanity.example.com/actor",
+		RelayActor: "https://relay.example.net/actor",
+	})
+	RelayState.Load()
+	relayed := []byte(`{"type":"Create","actor":"https://origin.example.com/users/alice"}`)
+	if keyID, _ = signingKeyForActivity("https://vanity.example.com/inbox", relayed); keyID != "https://relay.example.net/actor#main-key" {
+		t.Fatalf("Expected identity key for relayed activities to its subscriber, but got %s", keyID)
+	}
+	if keyID, _ = signingKeyForActivity("https://example.com/inbox", relayed); keyID != relayConfig.ActorKeyID() {
+		t.Fatalf("Expected main key for relayed activities to other subscribers, but got %s", keyID)
+	}
+}
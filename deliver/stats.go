@@ -4,6 +4,8 @@ import (
 	"context"
 	"strconv"
 	"time"
+
+	"github.com/yukimochi/Activity-Relay/models"
 )
 
 // IncrementOutboxCount increments the outbox counter
@@ -11,11 +13,46 @@ func IncrementOutboxCount() {
 	ctx := context.TODO()
 	now := time.Now()
 	bucket := now.Unix() / 60 * 60 // Round to minute
-	key := "relay:stats:outbox:" + strconv.FormatInt(bucket, 10)
+	key := models.RedisKey("relay:stats:outbox:") + strconv.FormatInt(bucket, 10)
 
 	RedisClient.Incr(ctx, key)
 	RedisClient.Expire(ctx, key, 25*time.Hour) // Keep for 25 hours
 
 	// Also increment total counter
-	RedisClient.Incr(ctx, "relay:stats:outbox:total")
+	RedisClient.Incr(ctx, models.RedisKey("relay:stats:outbox:total"))
+}
+
+// IncrementOutboxDomainCount increments the delivery counter of a destination host
+func IncrementOutboxDomainCount(host string) {
+	ctx := context.TODO()
+	now := time.Now()
+	bucket := now.Unix() / 60 * 60 // Round to minute
+	key := models.RedisKey("relay:stats:outbox:domain:") + host + ":" + strconv.FormatInt(bucket, 10)
+
+	RedisClient.Incr(ctx, key)
+	RedisClient.Expire(ctx, key, 25*time.Hour) // Keep for 25 hours
+}
+
+// IncrementOutboxFailureCount increments the failed delivery counter
+func IncrementOutboxFailureCount() {
+	ctx := context.TODO()
+	now := time.Now()
+	bucket := now.Unix() / 60 * 60 // Round to minute
+	key := models.RedisKey("relay:stats:outbox:failures:") + strconv.FormatInt(bucket, 10)
+
+	RedisClient.Incr(ctx, key)
+	RedisClient.Expire(ctx, key, 25*time.Hour) // Keep for 25 hours
+
+	// Also increment total counter
+	RedisClient.Incr(ctx, models.RedisKey("relay:stats:outbox:failures:total"))
+}
+
+// IncrementOutboxDroppedCount increments the counter of deliveries dropped after exhausting retries
+func IncrementOutboxDroppedCount() {
+	RedisClient.Incr(context.TODO(), models.RedisKey("relay:stats:outbox:dropped:total"))
+}
+
+// IncrementOutboxShortCircuitCount increments the counter of deliveries skipped by an open circuit
+func IncrementOutboxShortCircuitCount() {
+	RedisClient.Incr(context.TODO(), models.RedisKey("relay:stats:outbox:short_circuited:total"))
 }
@@ -0,0 +1,123 @@
+package discord
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxEmbedsPerMessage is the number of embeds Discord accepts in one webhook message
+const maxEmbedsPerMessage = 10
+
+var batchMutex sync.Mutex
+var batchWindow time.Duration
+var batchQueue map[string][]NotificationEvent
+var batchStop chan struct{}
+var batchDone chan struct{}
+
+// EnableBatching coalesces SendNotificationBatched calls within window into one message per webhook
+func EnableBatching(window time.Duration) {
+	DisableBatching()
+	if window <= 0 {
+		return
+	}
+
+	batchMutex.Lock()
+	batchWindow = window
+	batchQueue = make(map[string][]NotificationEvent)
+	batchStop = make(chan struct{})
+	batchDone = make(chan struct{})
+	go runBatchFlusher(window, batchStop, batchDone)
+	batchMutex.Unlock()
+	logrus.Info("Webhook notification batching enabled (", window, " window)")
+}
+
+// DisableBatching stops the background flusher after sending queued notifications
+func DisableBatching() {
+	batchMutex.Lock()
+	stop, done := batchStop, batchDone
+	batchWindow = 0
+	batchStop, batchDone = nil, nil
+	batchMutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// IsBatching returns whether notifications sent by SendNotificationBatched are coalesced
+func IsBatching() bool {
+	batchMutex.Lock()
+	defer batchMutex.Unlock()
+	return batchWindow > 0
+}
+
+// SendNotificationBatched queues a notification for the next flush, or sends it immediately when batching is disabled
+func SendNotificationBatched(notifyType NotificationType, domain, actorID string) {
+	if !IsEnabled() {
+		return
+	}
+
+	batchMutex.Lock()
+	if batchWindow <= 0 {
+		batchMutex.Unlock()
+		SendNotification(notifyType, domain, actorID)
+		return
+	}
+	event := newNotificationEvent(notifyType, domain, actorID)
+	var full map[string][]NotificationEvent
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(notifyType) {
+			continue
+		}
+		batchQueue[webhook.URL] = append(batchQueue[webhook.URL], event)
+		if len(batchQueue[webhook.URL]) >= maxEmbedsPerMessage {
+			if full == nil {
+				full = make(map[string][]NotificationEvent)
+			}
+			full[webhook.URL] = batchQueue[webhook.URL]
+			delete(batchQueue, webhook.URL)
+		}
+	}
+	batchMutex.Unlock()
+
+	for url, events := range full {
+		go postEvents(notifier, url, events)
+	}
+}
+
+func runBatchFlusher(window time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			flushBatch(false)
+		case <-stop:
+			flushBatch(true)
+			return
+		}
+	}
+}
+
+func flushBatch(wait bool) {
+	batchMutex.Lock()
+	queue := batchQueue
+	batchQueue = make(map[string][]NotificationEvent)
+	batchMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for url, events := range queue {
+		wg.Add(1)
+		go func(url string, events []NotificationEvent) {
+			defer wg.Done()
+			postEvents(notifier, url, events)
+		}(url, events)
+	}
+	if wait {
+		wg.Wait()
+	}
+}
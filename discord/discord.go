@@ -3,7 +3,10 @@ package discord
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -43,8 +46,66 @@ const (
 	NotifyAccepted
 	NotifyRejected
 	NotifyBlocked
+	NotifyDeliveryDegraded
+	NotifyFlag
 )
 
+// notificationTypeNames maps NotificationType to the names used in webhook specs
+var notificationTypeNames = map[string]NotificationType{
+	"follow":            NotifyFollow,
+	"unfollow":          NotifyUnfollow,
+	"pending_request":   NotifyPendingRequest,
+	"accepted":          NotifyAccepted,
+	"rejected":          NotifyRejected,
+	"blocked":           NotifyBlocked,
+	"delivery_degraded": NotifyDeliveryDegraded,
+	"flag":              NotifyFlag,
+}
+
+// Webhook represents a Discord webhook destination
+type Webhook struct {
+	URL string
+	// Types filters notifications sent to this webhook, empty receives all
+	Types []NotificationType
+}
+
+// Accepts returns whether the webhook receives the notification type
+func (webhook Webhook) Accepts(notifyType NotificationType) bool {
+	if len(webhook.Types) == 0 {
+		return true
+	}
+	for _, t := range webhook.Types {
+		if t == notifyType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWebhook parses "<url>" or "<url>|<type>,<type>" into Webhook
+func ParseWebhook(spec string) (Webhook, error) {
+	url, typeList, hasTypes := strings.Cut(strings.TrimSpace(spec), "|")
+	webhook := Webhook{URL: strings.TrimSpace(url)}
+	if webhook.URL == "" {
+		return webhook, errors.New("webhook URL is empty")
+	}
+	if !hasTypes {
+		return webhook, nil
+	}
+	for _, name := range strings.Split(typeList, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		notifyType, ok := notificationTypeNames[name]
+		if !ok {
+			return webhook, errors.New("unknown notification type: " + name)
+		}
+		webhook.Types = append(webhook.Types, notifyType)
+	}
+	return webhook, nil
+}
+
 // Colors for different notification types
 const (
 	ColorGreen  = 0x2ECC71 // Follow accepted
@@ -53,91 +114,137 @@ const (
 	ColorBlue   = 0x3498DB // Accepted by admin
 	ColorGray   = 0x95A5A6 // Rejected by admin
 	ColorOrange = 0xE67E22 // Blocked server attempted
+	ColorPurple = 0x9B59B6 // Delivery degraded
+	ColorPink   = 0xE91E63 // Report received
 )
 
-var webhookURL string
+// maxWebhookAttempts is the number of tries for a webhook hitting 429 or 5xx
+const maxWebhookAttempts = 3
+
+// webhookBackoff is the first retry delay for 5xx, doubled on each attempt
+var webhookBackoff = time.Second
+
+// maxWebhookRetryAfter bounds the Retry-After wait of a webhook, a longer rate limit gives up instead of blocking the sender
+var maxWebhookRetryAfter = time.Minute
+
+var webhooks []Webhook
 var serviceName string
 var serviceIconURL string
+var notifier Notifier = discordNotifier{}
 
-// Initialize sets up the Discord notifier
-func Initialize(url, name, iconURL string) {
-	webhookURL = url
+// httpClient posts webhooks, replaced by SetHTTPClient with the relay's shared client
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// SetHTTPClient sets the client used to post webhooks
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+}
+
+// Initialize sets up the notifier for webhookType, url may be empty when webhooks are added by AddWebhook
+func Initialize(webhookType WebhookType, url, name, iconURL string) {
+	notifier = NewNotifier(webhookType)
+	webhooks = nil
 	serviceName = name
 	serviceIconURL = iconURL
-	if webhookURL != "" {
-		logrus.Info("Discord notifications enabled")
+	if url != "" {
+		AddWebhook(Webhook{URL: url})
 	}
 }
 
-// IsEnabled returns whether Discord notifications are enabled
+// AddWebhook adds a webhook receiving notifications
+func AddWebhook(webhook Webhook) {
+	webhooks = append(webhooks, webhook)
+	logrus.Info("Webhook notifications enabled (", len(webhooks), " webhooks)")
+}
+
+// IsEnabled returns whether webhook notifications are enabled
 func IsEnabled() bool {
-	return webhookURL != ""
+	return len(webhooks) > 0
 }
 
-// SendNotification sends a notification to Discord
+// SendNotification sends a notification through the configured backend
 func SendNotification(notifyType NotificationType, domain, actorID string) {
 	if !IsEnabled() {
 		return
 	}
+	notifier.Notify(newNotificationEvent(notifyType, domain, actorID))
+}
 
-	var embed Embed
-	embed.Timestamp = time.Now().UTC().Format(time.RFC3339)
-	embed.Fields = []Field{
-		{Name: "Domain", Value: domain, Inline: true},
-		{Name: "Actor", Value: actorID, Inline: false},
-	}
-
-	switch notifyType {
-	case NotifyFollow:
-		embed.Title = "✅ New Server Registered"
-		embed.Description = "A new server has joined the relay."
-		embed.Color = ColorGreen
-	case NotifyUnfollow:
-		embed.Title = "❌ Server Unregistered"
-		embed.Description = "A server has left the relay."
-		embed.Color = ColorRed
-	case NotifyPendingRequest:
-		embed.Title = "⏳ Pending Follow Request"
-		embed.Description = "A new server is requesting to join the relay (manual approval required)."
-		embed.Color = ColorYellow
-	case NotifyAccepted:
-		embed.Title = "✅ Follow Request Accepted"
-		embed.Description = "A follow request has been approved by admin."
-		embed.Color = ColorBlue
-	case NotifyRejected:
-		embed.Title = "🚫 Follow Request Rejected"
-		embed.Description = "A follow request has been rejected by admin."
-		embed.Color = ColorGray
-	case NotifyBlocked:
-		embed.Title = "🛡️ Blocked Server Attempted Registration"
-		embed.Description = "A blocked server attempted to register with the relay."
-		embed.Color = ColorOrange
+// SendDeliveryDegraded notifies that deliveries to domain failed failures times in a row, sent immediately even when batching
+func SendDeliveryDegraded(domain string, failures int, lastError string) {
+	if !IsEnabled() {
+		return
 	}
+	event := newNotificationEvent(NotifyDeliveryDegraded, domain, "")
+	event.Failures = failures
+	event.LastError = lastError
+	notifier.Notify(event)
+}
 
-	payload := WebhookPayload{
-		Username:  serviceName,
-		AvatarURL: serviceIconURL,
-		Embeds:    []Embed{embed},
+// SendFlag notifies moderators of a report by actorID on domain about objects, sent immediately even when batching
+func SendFlag(domain, actorID string, objects []string, reason string) {
+	if !IsEnabled() {
+		return
 	}
-
-	go sendWebhook(payload)
+	event := newNotificationEvent(NotifyFlag, domain, actorID)
+	event.Objects = objects
+	event.Reason = reason
+	notifier.Notify(event)
 }
 
-func sendWebhook(payload WebhookPayload) {
+func sendWebhook(webhookURL string, payload interface{}) {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		logrus.Error("Failed to marshal Discord webhook payload: ", err)
+		logrus.Error("Failed to marshal webhook payload: ", err)
 		return
 	}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		logrus.Error("Failed to send Discord webhook: ", err)
-		return
+	for attempt := 1; ; attempt++ {
+		resp, err := httpClient.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
+		if err != nil {
+			logrus.Error("Failed to send webhook: ", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return
+		}
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= maxWebhookAttempts {
+			logrus.Error("Webhook returned non-2xx status: ", resp.StatusCode)
+			return
+		}
+
+		wait := webhookBackoff * time.Duration(1<<(attempt-1))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+			if wait > maxWebhookRetryAfter {
+				logrus.Error("Webhook rate limited for ", wait, ", giving up")
+				return
+			}
+		}
+		logrus.Warn("Webhook returned ", resp.StatusCode, ", retrying in ", wait)
+		time.Sleep(wait)
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		logrus.Error("Discord webhook returned non-2xx status: ", resp.StatusCode)
+// parseRetryAfter reads Retry-After as seconds (Discord may send fractions) or HTTP-date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
 	}
+	return 0, false
 }
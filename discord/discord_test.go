@@ -0,0 +1,307 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendWebhookRetryAfter(t *testing.T) {
+	var posts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&posts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(429)
+			return
+		}
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookDiscord, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+
+	start := time.Now()
+	sendWebhook(s.URL, WebhookPayload{Content: "test"})
+	elapsed := time.Since(start)
+
+	if posts != 2 {
+		t.Fatalf("Expected exactly 2 POSTs, but got %d", posts)
+	}
+	if elapsed < time.Second {
+		t.Fatalf("Expected Retry-After delay of 1s to be respected, but took %v", elapsed)
+	}
+}
+
+func TestSendWebhookRetryAfterTooLong(t *testing.T) {
+	var posts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(429)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookDiscord, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+
+	start := time.Now()
+	sendWebhook(s.URL, WebhookPayload{Content: "test"})
+	elapsed := time.Since(start)
+
+	if posts != 1 {
+		t.Fatalf("Expected to give up after 1 POST, but got %d", posts)
+	}
+	if elapsed > maxWebhookRetryAfter {
+		t.Fatalf("Expected Retry-After beyond %v not to be waited for, but took %v", maxWebhookRetryAfter, elapsed)
+	}
+}
+
+func TestSendWebhookServerErrorGivesUp(t *testing.T) {
+	var posts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		w.WriteHeader(503)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookDiscord, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+	webhookBackoff = time.Millisecond
+	defer func() { webhookBackoff = time.Second }()
+
+	sendWebhook(s.URL, WebhookPayload{Content: "test"})
+
+	if posts != maxWebhookAttempts {
+		t.Fatalf("Expected %d POSTs, but got %d", maxWebhookAttempts, posts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parseRetryAfter("0.5"); !ok || wait != 500*time.Millisecond {
+		t.Fatalf("Expected 500ms, but got %v (%v)", wait, ok)
+	}
+	if _, ok := parseRetryAfter("invalid"); ok {
+		t.Fatal("Expected invalid Retry-After to be rejected")
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	webhook, err := ParseWebhook("https://discord.example.com/api/webhooks/1")
+	if err != nil || webhook.URL != "https://discord.example.com/api/webhooks/1" || len(webhook.Types) != 0 {
+		t.Fatalf("Expected plain webhook, but got %+v (%v)", webhook, err)
+	}
+	webhook, err = ParseWebhook("https://discord.example.com/api/webhooks/2|blocked, pending_request")
+	if err != nil || len(webhook.Types) != 2 || !webhook.Accepts(NotifyBlocked) || webhook.Accepts(NotifyFollow) {
+		t.Fatalf("Expected webhook filtered to blocked and pending_request, but got %+v (%v)", webhook, err)
+	}
+	if _, err = ParseWebhook("https://discord.example.com/api/webhooks/3|unknown"); err == nil {
+		t.Fatal("Expected unknown notification type to be rejected")
+	}
+}
+
+func TestSendNotificationFanOut(t *testing.T) {
+	received := make(chan string, 4)
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload WebhookPayload
+			json.NewDecoder(r.Body).Decode(&payload)
+			received <- name + ":" + payload.Embeds[0].Fields[0].Value
+			w.WriteHeader(204)
+		}))
+	}
+	ops := newServer("ops")
+	defer ops.Close()
+	mod := newServer("mod")
+	defer mod.Close()
+
+	Initialize(WebhookDiscord, ops.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+	AddWebhook(Webhook{URL: mod.URL, Types: []NotificationType{NotifyBlocked, NotifyPendingRequest}})
+
+	SendNotification(NotifyFollow, "follow.example.com", "https://follow.example.com/actor")
+	SendNotification(NotifyBlocked, "blocked.example.com", "https://blocked.example.com/actor")
+
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-received:
+			got[r] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected 3 webhook deliveries, but got %v", got)
+		}
+	}
+	for _, expected := range []string{"ops:follow.example.com", "ops:blocked.example.com", "mod:blocked.example.com"} {
+		if !got[expected] {
+			t.Fatalf("Expected delivery %s, but got %v", expected, got)
+		}
+	}
+	select {
+	case r := <-received:
+		t.Fatalf("Expected no delivery to filtered webhook, but got %s", r)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSendNotificationBatched(t *testing.T) {
+	var posts, embeds int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		atomic.AddInt32(&posts, 1)
+		atomic.AddInt32(&embeds, int32(len(payload.Embeds)))
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookDiscord, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+	EnableBatching(time.Hour)
+
+	for i := 0; i < 13; i++ {
+		SendNotificationBatched(NotifyFollow, "example.com", "https://example.com/actor")
+	}
+	DisableBatching()
+	time.Sleep(100 * time.Millisecond)
+
+	if atomic.LoadInt32(&posts) != 2 {
+		t.Fatalf("Expected 13 notifications in 2 POSTs, but got %d", posts)
+	}
+	if atomic.LoadInt32(&embeds) != 13 {
+		t.Fatalf("Expected 13 embeds, but got %d", embeds)
+	}
+}
+
+func TestSendNotificationBatchedDisabled(t *testing.T) {
+	var posts int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookDiscord, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+
+	for i := 0; i < 3; i++ {
+		SendNotificationBatched(NotifyUnfollow, "example.com", "https://example.com/actor")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if atomic.LoadInt32(&posts) != 3 {
+		t.Fatalf("Expected one POST per notification, but got %d", posts)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	received := make(chan SlackPayload, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SlackPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		w.WriteHeader(200)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookSlack, s.URL, "Test Relay", "https://relay.example.com/icon.png")
+	defer Initialize(WebhookDiscord, "", "", "")
+
+	SendNotification(NotifyBlocked, "blocked.example.com", "https://blocked.example.com/actor")
+
+	select {
+	case payload := <-received:
+		if payload.Username != "Test Relay" || payload.IconURL != "https://relay.example.com/icon.png" {
+			t.Fatalf("Expected service name and icon, but got %+v", payload)
+		}
+		if len(payload.Attachments) != 1 {
+			t.Fatalf("Expected 1 attachment, but got %d", len(payload.Attachments))
+		}
+		attachment := payload.Attachments[0]
+		if attachment.Color != "#E67E22" {
+			t.Fatalf("Expected color #E67E22, but got %s", attachment.Color)
+		}
+		if len(attachment.Fields) != 2 || attachment.Fields[0].Value != "blocked.example.com" {
+			t.Fatalf("Expected domain field, but got %+v", attachment.Fields)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Slack webhook to be called, but it was not")
+	}
+}
+
+func TestParseWebhookType(t *testing.T) {
+	for name, expected := range map[string]WebhookType{"": WebhookDiscord, "discord": WebhookDiscord, "Slack": WebhookSlack} {
+		webhookType, err := ParseWebhookType(name)
+		if err != nil || webhookType != expected {
+			t.Fatalf("Expected %q to parse as %s, but got %s %v", name, expected, webhookType, err)
+		}
+	}
+	if _, err := ParseWebhookType("teams"); err == nil {
+		t.Fatal("Expected unknown webhook type to fail, but it succeeded")
+	}
+}
+
+func TestSendDeliveryDegraded(t *testing.T) {
+	received := make(chan SlackPayload, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SlackPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		w.WriteHeader(200)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookSlack, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+
+	SendDeliveryDegraded("down.example.com", 10, strings.Repeat("x", 2000))
+
+	select {
+	case payload := <-received:
+		fields := payload.Attachments[0].Fields
+		if len(fields) != 3 || fields[0].Value != "down.example.com" || fields[1].Value != "10" {
+			t.Fatalf("Expected domain and failure count fields, but got %+v", fields)
+		}
+		if len(fields[2].Value) != maxFieldValueLength {
+			t.Fatalf("Expected last error to be truncated to %d, but got %d", maxFieldValueLength, len(fields[2].Value))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected webhook to be called, but it was not")
+	}
+
+	if webhook, err := ParseWebhook("https://example.com/hook|delivery_degraded"); err != nil || !webhook.Accepts(NotifyDeliveryDegraded) || webhook.Accepts(NotifyFollow) {
+		t.Fatalf("Expected delivery_degraded to be a webhook type, but got %+v, %v", webhook, err)
+	}
+}
+
+func TestSendFlag(t *testing.T) {
+	received := make(chan WebhookPayload, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		w.WriteHeader(204)
+	}))
+	defer s.Close()
+
+	Initialize(WebhookDiscord, s.URL, "Test Relay", "")
+	defer Initialize(WebhookDiscord, "", "", "")
+
+	SendFlag("reporter.example.com", "https://reporter.example.com/actor", []string{"https://spam.example.com/users/spammer", "https://spam.example.com/notes/1"}, "Spam")
+
+	select {
+	case payload := <-received:
+		embed := payload.Embeds[0]
+		if embed.Color != ColorPink || len(embed.Fields) != 4 {
+			t.Fatalf("Expected a flag embed with 4 fields, but got %+v", embed)
+		}
+		if embed.Fields[2].Value != "https://spam.example.com/users/spammer\nhttps://spam.example.com/notes/1" || embed.Fields[3].Value != "Spam" {
+			t.Fatalf("Expected reported objects and reason fields, but got %+v", embed.Fields)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected webhook to be called, but it was not")
+	}
+}
@@ -0,0 +1,255 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookType selects the chat service webhooks are posted to
+type WebhookType string
+
+const (
+	WebhookDiscord WebhookType = "discord"
+	WebhookSlack   WebhookType = "slack"
+)
+
+// ParseWebhookType parses a webhook type name, empty means discord
+func ParseWebhookType(name string) (WebhookType, error) {
+	switch WebhookType(strings.ToLower(strings.TrimSpace(name))) {
+	case "", WebhookDiscord:
+		return WebhookDiscord, nil
+	case WebhookSlack:
+		return WebhookSlack, nil
+	default:
+		return "", errors.New("unknown webhook type: " + name)
+	}
+}
+
+// NotificationEvent represents a relay event to notify
+type NotificationEvent struct {
+	Type    NotificationType
+	Domain  string
+	ActorID string
+	Time    time.Time
+	// Failures and LastError describe NotifyDeliveryDegraded events
+	Failures  int
+	LastError string
+	// Objects and Reason describe NotifyFlag events
+	Objects []string
+	Reason  string
+}
+
+func newNotificationEvent(notifyType NotificationType, domain, actorID string) NotificationEvent {
+	return NotificationEvent{
+		Type:    notifyType,
+		Domain:  domain,
+		ActorID: actorID,
+		Time:    time.Now().UTC(),
+	}
+}
+
+// Notifier delivers notification events to the registered webhooks
+type Notifier interface {
+	Notify(event NotificationEvent)
+}
+
+// webhookNotifier is a Notifier encoding events into webhook payloads
+type webhookNotifier interface {
+	Notifier
+	// payloads encodes events into as few webhook messages as the service allows
+	payloads(events []NotificationEvent) []interface{}
+}
+
+// NewNotifier returns the Notifier for webhookType
+func NewNotifier(webhookType WebhookType) Notifier {
+	if webhookType == WebhookSlack {
+		return slackNotifier{}
+	}
+	return discordNotifier{}
+}
+
+func notifyWebhooks(notifier webhookNotifier, event NotificationEvent) {
+	for _, webhook := range webhooks {
+		if webhook.Accepts(event.Type) {
+			go postEvents(notifier, webhook.URL, []NotificationEvent{event})
+		}
+	}
+}
+
+func postEvents(notifier Notifier, webhookURL string, events []NotificationEvent) {
+	encoder, ok := notifier.(webhookNotifier)
+	if !ok {
+		for _, event := range events {
+			notifier.Notify(event)
+		}
+		return
+	}
+	for _, payload := range encoder.payloads(events) {
+		sendWebhook(webhookURL, payload)
+	}
+}
+
+// eventStyle returns the title, description and color shown for a notification type
+func eventStyle(notifyType NotificationType) (string, string, int) {
+	switch notifyType {
+	case NotifyFollow:
+		return "✅ New Server Registered", "A new server has joined the relay.", ColorGreen
+	case NotifyUnfollow:
+		return "❌ Server Unregistered", "A server has left the relay.", ColorRed
+	case NotifyPendingRequest:
+		return "⏳ Pending Follow Request", "A new server is requesting to join the relay (manual approval required).", ColorYellow
+	case NotifyAccepted:
+		return "✅ Follow Request Accepted", "A follow request has been approved by admin.", ColorBlue
+	case NotifyRejected:
+		return "🚫 Follow Request Rejected", "A follow request has been rejected by admin.", ColorGray
+	case NotifyBlocked:
+		return "🛡️ Blocked Server Attempted Registration", "A blocked server attempted to register with the relay.", ColorOrange
+	case NotifyDeliveryDegraded:
+		return "⚠️ Delivery Degraded", "Deliveries to a server are failing persistently.", ColorPurple
+	case NotifyFlag:
+		return "🚩 Report Received", "A server has sent a report to the relay.", ColorPink
+	}
+	return "", "", 0
+}
+
+// maxFieldValueLength is the longest field value Discord accepts
+const maxFieldValueLength = 1024
+
+// truncateFieldValue shortens value to the longest field value Discord accepts
+func truncateFieldValue(value string) string {
+	if len(value) > maxFieldValueLength {
+		return value[:maxFieldValueLength-3] + "..."
+	}
+	return value
+}
+
+// eventFields returns the fields shown for an event
+func eventFields(event NotificationEvent) []Field {
+	switch event.Type {
+	case NotifyDeliveryDegraded:
+		return []Field{
+			{Name: "Domain", Value: event.Domain, Inline: true},
+			{Name: "Consecutive Failures", Value: strconv.Itoa(event.Failures), Inline: true},
+			{Name: "Last Error", Value: truncateFieldValue(event.LastError), Inline: false},
+		}
+	case NotifyFlag:
+		reason := event.Reason
+		if reason == "" {
+			reason = "(none)"
+		}
+		return []Field{
+			{Name: "Domain", Value: event.Domain, Inline: true},
+			{Name: "Reporter", Value: event.ActorID, Inline: false},
+			{Name: "Reported", Value: truncateFieldValue(strings.Join(event.Objects, "\n")), Inline: false},
+			{Name: "Reason", Value: truncateFieldValue(reason), Inline: false},
+		}
+	}
+	return []Field{
+		{Name: "Domain", Value: event.Domain, Inline: true},
+		{Name: "Actor", Value: event.ActorID, Inline: false},
+	}
+}
+
+// discordNotifier posts events as Discord embeds
+type discordNotifier struct{}
+
+func (notifier discordNotifier) Notify(event NotificationEvent) {
+	notifyWebhooks(notifier, event)
+}
+
+func (discordNotifier) payloads(events []NotificationEvent) []interface{} {
+	var payloads []interface{}
+	for len(events) > 0 {
+		n := min(len(events), maxEmbedsPerMessage)
+		payload := WebhookPayload{
+			Username:  serviceName,
+			AvatarURL: serviceIconURL,
+		}
+		for _, event := range events[:n] {
+			payload.Embeds = append(payload.Embeds, buildEmbed(event))
+		}
+		payloads = append(payloads, payload)
+		events = events[n:]
+	}
+	return payloads
+}
+
+func buildEmbed(event NotificationEvent) Embed {
+	title, description, color := eventStyle(event.Type)
+	return Embed{
+		Title:       title,
+		Description: description,
+		Color:       color,
+		Timestamp:   event.Time.Format(time.RFC3339),
+		Fields:      eventFields(event),
+	}
+}
+
+// SlackAttachment represents a Slack message attachment
+type SlackAttachment struct {
+	Color     string       `json:"color,omitempty"`
+	Title     string       `json:"title,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []SlackField `json:"fields,omitempty"`
+	Timestamp int64        `json:"ts,omitempty"`
+}
+
+// SlackField represents a field in a Slack attachment
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short,omitempty"`
+}
+
+// SlackPayload represents the Slack incoming webhook payload
+type SlackPayload struct {
+	Text        string            `json:"text,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	IconURL     string            `json:"icon_url,omitempty"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// maxAttachmentsPerMessage is the number of attachments Slack recommends in one message
+const maxAttachmentsPerMessage = 20
+
+// slackNotifier posts events as Slack attachments
+type slackNotifier struct{}
+
+func (notifier slackNotifier) Notify(event NotificationEvent) {
+	notifyWebhooks(notifier, event)
+}
+
+func (slackNotifier) payloads(events []NotificationEvent) []interface{} {
+	var payloads []interface{}
+	for len(events) > 0 {
+		n := min(len(events), maxAttachmentsPerMessage)
+		payload := SlackPayload{
+			Username: serviceName,
+			IconURL:  serviceIconURL,
+		}
+		for _, event := range events[:n] {
+			payload.Attachments = append(payload.Attachments, buildSlackAttachment(event))
+		}
+		payloads = append(payloads, payload)
+		events = events[n:]
+	}
+	return payloads
+}
+
+func buildSlackAttachment(event NotificationEvent) SlackAttachment {
+	title, description, color := eventStyle(event.Type)
+	var fields []SlackField
+	for _, field := range eventFields(event) {
+		fields = append(fields, SlackField{Title: field.Name, Value: field.Value, Short: field.Inline})
+	}
+	return SlackAttachment{
+		Color:     fmt.Sprintf("#%06X", color),
+		Title:     title,
+		Text:      description,
+		Timestamp: event.Time.Unix(),
+		Fields:    fields,
+	}
+}
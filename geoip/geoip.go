@@ -0,0 +1,54 @@
+// Package geoip resolves the country of an IP address from a MaxMind DB (GeoLite2 / GeoIP2 Country or City) file.
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Reader looks up IP addresses in a MaxMind DB loaded in memory.
+type Reader struct {
+	database *maxminddb.Reader
+}
+
+// countryRecord holds the fields of a Country or City record a country lookup needs
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// Open loads the MaxMind DB at path.
+func Open(path string) (*Reader, error) {
+	database, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{database: database}, nil
+}
+
+// FromBytes parses a MaxMind DB held in buffer.
+func FromBytes(buffer []byte) (*Reader, error) {
+	database, err := maxminddb.FromBytes(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{database: database}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of ip, falling back to the country where its network is
+// registered. Empty means the database does not know ip.
+func (reader *Reader) Country(ip net.IP) (string, error) {
+	var record countryRecord
+	if err := reader.database.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	return record.RegisteredCountry.ISOCode, nil
+}
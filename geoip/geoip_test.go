@@ -0,0 +1,131 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// metadataStartMarker precedes the metadata map at the end of a MaxMind DB file
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+func encodeString(value string) []byte {
+	return append([]byte{2<<5 | byte(len(value))}, value...)
+}
+
+func encodeUint16(value uint16) []byte {
+	return []byte{5<<5 | 2, byte(value >> 8), byte(value)}
+}
+
+func encodeUint32(value uint32) []byte {
+	return []byte{6<<5 | 4, byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+}
+
+func encodeMap(pairs ...[]byte) []byte {
+	encoded := []byte{7<<5 | byte(len(pairs)/2)}
+	for _, pair := range pairs {
+		encoded = append(encoded, pair...)
+	}
+	return encoded
+}
+
+func encodePointer(offset int) []byte {
+	return []byte{1<<5 | byte(offset>>8)&0x7, byte(offset)}
+}
+
+// buildDatabase returns a MaxMind DB with 24 bit records where, for IPv4, 0.0.0.0/2 is in JP and 64.0.0.0/2 is
+// registered in US. An IPv6 database reaches the IPv4 nodes through ::/96.
+func buildDatabase(ipVersion uint16) []byte {
+	var data []byte
+	usOffset := len(data)
+	data = append(data, encodeString("US")...)
+	jpOffset := len(data)
+	data = append(data, encodeMap(encodeString("country"), encodeMap(encodeString("iso_code"), encodeString("JP")))...)
+	registeredOffset := len(data)
+	data = append(data, encodeMap(encodeString("registered_country"), encodeMap(encodeString("iso_code"), encodePointer(usOffset)))...)
+
+	var nodes [][2]int
+	if ipVersion == 6 {
+		for i := 0; i < 96; i++ {
+			nodes = append(nodes, [2]int{i + 1, -1})
+		}
+	}
+	nodes = append(nodes, [2]int{len(nodes) + 1, -1})
+	nodeCount := len(nodes) + 1
+	nodes = append(nodes, [2]int{-jpOffset - 2, -registeredOffset - 2})
+
+	var tree []byte
+	for _, node := range nodes {
+		for _, record := range node {
+			switch {
+			case record == -1:
+				record = nodeCount
+			case record < -1:
+				record = nodeCount + 16 + (-record - 2)
+			}
+			tree = append(tree, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(tree)
+	buffer.Write(make([]byte, 16))
+	buffer.Write(data)
+	buffer.Write(metadataStartMarker)
+	buffer.Write(encodeMap(
+		encodeString("node_count"), encodeUint32(uint32(nodeCount)),
+		encodeString("record_size"), encodeUint16(24),
+		encodeString("ip_version"), encodeUint16(ipVersion),
+		encodeString("database_type"), encodeString("Test-Country"),
+	))
+	return buffer.Bytes()
+}
+
+func TestReaderCountry(t *testing.T) {
+	for _, ipVersion := range []uint16{4, 6} {
+		reader, err := FromBytes(buildDatabase(ipVersion))
+		if err != nil {
+			t.Fatalf("Expected IPv%d database to open, but got error: %v", ipVersion, err)
+		}
+		for ip, expected := range map[string]string{
+			"1.2.3.4":     "JP",
+			"63.255.0.1":  "JP",
+			"64.0.0.1":    "US",
+			"127.0.0.1":   "US",
+			"128.0.0.1":   "",
+			"203.0.113.9": "",
+		} {
+			country, err := reader.Country(net.ParseIP(ip))
+			if err != nil || country != expected {
+				t.Errorf("Expected country of %s to be %q in IPv%d database, but got %q (%v)", ip, expected, ipVersion, country, err)
+			}
+		}
+	}
+
+	reader, _ := FromBytes(buildDatabase(6))
+	if country, err := reader.Country(net.ParseIP("2001:db8::1")); err != nil || country != "" {
+		t.Errorf("Expected unknown IPv6 address to have no country, but got %q (%v)", country, err)
+	}
+	reader, _ = FromBytes(buildDatabase(4))
+	if _, err := reader.Country(net.ParseIP("2001:db8::1")); err == nil {
+		t.Error("Expected IPv6 lookup in IPv4 database to fail")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	os.WriteFile(path, buildDatabase(4), 0o600)
+	if _, err := Open(path); err != nil {
+		t.Fatalf("Expected database to open, but got error: %v", err)
+	}
+
+	os.WriteFile(path, []byte("not a database"), 0o600)
+	if _, err := Open(path); err == nil {
+		t.Fatal("Expected invalid database to fail")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Fatal("Expected missing database to fail")
+	}
+}
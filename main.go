@@ -29,6 +29,8 @@ YAML Format
 		YUKIMOCHI Toot Relay Service is Running by Activity-Relay
 	RELAY_ICON: https://example.com/example_icon.png
 	RELAY_IMAGE: https://example.com/example_image.png
+	RELAY_ADMIN_EMAIL: admin@example.com
+	RELAY_TERMS_URL: https://example.com/terms
 
 # Environment Variable
 
@@ -42,6 +44,8 @@ This is Optional : When config file not exist, use environment variables.
   - RELAY_SUMMARY
   - RELAY_ICON
   - RELAY_IMAGE
+  - RELAY_ADMIN_EMAIL
+  - RELAY_TERMS_URL
 */
 package main
 
@@ -59,8 +63,10 @@ import (
 )
 
 var (
-	version = "devel"
-	verbose bool
+	version   = "devel"
+	commit    = "unknown"
+	buildDate = "unknown"
+	verbose   bool
 
 	GlobalConfig *models.RelayConfig
 )
@@ -85,6 +91,7 @@ func buildCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initConfig(cmd)
 			fmt.Println(GlobalConfig.DumpWelcomeMessage("API Server", version))
+			api.BuildCommit, api.BuildDate = commit, buildDate
 			err := api.Entrypoint(GlobalConfig, version)
 			if err != nil {
 				logrus.Fatal(err.Error())
@@ -150,10 +157,75 @@ func initConfig(cmd *cobra.Command) {
 		viper.BindEnv("RELAY_SUMMARY")
 		viper.BindEnv("RELAY_ICON")
 		viper.BindEnv("RELAY_IMAGE")
+		viper.BindEnv("RELAY_ADMIN_EMAIL")
+		viper.BindEnv("RELAY_TERMS_URL")
+		viper.BindEnv("SIGNATURE_ALLOWED_ALGORITHMS")
+		viper.BindEnv("SIGNATURE_REQUIRE_DIGEST")
+		viper.BindEnv("INBOX_RATE_LIMIT")
+		viper.BindEnv("INBOX_RATE_BURST")
+		viper.BindEnv("METRICS_PATH")
+		viper.BindEnv("DISCORD_WEBHOOK_URLS")
+		viper.BindEnv("DEAD_INSTANCE_THRESHOLD")
+		viper.BindEnv("ADMIN_TOKEN")
+		viper.BindEnv("ADMIN_ALLOWED_CIDRS")
+		viper.BindEnv("INBOX_MAX_BODY_SIZE")
+		viper.BindEnv("DELAY_METRICS_EXCLUDED_HOSTS")
+		viper.BindEnv("DELIVERY_MAX_IN_FLIGHT")
+		viper.BindEnv("DISCORD_BATCH_WINDOW")
+		viper.BindEnv("WEBHOOK_TYPE")
+		viper.BindEnv("ACTOR_KEY_ROTATION_GRACE")
+		viper.BindEnv("CORS_ALLOWED_ORIGINS")
+		viper.BindEnv("DELIVERY_RETRY_MAX_ATTEMPTS")
+		viper.BindEnv("ACTOR_ED25519_PEM")
+		viper.BindEnv("NODEINFO_USAGE_MODE")
+		viper.BindEnv("NODEINFO_RELAY_METADATA")
+		viper.BindEnv("NODEINFO_METADATA")
+		viper.BindEnv("CATCHUP_ACTIVITY_COUNT")
+		viper.BindEnv("CIRCUIT_BREAKER_THRESHOLD")
+		viper.BindEnv("CIRCUIT_BREAKER_COOLDOWN")
+		viper.BindEnv("LOG_FORMAT")
+		viper.BindEnv("HTTP_TIMEOUT")
+		viper.BindEnv("HIDE_FOLLOWERS_COLLECTION")
+		viper.BindEnv("MIN_SOFTWARE_VERSIONS")
+		viper.BindEnv("MIN_SOFTWARE_VERSION_ALLOW_UNREACHABLE")
+		viper.BindEnv("COLLECTION_SYNCHRONIZATION")
+		viper.BindEnv("ACTOR_CACHE_TTL")
+		viper.BindEnv("ACTOR_CACHE_SIZE")
+		viper.BindEnv("OUTBOUND_TLS_MIN_VERSION")
+		viper.BindEnv("DELIVERY_DEGRADED_THRESHOLD")
+		viper.BindEnv("RELAY_IDENTITIES")
+		viper.BindEnv("DELIVERY_GZIP_MIN_SIZE")
+		viper.BindEnv("DELIVERY_GZIP_DOMAINS")
+		viper.BindEnv("REDIS_SLOW_THRESHOLD")
+		viper.BindEnv("REDIS_KEY_PREFIX")
+		viper.BindEnv("INBOX_PROCESSING_TIMEOUT")
+		viper.BindEnv("DELIVERY_DELAY")
+		viper.BindEnv("DELIVERY_DELAY_JITTER")
+		viper.BindEnv("DELIVERY_ORDERED")
+		viper.BindEnv("DELAY_METRICS_HISTOGRAM_BUCKETS")
+		viper.BindEnv("SIGNATURE_CLOCK_SKEW")
+		viper.BindEnv("MIRROR_URL")
+		viper.BindEnv("MIRROR_ACTIVITY_TYPES")
+		viper.BindEnv("MIRROR_SAMPLE_RATE")
+		viper.BindEnv("GEOIP_DB_PATH")
+		viper.BindEnv("GEOIP_BLOCKED_COUNTRIES")
+		viper.BindEnv("GEOIP_CLIENT_IP_HEADER")
+		viper.BindEnv("ABOUT_FIELDS")
+		viper.BindEnv("DELAY_METRICS_PRUNE_INTERVAL")
+		viper.BindEnv("ACTOR_INTEGRITY_PROOF")
+		viper.BindEnv("UNDO_FOLLOW_GRACE")
+		viper.BindEnv("BATCH_DELIVERY_INTERVAL")
+		viper.BindEnv("PAUSED_MAX_ACTIVITIES")
+		viper.BindEnv("INBOX_ACCEPT_BODY")
+		viper.BindEnv("BLOCKLIST_URLS")
+		viper.BindEnv("BLOCKLIST_REFRESH_INTERVAL")
 	}
 
 	GlobalConfig, err = models.NewRelayConfig()
 	if err != nil {
 		logrus.Fatal(err.Error())
 	}
+	if GlobalConfig.LogFormat() == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	}
 }
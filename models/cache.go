@@ -0,0 +1,92 @@
+package models
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ActorCache : Size bounded LRU cache of fetched remote actor documents.
+type ActorCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type actorCacheEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewActorCache : Create ActorCache keeping up to maxSize actors for ttl.
+func NewActorCache(ttl time.Duration, maxSize int) *ActorCache {
+	return &ActorCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get : Cached document of key, expired entries are dropped.
+func (cache *ActorCache) Get(key string) ([]byte, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, found := cache.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*actorCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		cache.remove(element)
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return entry.data, true
+}
+
+// Set : Store document of key for ttl, the cache TTL when ttl is zero. Evicts the least recently used entry when full.
+func (cache *ActorCache) Set(key string, data []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = cache.ttl
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, found := cache.entries[key]; found {
+		entry := element.Value.(*actorCacheEntry)
+		entry.data, entry.expiresAt = data, time.Now().Add(ttl)
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&actorCacheEntry{key, data, time.Now().Add(ttl)})
+	for cache.order.Len() > cache.maxSize {
+		cache.remove(cache.order.Back())
+	}
+}
+
+// Delete : Remove key from cache.
+func (cache *ActorCache) Delete(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, found := cache.entries[key]; found {
+		cache.remove(element)
+	}
+}
+
+// Len : Number of cached entries, including expired ones not yet dropped.
+func (cache *ActorCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.order.Len()
+}
+
+func (cache *ActorCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*actorCacheEntry).key)
+}
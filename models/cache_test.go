@@ -0,0 +1,72 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestActorCacheEviction(t *testing.T) {
+	cache := NewActorCache(time.Minute, 2)
+	cache.Set("https://a.example.com/actor", []byte("a"), 0)
+	cache.Set("https://b.example.com/actor", []byte("b"), 0)
+	cache.Get("https://a.example.com/actor")
+	cache.Set("https://c.example.com/actor", []byte("c"), 0)
+
+	if _, found := cache.Get("https://b.example.com/actor"); found {
+		t.Fatal("Expected least recently used entry to be evicted")
+	}
+	if _, found := cache.Get("https://a.example.com/actor"); !found {
+		t.Fatal("Expected recently used entry to be kept")
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("Expected 2 entries, but got %d", cache.Len())
+	}
+}
+
+func TestActorCacheExpiry(t *testing.T) {
+	cache := NewActorCache(time.Minute, 10)
+	cache.Set("https://a.example.com/actor", []byte("a"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, found := cache.Get("https://a.example.com/actor"); found {
+		t.Fatal("Expected expired entry to be dropped")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("Expected expired entry to be removed, but got %d entries", cache.Len())
+	}
+}
+
+func TestNewActivityPubActorFromRemoteActorCached(t *testing.T) {
+	requests := 0
+	var actorID string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.Write([]byte(`{"id":"` + actorID + `","type":"Person","inbox":"` + actorID + `/inbox"}`))
+	}))
+	defer s.Close()
+	actorID = s.URL + "/actor"
+
+	cache := NewActorCache(time.Minute, 10)
+	for i := 0; i < 2; i++ {
+		actor, err := NewActivityPubActorFromRemoteActor(actorID, "Activity-Relay/test", cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actor.ID != actorID {
+			t.Fatalf("Expected actor %s, but got %s", actorID, actor.ID)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Expected one HTTP request within TTL, but got %d", requests)
+	}
+
+	cache.Set(actorID, []byte(`{}`), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	NewActivityPubActorFromRemoteActor(actorID, "Activity-Relay/test", cache)
+	if requests != 2 {
+		t.Fatalf("Expected expired entry to be fetched again, but got %d requests", requests)
+	}
+}
@@ -2,34 +2,114 @@ package models
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"github.com/yukimochi/Activity-Relay/discord"
 	"github.com/yukimochi/machinery-v1/v1"
 	"github.com/yukimochi/machinery-v1/v1/config"
 )
 
+// maxSignatureClockSkew bounds SIGNATURE_CLOCK_SKEW, a wider window lets captured requests be replayed for longer
+const maxSignatureClockSkew = time.Hour
+
+// aboutFields are the fields /about can show
+var aboutFields = []string{"name", "description", "actor", "subscribers", "open", "relay_styles", "blocked_domains"}
+
 // RelayConfig contains valid configuration.
 type RelayConfig struct {
-	actorKey          *rsa.PrivateKey
-	domain            *url.URL
-	redisClient       *redis.Client
-	redisURL          string
-	serverBind        string
-	serviceName       string
-	serviceSummary    string
-	serviceIconURL    *url.URL
-	serviceImageURL   *url.URL
-	jobConcurrency    int
-	discordWebhookURL string
+	actorKeys          atomic.Pointer[actorKeyring]
+	actorPEMPath       string
+	actorEd25519Key    ed25519.PrivateKey
+	domain             *url.URL
+	redisClient        *redis.Client
+	redisURL           string
+	serverBind         string
+	serviceName        string
+	serviceSummary     string
+	serviceIconURL     *url.URL
+	serviceImageURL    *url.URL
+	serviceAdminEmail  string
+	serviceTermsURL    *url.URL
+	jobConcurrency     int
+	discordWebhookURL  string
+	discordWebhooks    []discord.Webhook
+	discordBatchWindow time.Duration
+	webhookType        discord.WebhookType
+
+	signatureAllowedAlgorithms         []string
+	signatureRequireDigest             bool
+	actorIntegrityProof                bool
+	signatureClockSkew                 time.Duration
+	mirrorURL                          string
+	mirrorActivityTypes                []string
+	mirrorSampleRate                   float64
+	geoIPDBPath                        string
+	geoIPBlockedCountries              []string
+	geoIPClientIPHeader                string
+	aboutFields                        []string
+	delayMetricsPruneInterval          time.Duration
+	undoFollowGrace                    time.Duration
+	batchDeliveryInterval              time.Duration
+	pausedMaxActivities                int
+	inboxAcceptBody                    bool
+	blocklistURLs                      []string
+	blocklistRefreshInterval           time.Duration
+	inboxRateLimit                     float64
+	inboxRateBurst                     int
+	metricsPath                        string
+	deadInstanceThreshold              int
+	inboxMaxBodySize                   int64
+	deliveryMaxInFlight                int
+	delayMetricsExcludedHosts          []string
+	delayMetricsHistogramBuckets       []time.Duration
+	adminToken                         string
+	actorKeyRotationGrace              time.Duration
+	corsAllowedOrigins                 []string
+	deliveryRetryMaxAttempts           int
+	deliveryDelay                      time.Duration
+	deliveryDelayJitter                time.Duration
+	deliveryOrdered                    bool
+	adminAllowedNetworks               []*net.IPNet
+	nodeinfoUsageMode                  NodeinfoUsageMode
+	nodeinfoMetadata                   map[string]interface{}
+	nodeinfoRelayMetadata              bool
+	catchUpActivityCount               int
+	circuitBreakerThreshold            int
+	circuitBreakerCooldown             time.Duration
+	logFormat                          string
+	httpTimeout                        time.Duration
+	inboxProcessingTimeout             time.Duration
+	hideFollowersCollection            bool
+	minSoftwareVersions                map[string]string
+	minSoftwareVersionAllowUnreachable bool
+	collectionSynchronization          bool
+	actorCacheTTL                      time.Duration
+	actorCacheSize                     int
+	outboundTLSMinVersion              uint16
+	deliveryDegradedThreshold          int
+	relayIdentities                    []RelayIdentity
+	deliveryGzipMinSize                int
+	deliveryGzipDomains                []string
+	redisKeyPrefix                     string
 }
 
+// builtInRoutes are the paths served by the API server with everything below them, METRICS_PATH must stay outside.
+var builtInRoutes = []string{"/.well-known", "/nodeinfo", "/actor", "/inbox", "/api", "/about", "/healthz", "/readyz"}
+
 // NewRelayConfig create valid RelayConfig from viper configuration.
 func NewRelayConfig() (*RelayConfig, error) {
 	domain, err := url.ParseRequestURI("https://" + viper.GetString("RELAY_DOMAIN"))
@@ -49,6 +129,70 @@ func NewRelayConfig() (*RelayConfig, error) {
 		imageURL = nil
 	}
 
+	var termsURL *url.URL
+	if viper.GetString("RELAY_TERMS_URL") != "" {
+		termsURL, err = url.ParseRequestURI(viper.GetString("RELAY_TERMS_URL"))
+		if err != nil {
+			logrus.Warn("RELAY_TERMS_URL: INVALID. THIS COLUMN IS DISABLED.")
+			termsURL = nil
+		}
+	}
+
+	mirrorURL := viper.GetString("MIRROR_URL")
+	if mirrorURL != "" {
+		parsed, err := url.ParseRequestURI(mirrorURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, errors.New("MIRROR_URL: must be an http or https URL")
+		}
+	}
+	var mirrorActivityTypes []string
+	for _, entry := range viper.GetStringSlice("MIRROR_ACTIVITY_TYPES") {
+		for _, activityType := range strings.Split(entry, ",") {
+			activityType = strings.TrimSpace(activityType)
+			if activityType != "" {
+				mirrorActivityTypes = append(mirrorActivityTypes, activityType)
+			}
+		}
+	}
+	mirrorSampleRate := 1.0
+	if viper.IsSet("MIRROR_SAMPLE_RATE") {
+		mirrorSampleRate = viper.GetFloat64("MIRROR_SAMPLE_RATE")
+	}
+	if mirrorSampleRate <= 0 || mirrorSampleRate > 1 {
+		return nil, errors.New("MIRROR_SAMPLE_RATE: must be greater than 0 and at most 1")
+	}
+
+	var geoIPBlockedCountries []string
+	for _, entry := range viper.GetStringSlice("GEOIP_BLOCKED_COUNTRIES") {
+		for _, country := range strings.Split(entry, ",") {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if country == "" {
+				continue
+			}
+			if len(country) != 2 || strings.Trim(country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+				return nil, errors.New("GEOIP_BLOCKED_COUNTRIES: " + country + " is not an ISO 3166-1 alpha-2 code")
+			}
+			geoIPBlockedCountries = append(geoIPBlockedCountries, country)
+		}
+	}
+
+	enabledAboutFields := []string{"name", "description", "actor", "subscribers", "open", "relay_styles"}
+	if len(viper.GetStringSlice("ABOUT_FIELDS")) > 0 {
+		enabledAboutFields = nil
+		for _, entry := range viper.GetStringSlice("ABOUT_FIELDS") {
+			for _, field := range strings.Split(entry, ",") {
+				field = strings.ToLower(strings.TrimSpace(field))
+				if field == "" {
+					continue
+				}
+				if !slices.Contains(aboutFields, field) {
+					return nil, errors.New("ABOUT_FIELDS: unknown field " + field + " (available: " + strings.Join(aboutFields, ", ") + ")")
+				}
+				enabledAboutFields = append(enabledAboutFields, field)
+			}
+		}
+	}
+
 	jobConcurrency := viper.GetInt("JOB_CONCURRENCY")
 	if jobConcurrency < 1 {
 		return nil, errors.New("JOB_CONCURRENCY IS 0 OR EMPTY. SHOULD BE SET MORE THAN 1")
@@ -64,7 +208,20 @@ func NewRelayConfig() (*RelayConfig, error) {
 	if err != nil {
 		return nil, errors.New("REDIS_URL: " + err.Error())
 	}
+	redisSlowThreshold := 100 * time.Millisecond
+	if viper.IsSet("REDIS_SLOW_THRESHOLD") {
+		redisSlowThreshold = viper.GetDuration("REDIS_SLOW_THRESHOLD")
+	}
+	if redisSlowThreshold < 0 {
+		return nil, errors.New("REDIS_SLOW_THRESHOLD: must not be negative")
+	}
+	keyPrefix := viper.GetString("REDIS_KEY_PREFIX")
+	if strings.ContainsAny(keyPrefix, "*?[]\\ \t\n") {
+		return nil, errors.New("REDIS_KEY_PREFIX: must not contain whitespace or glob characters")
+	}
+	configureRedisRetry(redisOption)
 	redisClient := redis.NewClient(redisOption)
+	redisClient.AddHook(redisHealthHook{redisSlowThreshold})
 	err = redisClient.Ping(context.TODO()).Err()
 	if err != nil {
 		return nil, errors.New("REDIS_URL: " + err.Error())
@@ -75,20 +232,418 @@ func NewRelayConfig() (*RelayConfig, error) {
 	if discordWebhookURL != "" {
 		logrus.Info("DISCORD_WEBHOOK_URL: Discord notifications enabled")
 	}
+	var discordWebhooks []discord.Webhook
+	for _, spec := range viper.GetStringSlice("DISCORD_WEBHOOK_URLS") {
+		webhook, err := discord.ParseWebhook(spec)
+		if err != nil {
+			return nil, errors.New("DISCORD_WEBHOOK_URLS: " + err.Error())
+		}
+		discordWebhooks = append(discordWebhooks, webhook)
+	}
+	nodeinfoUsageMode, err := ParseNodeinfoUsageMode(viper.GetString("NODEINFO_USAGE_MODE"))
+	if err != nil {
+		return nil, errors.New("NODEINFO_USAGE_MODE: " + err.Error())
+	}
+	var nodeinfoMetadata map[string]interface{}
+	// JSON keeps the key case that viper would lower for a YAML map
+	if viper.GetString("NODEINFO_METADATA") != "" {
+		err = json.Unmarshal([]byte(viper.GetString("NODEINFO_METADATA")), &nodeinfoMetadata)
+		if err != nil {
+			return nil, errors.New("NODEINFO_METADATA: " + err.Error())
+		}
+	}
+	webhookType, err := discord.ParseWebhookType(viper.GetString("WEBHOOK_TYPE"))
+	if err != nil {
+		return nil, errors.New("WEBHOOK_TYPE: " + err.Error())
+	}
+	discordBatchWindow := viper.GetDuration("DISCORD_BATCH_WINDOW")
+	if discordBatchWindow < 0 {
+		return nil, errors.New("DISCORD_BATCH_WINDOW: must not be negative")
+	}
+
+	var signatureAllowedAlgorithms []string
+	for _, entry := range viper.GetStringSlice("SIGNATURE_ALLOWED_ALGORITHMS") {
+		for _, algorithm := range strings.Split(entry, ",") {
+			algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+			if algorithm != "" {
+				signatureAllowedAlgorithms = append(signatureAllowedAlgorithms, algorithm)
+			}
+		}
+	}
+	metricsPath := viper.GetString("METRICS_PATH")
+	if metricsPath == "" {
+		metricsPath = "/metrics"
+	}
+	if !strings.HasPrefix(metricsPath, "/") {
+		return nil, errors.New("METRICS_PATH: SHOULD START WITH /")
+	}
+	for _, route := range builtInRoutes {
+		if metricsPath == route || strings.HasPrefix(metricsPath, route+"/") {
+			return nil, errors.New("METRICS_PATH: must not collide with built-in route " + route)
+		}
+	}
+
+	var delayMetricsExcludedHosts []string
+	for _, entry := range viper.GetStringSlice("DELAY_METRICS_EXCLUDED_HOSTS") {
+		for _, host := range strings.Split(entry, ",") {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host != "" {
+				delayMetricsExcludedHosts = append(delayMetricsExcludedHosts, host)
+			}
+		}
+	}
+
+	delayMetricsHistogramBuckets := []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 5 * time.Minute}
+	if viper.IsSet("DELAY_METRICS_HISTOGRAM_BUCKETS") {
+		delayMetricsHistogramBuckets = nil
+		for _, entry := range viper.GetStringSlice("DELAY_METRICS_HISTOGRAM_BUCKETS") {
+			for _, bound := range strings.Split(entry, ",") {
+				bound = strings.TrimSpace(bound)
+				if bound == "" {
+					continue
+				}
+				duration, err := time.ParseDuration(bound)
+				if err != nil || duration <= 0 {
+					return nil, errors.New("DELAY_METRICS_HISTOGRAM_BUCKETS: " + bound + " is not a positive duration")
+				}
+				if len(delayMetricsHistogramBuckets) > 0 && duration <= delayMetricsHistogramBuckets[len(delayMetricsHistogramBuckets)-1] {
+					return nil, errors.New("DELAY_METRICS_HISTOGRAM_BUCKETS: bounds must be ascending")
+				}
+				delayMetricsHistogramBuckets = append(delayMetricsHistogramBuckets, duration)
+			}
+		}
+	}
+
+	delayMetricsPruneInterval := time.Hour
+	if viper.IsSet("DELAY_METRICS_PRUNE_INTERVAL") {
+		delayMetricsPruneInterval = viper.GetDuration("DELAY_METRICS_PRUNE_INTERVAL")
+	}
+	if delayMetricsPruneInterval < 0 {
+		return nil, errors.New("DELAY_METRICS_PRUNE_INTERVAL: must not be negative")
+	}
+
+	undoFollowGrace := viper.GetDuration("UNDO_FOLLOW_GRACE")
+	if undoFollowGrace < 0 {
+		return nil, errors.New("UNDO_FOLLOW_GRACE: must not be negative")
+	}
+
+	batchDeliveryInterval := time.Minute
+	if viper.IsSet("BATCH_DELIVERY_INTERVAL") {
+		batchDeliveryInterval = viper.GetDuration("BATCH_DELIVERY_INTERVAL")
+	}
+	if batchDeliveryInterval <= 0 {
+		return nil, errors.New("BATCH_DELIVERY_INTERVAL: must be positive")
+	}
+
+	pausedMaxActivities := 10000
+	if viper.IsSet("PAUSED_MAX_ACTIVITIES") {
+		pausedMaxActivities = viper.GetInt("PAUSED_MAX_ACTIVITIES")
+	}
+	if pausedMaxActivities <= 0 {
+		return nil, errors.New("PAUSED_MAX_ACTIVITIES: must be positive")
+	}
+
+	var blocklistURLs []string
+	for _, entry := range viper.GetStringSlice("BLOCKLIST_URLS") {
+		for _, blocklistURL := range strings.Split(entry, ",") {
+			blocklistURL = strings.TrimSpace(blocklistURL)
+			if blocklistURL == "" {
+				continue
+			}
+			parsed, err := url.ParseRequestURI(blocklistURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				return nil, errors.New("BLOCKLIST_URLS: " + blocklistURL + " is not an http or https URL")
+			}
+			blocklistURLs = append(blocklistURLs, blocklistURL)
+		}
+	}
+	blocklistRefreshInterval := time.Hour
+	if viper.IsSet("BLOCKLIST_REFRESH_INTERVAL") {
+		blocklistRefreshInterval = viper.GetDuration("BLOCKLIST_REFRESH_INTERVAL")
+	}
+	if blocklistRefreshInterval <= 0 {
+		return nil, errors.New("BLOCKLIST_REFRESH_INTERVAL: must be positive")
+	}
+
+	var adminAllowedNetworks []*net.IPNet
+	for _, entry := range viper.GetStringSlice("ADMIN_ALLOWED_CIDRS") {
+		for _, cidr := range strings.Split(entry, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, errors.New("ADMIN_ALLOWED_CIDRS: " + err.Error())
+			}
+			adminAllowedNetworks = append(adminAllowedNetworks, network)
+		}
+	}
+
+	inboxMaxBodySize := int64(2 << 20)
+	if viper.IsSet("INBOX_MAX_BODY_SIZE") {
+		inboxMaxBodySize = viper.GetInt64("INBOX_MAX_BODY_SIZE")
+	}
+	if inboxMaxBodySize < 1 {
+		return nil, errors.New("INBOX_MAX_BODY_SIZE: SHOULD BE MORE THAN 0")
+	}
+
+	deliveryMaxInFlight := viper.GetInt("DELIVERY_MAX_IN_FLIGHT")
+	if deliveryMaxInFlight < 1 {
+		deliveryMaxInFlight = jobConcurrency
+	}
+
+	deadInstanceThreshold := 10
+	if viper.IsSet("DEAD_INSTANCE_THRESHOLD") {
+		deadInstanceThreshold = viper.GetInt("DEAD_INSTANCE_THRESHOLD")
+	}
+
+	deliveryDegradedThreshold := 10
+	if viper.IsSet("DELIVERY_DEGRADED_THRESHOLD") {
+		deliveryDegradedThreshold = viper.GetInt("DELIVERY_DEGRADED_THRESHOLD")
+	}
+
+	signatureRequireDigest := true
+	if viper.IsSet("SIGNATURE_REQUIRE_DIGEST") {
+		signatureRequireDigest = viper.GetBool("SIGNATURE_REQUIRE_DIGEST")
+	}
+	signatureClockSkew := 30 * time.Second
+	if viper.IsSet("SIGNATURE_CLOCK_SKEW") {
+		signatureClockSkew = viper.GetDuration("SIGNATURE_CLOCK_SKEW")
+	}
+	if signatureClockSkew <= 0 || signatureClockSkew > maxSignatureClockSkew {
+		return nil, errors.New("SIGNATURE_CLOCK_SKEW: must be positive and at most " + maxSignatureClockSkew.String())
+	}
+
+	var actorEd25519Key ed25519.PrivateKey
+	if viper.GetString("ACTOR_ED25519_PEM") != "" {
+		actorEd25519Key, err = readPrivateKeyEd25519(viper.GetString("ACTOR_ED25519_PEM"))
+		if err != nil {
+			return nil, errors.New("ACTOR_ED25519_PEM: " + err.Error())
+		}
+	}
+	actorIntegrityProof := viper.GetBool("ACTOR_INTEGRITY_PROOF")
+	if actorIntegrityProof && actorEd25519Key == nil {
+		return nil, errors.New("ACTOR_INTEGRITY_PROOF: requires ACTOR_ED25519_PEM")
+	}
+
+	relayIdentities, err := parseRelayIdentities(viper.GetStringSlice("RELAY_IDENTITIES"), domain)
+	if err != nil {
+		return nil, errors.New("RELAY_IDENTITIES: " + err.Error())
+	}
+
+	deliveryGzipMinSize := viper.GetInt("DELIVERY_GZIP_MIN_SIZE")
+	if deliveryGzipMinSize < 0 {
+		return nil, errors.New("DELIVERY_GZIP_MIN_SIZE: must not be negative")
+	}
+	var deliveryGzipDomains []string
+	for _, entry := range viper.GetStringSlice("DELIVERY_GZIP_DOMAINS") {
+		for _, domain := range strings.Split(entry, ",") {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			if domain != "" {
+				deliveryGzipDomains = append(deliveryGzipDomains, domain)
+			}
+		}
+	}
+
+	deliveryRetryMaxAttempts := 5
+	if viper.IsSet("DELIVERY_RETRY_MAX_ATTEMPTS") {
+		deliveryRetryMaxAttempts = viper.GetInt("DELIVERY_RETRY_MAX_ATTEMPTS")
+	}
+
+	deliveryDelay := viper.GetDuration("DELIVERY_DELAY")
+	if deliveryDelay < 0 {
+		return nil, errors.New("DELIVERY_DELAY: must not be negative")
+	}
+	deliveryDelayJitter := viper.GetDuration("DELIVERY_DELAY_JITTER")
+	if deliveryDelayJitter < 0 {
+		return nil, errors.New("DELIVERY_DELAY_JITTER: must not be negative")
+	}
+	deliveryOrdered := viper.GetBool("DELIVERY_ORDERED")
+	if deliveryOrdered && (deliveryDelay > 0 || deliveryDelayJitter > 0) {
+		return nil, errors.New("DELIVERY_ORDERED: can not be used with DELIVERY_DELAY or DELIVERY_DELAY_JITTER")
+	}
+
+	corsAllowedOrigins := []string{"*"}
+	if viper.IsSet("CORS_ALLOWED_ORIGINS") {
+		corsAllowedOrigins = nil
+		for _, entry := range viper.GetStringSlice("CORS_ALLOWED_ORIGINS") {
+			for _, origin := range strings.Split(entry, ",") {
+				origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+				if origin != "" {
+					corsAllowedOrigins = append(corsAllowedOrigins, origin)
+				}
+			}
+		}
+	}
+
+	catchUpActivityCount := viper.GetInt("CATCHUP_ACTIVITY_COUNT")
+	if catchUpActivityCount < 0 {
+		return nil, errors.New("CATCHUP_ACTIVITY_COUNT: must not be negative")
+	}
+
+	circuitBreakerCooldown := 5 * time.Minute
+	if viper.IsSet("CIRCUIT_BREAKER_COOLDOWN") {
+		circuitBreakerCooldown = viper.GetDuration("CIRCUIT_BREAKER_COOLDOWN")
+	}
+	if circuitBreakerCooldown <= 0 {
+		return nil, errors.New("CIRCUIT_BREAKER_COOLDOWN: must be positive")
+	}
+
+	logFormat := strings.ToLower(viper.GetString("LOG_FORMAT"))
+	if logFormat == "" {
+		logFormat = "text"
+	}
+	if logFormat != "text" && logFormat != "json" {
+		return nil, errors.New("LOG_FORMAT: SHOULD BE text OR json")
+	}
 
-	return &RelayConfig{
-		actorKey:          privateKey,
-		domain:            domain,
-		redisClient:       redisClient,
-		redisURL:          redisURL,
-		serverBind:        serverBind,
-		serviceName:       viper.GetString("RELAY_SERVICENAME"),
-		serviceSummary:    viper.GetString("RELAY_SUMMARY"),
-		serviceIconURL:    iconURL,
-		serviceImageURL:   imageURL,
-		jobConcurrency:    jobConcurrency,
-		discordWebhookURL: discordWebhookURL,
-	}, nil
+	httpTimeout := 10 * time.Second
+	if viper.IsSet("HTTP_TIMEOUT") {
+		httpTimeout = viper.GetDuration("HTTP_TIMEOUT")
+	}
+	if httpTimeout <= 0 {
+		return nil, errors.New("HTTP_TIMEOUT: must be positive")
+	}
+
+	inboxProcessingTimeout := 5 * time.Second
+	if viper.IsSet("INBOX_PROCESSING_TIMEOUT") {
+		inboxProcessingTimeout = viper.GetDuration("INBOX_PROCESSING_TIMEOUT")
+	}
+	if inboxProcessingTimeout <= 0 {
+		return nil, errors.New("INBOX_PROCESSING_TIMEOUT: must be positive")
+	}
+
+	actorCacheTTL := 5 * time.Minute
+	if viper.IsSet("ACTOR_CACHE_TTL") {
+		actorCacheTTL = viper.GetDuration("ACTOR_CACHE_TTL")
+	}
+	if actorCacheTTL <= 0 {
+		return nil, errors.New("ACTOR_CACHE_TTL: must be positive")
+	}
+	actorCacheSize := 10000
+	if viper.IsSet("ACTOR_CACHE_SIZE") {
+		actorCacheSize = viper.GetInt("ACTOR_CACHE_SIZE")
+	}
+	if actorCacheSize < 1 {
+		return nil, errors.New("ACTOR_CACHE_SIZE: must be positive")
+	}
+
+	var outboundTLSMinVersion uint16
+	switch viper.GetString("OUTBOUND_TLS_MIN_VERSION") {
+	case "", "1.2":
+		outboundTLSMinVersion = tls.VersionTLS12
+	case "1.3":
+		outboundTLSMinVersion = tls.VersionTLS13
+	default:
+		return nil, errors.New("OUTBOUND_TLS_MIN_VERSION: SHOULD BE 1.2 OR 1.3")
+	}
+
+	minSoftwareVersions := map[string]string{}
+	for _, entry := range viper.GetStringSlice("MIN_SOFTWARE_VERSIONS") {
+		for _, pair := range strings.Split(entry, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			name, version, found := strings.Cut(pair, ":")
+			name, version = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(version)
+			if !found || name == "" || version == "" || version[0] < '0' || version[0] > '9' {
+				return nil, errors.New("MIN_SOFTWARE_VERSIONS: INVALID ENTRY " + pair + ", SHOULD BE software:version")
+			}
+			minSoftwareVersions[name] = version
+		}
+	}
+	minSoftwareVersionAllowUnreachable := true
+	if viper.IsSet("MIN_SOFTWARE_VERSION_ALLOW_UNREACHABLE") {
+		minSoftwareVersionAllowUnreachable = viper.GetBool("MIN_SOFTWARE_VERSION_ALLOW_UNREACHABLE")
+	}
+
+	actorKeyRotationGrace := 24 * time.Hour
+	if viper.IsSet("ACTOR_KEY_ROTATION_GRACE") {
+		actorKeyRotationGrace = viper.GetDuration("ACTOR_KEY_ROTATION_GRACE")
+	}
+
+	relayConfig := &RelayConfig{
+		actorPEMPath:       viper.GetString("ACTOR_PEM"),
+		actorEd25519Key:    actorEd25519Key,
+		domain:             domain,
+		redisClient:        redisClient,
+		redisURL:           redisURL,
+		serverBind:         serverBind,
+		serviceName:        viper.GetString("RELAY_SERVICENAME"),
+		serviceSummary:     viper.GetString("RELAY_SUMMARY"),
+		serviceIconURL:     iconURL,
+		serviceImageURL:    imageURL,
+		serviceAdminEmail:  viper.GetString("RELAY_ADMIN_EMAIL"),
+		serviceTermsURL:    termsURL,
+		jobConcurrency:     jobConcurrency,
+		discordWebhookURL:  discordWebhookURL,
+		discordWebhooks:    discordWebhooks,
+		discordBatchWindow: discordBatchWindow,
+		webhookType:        webhookType,
+
+		signatureAllowedAlgorithms:         signatureAllowedAlgorithms,
+		signatureRequireDigest:             signatureRequireDigest,
+		actorIntegrityProof:                actorIntegrityProof,
+		signatureClockSkew:                 signatureClockSkew,
+		mirrorURL:                          mirrorURL,
+		mirrorActivityTypes:                mirrorActivityTypes,
+		mirrorSampleRate:                   mirrorSampleRate,
+		geoIPDBPath:                        viper.GetString("GEOIP_DB_PATH"),
+		geoIPBlockedCountries:              geoIPBlockedCountries,
+		geoIPClientIPHeader:                viper.GetString("GEOIP_CLIENT_IP_HEADER"),
+		aboutFields:                        enabledAboutFields,
+		delayMetricsPruneInterval:          delayMetricsPruneInterval,
+		undoFollowGrace:                    undoFollowGrace,
+		batchDeliveryInterval:              batchDeliveryInterval,
+		pausedMaxActivities:                pausedMaxActivities,
+		inboxAcceptBody:                    viper.GetBool("INBOX_ACCEPT_BODY"),
+		blocklistURLs:                      blocklistURLs,
+		blocklistRefreshInterval:           blocklistRefreshInterval,
+		inboxRateLimit:                     viper.GetFloat64("INBOX_RATE_LIMIT"),
+		inboxRateBurst:                     viper.GetInt("INBOX_RATE_BURST"),
+		metricsPath:                        metricsPath,
+		deadInstanceThreshold:              deadInstanceThreshold,
+		inboxMaxBodySize:                   inboxMaxBodySize,
+		deliveryMaxInFlight:                deliveryMaxInFlight,
+		delayMetricsExcludedHosts:          delayMetricsExcludedHosts,
+		delayMetricsHistogramBuckets:       delayMetricsHistogramBuckets,
+		adminToken:                         viper.GetString("ADMIN_TOKEN"),
+		adminAllowedNetworks:               adminAllowedNetworks,
+		actorKeyRotationGrace:              actorKeyRotationGrace,
+		corsAllowedOrigins:                 corsAllowedOrigins,
+		deliveryRetryMaxAttempts:           deliveryRetryMaxAttempts,
+		deliveryDelay:                      deliveryDelay,
+		deliveryDelayJitter:                deliveryDelayJitter,
+		deliveryOrdered:                    deliveryOrdered,
+		nodeinfoUsageMode:                  nodeinfoUsageMode,
+		nodeinfoMetadata:                   nodeinfoMetadata,
+		catchUpActivityCount:               catchUpActivityCount,
+		circuitBreakerThreshold:            viper.GetInt("CIRCUIT_BREAKER_THRESHOLD"),
+		circuitBreakerCooldown:             circuitBreakerCooldown,
+		logFormat:                          logFormat,
+		nodeinfoRelayMetadata:              viper.GetBool("NODEINFO_RELAY_METADATA"),
+		httpTimeout:                        httpTimeout,
+		inboxProcessingTimeout:             inboxProcessingTimeout,
+		hideFollowersCollection:            viper.GetBool("HIDE_FOLLOWERS_COLLECTION"),
+		minSoftwareVersions:                minSoftwareVersions,
+		minSoftwareVersionAllowUnreachable: minSoftwareVersionAllowUnreachable,
+		collectionSynchronization:          viper.GetBool("COLLECTION_SYNCHRONIZATION"),
+		actorCacheTTL:                      actorCacheTTL,
+		actorCacheSize:                     actorCacheSize,
+		outboundTLSMinVersion:              outboundTLSMinVersion,
+		deliveryDegradedThreshold:          deliveryDegradedThreshold,
+		relayIdentities:                    relayIdentities,
+		deliveryGzipMinSize:                deliveryGzipMinSize,
+		deliveryGzipDomains:                deliveryGzipDomains,
+		redisKeyPrefix:                     keyPrefix,
+	}
+	relayConfig.actorKeys.Store(&actorKeyring{active: actorKeyPair{mainKeyFragment, privateKey}})
+	// Keys are namespaced together with the client they are used with
+	redisKeyPrefix = relayConfig.redisKeyPrefix
+
+	return relayConfig, nil
 }
 
 // ServerBind is API Server's bind interface definition.
@@ -106,16 +661,31 @@ func (relayConfig *RelayConfig) ServerServiceName() string {
 	return relayConfig.serviceName
 }
 
+// ServerServiceSummary is API Server's summary definition.
+func (relayConfig *RelayConfig) ServerServiceSummary() string {
+	return relayConfig.serviceSummary
+}
+
+// ServerAdminEmail is API Server's admin contact definition, empty unless configured.
+func (relayConfig *RelayConfig) ServerAdminEmail() string {
+	return relayConfig.serviceAdminEmail
+}
+
+// ServerTermsURL is API Server's terms of service definition, nil unless configured.
+func (relayConfig *RelayConfig) ServerTermsURL() *url.URL {
+	return relayConfig.serviceTermsURL
+}
+
+// DeliveryMaxInFlight is API Worker's limit of concurrent outbound deliveries.
+func (relayConfig *RelayConfig) DeliveryMaxInFlight() int {
+	return relayConfig.deliveryMaxInFlight
+}
+
 // JobConcurrency is API Worker's jobConcurrency definition.
 func (relayConfig *RelayConfig) JobConcurrency() int {
 	return relayConfig.jobConcurrency
 }
 
-// ActorKey is API Worker's HTTPSignature private key.
-func (relayConfig *RelayConfig) ActorKey() *rsa.PrivateKey {
-	return relayConfig.actorKey
-}
-
 // RedisClient is return redis client from RelayConfig.
 func (relayConfig *RelayConfig) RedisClient() *redis.Client {
 	return relayConfig.redisClient
@@ -126,6 +696,276 @@ func (relayConfig *RelayConfig) DiscordWebhookURL() string {
 	return relayConfig.discordWebhookURL
 }
 
+// DiscordWebhooks returns the additional Discord webhooks with their notification filters.
+func (relayConfig *RelayConfig) DiscordWebhooks() []discord.Webhook {
+	return relayConfig.discordWebhooks
+}
+
+// WebhookType returns the service the notification webhooks are posted to.
+func (relayConfig *RelayConfig) WebhookType() discord.WebhookType {
+	return relayConfig.webhookType
+}
+
+// NodeinfoUsageMode returns how connections are reported as nodeinfo users.
+func (relayConfig *RelayConfig) NodeinfoUsageMode() NodeinfoUsageMode {
+	return relayConfig.nodeinfoUsageMode
+}
+
+// NodeinfoMetadata returns the operator supplied entries of nodeinfo metadata.
+func (relayConfig *RelayConfig) NodeinfoMetadata() map[string]interface{} {
+	return relayConfig.nodeinfoMetadata
+}
+
+// NodeinfoRelayMetadata returns whether relay capabilities are advertised in nodeinfo metadata.
+func (relayConfig *RelayConfig) NodeinfoRelayMetadata() bool {
+	return relayConfig.nodeinfoRelayMetadata
+}
+
+// CatchUpActivityCount returns how many recent activities are replayed to a new subscriber, zero disables replay.
+func (relayConfig *RelayConfig) CatchUpActivityCount() int {
+	return relayConfig.catchUpActivityCount
+}
+
+// CircuitBreakerThreshold returns the consecutive failures that open the circuit of a domain, zero disables the breaker.
+func (relayConfig *RelayConfig) CircuitBreakerThreshold() int {
+	return relayConfig.circuitBreakerThreshold
+}
+
+// CircuitBreakerCooldown returns how long an open circuit skips deliveries before probing the domain again.
+func (relayConfig *RelayConfig) CircuitBreakerCooldown() time.Duration {
+	return relayConfig.circuitBreakerCooldown
+}
+
+// LogFormat returns the log output format, text or json.
+func (relayConfig *RelayConfig) LogFormat() string {
+	return relayConfig.logFormat
+}
+
+// HTTPTimeout returns the timeout of outbound requests to remote instances and webhooks.
+func (relayConfig *RelayConfig) HTTPTimeout() time.Duration {
+	return relayConfig.httpTimeout
+}
+
+// InboxProcessingTimeout returns how long an inbox request may take before it is answered and processing continues in the background.
+func (relayConfig *RelayConfig) InboxProcessingTimeout() time.Duration {
+	return relayConfig.inboxProcessingTimeout
+}
+
+// UserAgent returns the User-Agent sent with outbound requests.
+func (relayConfig *RelayConfig) UserAgent(version string) string {
+	return "Activity-Relay/" + version + " (+" + relayConfig.domain.String() + ")"
+}
+
+// HideFollowersCollection returns whether the followers collection publishes only its totalItems.
+func (relayConfig *RelayConfig) HideFollowersCollection() bool {
+	return relayConfig.hideFollowersCollection
+}
+
+// MinSoftwareVersions returns the minimum version of following instances by lowercase software name.
+func (relayConfig *RelayConfig) MinSoftwareVersions() map[string]string {
+	return relayConfig.minSoftwareVersions
+}
+
+// MinSoftwareVersionAllowUnreachable returns whether follows are accepted when nodeinfo of the instance can't be fetched.
+func (relayConfig *RelayConfig) MinSoftwareVersionAllowUnreachable() bool {
+	return relayConfig.minSoftwareVersionAllowUnreachable
+}
+
+// CollectionSynchronization returns whether deliveries carry the FEP-8fcf followers digest.
+func (relayConfig *RelayConfig) CollectionSynchronization() bool {
+	return relayConfig.collectionSynchronization
+}
+
+// ActorCacheTTL returns how long a fetched remote actor is reused.
+func (relayConfig *RelayConfig) ActorCacheTTL() time.Duration {
+	return relayConfig.actorCacheTTL
+}
+
+// ActorCacheSize returns the number of remote actors kept in memory.
+func (relayConfig *RelayConfig) ActorCacheSize() int {
+	return relayConfig.actorCacheSize
+}
+
+// OutboundTLSMinVersion returns the lowest TLS version accepted when connecting to remote instances.
+func (relayConfig *RelayConfig) OutboundTLSMinVersion() uint16 {
+	return relayConfig.outboundTLSMinVersion
+}
+
+// DiscordBatchWindow returns the window for coalescing Discord notifications, zero disables batching.
+func (relayConfig *RelayConfig) DiscordBatchWindow() time.Duration {
+	return relayConfig.discordBatchWindow
+}
+
+// SignatureAllowedAlgorithms returns HTTP Signature algorithms accepted on inbox. Empty means all.
+func (relayConfig *RelayConfig) SignatureAllowedAlgorithms() []string {
+	return relayConfig.signatureAllowedAlgorithms
+}
+
+// SignatureRequireDigest returns whether inbox requires Digest header.
+func (relayConfig *RelayConfig) SignatureRequireDigest() bool {
+	return relayConfig.signatureRequireDigest
+}
+
+// SignatureClockSkew returns accepted offset of inbound signature times from the relay's clock.
+func (relayConfig *RelayConfig) SignatureClockSkew() time.Duration {
+	return relayConfig.signatureClockSkew
+}
+
+// MirrorURL returns the endpoint receiving copies of relayed activities. Empty means disabled.
+func (relayConfig *RelayConfig) MirrorURL() string {
+	return relayConfig.mirrorURL
+}
+
+// MirrorActivityTypes returns activity types copied to MirrorURL. Empty means all.
+func (relayConfig *RelayConfig) MirrorActivityTypes() []string {
+	return relayConfig.mirrorActivityTypes
+}
+
+// MirrorSampleRate returns the fraction of activities copied to MirrorURL.
+func (relayConfig *RelayConfig) MirrorSampleRate() float64 {
+	return relayConfig.mirrorSampleRate
+}
+
+// GeoIPDBPath returns the MaxMind DB used to block inbox connections by country. Empty disables geoblocking.
+func (relayConfig *RelayConfig) GeoIPDBPath() string {
+	return relayConfig.geoIPDBPath
+}
+
+// GeoIPBlockedCountries returns ISO 3166-1 alpha-2 codes of countries whose inbox connections are rejected.
+func (relayConfig *RelayConfig) GeoIPBlockedCountries() []string {
+	return relayConfig.geoIPBlockedCountries
+}
+
+// GeoIPClientIPHeader returns the header set by a trusted proxy with the client address. Empty means RemoteAddr.
+func (relayConfig *RelayConfig) GeoIPClientIPHeader() string {
+	return relayConfig.geoIPClientIPHeader
+}
+
+// AboutFields returns the fields shown by /about.
+func (relayConfig *RelayConfig) AboutFields() []string {
+	return relayConfig.aboutFields
+}
+
+// DelayMetricsPruneInterval returns how often instances without recent delay metrics are pruned. Zero disables pruning.
+func (relayConfig *RelayConfig) DelayMetricsPruneInterval() time.Duration {
+	return relayConfig.delayMetricsPruneInterval
+}
+
+// UndoFollowGrace returns how long removal on Undo(Follow) waits for a new Follow cancelling it. Zero removes immediately.
+func (relayConfig *RelayConfig) UndoFollowGrace() time.Duration {
+	return relayConfig.undoFollowGrace
+}
+
+// BatchDeliveryInterval returns how often activities buffered for subscribers in batch mode are delivered.
+func (relayConfig *RelayConfig) BatchDeliveryInterval() time.Duration {
+	return relayConfig.batchDeliveryInterval
+}
+
+// PausedMaxActivities returns how many activities are held while delivery is paused, the oldest are dropped beyond it.
+func (relayConfig *RelayConfig) PausedMaxActivities() int {
+	return relayConfig.pausedMaxActivities
+}
+
+// InboxAcceptBody returns whether accepted inbox activities are answered with the relay name and request id.
+func (relayConfig *RelayConfig) InboxAcceptBody() bool {
+	return relayConfig.inboxAcceptBody
+}
+
+// BlocklistURLs returns the remote blocklists, in CSV, whose domains are blocked.
+func (relayConfig *RelayConfig) BlocklistURLs() []string {
+	return relayConfig.blocklistURLs
+}
+
+// BlocklistRefreshInterval returns how often remote blocklists are fetched again.
+func (relayConfig *RelayConfig) BlocklistRefreshInterval() time.Duration {
+	return relayConfig.blocklistRefreshInterval
+}
+
+// InboxRateLimit returns accepted activities per second per instance. Zero means unlimited.
+func (relayConfig *RelayConfig) InboxRateLimit() float64 {
+	return relayConfig.inboxRateLimit
+}
+
+// InboxRateBurst returns burst size of inbox rate limit.
+func (relayConfig *RelayConfig) InboxRateBurst() int {
+	return relayConfig.inboxRateBurst
+}
+
+// DeliveryRetryMaxAttempts returns how many times a failed delivery is retried, 0 disables retries.
+func (relayConfig *RelayConfig) DeliveryRetryMaxAttempts() int {
+	return relayConfig.deliveryRetryMaxAttempts
+}
+
+// DeliveryDelay returns the fixed wait before relayed activities are sent, 0 sends them right away.
+func (relayConfig *RelayConfig) DeliveryDelay() time.Duration {
+	return relayConfig.deliveryDelay
+}
+
+// DeliveryDelayJitter returns the upper bound of a random wait added to DeliveryDelay.
+func (relayConfig *RelayConfig) DeliveryDelayJitter() time.Duration {
+	return relayConfig.deliveryDelayJitter
+}
+
+// DeliveryOrdered returns whether deliveries to each domain are sent one at a time in enqueue order, instead of in parallel.
+func (relayConfig *RelayConfig) DeliveryOrdered() bool {
+	return relayConfig.deliveryOrdered
+}
+
+// DeadInstanceThreshold returns consecutive 404/410 deliveries before unfollowing an instance, 0 disables it.
+func (relayConfig *RelayConfig) DeadInstanceThreshold() int {
+	return relayConfig.deadInstanceThreshold
+}
+
+// DeliveryDegradedThreshold returns the consecutive failed deliveries to a domain that trigger a degraded notification, 0 disables it.
+func (relayConfig *RelayConfig) DeliveryDegradedThreshold() int {
+	return relayConfig.deliveryDegradedThreshold
+}
+
+// DeliveryGzipMinSize returns the body size in bytes from which deliveries are gzip compressed, 0 disables compression.
+func (relayConfig *RelayConfig) DeliveryGzipMinSize() int {
+	return relayConfig.deliveryGzipMinSize
+}
+
+// DeliveryGzipDomains returns the destination domains known to accept gzip compressed deliveries, "*" matches every domain.
+func (relayConfig *RelayConfig) DeliveryGzipDomains() []string {
+	return relayConfig.deliveryGzipDomains
+}
+
+// RedisKeyPrefix returns the prefix of every Redis key of this relay, empty by default.
+func (relayConfig *RelayConfig) RedisKeyPrefix() string {
+	return relayConfig.redisKeyPrefix
+}
+
+// InboxMaxBodySize returns the largest activity body accepted on inbox in bytes.
+func (relayConfig *RelayConfig) InboxMaxBodySize() int64 {
+	return relayConfig.inboxMaxBodySize
+}
+
+// DelayMetricsExcludedHosts returns hosts ignored by delay metrics.
+func (relayConfig *RelayConfig) DelayMetricsExcludedHosts() []string {
+	return relayConfig.delayMetricsExcludedHosts
+}
+
+// DelayMetricsHistogramBuckets returns the ascending upper bounds of delay histogram buckets, empty disables the histogram.
+func (relayConfig *RelayConfig) DelayMetricsHistogramBuckets() []time.Duration {
+	return relayConfig.delayMetricsHistogramBuckets
+}
+
+// AdminToken returns the bearer token required by admin API.
+func (relayConfig *RelayConfig) AdminToken() string {
+	return relayConfig.adminToken
+}
+
+// AdminAllowedNetworks returns source networks allowed to use admin API, empty allows all.
+func (relayConfig *RelayConfig) AdminAllowedNetworks() []*net.IPNet {
+	return relayConfig.adminAllowedNetworks
+}
+
+// MetricsPath returns the path serving Prometheus metrics.
+func (relayConfig *RelayConfig) MetricsPath() string {
+	return relayConfig.metricsPath
+}
+
 // ServiceIconURL returns the service icon URL.
 func (relayConfig *RelayConfig) ServiceIconURL() string {
 	if relayConfig.serviceIconURL != nil {
@@ -146,11 +986,26 @@ JOB_CONCURRENCY : %s
 `, version, moduleName, relayConfig.serviceName, relayConfig.domain.Host, relayConfig.redisURL, relayConfig.serverBind, strconv.Itoa(relayConfig.jobConcurrency))
 }
 
+// MachineryQueue is the Redis list holding queued delivery tasks.
+const MachineryQueue = "relay"
+
+// RetryQueue is the Redis sorted set holding failed deliveries scored by their next attempt time.
+const RetryQueue = "relay:retry"
+
+// DelayedQueue is the Redis sorted set holding delayed deliveries scored by their send time in milliseconds.
+const DelayedQueue = "relay:delayed"
+
+// OrderedQueue is the prefix of the Redis lists holding deliveries to one domain, sent in order when DELIVERY_ORDERED is enabled.
+const OrderedQueue = "relay:ordered:"
+
+// OrderedWakeups is the Redis sorted set of domains whose ordered queue is resumed at their score in unix seconds.
+const OrderedWakeups = "relay:ordered_wakeups"
+
 // NewMachineryServer create Redis backed Machinery Server from RelayConfig.
 func NewMachineryServer(globalConfig *RelayConfig) (*machinery.Server, error) {
 	cnf := &config.Config{
 		Broker:          globalConfig.redisURL,
-		DefaultQueue:    "relay",
+		DefaultQueue:    RedisKey(MachineryQueue),
 		ResultBackend:   globalConfig.redisURL,
 		ResultsExpireIn: 1,
 	}
@@ -158,3 +1013,8 @@ func NewMachineryServer(globalConfig *RelayConfig) (*machinery.Server, error) {
 
 	return newServer, err
 }
+
+// CORSAllowedOrigins returns origins allowed to read JSON API responses, "*" allows any.
+func (relayConfig *RelayConfig) CORSAllowedOrigins() []string {
+	return relayConfig.corsAllowedOrigins
+}
@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -37,10 +38,18 @@ func TestNewRelayConfig(t *testing.T) {
 
 	t.Run("Fail to load invalid configuration", func(t *testing.T) {
 		invalidConfig := map[string]string{
-			"ACTOR_PEM@notFound":        "../misc/test/notfound.pem",
-			"ACTOR_PEM@invalidKey":      "../misc/test/actor.dh.pem",
-			"REDIS_URL@invalidURL":      "",
-			"REDIS_URL@unreachableHost": "redis://localhost:6380",
+			"ACTOR_PEM@notFound":                      "../misc/test/notfound.pem",
+			"ACTOR_PEM@invalidKey":                    "../misc/test/actor.dh.pem",
+			"REDIS_URL@invalidURL":                    "",
+			"REDIS_URL@unreachableHost":               "redis://localhost:6380",
+			"LOG_FORMAT@unknownFormat":                "xml",
+			"OUTBOUND_TLS_MIN_VERSION@tooOld":         "1.0",
+			"REDIS_KEY_PREFIX@globPattern":            "relay-*:",
+			"ABOUT_FIELDS@unknownField":               "name,email",
+			"ACTOR_INTEGRITY_PROOF@withoutEd25519Key": "true",
+			"BLOCKLIST_URLS@notHTTP":                  "ftp://example.com/blocklist.csv",
+			"METRICS_PATH@builtInRoute":               "/inbox",
+			"METRICS_PATH@belowBuiltInRoute":          "/api/stats",
 		}
 
 		for key, value := range invalidConfig {
@@ -58,6 +67,19 @@ func TestNewRelayConfig(t *testing.T) {
 	})
 }
 
+func TestRelayConfig_PausedMaxActivities(t *testing.T) {
+	defer viper.Set("PAUSED_MAX_ACTIVITIES", nil)
+
+	relayConfig := createRelayConfig(t)
+	if relayConfig.PausedMaxActivities() != 10000 {
+		t.Fatalf("Expected default of 10000 held activities, but got %d", relayConfig.PausedMaxActivities())
+	}
+	viper.Set("PAUSED_MAX_ACTIVITIES", 0)
+	if _, err := NewRelayConfig(); err == nil {
+		t.Fatal("Expected PAUSED_MAX_ACTIVITIES of 0 to be rejected")
+	}
+}
+
 func createRelayConfig(t *testing.T) *RelayConfig {
 	relayConfig, err := NewRelayConfig()
 	if err != nil {
@@ -81,6 +103,43 @@ func TestRelayConfig_ServerHostname(t *testing.T) {
 	}
 }
 
+func TestRelayConfig_ServerContact(t *testing.T) {
+	relayConfig := createRelayConfig(t)
+	if relayConfig.ServerAdminEmail() != "" || relayConfig.ServerTermsURL() != nil {
+		t.Fatalf("Expected contact fields to be empty by default, but got '%s' and %v", relayConfig.ServerAdminEmail(), relayConfig.ServerTermsURL())
+	}
+	if actor := NewActivityPubActorFromRelayConfig(relayConfig); actor.AttributedTo != "" {
+		t.Fatalf("Expected attributedTo to be omitted by default, but got '%s'", actor.AttributedTo)
+	}
+
+	viper.Set("RELAY_ADMIN_EMAIL", "admin@example.com")
+	viper.Set("RELAY_TERMS_URL", "https://example.com/terms")
+	defer viper.Set("RELAY_ADMIN_EMAIL", "")
+	defer viper.Set("RELAY_TERMS_URL", "")
+	relayConfig = createRelayConfig(t)
+	if relayConfig.ServerTermsURL().String() != "https://example.com/terms" {
+		t.Fatalf("Expected ServerTermsURL() to return 'https://example.com/terms', but got %v", relayConfig.ServerTermsURL())
+	}
+	actor := NewActivityPubActorFromRelayConfig(relayConfig)
+	if actor.AttributedTo != "mailto:admin@example.com" || actor.Summary != relayConfig.ServerServiceSummary() {
+		t.Fatalf("Expected actor to carry contact and summary, but got '%s' and '%s'", actor.AttributedTo, actor.Summary)
+	}
+}
+
+func TestRelayConfig_UserAgent(t *testing.T) {
+	relayConfig := createRelayConfig(t)
+	expected := "Activity-Relay/1.0.0 (+https://" + relayConfig.domain.Host + ")"
+	if relayConfig.UserAgent("1.0.0") != expected {
+		t.Errorf("Expected UserAgent() to return '%s', but got '%s'", expected, relayConfig.UserAgent("1.0.0"))
+	}
+	if relayConfig.HTTPTimeout() != 10*time.Second {
+		t.Errorf("Expected HTTPTimeout() to default to 10s, but got %v", relayConfig.HTTPTimeout())
+	}
+	if relayConfig.ActorCacheTTL() != 5*time.Minute || relayConfig.ActorCacheSize() != 10000 {
+		t.Errorf("Expected actor cache to default to 5m and 10000 entries, but got %v and %d", relayConfig.ActorCacheTTL(), relayConfig.ActorCacheSize())
+	}
+}
+
 func TestRelayConfig_DumpWelcomeMessage(t *testing.T) {
 	relayConfig := createRelayConfig(t)
 	w := relayConfig.DumpWelcomeMessage("Testing", "")
@@ -109,3 +168,29 @@ func TestNewMachineryServer(t *testing.T) {
 		t.Errorf("Expected NewMachineryServer to succeed, but got error: %v", err)
 	}
 }
+
+func TestRelayConfig_RelayIdentities(t *testing.T) {
+	defer viper.Set("RELAY_IDENTITIES", "")
+
+	viper.Set("RELAY_IDENTITIES", "Relay.Example.Net=../misc/test/testKey.pem, relay.example.org=../misc/test/testKey.pem")
+	relayConfig := createRelayConfig(t)
+	if len(relayConfig.RelayIdentities()) != 2 {
+		t.Fatalf("Expected 2 identities, but got %d", len(relayConfig.RelayIdentities()))
+	}
+	identity, found := relayConfig.RelayIdentityByActorID("https://relay.example.net/actor")
+	if !found || identity.KeyID() != "https://relay.example.net/actor#main-key" || identity.Key() == nil {
+		t.Fatalf("Expected identity of relay.example.net, but got %+v", identity)
+	}
+
+	for _, invalid := range []string{
+		"relay.example.net",
+		"relay.example.net=../misc/test/notfound.pem",
+		"relay.toot.yukimochi.jp=../misc/test/testKey.pem",
+		"relay.example.net=../misc/test/testKey.pem,relay.example.net=../misc/test/testKey.pem",
+	} {
+		viper.Set("RELAY_IDENTITIES", invalid)
+		if _, err := NewRelayConfig(); err == nil {
+			t.Fatalf("Expected RELAY_IDENTITIES %s to be rejected", invalid)
+		}
+	}
+}
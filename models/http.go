@@ -0,0 +1,33 @@
+package models
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// HTTPClient is shared by outbound requests to remote instances and webhooks.
+// ConfigureHTTPClient applies the configured timeout and User-Agent to it.
+var HTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// userAgentTransport sets the User-Agent of requests that do not carry one.
+type userAgentTransport struct {
+	userAgent string
+	base      http.RoundTripper
+}
+
+func (transport *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", transport.userAgent)
+	}
+	return transport.base.RoundTrip(req)
+}
+
+// ConfigureHTTPClient sets the timeout, default User-Agent and minimum TLS version of HTTPClient.
+func ConfigureHTTPClient(timeout time.Duration, userAgent string, tlsMinVersion uint16) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tlsMinVersion}
+	HTTPClient.Timeout = timeout
+	HTTPClient.Transport = &userAgentTransport{userAgent, transport}
+}
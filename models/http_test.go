@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfigureHTTPClient(t *testing.T) {
+	defer func(client http.Client) { *HTTPClient = client }(*HTTPClient)
+
+	var userAgents []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+	}))
+	defer s.Close()
+
+	ConfigureHTTPClient(3*time.Second, "Activity-Relay/test (+https://relay.example.com)", tls.VersionTLS12)
+	if HTTPClient.Timeout != 3*time.Second {
+		t.Fatalf("Expected timeout to be 3s, but got %v", HTTPClient.Timeout)
+	}
+
+	HTTPClient.Get(s.URL)
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("User-Agent", "custom")
+	HTTPClient.Do(req)
+	if len(userAgents) != 2 || userAgents[0] != "Activity-Relay/test (+https://relay.example.com)" || userAgents[1] != "custom" {
+		t.Fatalf("Expected default and explicit User-Agent, but got %v", userAgents)
+	}
+}
+
+func TestConfigureHTTPClientTLSMinVersion(t *testing.T) {
+	defer func(client http.Client) { *HTTPClient = client }(*HTTPClient)
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	s.StartTLS()
+	defer s.Close()
+
+	ConfigureHTTPClient(3*time.Second, "Activity-Relay/test", tls.VersionTLS13)
+	if _, err := HTTPClient.Get(s.URL); err == nil {
+		t.Fatal("Expected request to a TLS 1.2 server to fail when TLS 1.3 is required")
+	}
+}
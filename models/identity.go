@@ -0,0 +1,91 @@
+package models
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// RelayIdentity : Additional relay actor served on its own hostname with its own key.
+type RelayIdentity struct {
+	domain *url.URL
+	key    *rsa.PrivateKey
+}
+
+// Host : Hostname the identity is served on.
+func (identity RelayIdentity) Host() string {
+	return identity.domain.Host
+}
+
+// ActorID : Actor ID of the identity.
+func (identity RelayIdentity) ActorID() string {
+	return identity.domain.String() + "/actor"
+}
+
+// KeyID : Key ID of the identity's signing key.
+func (identity RelayIdentity) KeyID() string {
+	return identity.ActorID() + "#" + mainKeyFragment
+}
+
+// Key : Signing key of the identity.
+func (identity RelayIdentity) Key() *rsa.PrivateKey {
+	return identity.key
+}
+
+// parseRelayIdentities reads "domain=key.pem" entries, rejecting the main domain and duplicates
+func parseRelayIdentities(entries []string, mainDomain *url.URL) ([]RelayIdentity, error) {
+	var identities []RelayIdentity
+	seen := map[string]bool{mainDomain.Host: true}
+	for _, entry := range entries {
+		for _, pair := range strings.Split(entry, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			host, keyPath, found := strings.Cut(pair, "=")
+			host, keyPath = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(keyPath)
+			if !found || host == "" || keyPath == "" {
+				return nil, errors.New("INVALID ENTRY " + pair + ", SHOULD BE domain=key.pem")
+			}
+			domain, err := url.ParseRequestURI("https://" + host)
+			if err != nil || domain.Host != host {
+				return nil, errors.New("INVALID DOMAIN " + host)
+			}
+			if seen[host] {
+				return nil, errors.New("DUPLICATED DOMAIN " + host)
+			}
+			seen[host] = true
+			key, err := readPrivateKeyRSA(keyPath)
+			if err != nil {
+				return nil, errors.New(host + ": " + err.Error())
+			}
+			identities = append(identities, RelayIdentity{domain, key})
+		}
+	}
+	return identities, nil
+}
+
+// RelayIdentities returns the additional relay identities served besides RELAY_DOMAIN.
+func (relayConfig *RelayConfig) RelayIdentities() []RelayIdentity {
+	return relayConfig.relayIdentities
+}
+
+// RelayIdentityByActorID returns the additional identity owning actorID.
+func (relayConfig *RelayConfig) RelayIdentityByActorID(actorID string) (RelayIdentity, bool) {
+	for _, identity := range relayConfig.relayIdentities {
+		if identity.ActorID() == actorID {
+			return identity, true
+		}
+	}
+	return RelayIdentity{}, false
+}
+
+// NewActivityPubActorFromRelayIdentity : Create Actor of an additional identity, sharing the relay's profile.
+func NewActivityPubActorFromRelayIdentity(globalConfig *RelayConfig, identity RelayIdentity) Actor {
+	return newRelayActor(globalConfig, identity.domain.String(), []PublicKey{{
+		ID:           identity.KeyID(),
+		Owner:        identity.ActorID(),
+		PublicKeyPem: generatePublicKeyPEMString(&identity.key.PublicKey),
+	}})
+}
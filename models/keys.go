@@ -0,0 +1,180 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mainKeyFragment is the key id fragment of the key loaded from ACTOR_PEM
+const mainKeyFragment = "main-key"
+
+// ed25519KeyFragment is the key id fragment of the key loaded from ACTOR_ED25519_PEM
+const ed25519KeyFragment = "ed25519-key"
+
+type actorKeyPair struct {
+	fragment string
+	key      *rsa.PrivateKey
+}
+
+// actorKeyring holds the active signing key and the key it replaced during the grace period
+type actorKeyring struct {
+	active            actorKeyPair
+	previous          *actorKeyPair
+	previousExpiresAt time.Time
+}
+
+func (keyring *actorKeyring) publishedKeys(now time.Time) []actorKeyPair {
+	keys := []actorKeyPair{keyring.active}
+	if keyring.previous != nil && now.Before(keyring.previousExpiresAt) {
+		keys = append(keys, *keyring.previous)
+	}
+	return keys
+}
+
+// rotatedKeyFragment derives a stable key id fragment from the public key
+func rotatedKeyFragment(key *rsa.PrivateKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	return "key-" + hex.EncodeToString(sum[:8])
+}
+
+// RotateKey atomically makes newKey the signing key, keeping the current key published for grace.
+func (relayConfig *RelayConfig) RotateKey(newKey *rsa.PrivateKey, grace time.Duration) error {
+	if newKey == nil {
+		return errors.New("new actor key is nil")
+	}
+	current := relayConfig.actorKeys.Load()
+	if current.active.key.Equal(newKey) {
+		return errors.New("new actor key is the active key")
+	}
+
+	next := &actorKeyring{active: actorKeyPair{rotatedKeyFragment(newKey), newKey}}
+	if grace > 0 {
+		previous := current.active
+		next.previous = &previous
+		next.previousExpiresAt = time.Now().Add(grace)
+	}
+	if !relayConfig.actorKeys.CompareAndSwap(current, next) {
+		return errors.New("actor key was rotated concurrently")
+	}
+	return nil
+}
+
+// ReloadActorKey reads ACTOR_PEM again and rotates to it when the key has changed.
+func (relayConfig *RelayConfig) ReloadActorKey() (bool, error) {
+	newKey, err := readPrivateKeyRSA(relayConfig.actorPEMPath)
+	if err != nil {
+		return false, errors.New("ACTOR_PEM: " + err.Error())
+	}
+	if relayConfig.ActorKey().Equal(newKey) {
+		return false, nil
+	}
+	err = relayConfig.RotateKey(newKey, relayConfig.actorKeyRotationGrace)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReloadActorKeyOnSignal reloads ACTOR_PEM on SIGHUP, calling onChange after a rotation and when the replaced key expires.
+func (relayConfig *RelayConfig) ReloadActorKeyOnSignal(onChange func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			rotated, err := relayConfig.ReloadActorKey()
+			if err != nil {
+				logrus.Error("Failed to reload actor key: ", err)
+				continue
+			}
+			if !rotated {
+				logrus.Info("Actor key is unchanged")
+				continue
+			}
+			logrus.Info("Actor key rotated to ", relayConfig.ActorKeyID())
+			onChange()
+			if expiresAt := relayConfig.PreviousActorKeyExpiresAt(); !expiresAt.IsZero() {
+				time.AfterFunc(time.Until(expiresAt), onChange)
+			}
+		}
+	}()
+}
+
+// ActorKey is API Worker's HTTPSignature private key.
+func (relayConfig *RelayConfig) ActorKey() *rsa.PrivateKey {
+	return relayConfig.actorKeys.Load().active.key
+}
+
+// ActorKeyID returns the key id of the active signing key.
+func (relayConfig *RelayConfig) ActorKeyID() string {
+	keyID, _ := relayConfig.SigningKey()
+	return keyID
+}
+
+// SigningKey returns the key id and private key of the active signing key as one consistent pair.
+func (relayConfig *RelayConfig) SigningKey() (string, *rsa.PrivateKey) {
+	active := relayConfig.actorKeys.Load().active
+	return relayConfig.actorKeyID(active.fragment), active.key
+}
+
+func (relayConfig *RelayConfig) actorKeyID(fragment string) string {
+	return relayConfig.domain.String() + "/actor#" + fragment
+}
+
+// ActorPublicKeys returns the public keys to publish on the relay actor, active key first.
+func (relayConfig *RelayConfig) ActorPublicKeys() []PublicKey {
+	var publicKeys []PublicKey
+	for _, pair := range relayConfig.actorKeys.Load().publishedKeys(time.Now()) {
+		publicKeys = append(publicKeys, PublicKey{
+			ID:           relayConfig.actorKeyID(pair.fragment),
+			Owner:        relayConfig.domain.String() + "/actor",
+			PublicKeyPem: generatePublicKeyPEMString(&pair.key.PublicKey),
+		})
+	}
+	if relayConfig.actorEd25519Key != nil {
+		publicKeys = append(publicKeys, PublicKey{
+			ID:           relayConfig.ActorEd25519KeyID(),
+			Owner:        relayConfig.domain.String() + "/actor",
+			PublicKeyPem: generateEd25519PublicKeyPEMString(relayConfig.actorEd25519Key.Public().(ed25519.PublicKey)),
+		})
+	}
+	return publicKeys
+}
+
+// ActorEd25519Key returns the optional Ed25519 signing key, nil when not configured.
+func (relayConfig *RelayConfig) ActorEd25519Key() ed25519.PrivateKey {
+	return relayConfig.actorEd25519Key
+}
+
+// ActorEd25519KeyID returns the key id of the Ed25519 signing key.
+func (relayConfig *RelayConfig) ActorEd25519KeyID() string {
+	return relayConfig.actorKeyID(ed25519KeyFragment)
+}
+
+// ActorIntegrityProof returns whether the relay actor document carries a FEP-8b32 integrity proof signed by the Ed25519 key.
+func (relayConfig *RelayConfig) ActorIntegrityProof() bool {
+	return relayConfig.actorIntegrityProof
+}
+
+// PreviousActorKeyExpiresAt returns when the replaced key stops being published, zero when none is.
+func (relayConfig *RelayConfig) PreviousActorKeyExpiresAt() time.Time {
+	keyring := relayConfig.actorKeys.Load()
+	if keyring.previous == nil {
+		return time.Time{}
+	}
+	return keyring.previousExpiresAt
+}
+
+// ActorKeyRotationGrace returns how long a replaced actor key stays published.
+func (relayConfig *RelayConfig) ActorKeyRotationGrace() time.Duration {
+	return relayConfig.actorKeyRotationGrace
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRotateKeyDualKeyActor(t *testing.T) {
+	relayConfig, err := NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeyID, oldKey := relayConfig.SigningKey()
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	err = relayConfig.RotateKey(newKey, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected rotation to succeed, but got error: %v", err)
+	}
+	newKeyID, signingKey := relayConfig.SigningKey()
+	if signingKey != newKey || newKeyID == oldKeyID {
+		t.Fatalf("Expected new key to sign with a new key id, but got %s", newKeyID)
+	}
+
+	actor := NewActivityPubActorFromRelayConfig(relayConfig)
+	data, _ := json.Marshal(&actor)
+	var document struct {
+		PublicKey []PublicKey `json:"publicKey"`
+	}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		t.Fatalf("Expected publicKey to be an array, but got error: %v", err)
+	}
+	if len(document.PublicKey) != 2 {
+		t.Fatalf("Expected 2 published keys, but got %d", len(document.PublicKey))
+	}
+	if document.PublicKey[0].ID != newKeyID || document.PublicKey[1].ID != oldKeyID {
+		t.Fatalf("Expected keys [%s %s], but got [%s %s]", newKeyID, oldKeyID, document.PublicKey[0].ID, document.PublicKey[1].ID)
+	}
+
+	var decoded Actor
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PublicKeyByID(oldKeyID).PublicKeyPem != generatePublicKeyPEMString(&oldKey.PublicKey) {
+		t.Fatal("Expected old key to remain verifiable during grace period")
+	}
+}
+
+func TestRotateKeyWithoutGrace(t *testing.T) {
+	relayConfig, err := NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	relayConfig.RotateKey(newKey, 0)
+
+	actor := NewActivityPubActorFromRelayConfig(relayConfig)
+	data, _ := json.Marshal(&actor)
+	var document struct {
+		PublicKey PublicKey `json:"publicKey"`
+	}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		t.Fatalf("Expected publicKey to be an object, but got error: %v", err)
+	}
+	if document.PublicKey.ID != relayConfig.ActorKeyID() {
+		t.Fatalf("Expected published key %s, but got %s", relayConfig.ActorKeyID(), document.PublicKey.ID)
+	}
+}
+
+func TestReloadActorKeyUnchanged(t *testing.T) {
+	viper.Set("ACTOR_PEM", "../misc/test/testKey.pem")
+	relayConfig, err := NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := relayConfig.ReloadActorKey()
+	if err != nil || rotated {
+		t.Fatalf("Expected unchanged key not to rotate, but got %v %v", rotated, err)
+	}
+}
+
+func TestActorPublishesEd25519Key(t *testing.T) {
+	viper.Set("ACTOR_ED25519_PEM", "../misc/test/testEd25519Key.pem")
+	defer viper.Set("ACTOR_ED25519_PEM", "")
+	relayConfig, err := NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actor := NewActivityPubActorFromRelayConfig(relayConfig)
+	data, _ := json.Marshal(&actor)
+	var decoded Actor
+	json.Unmarshal(data, &decoded)
+	if decoded.PublicKey.ID != relayConfig.ActorKeyID() {
+		t.Fatalf("Expected RSA key first, but got %s", decoded.PublicKey.ID)
+	}
+	if !decoded.SupportsEd25519() || decoded.PublicKeyByID(relayConfig.ActorEd25519KeyID()).ID != relayConfig.ActorEd25519KeyID() {
+		t.Fatalf("Expected Ed25519 key to be published, but got %s", data)
+	}
+}
@@ -1,15 +1,17 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"io"
 	"net/http"
 	"net/url"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/google/uuid"
-	"github.com/patrickmn/go-cache"
 )
 
 // PublicKey : Activity Certificate.
@@ -38,10 +40,144 @@ type Actor struct {
 	PreferredUsername string      `json:"preferredUsername,omitempty"`
 	Summary           string      `json:"summary,omitempty"`
 	Inbox             string      `json:"inbox,omitempty"`
+	FollowersURL      string      `json:"followers,omitempty"`
+	OutboxURL         string      `json:"outbox,omitempty"`
 	Endpoints         *Endpoints  `json:"endpoints,omitempty"`
 	PublicKey         PublicKey   `json:"publicKey,omitempty"`
 	Icon              *Image      `json:"icon,omitempty"`
 	Image             *Image      `json:"image,omitempty"`
+	AlsoKnownAs       interface{} `json:"alsoKnownAs,omitempty"`
+	AttributedTo      string      `json:"attributedTo,omitempty"`
+	// AdditionalPublicKeys are published with PublicKey as a publicKey array, e.g. during key rotation
+	AdditionalPublicKeys []PublicKey `json:"-"`
+	// AssertionMethod are the FEP-521a Multikeys of assertionMethod, preferred over publicKey for verification
+	AssertionMethod []Multikey `json:"-"`
+}
+
+// actorJSON is Actor without its JSON methods
+type actorJSON Actor
+
+// MarshalJSON writes publicKey as an array when the actor has additional keys.
+func (actor Actor) MarshalJSON() ([]byte, error) {
+	if len(actor.AdditionalPublicKeys) == 0 {
+		return json.Marshal(actorJSON(actor))
+	}
+	return json.Marshal(struct {
+		actorJSON
+		PublicKey []PublicKey `json:"publicKey"`
+	}{
+		actorJSON: actorJSON(actor),
+		PublicKey: append([]PublicKey{actor.PublicKey}, actor.AdditionalPublicKeys...),
+	})
+}
+
+// UnmarshalJSON accepts publicKey and assertionMethod as an object or an array of objects.
+func (actor *Actor) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		*actorJSON
+		PublicKey       json.RawMessage `json:"publicKey"`
+		AssertionMethod json.RawMessage `json:"assertionMethod"`
+	}
+	aux.actorJSON = (*actorJSON)(actor)
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	actor.AssertionMethod, err = parseMultikeys(aux.AssertionMethod)
+	if err != nil {
+		return err
+	}
+	actor.PublicKey = PublicKey{}
+	actor.AdditionalPublicKeys = nil
+	if len(aux.PublicKey) == 0 || string(aux.PublicKey) == "null" {
+		return nil
+	}
+	if aux.PublicKey[0] != '[' {
+		return json.Unmarshal(aux.PublicKey, &actor.PublicKey)
+	}
+	var publicKeys []PublicKey
+	err = json.Unmarshal(aux.PublicKey, &publicKeys)
+	if err != nil {
+		return err
+	}
+	if len(publicKeys) > 0 {
+		actor.PublicKey = publicKeys[0]
+		actor.AdditionalPublicKeys = publicKeys[1:]
+	}
+	return nil
+}
+
+// IsAlsoKnownAs returns whether the actor lists id in alsoKnownAs.
+func (actor *Actor) IsAlsoKnownAs(id string) bool {
+	switch aliases := actor.AlsoKnownAs.(type) {
+	case string:
+		return aliases == id
+	case []interface{}:
+		for _, alias := range aliases {
+			if alias == id {
+				return true
+			}
+		}
+	case []string:
+		for _, alias := range aliases {
+			if alias == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SupportsEd25519 returns whether the actor publishes an Ed25519 public key.
+func (actor *Actor) SupportsEd25519() bool {
+	for _, key := range actor.VerificationKeys() {
+		if key.Algorithm == VerificationAlgorithmEd25519 {
+			return true
+		}
+	}
+	return false
+}
+
+// VerificationKeys returns the parsable keys of assertionMethod controlled by the actor followed by those of publicKey.
+func (actor *Actor) VerificationKeys() []VerificationKey {
+	var keys []VerificationKey
+	for _, multikey := range actor.AssertionMethod {
+		if multikey.Controller != actor.ID {
+			// A key controlled by another actor does not speak for this one
+			continue
+		}
+		key, err := multikey.VerificationKey()
+		if err == nil {
+			keys = append(keys, key)
+		}
+	}
+	for _, publicKey := range append([]PublicKey{actor.PublicKey}, actor.AdditionalPublicKeys...) {
+		key, ok := verificationKeyFromPEM(publicKey)
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// VerificationKeyByID returns the verification key with keyID, false when the actor publishes no such key.
+func (actor *Actor) VerificationKeyByID(keyID string) (VerificationKey, bool) {
+	for _, key := range actor.VerificationKeys() {
+		if key.ID == keyID {
+			return key, true
+		}
+	}
+	return VerificationKey{}, false
+}
+
+// PublicKeyByID returns the actor's public key with keyID, falling back to the primary key.
+func (actor *Actor) PublicKeyByID(keyID string) PublicKey {
+	for _, publicKey := range actor.AdditionalPublicKeys {
+		if publicKey.ID == keyID {
+			return publicKey
+		}
+	}
+	return actor.PublicKey
 }
 
 // Followers : ActivityPub Terms for Actor's Followers.
@@ -49,12 +185,18 @@ func (actor *Actor) Followers() string {
 	return actor.ID + "/followers"
 }
 
+// FollowersSynchronization : Get FEP-8fcf partial followers collection URL.
+func (actor *Actor) FollowersSynchronization() string {
+	return actor.ID + "/followers_synchronization"
+}
+
 // NewActivityPubActorFromRelayConfig : Create Actor from relay config.
 func NewActivityPubActorFromRelayConfig(globalConfig *RelayConfig) Actor {
-	hostname := globalConfig.domain.String()
-	publicKey := &globalConfig.actorKey.PublicKey
-	publicKeyPemString := generatePublicKeyPEMString(publicKey)
+	return newRelayActor(globalConfig, globalConfig.domain.String(), globalConfig.ActorPublicKeys())
+}
 
+// newRelayActor builds a relay actor served on hostname, publishing publicKeys
+func newRelayActor(globalConfig *RelayConfig, hostname string, publicKeys []PublicKey) Actor {
 	newActor := Actor{
 		Context:           []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
 		ID:                hostname + "/actor",
@@ -63,11 +205,12 @@ func NewActivityPubActorFromRelayConfig(globalConfig *RelayConfig) Actor {
 		PreferredUsername: "relay",
 		Summary:           globalConfig.serviceSummary,
 		Inbox:             hostname + "/inbox",
-		PublicKey: PublicKey{
-			ID:           hostname + "/actor#main-key",
-			Owner:        hostname + "/actor",
-			PublicKeyPem: publicKeyPemString,
-		},
+		FollowersURL:      hostname + "/actor/followers",
+		OutboxURL:         hostname + "/actor/outbox",
+		PublicKey:         publicKeys[0],
+	}
+	if len(publicKeys) > 1 {
+		newActor.AdditionalPublicKeys = publicKeys[1:]
 	}
 
 	if globalConfig.serviceIconURL != nil {
@@ -80,35 +223,52 @@ func NewActivityPubActorFromRelayConfig(globalConfig *RelayConfig) Actor {
 			URL: globalConfig.serviceImageURL.String(),
 		}
 	}
+	if globalConfig.serviceAdminEmail != "" {
+		newActor.AttributedTo = "mailto:" + globalConfig.serviceAdminEmail
+	}
 
 	return newActor
 }
 
+// HTTPStatusError : Unexpected status of a remote fetch.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (err *HTTPStatusError) Error() string {
+	return err.Status
+}
+
 // NewActivityPubActorFromRemoteActor : Retrieve Actor from remote instance.
-func NewActivityPubActorFromRemoteActor(url string, uaString string, cache *cache.Cache) (Actor, error) {
+func NewActivityPubActorFromRemoteActor(url string, uaString string, cache *ActorCache) (Actor, error) {
+	return NewActivityPubActorFromRemoteActorWithContext(context.Background(), url, uaString, cache)
+}
+
+// NewActivityPubActorFromRemoteActorWithContext : Retrieve Actor from remote instance, aborting when ctx is done.
+func NewActivityPubActorFromRemoteActorWithContext(ctx context.Context, url string, uaString string, cache *ActorCache) (Actor, error) {
 	var actor = new(Actor)
 	var err error
 	cacheData, found := cache.Get(url)
 	if found {
-		err = json.Unmarshal(cacheData.([]byte), &actor)
+		err = json.Unmarshal(cacheData, &actor)
 		if err != nil {
 			cache.Delete(url)
 		} else {
 			return *actor, nil
 		}
 	}
-	req, _ := http.NewRequest("GET", url, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("Accept", "application/activity+json")
 	req.Header.Set("User-Agent", uaString)
-	client := new(http.Client)
-	resp, err := client.Do(req)
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return *actor, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return *actor, errors.New(resp.Status)
+		return *actor, &HTTPStatusError{resp.StatusCode, resp.Status}
 	}
 
 	data, _ := io.ReadAll(resp.Body)
@@ -116,10 +276,23 @@ func NewActivityPubActorFromRemoteActor(url string, uaString string, cache *cach
 	if err != nil {
 		return *actor, err
 	}
-	cache.Set(url, data, 5*time.Minute)
+	cache.Set(url, data, 0)
 	return *actor, nil
 }
 
+// OrderedCollection : ActivityPub OrderedCollection or OrderedCollectionPage of IDs.
+type OrderedCollection struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id,omitempty"`
+	Type         string      `json:"type,omitempty"`
+	TotalItems   int         `json:"totalItems"`
+	First        string      `json:"first,omitempty"`
+	PartOf       string      `json:"partOf,omitempty"`
+	Next         string      `json:"next,omitempty"`
+	Prev         string      `json:"prev,omitempty"`
+	OrderedItems []string    `json:"orderedItems,omitempty"`
+}
+
 // Activity : ActivityPub Activity.
 type Activity struct {
 	Context   interface{} `json:"@context,omitempty"`
@@ -130,6 +303,21 @@ type Activity struct {
 	To        []string    `json:"to,omitempty"`
 	Cc        []string    `json:"cc,omitempty"`
 	Published string      `json:"published,omitempty"`
+	Summary   string      `json:"summary,omitempty"`
+	Content   string      `json:"content,omitempty"`
+	Target    interface{} `json:"target,omitempty"`
+}
+
+// TargetID : Get target ID of activity such as Move.
+func (activity *Activity) TargetID() string {
+	switch target := activity.Target.(type) {
+	case string:
+		return target
+	case map[string]interface{}:
+		id, _ := target["id"].(string)
+		return id
+	}
+	return ""
 }
 
 // GenerateReply : Generate activity to activity's actor.
@@ -189,6 +377,76 @@ func (activity *Activity) UnwrapInnerObjectId() (string, error) {
 	return "", errors.New("object not has id")
 }
 
+// Hashtags : Hashtags attached to inner object, normalized by NormalizeHashtag.
+func (activity *Activity) Hashtags() []string {
+	innerObject, ok := activity.Object.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var tags []interface{}
+	switch tag := innerObject["tag"].(type) {
+	case []interface{}:
+		tags = tag
+	case map[string]interface{}:
+		tags = []interface{}{tag}
+	}
+
+	var hashtags []string
+	for _, tag := range tags {
+		tagObject, ok := tag.(map[string]interface{})
+		if !ok || tagObject["type"] != "Hashtag" {
+			continue
+		}
+		if name, ok := tagObject["name"].(string); ok && name != "" {
+			hashtags = append(hashtags, NormalizeHashtag(name))
+		}
+	}
+	return hashtags
+}
+
+// Languages : Languages of inner object from its contentMap keys, or else the @language of a JSON-LD context,
+// normalized by NormalizeLanguage.
+func (activity *Activity) Languages() []string {
+	innerObject, ok := activity.Object.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var languages []string
+	if contentMap, ok := innerObject["contentMap"].(map[string]interface{}); ok {
+		for language := range contentMap {
+			if language = NormalizeLanguage(language); language != "" {
+				languages = append(languages, language)
+			}
+		}
+	}
+	if len(languages) > 0 {
+		sort.Strings(languages)
+		return languages
+	}
+	for _, context := range []interface{}{innerObject["@context"], activity.Context} {
+		if language := contextLanguage(context); language != "" {
+			return []string{language}
+		}
+	}
+	return nil
+}
+
+// contextLanguage returns the default @language of a JSON-LD context given as an object or an array
+func contextLanguage(context interface{}) string {
+	switch context := context.(type) {
+	case map[string]interface{}:
+		language, _ := context["@language"].(string)
+		return NormalizeLanguage(language)
+	case []interface{}:
+		for _, entry := range context {
+			if language := contextLanguage(entry); language != "" {
+				return language
+			}
+		}
+	}
+	return ""
+}
+
 // NewActivityPubActivity : Generate activity.
 func NewActivityPubActivity(actor Actor, to []string, object interface{}, activityType string) Activity {
 	return Activity{
@@ -203,20 +461,24 @@ func NewActivityPubActivity(actor Actor, to []string, object interface{}, activi
 
 // NewActivityPubActivityFromRemoteActivity : Retrieve Activity from remote instance.
 func NewActivityPubActivityFromRemoteActivity(url string, uaString string) (Activity, error) {
+	return NewActivityPubActivityFromRemoteActivityWithContext(context.Background(), url, uaString)
+}
+
+// NewActivityPubActivityFromRemoteActivityWithContext : Retrieve Activity from remote instance, aborting when ctx is done.
+func NewActivityPubActivityFromRemoteActivityWithContext(ctx context.Context, url string, uaString string) (Activity, error) {
 	var activity = new(Activity)
 	var err error
-	req, _ := http.NewRequest("GET", url, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("Accept", "application/activity+json")
 	req.Header.Set("User-Agent", uaString)
-	client := new(http.Client)
-	resp, err := client.Do(req)
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return *activity, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return *activity, errors.New(resp.Status)
+		return *activity, &HTTPStatusError{resp.StatusCode, resp.Status}
 	}
 
 	data, _ := io.ReadAll(resp.Body)
@@ -263,10 +525,35 @@ func (actor *Actor) GenerateWebfingerResource(hostname *url.URL) WebfingerResour
 	return *resource
 }
 
+// HostMeta : Host-meta Resource (RFC 6415).
+type HostMeta struct {
+	XMLName xml.Name       `xml:"http://docs.oasis-open.org/ns/xri/xrd-1.0 XRD" json:"-"`
+	Links   []HostMetaLink `xml:"Link" json:"links"`
+}
+
+// HostMetaLink : Host-meta Link Resource.
+type HostMetaLink struct {
+	Rel      string `xml:"rel,attr" json:"rel"`
+	Template string `xml:"template,attr" json:"template"`
+}
+
+// GenerateHostMeta : Generate Host-meta resource pointing to webfinger.
+func GenerateHostMeta(hostname *url.URL) HostMeta {
+	return HostMeta{
+		Links: []HostMetaLink{
+			{
+				"lrdd",
+				"https://" + hostname.Host + "/.well-known/webfinger?resource={uri}",
+			},
+		},
+	}
+}
+
 // NodeinfoResources : Nodeinfo Resources.
 type NodeinfoResources struct {
 	NodeinfoLinks NodeinfoLinks
 	Nodeinfo      Nodeinfo
+	Nodeinfo20    Nodeinfo
 }
 
 // NodeinfoLinks : Nodeinfo Link Resource.
@@ -296,6 +583,7 @@ type NodeinfoSoftware struct {
 	Name       string `json:"name"`
 	Version    string `json:"version"`
 	Repository string `json:"repository,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
 }
 
 // NodeinfoServices : NodeinfoSoftware Resource.
@@ -306,7 +594,8 @@ type NodeinfoServices struct {
 
 // NodeinfoUsage : NodeinfoUsage Resource.
 type NodeinfoUsage struct {
-	Users NodeinfoUsageUsers `json:"users"`
+	Users      NodeinfoUsageUsers `json:"users"`
+	LocalPosts *int               `json:"localPosts,omitempty"`
 }
 
 // NodeinfoUsageUsers : NodeinfoUsageUsers Resource.
@@ -316,27 +605,66 @@ type NodeinfoUsageUsers struct {
 	ActiveHalfyear int `json:"activeHalfyear"`
 }
 
-// NodeinfoMetadata : NodeinfoMetadata Resource.
-type NodeinfoMetadata struct {
+// NodeinfoUsageMode : How the relay reports its connections as nodeinfo users.
+type NodeinfoUsageMode string
+
+const (
+	// NodeinfoUsageConnections reports subscribers plus followers as users.
+	NodeinfoUsageConnections NodeinfoUsageMode = "connections"
+	// NodeinfoUsageInstances reports the number of distinct connected instances as users.
+	NodeinfoUsageInstances NodeinfoUsageMode = "instances"
+	// NodeinfoUsageZero reports zero users.
+	NodeinfoUsageZero NodeinfoUsageMode = "zero"
+)
+
+// ParseNodeinfoUsageMode : Parse nodeinfo usage mode name, empty means connections.
+func ParseNodeinfoUsageMode(name string) (NodeinfoUsageMode, error) {
+	switch mode := NodeinfoUsageMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return NodeinfoUsageConnections, nil
+	case NodeinfoUsageConnections, NodeinfoUsageInstances, NodeinfoUsageZero:
+		return mode, nil
+	default:
+		return "", errors.New("unknown nodeinfo usage mode: " + name)
+	}
 }
 
+// NodeinfoMetadata : NodeinfoMetadata Resource, free-form and empty unless configured.
+type NodeinfoMetadata map[string]interface{}
+
 // GenerateNodeinfoResources : Generate Nodeinfo resources.
 func GenerateNodeinfoResources(hostname *url.URL, serverVersion string) NodeinfoResources {
 	resources := new(NodeinfoResources)
 
 	resources.NodeinfoLinks.Links = []NodeinfoLink{
+		{
+			"http://nodeinfo.diaspora.software/ns/schema/2.0",
+			"https://" + hostname.Host + "/nodeinfo/2.0",
+		},
 		{
 			"http://nodeinfo.diaspora.software/ns/schema/2.1",
 			"https://" + hostname.Host + "/nodeinfo/2.1",
 		},
 	}
+	// Relay has no local posts, but 2.1 consumers expect the field
+	localPosts := 0
 	resources.Nodeinfo = Nodeinfo{
 		"2.1",
-		NodeinfoSoftware{"activity-relay", serverVersion, "https://github.com/yukimochi/Activity-Relay"},
+		NodeinfoSoftware{"activity-relay", serverVersion, "https://github.com/yukimochi/Activity-Relay", "https://github.com/yukimochi/Activity-Relay"},
+		[]string{"activitypub"},
+		NodeinfoServices{[]string{}, []string{}},
+		true,
+		NodeinfoUsage{NodeinfoUsageUsers{0, 0, 0}, &localPosts},
+		NodeinfoMetadata{},
+	}
+	// Nodeinfo 2.0 schema does not allow software.repository and software.homepage
+	resources.Nodeinfo20 = Nodeinfo{
+		"2.0",
+		NodeinfoSoftware{"activity-relay", serverVersion, "", ""},
 		[]string{"activitypub"},
 		NodeinfoServices{[]string{}, []string{}},
 		true,
-		NodeinfoUsage{NodeinfoUsageUsers{0, 0, 0}},
+		NodeinfoUsage{NodeinfoUsageUsers{0, 0, 0}, nil},
 		NodeinfoMetadata{},
 	}
 
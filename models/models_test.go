@@ -38,3 +38,33 @@ func TestMain(m *testing.M) {
 	code := m.Run()
 	os.Exit(code)
 }
+
+func TestParseNodeinfoUsageMode(t *testing.T) {
+	for name, expected := range map[string]NodeinfoUsageMode{"": NodeinfoUsageConnections, "Instances": NodeinfoUsageInstances, "zero": NodeinfoUsageZero} {
+		mode, err := ParseNodeinfoUsageMode(name)
+		if err != nil || mode != expected {
+			t.Fatalf("Expected %q to parse as %s, but got %s %v", name, expected, mode, err)
+		}
+	}
+	if _, err := ParseNodeinfoUsageMode("fake"); err == nil {
+		t.Fatal("Expected unknown nodeinfo usage mode to fail, but it succeeded")
+	}
+}
+
+func TestActivityLanguages(t *testing.T) {
+	for _, tc := range []struct {
+		activity Activity
+		expected []string
+	}{
+		{Activity{Object: map[string]interface{}{"contentMap": map[string]interface{}{"ja": "", "EN_us": ""}}}, []string{"en-us", "ja"}},
+		{Activity{Object: map[string]interface{}{"@context": []interface{}{"https://www.w3.org/ns/activitystreams", map[string]interface{}{"@language": "ja"}}}}, []string{"ja"}},
+		{Activity{Context: map[string]interface{}{"@language": "de"}, Object: map[string]interface{}{}}, []string{"de"}},
+		{Activity{Object: map[string]interface{}{"content": "text"}}, nil},
+		{Activity{Object: "https://example.com/note"}, nil},
+	} {
+		languages := tc.activity.Languages()
+		if fmt.Sprint(languages) != fmt.Sprint(tc.expected) {
+			t.Fatalf("Expected languages %v, but got %v", tc.expected, languages)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Multikey : FEP-521a verification method published in assertionMethod.
+type Multikey struct {
+	ID                 string `json:"id,omitempty"`
+	Type               string `json:"type,omitempty"`
+	Controller         string `json:"controller,omitempty"`
+	PublicKeyMultibase string `json:"publicKeyMultibase,omitempty"`
+}
+
+// VerificationKey is a parsed public key of an actor and the HTTP Signature algorithm it verifies.
+type VerificationKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.PublicKey
+}
+
+const (
+	// VerificationAlgorithmRSA is the HTTP Signature algorithm of RSA keys
+	VerificationAlgorithmRSA = "rsa-sha256"
+	// VerificationAlgorithmEd25519 is the HTTP Signature algorithm of Ed25519 keys
+	VerificationAlgorithmEd25519 = "ed25519"
+)
+
+// multicodec prefixes of public key types, as unsigned varints
+var (
+	multicodecEd25519Pub = []byte{0xed, 0x01}
+	multicodecRSAPub     = []byte{0x85, 0x24}
+)
+
+const base58BTCAlphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// parseMultikeys accepts assertionMethod as an object or an array of objects, ignoring entries other than Multikey.
+func parseMultikeys(data json.RawMessage) ([]Multikey, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var methods []Multikey
+	if data[0] == '[' {
+		var entries []json.RawMessage
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			var method Multikey
+			if json.Unmarshal(entry, &method) == nil && method.Type == "Multikey" {
+				methods = append(methods, method)
+			}
+		}
+		return methods, nil
+	}
+	var method Multikey
+	err := json.Unmarshal(data, &method)
+	if err != nil {
+		return nil, err
+	}
+	if method.Type == "Multikey" {
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
+
+// VerificationKey decodes publicKeyMultibase, an Ed25519 or RSA public key in base58btc multibase.
+func (multikey Multikey) VerificationKey() (VerificationKey, error) {
+	if !strings.HasPrefix(multikey.PublicKeyMultibase, "z") {
+		return VerificationKey{}, errors.New("publicKeyMultibase is not base58btc encoded")
+	}
+	decoded, err := decodeBase58BTC(multikey.PublicKeyMultibase[1:])
+	if err != nil {
+		return VerificationKey{}, err
+	}
+	switch {
+	case len(decoded) == len(multicodecEd25519Pub)+ed25519.PublicKeySize && string(decoded[:2]) == string(multicodecEd25519Pub):
+		return VerificationKey{multikey.ID, VerificationAlgorithmEd25519, ed25519.PublicKey(decoded[2:])}, nil
+	case len(decoded) > len(multicodecRSAPub) && string(decoded[:2]) == string(multicodecRSAPub):
+		publicKey, err := x509.ParsePKCS1PublicKey(decoded[2:])
+		if err != nil {
+			return VerificationKey{}, err
+		}
+		return VerificationKey{multikey.ID, VerificationAlgorithmRSA, publicKey}, nil
+	}
+	return VerificationKey{}, errors.New("unsupported multikey type")
+}
+
+func decodeBase58BTC(encoded string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, char := range encoded {
+		index := strings.IndexRune(base58BTCAlphabet, char)
+		if index < 0 {
+			return nil, errors.New("invalid base58btc character")
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(index)))
+	}
+	leadingZeros := 0
+	for leadingZeros < len(encoded) && encoded[leadingZeros] == '1' {
+		leadingZeros++
+	}
+	return append(make([]byte, leadingZeros), value.Bytes()...), nil
+}
+
+func encodeBase58BTC(decoded []byte) string {
+	value := new(big.Int).SetBytes(decoded)
+	radix := big.NewInt(58)
+	modulo := new(big.Int)
+	var encoded []byte
+	for value.Sign() > 0 {
+		value.DivMod(value, radix, modulo)
+		encoded = append(encoded, base58BTCAlphabet[modulo.Int64()])
+	}
+	for _, b := range decoded {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, '1')
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// verificationKeyFromPEM parses a publicKeyPem holding an RSA or Ed25519 public key.
+func verificationKeyFromPEM(publicKey PublicKey) (VerificationKey, bool) {
+	decoded, _ := pem.Decode([]byte(publicKey.PublicKeyPem))
+	if decoded == nil {
+		return VerificationKey{}, false
+	}
+	if decoded.Type == "RSA PUBLIC KEY" {
+		key, err := x509.ParsePKCS1PublicKey(decoded.Bytes)
+		if err != nil {
+			return VerificationKey{}, false
+		}
+		return VerificationKey{publicKey.ID, VerificationAlgorithmRSA, key}, true
+	}
+	key, err := x509.ParsePKIXPublicKey(decoded.Bytes)
+	if err != nil {
+		return VerificationKey{}, false
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return VerificationKey{publicKey.ID, VerificationAlgorithmRSA, key}, true
+	case ed25519.PublicKey:
+		return VerificationKey{publicKey.ID, VerificationAlgorithmEd25519, key}, true
+	}
+	return VerificationKey{}, false
+}
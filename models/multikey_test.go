@@ -0,0 +1,94 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+)
+
+func TestActorAssertionMethodOnly(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	multibase := "z" + encodeBase58BTC(append([]byte{0xed, 0x01}, publicKey...))
+	data := []byte(`{
+		"id": "https://example.com/users/alice",
+		"type": "Person",
+		"inbox": "https://example.com/users/alice/inbox",
+		"assertionMethod": [{
+			"id": "https://example.com/users/alice#ed25519-key",
+			"type": "Multikey",
+			"controller": "https://example.com/users/alice",
+			"publicKeyMultibase": "` + multibase + `"
+		}]
+	}`)
+
+	var actor Actor
+	err := json.Unmarshal(data, &actor)
+	if err != nil {
+		t.Fatalf("Expected actor to be parsed, but got error: %v", err)
+	}
+	if len(actor.AssertionMethod) != 1 {
+		t.Fatalf("Expected 1 assertionMethod, but got %d", len(actor.AssertionMethod))
+	}
+	if !actor.SupportsEd25519() {
+		t.Fatal("Expected actor with an Ed25519 Multikey to support Ed25519")
+	}
+	key, found := actor.VerificationKeyByID("https://example.com/users/alice#ed25519-key")
+	if !found || key.Algorithm != VerificationAlgorithmEd25519 {
+		t.Fatalf("Expected Ed25519 verification key, but got %+v", key)
+	}
+	signature := ed25519.Sign(privateKey, []byte("message"))
+	if !ed25519.Verify(key.Key.(ed25519.PublicKey), []byte("message"), signature) {
+		t.Fatal("Expected decoded Multikey to verify a signature of its private key")
+	}
+}
+
+func TestActorPrefersAssertionMethod(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	actor := Actor{
+		PublicKey: globalConfig.ActorPublicKeys()[0],
+		AssertionMethod: []Multikey{{
+			ID:                 "https://example.com/users/alice#ed25519-key",
+			Type:               "Multikey",
+			PublicKeyMultibase: "z" + encodeBase58BTC(append([]byte{0xed, 0x01}, publicKey...)),
+		}},
+	}
+
+	keys := actor.VerificationKeys()
+	if len(keys) != 2 || keys[0].Algorithm != VerificationAlgorithmEd25519 || keys[1].Algorithm != VerificationAlgorithmRSA {
+		t.Fatalf("Expected assertionMethod key before publicKey, but got %+v", keys)
+	}
+	if key, found := actor.VerificationKeyByID("https://example.com/unknown#key"); found {
+		t.Fatalf("Expected unknown key id not to be found, but got %+v", key)
+	}
+	key, _ := actor.VerificationKeyByID(actor.PublicKey.ID)
+	if key.Algorithm != VerificationAlgorithmRSA {
+		t.Fatalf("Expected publicKey to be selected by its id, but got %s", key.Algorithm)
+	}
+
+	_, err := Multikey{Type: "Multikey", PublicKeyMultibase: "uAAAA"}.VerificationKey()
+	if err == nil {
+		t.Fatal("Expected non base58btc multibase to be rejected")
+	}
+}
+
+func TestActorAssertionMethodController(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	actor := Actor{
+		ID: "https://example.com/users/alice",
+		AssertionMethod: []Multikey{{
+			ID:                 "https://example.com/users/alice#ed25519-key",
+			Type:               "Multikey",
+			Controller:         "https://evil.example.com/users/mallory",
+			PublicKeyMultibase: "z" + encodeBase58BTC(append([]byte{0xed, 0x01}, publicKey...)),
+		}},
+	}
+
+	if key, found := actor.VerificationKeyByID("https://example.com/users/alice#ed25519-key"); found {
+		t.Fatalf("Expected key controlled by another actor to be ignored, but got %+v", key)
+	}
+	actor.AssertionMethod[0].Controller = actor.ID
+	if _, found := actor.VerificationKeyByID("https://example.com/users/alice#ed25519-key"); !found {
+		t.Fatal("Expected key controlled by the actor to be found")
+	}
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// IntegrityProofContext is the JSON-LD context defining FEP-8b32 Data Integrity proofs.
+const IntegrityProofContext = "https://w3id.org/security/data-integrity/v2"
+
+// integrityProofCryptosuite is the only supported cryptosuite, Ed25519 over JCS canonicalized JSON
+const integrityProofCryptosuite = "eddsa-jcs-2022"
+
+// AddIntegrityProof returns document with an eddsa-jcs-2022 DataIntegrityProof signed by privateKey.
+func AddIntegrityProof(document []byte, verificationMethod string, privateKey ed25519.PrivateKey, created time.Time) ([]byte, error) {
+	unsecured, err := decodeProofDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	delete(unsecured, "proof")
+	proof := map[string]interface{}{
+		"type":               "DataIntegrityProof",
+		"cryptosuite":        integrityProofCryptosuite,
+		"verificationMethod": verificationMethod,
+		"proofPurpose":       "assertionMethod",
+		"created":            created.UTC().Format(time.RFC3339),
+	}
+	hashData, err := integrityProofHashData(unsecured, proof)
+	if err != nil {
+		return nil, err
+	}
+	proof["proofValue"] = "z" + encodeBase58BTC(ed25519.Sign(privateKey, hashData))
+	unsecured["proof"] = proof
+	return json.Marshal(unsecured)
+}
+
+// VerifyIntegrityProof checks the eddsa-jcs-2022 DataIntegrityProof of document against publicKey.
+func VerifyIntegrityProof(document []byte, publicKey ed25519.PublicKey) error {
+	secured, err := decodeProofDocument(document)
+	if err != nil {
+		return err
+	}
+	proof, ok := secured["proof"].(map[string]interface{})
+	if !ok {
+		return errors.New("document has no proof")
+	}
+	delete(secured, "proof")
+	if proof["type"] != "DataIntegrityProof" || proof["cryptosuite"] != integrityProofCryptosuite {
+		return errors.New("unsupported proof type")
+	}
+	proofValue, _ := proof["proofValue"].(string)
+	if !strings.HasPrefix(proofValue, "z") {
+		return errors.New("proofValue is not base58btc encoded")
+	}
+	signature, err := decodeBase58BTC(proofValue[1:])
+	if err != nil {
+		return err
+	}
+	delete(proof, "proofValue")
+	hashData, err := integrityProofHashData(secured, proof)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, hashData, signature) {
+		return errors.New("proof signature does not match")
+	}
+	return nil
+}
+
+func decodeProofDocument(document []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var decoded map[string]interface{}
+	err := decoder.Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+	if decoded == nil {
+		return nil, errors.New("document is not an object")
+	}
+	return decoded, nil
+}
+
+// integrityProofHashData returns the hashed proof configuration followed by the hashed document, as signed by eddsa-jcs-2022
+func integrityProofHashData(unsecured map[string]interface{}, proof map[string]interface{}) ([]byte, error) {
+	proofConfig := make(map[string]interface{}, len(proof)+1)
+	for key, value := range proof {
+		proofConfig[key] = value
+	}
+	if context, found := unsecured["@context"]; found {
+		proofConfig["@context"] = context
+	}
+	canonicalProofConfig, err := canonicalJSON(proofConfig)
+	if err != nil {
+		return nil, err
+	}
+	canonicalDocument, err := canonicalJSON(unsecured)
+	if err != nil {
+		return nil, err
+	}
+	proofConfigHash := sha256.Sum256(canonicalProofConfig)
+	documentHash := sha256.Sum256(canonicalDocument)
+	return append(proofConfigHash[:], documentHash[:]...), nil
+}
+
+// canonicalJSON serializes value by the JSON Canonicalization Scheme (RFC 8785)
+func canonicalJSON(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := writeCanonicalJSON(&buffer, value)
+	return buffer.Bytes(), err
+}
+
+func writeCanonicalJSON(buffer *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteString("null")
+	case bool:
+		buffer.WriteString(strconv.FormatBool(value))
+	case string:
+		writeCanonicalString(buffer, value)
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		return writeCanonicalNumber(buffer, number)
+	case float64:
+		return writeCanonicalNumber(buffer, value)
+	case []interface{}:
+		buffer.WriteByte('[')
+		for i, element := range value {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			err := writeCanonicalJSON(buffer, element)
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		// Members are ordered by the UTF-16 code units of their names
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := utf16.Encode([]rune(keys[i])), utf16.Encode([]rune(keys[j]))
+			for k := 0; k < len(a) && k < len(b); k++ {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+			return len(a) < len(b)
+		})
+		buffer.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			writeCanonicalString(buffer, key)
+			buffer.WriteByte(':')
+			err := writeCanonicalJSON(buffer, value[key])
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	default:
+		return errors.New("unsupported JSON value")
+	}
+	return nil
+}
+
+// writeCanonicalString escapes only what JSON requires, leaving other characters as they are
+func writeCanonicalString(buffer *bytes.Buffer, value string) {
+	buffer.WriteByte('"')
+	for _, char := range value {
+		switch char {
+		case '"':
+			buffer.WriteString(`\"`)
+		case '\\':
+			buffer.WriteString(`\\`)
+		case '\b':
+			buffer.WriteString(`\b`)
+		case '\f':
+			buffer.WriteString(`\f`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		case '\r':
+			buffer.WriteString(`\r`)
+		case '\t':
+			buffer.WriteString(`\t`)
+		default:
+			if char < 0x20 {
+				buffer.WriteString(`\u00`)
+				buffer.WriteByte("0123456789abcdef"[char>>4])
+				buffer.WriteByte("0123456789abcdef"[char&0xF])
+			} else {
+				buffer.WriteRune(char)
+			}
+		}
+	}
+	buffer.WriteByte('"')
+}
+
+// writeCanonicalNumber writes number the way ECMAScript converts it to a string
+func writeCanonicalNumber(buffer *bytes.Buffer, number float64) error {
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return errors.New("unsupported JSON number")
+	}
+	if number == 0 {
+		buffer.WriteByte('0')
+		return nil
+	}
+	if abs := math.Abs(number); abs >= 1e-6 && abs < 1e21 {
+		buffer.WriteString(strconv.FormatFloat(number, 'f', -1, 64))
+		return nil
+	}
+	formatted := strconv.FormatFloat(number, 'e', -1, 64)
+	// Go pads the exponent to two digits, ECMAScript does not
+	mantissa, exponent, _ := strings.Cut(formatted, "e")
+	sign := exponent[0]
+	exponent = strings.TrimLeft(exponent[1:], "0")
+	buffer.WriteString(mantissa + "e" + string(sign) + exponent)
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	for input, expected := range map[string]string{
+		`{"b": 1, "a": [true, null, "x"]}`:          `{"a":[true,null,"x"],"b":1}`,
+		`{"numbers": [1.0, 1e21, 1e-7, -0.5, 100]}`: `{"numbers":[1,1e+21,1e-7,-0.5,100]}`,
+		`{"text": "<é\n\u001f>"}`:                   "{\"text\":\"<é\\n\\u001f>\"}",
+		`{"\ufb33": 1, "😀": 2, "€": 3}`:             "{\"€\":3,\"😀\":2,\"\ufb33\":1}",
+	} {
+		decoded, err := decodeProofDocument([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		canonical, err := canonicalJSON(decoded)
+		if err != nil || string(canonical) != expected {
+			t.Errorf("Expected %s to canonicalize to %s, but got %s (%v)", input, expected, canonical, err)
+		}
+	}
+}
+
+func TestIntegrityProof(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	document := []byte(`{"@context": ["https://www.w3.org/ns/activitystreams", "` + IntegrityProofContext + `"], "id": "https://relay.example.com/actor", "type": "Service"}`)
+
+	signed, err := AddIntegrityProof(document, "https://relay.example.com/actor#ed25519-key", privateKey, time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("Expected document to be signed, but got error: %v", err)
+	}
+	if err := VerifyIntegrityProof(signed, publicKey); err != nil {
+		t.Fatalf("Expected proof to verify, but got error: %v", err)
+	}
+
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := VerifyIntegrityProof(signed, otherKey); err == nil {
+		t.Fatal("Expected proof to fail with another key")
+	}
+	if err := VerifyIntegrityProof(document, publicKey); err == nil {
+		t.Fatal("Expected document without proof to fail")
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// redisKeyPrefix namespaces every Redis key of this relay, set from REDIS_KEY_PREFIX by NewRelayConfig
+var redisKeyPrefix string
+
+// RedisKey returns key namespaced by REDIS_KEY_PREFIX, so that several relays can share one Redis.
+func RedisKey(key string) string {
+	return redisKeyPrefix + key
+}
+
+// redisErrorCount counts failed Redis operations of this process
+var redisErrorCount atomic.Int64
+
+// RedisErrorCount returns the number of failed Redis operations since the process started.
+func RedisErrorCount() int64 {
+	return redisErrorCount.Load()
+}
+
+// configureRedisRetry sets retry and backoff for transient Redis failures, unless set in REDIS_URL
+func configureRedisRetry(option *redis.Options) {
+	if option.MaxRetries == 0 {
+		option.MaxRetries = 5
+	}
+	if option.MinRetryBackoff == 0 {
+		option.MinRetryBackoff = 100 * time.Millisecond
+	}
+	if option.MaxRetryBackoff == 0 {
+		option.MaxRetryBackoff = 2 * time.Second
+	}
+}
+
+// redisHealthHook : Count failed Redis operations and warn on round trips slower than slowThreshold.
+type redisHealthHook struct {
+	slowThreshold time.Duration
+}
+
+func (hook redisHealthHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			redisErrorCount.Add(1)
+			logrus.WithField("addr", addr).WithError(err).Warn("Failed to connect to Redis")
+		}
+		return conn, err
+	}
+}
+
+func (hook redisHealthHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		hook.record(cmd.Name(), time.Since(start), err)
+		return err
+	}
+}
+
+func (hook redisHealthHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		hook.record("pipeline", time.Since(start), err)
+		return err
+	}
+}
+
+func (hook redisHealthHook) record(command string, latency time.Duration, err error) {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		redisErrorCount.Add(1)
+		logrus.WithField("command", command).WithError(err).Debug("Redis operation failed")
+	}
+	if hook.slowThreshold > 0 && latency > hook.slowThreshold {
+		logrus.WithField("command", command).WithField("latency", latency.String()).Warn("Redis round trip exceeded threshold")
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+func TestRedisHealthHook(t *testing.T) {
+	before := RedisErrorCount()
+	globalConfig.RedisClient().Get(context.TODO(), "relay:nonexistent").Result()
+	if RedisErrorCount() != before {
+		t.Fatalf("Expected a missing key not to count as a Redis error, but got %d errors", RedisErrorCount()-before)
+	}
+
+	unreachable := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer unreachable.Close()
+	unreachable.AddHook(redisHealthHook{100 * time.Millisecond})
+	unreachable.Get(context.TODO(), "relay:nonexistent").Result()
+	if RedisErrorCount() <= before {
+		t.Fatal("Expected failed Redis operation to be counted")
+	}
+}
+
+func TestConfigureRedisRetry(t *testing.T) {
+	option, _ := redis.ParseURL("redis://127.0.0.1:6379/0?max_retries=2")
+	configureRedisRetry(option)
+	if option.MaxRetries != 2 {
+		t.Fatalf("Expected max_retries from REDIS_URL to be kept, but got %d", option.MaxRetries)
+	}
+	if option.MinRetryBackoff != 100*time.Millisecond || option.MaxRetryBackoff != 2*time.Second {
+		t.Fatalf("Expected default retry backoff, but got %v-%v", option.MinRetryBackoff, option.MaxRetryBackoff)
+	}
+}
+
+func TestRedisKeyPrefix(t *testing.T) {
+	relayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer func() {
+		viper.Set("REDIS_KEY_PREFIX", "")
+		NewRelayConfig()
+		relayState.RedisClient.FlushAll(context.TODO()).Result()
+		relayState.Load()
+	}()
+
+	viper.Set("REDIS_KEY_PREFIX", "relay-a:")
+	relayConfig, err := NewRelayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayConfig.RedisKeyPrefix() != "relay-a:" || RedisKey("relay:config") != "relay-a:relay:config" {
+		t.Fatalf("Expected keys to be prefixed with relay-a:, but got %s", RedisKey("relay:config"))
+	}
+
+	relayState.AddSubscriber(Subscriber{Domain: "example.com", InboxURL: "https://example.com/inbox"})
+	relayState.SetConfig(PersonOnly, true)
+	if exists, _ := relayState.RedisClient.Exists(context.TODO(), "relay-a:relay:subscription:example.com").Result(); exists != 1 {
+		t.Fatal("Expected subscription to be stored under the prefixed key")
+	}
+	if exists, _ := relayState.RedisClient.Exists(context.TODO(), "relay:subscription:example.com", "relay:config").Result(); exists != 0 {
+		t.Fatal("Expected no unprefixed key to be written")
+	}
+
+	relayState.Load()
+	if len(relayState.Subscribers) != 1 || !relayState.RelayConfig.PersonOnly {
+		t.Fatalf("Expected state to be loaded from prefixed keys, but got %d subscribers", len(relayState.Subscribers))
+	}
+}
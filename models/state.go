@@ -2,7 +2,10 @@ package models
 
 import (
 	"context"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -16,19 +19,45 @@ const (
 	PersonOnly Config = iota
 	// ManuallyAccept : Manually Accept Follow-Request
 	ManuallyAccept
+	// RelayReactions : Relay Like and EmojiReact Activities
+	RelayReactions
+	// RequireSharedInbox : Reject Follow-Request from Actor without sharedInbox
+	RequireSharedInbox
+	// ExcludeBotActors : Do not relay Create Activities by Service or Application Actors
+	ExcludeBotActors
+	// AllowlistOnly : Reject Follow-Request from domains not in AllowedDomains
+	AllowlistOnly
+	// RequirePublished : Do not relay Create Activities without published timestamp while MaxActivityAge is set
+	RequirePublished
+	// AllowUnsignedDeletes : Relay Delete Activities of an actor for itself even when its signature cannot be verified
+	AllowUnsignedDeletes
+	// RequireLanguage : Do not relay Create Activities without language while LanguageFilters is set
+	RequireLanguage
 )
 
+// RelayActivityTypes : Activity types relayed to subscribers, each can be disabled individually
+var RelayActivityTypes = []string{"Create", "Update", "Delete", "Move", "Like", "EmojiReact"}
+
 // RelayState : Store Subscribers, Followers And Relay Configurations
 type RelayState struct {
 	RedisClient *redis.Client `json:"-"`
 	notifiable  bool
 
-	RelayConfig             relayConfig  `json:"relayConfig,omitempty"`
-	LimitedDomains          []string     `json:"limitedDomains,omitempty"`
-	BlockedDomains          []string     `json:"blockedDomains,omitempty"`
-	Subscribers             []Subscriber `json:"subscriptions,omitempty"`
-	Followers               []Follower   `json:"followers,omitempty"`
-	SubscribersAndFollowers []Subscriber `json:"-"`
+	RelayConfig             relayConfig       `json:"relayConfig,omitempty"`
+	LimitedDomains          []string          `json:"limitedDomains,omitempty"`
+	BlockedDomains          []string          `json:"blockedDomains,omitempty"`
+	BlockedDomainSources    map[string]string `json:"blockedDomainSources,omitempty"`
+	AllowedDomains          []string          `json:"allowedDomains,omitempty"`
+	BatchDomains            []string          `json:"batchDomains,omitempty"`
+	TagFilters              []string          `json:"tagFilters,omitempty"`
+	LanguageFilters         []string          `json:"languageFilters,omitempty"`
+	MaxActivityAge          time.Duration     `json:"maxActivityAge,omitempty"`
+	Paused                  bool              `json:"-"`
+	EnabledActivityTypes    map[string]bool   `json:"-"`
+	DisabledActivityTypes   []string          `json:"disabledActivityTypes,omitempty"`
+	Subscribers             []Subscriber      `json:"subscriptions,omitempty"`
+	Followers               []Follower        `json:"followers,omitempty"`
+	SubscribersAndFollowers []Subscriber      `json:"-"`
 }
 
 // NewState : Create new RelayState instance with redis client
@@ -42,11 +71,11 @@ func NewState(redisClient *redis.Client, notifiable bool) RelayState {
 }
 
 func (config *RelayState) ListenNotify(c chan<- bool) {
-	_, err := config.RedisClient.Subscribe(context.TODO(), "relay_refresh").Receive(context.TODO())
+	_, err := config.RedisClient.Subscribe(context.TODO(), RedisKey("relay_refresh")).Receive(context.TODO())
 	if err != nil {
 		panic(err)
 	}
-	ch := config.RedisClient.Subscribe(context.TODO(), "relay_refresh").Channel()
+	ch := config.RedisClient.Subscribe(context.TODO(), RedisKey("relay_refresh")).Channel()
 
 	cNotify := c != nil
 	go func() {
@@ -65,22 +94,50 @@ func (config *RelayState) Load() {
 	config.RelayConfig.load(config.RedisClient)
 	var limitedDomains []string
 	var blockedDomains []string
+	var allowedDomains []string
+	var batchDomains []string
+	var tagFilters []string
+	var languageFilters []string
 	var subscribers []Subscriber
 	var followers []Follower
 	var subscribersAndFollowers []Subscriber
 
-	domains, _ := config.RedisClient.HKeys(context.TODO(), "relay:config:limitedDomain").Result()
+	domains, _ := config.RedisClient.HKeys(context.TODO(), RedisKey("relay:config:limitedDomain")).Result()
 	for _, domain := range domains {
 		limitedDomains = append(limitedDomains, domain)
 	}
-	domains, _ = config.RedisClient.HKeys(context.TODO(), "relay:config:blockedDomain").Result()
+	domains, _ = config.RedisClient.HKeys(context.TODO(), RedisKey("relay:config:blockedDomain")).Result()
 	for _, domain := range domains {
 		blockedDomains = append(blockedDomains, domain)
 	}
+	// Blocks of remote blocklists are tagged with their source URL, manual blocks with "1"
+	blockedDomainSources := map[string]string{}
+	blocks, _ := config.RedisClient.HGetAll(context.TODO(), RedisKey("relay:config:blockedDomain")).Result()
+	for domain, source := range blocks {
+		if source != "1" {
+			blockedDomainSources[domain] = source
+		}
+	}
+	domains, _ = config.RedisClient.HKeys(context.TODO(), RedisKey("relay:config:allowedDomain")).Result()
+	for _, domain := range domains {
+		allowedDomains = append(allowedDomains, domain)
+	}
+	domains, _ = config.RedisClient.HKeys(context.TODO(), RedisKey("relay:config:batchDomain")).Result()
+	for _, domain := range domains {
+		batchDomains = append(batchDomains, domain)
+	}
+	tags, _ := config.RedisClient.HKeys(context.TODO(), RedisKey("relay:config:tagFilter")).Result()
+	for _, tag := range tags {
+		tagFilters = append(tagFilters, tag)
+	}
+	languages, _ := config.RedisClient.HKeys(context.TODO(), RedisKey("relay:config:languageFilter")).Result()
+	for _, language := range languages {
+		languageFilters = append(languageFilters, language)
+	}
 
-	domains, _ = config.RedisClient.Keys(context.TODO(), "relay:subscription:*").Result()
+	domains, _ = config.RedisClient.Keys(context.TODO(), RedisKey("relay:subscription:*")).Result()
 	for _, domain := range domains {
-		domainName := strings.Replace(domain, "relay:subscription:", "", 1)
+		domainName := strings.Replace(domain, RedisKey("relay:subscription:"), "", 1)
 		inboxURL, _ := config.RedisClient.HGet(context.TODO(), domain, "inbox_url").Result()
 		activityID, err := config.RedisClient.HGet(context.TODO(), domain, "activity_id").Result()
 		if err != nil {
@@ -90,13 +147,15 @@ func (config *RelayState) Load() {
 		if err != nil {
 			actorID = ""
 		}
-		subscribers = append(subscribers, Subscriber{domainName, inboxURL, activityID, actorID})
-		subscribersAndFollowers = append(subscribersAndFollowers, Subscriber{domainName, inboxURL, activityID, actorID})
+		joinedAt, _ := config.RedisClient.HGet(context.TODO(), domain, "joined_at").Int64()
+		relayActor, _ := config.RedisClient.HGet(context.TODO(), domain, "relay_actor").Result()
+		subscribers = append(subscribers, Subscriber{domainName, inboxURL, activityID, actorID, joinedAt, relayActor})
+		subscribersAndFollowers = append(subscribersAndFollowers, Subscriber{domainName, inboxURL, activityID, actorID, joinedAt, relayActor})
 	}
 
-	domains, _ = config.RedisClient.Keys(context.TODO(), "relay:follower:*").Result()
+	domains, _ = config.RedisClient.Keys(context.TODO(), RedisKey("relay:follower:*")).Result()
 	for _, domain := range domains {
-		domainName := strings.Replace(domain, "relay:follower:", "", 1)
+		domainName := strings.Replace(domain, RedisKey("relay:follower:"), "", 1)
 		inboxURL, _ := config.RedisClient.HGet(context.TODO(), domain, "inbox_url").Result()
 		activityID, err := config.RedisClient.HGet(context.TODO(), domain, "activity_id").Result()
 		if err != nil {
@@ -110,12 +169,34 @@ func (config *RelayState) Load() {
 		if err != nil {
 			mutuallyFollow = "0"
 		}
-		followers = append(followers, Follower{domainName, inboxURL, activityID, actorID, mutuallyFollow == "1"})
-		subscribersAndFollowers = append(subscribersAndFollowers, Subscriber{domainName, inboxURL, activityID, actorID})
+		joinedAt, _ := config.RedisClient.HGet(context.TODO(), domain, "joined_at").Int64()
+		relayActor, _ := config.RedisClient.HGet(context.TODO(), domain, "relay_actor").Result()
+		followers = append(followers, Follower{domainName, inboxURL, activityID, actorID, mutuallyFollow == "1", joinedAt, relayActor})
+		subscribersAndFollowers = append(subscribersAndFollowers, Subscriber{domainName, inboxURL, activityID, actorID, joinedAt, relayActor})
 	}
 
 	config.LimitedDomains = limitedDomains
 	config.BlockedDomains = blockedDomains
+	config.BlockedDomainSources = blockedDomainSources
+	config.AllowedDomains = allowedDomains
+	config.BatchDomains = batchDomains
+	config.TagFilters = tagFilters
+	config.LanguageFilters = languageFilters
+	maxActivityAge, _ := config.RedisClient.HGet(context.TODO(), RedisKey("relay:config"), "max_activity_age").Int64()
+	config.MaxActivityAge = time.Duration(maxActivityAge) * time.Second
+	paused, _ := config.RedisClient.HGet(context.TODO(), RedisKey("relay:config"), "paused").Result()
+	config.Paused = paused == "1"
+	activityTypes, _ := config.RedisClient.HGetAll(context.TODO(), RedisKey("relay:config:activityType")).Result()
+	enabledActivityTypes := map[string]bool{}
+	var disabledActivityTypes []string
+	for _, activityType := range RelayActivityTypes {
+		enabledActivityTypes[activityType] = activityTypes[activityType] != "0"
+		if !enabledActivityTypes[activityType] {
+			disabledActivityTypes = append(disabledActivityTypes, activityType)
+		}
+	}
+	config.EnabledActivityTypes = enabledActivityTypes
+	config.DisabledActivityTypes = disabledActivityTypes
 	config.Subscribers = subscribers
 	config.Followers = followers
 	config.SubscribersAndFollowers = subscribersAndFollowers
@@ -129,9 +210,23 @@ func (config *RelayState) SetConfig(key Config, value bool) {
 	}
 	switch key {
 	case PersonOnly:
-		config.RedisClient.HSet(context.TODO(), "relay:config", "block_service", strValue).Result()
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "block_service", strValue).Result()
 	case ManuallyAccept:
-		config.RedisClient.HSet(context.TODO(), "relay:config", "manually_accept", strValue).Result()
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "manually_accept", strValue).Result()
+	case RelayReactions:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "relay_reactions", strValue).Result()
+	case RequireSharedInbox:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "require_shared_inbox", strValue).Result()
+	case ExcludeBotActors:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "exclude_bot_actors", strValue).Result()
+	case AllowlistOnly:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "allowlist_only", strValue).Result()
+	case RequirePublished:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "require_published", strValue).Result()
+	case AllowUnsignedDeletes:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "allow_unsigned_deletes", strValue).Result()
+	case RequireLanguage:
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "require_language", strValue).Result()
 	}
 
 	config.refresh()
@@ -139,19 +234,23 @@ func (config *RelayState) SetConfig(key Config, value bool) {
 
 // AddSubscriber : Add new instance for subscriber list
 func (config *RelayState) AddSubscriber(domain Subscriber) {
-	config.RedisClient.HMSet(context.TODO(), "relay:subscription:"+domain.Domain, map[string]interface{}{
+	config.RedisClient.HMSet(context.TODO(), RedisKey("relay:subscription:")+domain.Domain, map[string]interface{}{
 		"inbox_url":   domain.InboxURL,
 		"activity_id": domain.ActivityID,
 		"actor_id":    domain.ActorID,
+		"relay_actor": domain.RelayActor,
 	})
+	if domain.JoinedAt != 0 {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:subscription:")+domain.Domain, "joined_at", strconv.FormatInt(domain.JoinedAt, 10))
+	}
 
 	config.refresh()
 }
 
 // DelSubscriber : Delete instance from subscriber list
 func (config *RelayState) DelSubscriber(domain string) {
-	config.RedisClient.Del(context.TODO(), "relay:subscription:"+domain).Result()
-	config.RedisClient.Del(context.TODO(), "relay:pending:"+domain).Result()
+	config.RedisClient.Del(context.TODO(), RedisKey("relay:subscription:")+domain).Result()
+	config.RedisClient.Del(context.TODO(), RedisKey("relay:pending:")+domain).Result()
 
 	config.refresh()
 }
@@ -168,12 +267,16 @@ func (config *RelayState) SelectSubscriber(domain string) *Subscriber {
 
 // AddFollower : Add new instance for follower list
 func (config *RelayState) AddFollower(domain Follower) {
-	config.RedisClient.HMSet(context.TODO(), "relay:follower:"+domain.Domain, map[string]interface{}{
+	config.RedisClient.HMSet(context.TODO(), RedisKey("relay:follower:")+domain.Domain, map[string]interface{}{
 		"inbox_url":       domain.InboxURL,
 		"activity_id":     domain.ActivityID,
 		"actor_id":        domain.ActorID,
 		"mutually_follow": domain.MutuallyFollow,
+		"relay_actor":     domain.RelayActor,
 	})
+	if domain.JoinedAt != 0 {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:follower:")+domain.Domain, "joined_at", strconv.FormatInt(domain.JoinedAt, 10))
+	}
 
 	config.refresh()
 }
@@ -181,9 +284,9 @@ func (config *RelayState) AddFollower(domain Follower) {
 // UpdateFollowerStatus : Update MutuallyFollow Status
 func (config *RelayState) UpdateFollowerStatus(domain string, mutuallyFollow bool) {
 	if mutuallyFollow {
-		config.RedisClient.HSet(context.TODO(), "relay:follower:"+domain, "mutually_follow", "1")
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:follower:")+domain, "mutually_follow", "1")
 	} else {
-		config.RedisClient.HSet(context.TODO(), "relay:follower:"+domain, "mutually_follow", "0")
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:follower:")+domain, "mutually_follow", "0")
 	}
 
 	config.refresh()
@@ -191,8 +294,8 @@ func (config *RelayState) UpdateFollowerStatus(domain string, mutuallyFollow boo
 
 // DelFollower : Delete instance from follower list
 func (config *RelayState) DelFollower(domain string) {
-	config.RedisClient.Del(context.TODO(), "relay:follower:"+domain).Result()
-	config.RedisClient.Del(context.TODO(), "relay:pending:"+domain).Result()
+	config.RedisClient.Del(context.TODO(), RedisKey("relay:follower:")+domain).Result()
+	config.RedisClient.Del(context.TODO(), RedisKey("relay:pending:")+domain).Result()
 
 	config.refresh()
 }
@@ -207,12 +310,125 @@ func (config *RelayState) SelectFollower(domain string) *Follower {
 	return nil
 }
 
+// SetMaxActivityAge : Set age of Create Activities beyond which they are not relayed, zero disables
+func (config *RelayState) SetMaxActivityAge(age time.Duration) {
+	if age > 0 {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "max_activity_age", int64(age/time.Second)).Result()
+	} else {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config"), "max_activity_age").Result()
+	}
+
+	config.refresh()
+}
+
+// SetPaused : Pause/Resume fan-out delivery, activities received while paused are held for replay
+func (config *RelayState) SetPaused(value bool) {
+	if value {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config"), "paused", "1").Result()
+	} else {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config"), "paused").Result()
+	}
+
+	config.refresh()
+}
+
+// SetActivityTypeEnabled : Enable/Disable relaying of activity type
+func (config *RelayState) SetActivityTypeEnabled(activityType string, value bool) {
+	if value {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:activityType"), activityType).Result()
+	} else {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:activityType"), activityType, "0").Result()
+	}
+
+	config.refresh()
+}
+
 // SetBlockedDomain : Set/Unset instance for blocked domain
 func (config *RelayState) SetBlockedDomain(domain string, value bool) {
 	if value {
-		config.RedisClient.HSet(context.TODO(), "relay:config:blockedDomain", domain, "1").Result()
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:blockedDomain"), domain, "1").Result()
 	} else {
-		config.RedisClient.HDel(context.TODO(), "relay:config:blockedDomain", domain).Result()
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:blockedDomain"), domain).Result()
+	}
+
+	config.refresh()
+}
+
+// SetBlockedDomainSource : Block domain as listed by the remote blocklist source, left to SyncRemoteBlockedDomains to unblock
+func (config *RelayState) SetBlockedDomainSource(domain string, source string) {
+	config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:blockedDomain"), domain, source).Result()
+
+	config.refresh()
+}
+
+// SyncRemoteBlockedDomains : Block domains of remote blocklists, keyed by source URL, and unblock those no source lists anymore.
+// Blocks are tagged with their source, manual blocks are never changed. A nil list keeps the blocks of its source as they are,
+// sources missing from lists have their blocks removed.
+func (config *RelayState) SyncRemoteBlockedDomains(lists map[string][]string) (added []string, removed []string) {
+	current, _ := config.RedisClient.HGetAll(context.TODO(), RedisKey("relay:config:blockedDomain")).Result()
+
+	// Each listed domain is tagged with one source, the first in URL order listing it
+	owners := map[string]string{}
+	for domain, source := range current {
+		if list, found := lists[source]; found && list == nil {
+			owners[domain] = source
+		}
+	}
+	sources := make([]string, 0, len(lists))
+	for source := range lists {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		for _, domain := range lists[source] {
+			if _, found := owners[domain]; !found {
+				owners[domain] = source
+			}
+		}
+	}
+
+	for domain, owner := range owners {
+		source, found := current[domain]
+		if found && (source == "1" || source == owner) {
+			continue
+		}
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:blockedDomain"), domain, owner).Result()
+		if !found {
+			added = append(added, domain)
+		}
+	}
+	for domain, source := range current {
+		if _, found := owners[domain]; source != "1" && !found {
+			config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:blockedDomain"), domain).Result()
+			removed = append(removed, domain)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	if len(added) > 0 || len(removed) > 0 {
+		config.refresh()
+	}
+	return added, removed
+}
+
+// SetAllowedDomain : Set/Unset instance for allowed domain
+func (config *RelayState) SetAllowedDomain(domain string, value bool) {
+	if value {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:allowedDomain"), domain, "1").Result()
+	} else {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:allowedDomain"), domain).Result()
+	}
+
+	config.refresh()
+}
+
+// SetBatchDomain : Set/Unset instance receiving activities in batches
+func (config *RelayState) SetBatchDomain(domain string, value bool) {
+	if value {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:batchDomain"), domain, "1").Result()
+	} else {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:batchDomain"), domain).Result()
 	}
 
 	config.refresh()
@@ -221,17 +437,51 @@ func (config *RelayState) SetBlockedDomain(domain string, value bool) {
 // SetLimitedDomain : Set/Unset instance for limited domain
 func (config *RelayState) SetLimitedDomain(domain string, value bool) {
 	if value {
-		config.RedisClient.HSet(context.TODO(), "relay:config:limitedDomain", domain, "1").Result()
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:limitedDomain"), domain, "1").Result()
+	} else {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:limitedDomain"), domain).Result()
+	}
+
+	config.refresh()
+}
+
+// SetTagFilter : Set/Unset hashtag required for relaying Create activities
+func (config *RelayState) SetTagFilter(tag string, value bool) {
+	tag = NormalizeHashtag(tag)
+	if value {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:tagFilter"), tag, "1").Result()
 	} else {
-		config.RedisClient.HDel(context.TODO(), "relay:config:limitedDomain", domain).Result()
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:tagFilter"), tag).Result()
 	}
 
 	config.refresh()
 }
 
+// SetLanguageFilter : Set/Unset language required for relaying Create activities
+func (config *RelayState) SetLanguageFilter(language string, value bool) {
+	language = NormalizeLanguage(language)
+	if value {
+		config.RedisClient.HSet(context.TODO(), RedisKey("relay:config:languageFilter"), language, "1").Result()
+	} else {
+		config.RedisClient.HDel(context.TODO(), RedisKey("relay:config:languageFilter"), language).Result()
+	}
+
+	config.refresh()
+}
+
+// NormalizeLanguage : Lowercase language tag with - as separator, e.g. ja or zh-hant
+func NormalizeLanguage(language string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(language), "_", "-"))
+}
+
+// NormalizeHashtag : Lowercase hashtag without leading #
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
 func (config *RelayState) refresh() {
 	if config.notifiable {
-		config.RedisClient.Publish(context.TODO(), "relay_refresh", nil)
+		config.RedisClient.Publish(context.TODO(), RedisKey("relay_refresh"), nil)
 	} else {
 		config.Load()
 	}
@@ -243,6 +493,9 @@ type Subscriber struct {
 	InboxURL   string `json:"inbox_url,omitempty"`
 	ActivityID string `json:"activity_id,omitempty"`
 	ActorID    string `json:"actor_id,omitempty"`
+	JoinedAt   int64  `json:"joined_at,omitempty"`
+	// RelayActor is the ID of the additional relay identity followed, empty for the main relay actor
+	RelayActor string `json:"relay_actor,omitempty"`
 }
 
 // Follower : Manage for LitePub Style Relay Follower
@@ -252,22 +505,67 @@ type Follower struct {
 	ActivityID     string `json:"activity_id,omitempty"`
 	ActorID        string `json:"actor_id,omitempty"`
 	MutuallyFollow bool   `json:"mutually_follow,omitempty"`
+	JoinedAt       int64  `json:"joined_at,omitempty"`
+	// RelayActor is the ID of the additional relay identity followed, empty for the main relay actor
+	RelayActor string `json:"relay_actor,omitempty"`
 }
 
 type relayConfig struct {
-	PersonOnly     bool `json:"blockService,omitempty"`
-	ManuallyAccept bool `json:"manuallyAccept,omitempty"`
+	PersonOnly           bool `json:"blockService,omitempty"`
+	ManuallyAccept       bool `json:"manuallyAccept,omitempty"`
+	RelayReactions       bool `json:"relayReactions,omitempty"`
+	RequireSharedInbox   bool `json:"requireSharedInbox,omitempty"`
+	ExcludeBotActors     bool `json:"excludeBotActors,omitempty"`
+	AllowlistOnly        bool `json:"allowlistOnly,omitempty"`
+	RequirePublished     bool `json:"requirePublished,omitempty"`
+	AllowUnsignedDeletes bool `json:"allowUnsignedDeletes,omitempty"`
+	RequireLanguage      bool `json:"requireLanguage,omitempty"`
 }
 
 func (config *relayConfig) load(redisClient *redis.Client) {
-	personOnly, err := redisClient.HGet(context.TODO(), "relay:config", "block_service").Result()
+	personOnly, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "block_service").Result()
 	if err != nil {
 		personOnly = "0"
 	}
-	manuallyAccept, err := redisClient.HGet(context.TODO(), "relay:config", "manually_accept").Result()
+	manuallyAccept, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "manually_accept").Result()
 	if err != nil {
 		manuallyAccept = "0"
 	}
+	relayReactions, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "relay_reactions").Result()
+	if err != nil {
+		relayReactions = "0"
+	}
+	requireSharedInbox, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "require_shared_inbox").Result()
+	if err != nil {
+		requireSharedInbox = "0"
+	}
 	config.PersonOnly = personOnly == "1"
 	config.ManuallyAccept = manuallyAccept == "1"
+	config.RelayReactions = relayReactions == "1"
+	excludeBotActors, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "exclude_bot_actors").Result()
+	if err != nil {
+		excludeBotActors = "0"
+	}
+	config.RequireSharedInbox = requireSharedInbox == "1"
+	config.ExcludeBotActors = excludeBotActors == "1"
+	allowlistOnly, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "allowlist_only").Result()
+	if err != nil {
+		allowlistOnly = "0"
+	}
+	config.AllowlistOnly = allowlistOnly == "1"
+	requirePublished, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "require_published").Result()
+	if err != nil {
+		requirePublished = "0"
+	}
+	config.RequirePublished = requirePublished == "1"
+	allowUnsignedDeletes, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "allow_unsigned_deletes").Result()
+	if err != nil {
+		allowUnsignedDeletes = "0"
+	}
+	config.AllowUnsignedDeletes = allowUnsignedDeletes == "1"
+	requireLanguage, err := redisClient.HGet(context.TODO(), RedisKey("relay:config"), "require_language").Result()
+	if err != nil {
+		requireLanguage = "0"
+	}
+	config.RequireLanguage = requireLanguage == "1"
 }
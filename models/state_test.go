@@ -150,6 +150,40 @@ func TestBlockedDomain(t *testing.T) {
 	})
 }
 
+func TestAllowedDomain(t *testing.T) {
+	relayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	t.Run("Set allowed domain to true", func(t *testing.T) {
+		relayState.SetAllowedDomain("example.com", true)
+		<-ch
+
+		valid := false
+		for _, domain := range relayState.AllowedDomains {
+			if domain == "example.com" {
+				valid = true
+			}
+		}
+		if !valid {
+			t.Fatalf("Expected allowed domain 'example.com' to be present, but not found")
+		}
+	})
+
+	t.Run("Set allowed domain to false", func(t *testing.T) {
+		relayState.SetAllowedDomain("example.com", false)
+		<-ch
+
+		valid := true
+		for _, domain := range relayState.AllowedDomains {
+			if domain == "example.com" {
+				valid = false
+			}
+		}
+		if !valid {
+			t.Fatalf("Expected allowed domain 'example.com' to be removed, but still found")
+		}
+	})
+}
+
 func TestLimitedDomain(t *testing.T) {
 	relayState.RedisClient.FlushAll(context.TODO()).Result()
 
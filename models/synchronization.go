@@ -0,0 +1,44 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+)
+
+// Origin : Scheme and host of URL, as compared by FEP-8fcf.
+func Origin(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// ActorIDsOnOrigin : Actor IDs of subscribers and followers of relayActor sharing origin, relayActor is empty for the main relay actor.
+func (config *RelayState) ActorIDsOnOrigin(origin string, relayActor string) []string {
+	var actorIDs []string
+	for _, subscription := range config.SubscribersAndFollowers {
+		if subscription.ActorID != "" && subscription.RelayActor == relayActor && Origin(subscription.ActorID) == origin {
+			actorIDs = append(actorIDs, subscription.ActorID)
+		}
+	}
+	return actorIDs
+}
+
+// CollectionDigest : FEP-8fcf partial collection digest, hex of the XORed SHA-256 of every ID.
+func CollectionDigest(ids []string) string {
+	var digest [sha256.Size]byte
+	for _, id := range ids {
+		sum := sha256.Sum256([]byte(id))
+		for i := range digest {
+			digest[i] ^= sum[i]
+		}
+	}
+	return hex.EncodeToString(digest[:])
+}
+
+// CollectionSynchronizationHeader : FEP-8fcf Collection-Synchronization header value.
+func CollectionSynchronizationHeader(collectionID string, partialURL string, digest string) string {
+	return `collectionId="` + collectionID + `", url="` + partialURL + `", digest="` + digest + `"`
+}
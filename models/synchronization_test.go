@@ -0,0 +1,54 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCollectionDigest(t *testing.T) {
+	if digest := CollectionDigest(nil); digest != strings.Repeat("0", 64) {
+		t.Fatalf("Expected empty digest to be zero, but got %s", digest)
+	}
+
+	sum := sha256.Sum256([]byte("https://example.com/users/alice"))
+	if digest := CollectionDigest([]string{"https://example.com/users/alice"}); digest != hex.EncodeToString(sum[:]) {
+		t.Fatalf("Expected single digest to be the SHA-256 of the ID, but got %s", digest)
+	}
+
+	forward := CollectionDigest([]string{"https://example.com/users/alice", "https://example.com/users/bob"})
+	backward := CollectionDigest([]string{"https://example.com/users/bob", "https://example.com/users/alice"})
+	if forward != backward {
+		t.Fatalf("Expected digest to be independent of order, but got %s and %s", forward, backward)
+	}
+	if digest := CollectionDigest([]string{"https://example.com/users/alice", "https://example.com/users/alice"}); digest != strings.Repeat("0", 64) {
+		t.Fatalf("Expected duplicate IDs to cancel out, but got %s", digest)
+	}
+}
+
+func TestCollectionSynchronizationHeader(t *testing.T) {
+	// Header of the FEP-8fcf example collection, the digest is the XOR of SHA-256 of both followers computed independently
+	expected := `collectionId="https://testing.example.org/users/1/followers", url="https://testing.example.org/users/1/followers_synchronization", digest="a42ba1a8ffbf0b92fc54c3a92188d3bfbfbe6692f76d905efcfb395a91e11e0f"`
+	digest := CollectionDigest([]string{"https://testing.example.org/users/2", "https://testing.example.org/users/3"})
+	header := CollectionSynchronizationHeader("https://testing.example.org/users/1/followers", "https://testing.example.org/users/1/followers_synchronization", digest)
+	if header != expected {
+		t.Fatalf("Expected %s, but got %s", expected, header)
+	}
+
+	format := regexp.MustCompile(`^collectionId="[^"]+", url="[^"]+", digest="[0-9a-f]{64}"$`)
+	header = CollectionSynchronizationHeader("https://relay.example.com/actor/followers", "https://relay.example.com/actor/followers_synchronization", CollectionDigest([]string{"https://example.com/users/alice"}))
+	if !format.MatchString(header) {
+		t.Fatalf("Expected header to match FEP-8fcf format, but got %s", header)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	if origin := Origin("https://example.com:8443/inbox?x=1"); origin != "https://example.com:8443" {
+		t.Fatalf("Expected https://example.com:8443, but got %s", origin)
+	}
+	if origin := Origin("not a url"); origin != "" {
+		t.Fatalf("Expected empty origin, but got %s", origin)
+	}
+}
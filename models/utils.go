@@ -2,11 +2,13 @@ package models
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"io/ioutil"
+	"os"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -73,3 +75,48 @@ func generatePublicKeyPEMString(publicKey *rsa.PublicKey) string {
 	)
 	return string(publicKeyPem)
 }
+
+func readPrivateKeyEd25519(keyPath string) (ed25519.PrivateKey, error) {
+	file, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	decoded, _ := pem.Decode(file)
+	if decoded == nil {
+		return nil, errors.New("ACTOR_ED25519_PEM IS INVALID. FAILED TO READ")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(decoded.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("ACTOR_ED25519_PEM IS NOT AN ED25519 KEY")
+	}
+	return privateKey, nil
+}
+
+func generateEd25519PublicKeyPEMString(publicKey ed25519.PublicKey) string {
+	publicKeyByte, _ := x509.MarshalPKIXPublicKey(publicKey)
+	publicKeyPem := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: publicKeyByte,
+		},
+	)
+	return string(publicKeyPem)
+}
+
+// IsEd25519PublicKeyPEM returns whether pemString holds an Ed25519 public key.
+func IsEd25519PublicKeyPEM(pemString string) bool {
+	decoded, _ := pem.Decode([]byte(pemString))
+	if decoded == nil {
+		return false
+	}
+	key, err := x509.ParsePKIXPublicKey(decoded.Bytes)
+	if err != nil {
+		return false
+	}
+	_, ok := key.(ed25519.PublicKey)
+	return ok
+}
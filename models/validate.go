@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// delayMetricsWindow : Delay metric buckets older than this have outlived their expiry
+const delayMetricsWindow = 25 * time.Hour
+
+// StateAnomaly : Inconsistent Redis entry found by Validate
+type StateAnomaly struct {
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+	// Orphaned : Entry is unusable and safe to remove
+	Orphaned bool `json:"orphaned"`
+}
+
+// StateReport : Result of RelayState.Validate
+type StateReport struct {
+	CheckedKeys int            `json:"checked_keys"`
+	Anomalies   []StateAnomaly `json:"anomalies"`
+}
+
+// Validate : Report inconsistent Redis entries without modifying them
+func (config *RelayState) Validate() StateReport {
+	ctx := context.TODO()
+	report := StateReport{Anomalies: []StateAnomaly{}}
+
+	relationDomains := map[string]string{}
+	for _, prefix := range []string{RedisKey("relay:subscription:"), RedisKey("relay:follower:")} {
+		keys, _ := config.RedisClient.Keys(ctx, prefix+"*").Result()
+		for _, key := range keys {
+			report.CheckedKeys++
+			keyType, _ := config.RedisClient.Type(ctx, key).Result()
+			if keyType != "hash" {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "not a hash but " + keyType, false})
+				continue
+			}
+			inboxURL, _ := config.RedisClient.HGet(ctx, key, "inbox_url").Result()
+			if inboxURL == "" {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "missing inbox_url", true})
+				continue
+			}
+			if inbox, err := url.Parse(inboxURL); err != nil || (inbox.Scheme != "https" && inbox.Scheme != "http") || inbox.Host == "" {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "invalid inbox_url " + inboxURL, false})
+			}
+			domain := strings.TrimPrefix(key, prefix)
+			if other, found := relationDomains[domain]; found {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "domain is also registered as " + other, false})
+			}
+			relationDomains[domain] = key
+		}
+	}
+
+	keys, _ := config.RedisClient.Keys(ctx, RedisKey("relay:activity:*")).Result()
+	for _, key := range keys {
+		report.CheckedKeys++
+		if ttl, _ := config.RedisClient.TTL(ctx, key).Result(); ttl < 0 {
+			report.Anomalies = append(report.Anomalies, StateAnomaly{key, "queued activity without expiry", true})
+		}
+	}
+
+	oldestBucket := time.Now().Add(-delayMetricsWindow).Unix()
+	for _, prefix := range []string{RedisKey("fdma:hour:"), RedisKey("fdma:delays:"), RedisKey("fdma:instances:")} {
+		keys, _ := config.RedisClient.Keys(ctx, prefix+"*").Result()
+		for _, key := range keys {
+			report.CheckedKeys++
+			bucket, err := strconv.ParseInt(strings.SplitN(strings.TrimPrefix(key, prefix), ":", 2)[0], 10, 64)
+			if err != nil {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "unparsable delay bucket", false})
+				continue
+			}
+			if bucket < oldestBucket {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "delay bucket beyond the 25h window", true})
+			} else if ttl, _ := config.RedisClient.TTL(ctx, key).Result(); ttl < 0 {
+				report.Anomalies = append(report.Anomalies, StateAnomaly{key, "delay bucket without expiry", false})
+			}
+		}
+	}
+
+	return report
+}
+
+// RepairOrphans : Remove orphaned entries of report, returns removed count
+func (config *RelayState) RepairOrphans(report StateReport) int {
+	var keys []string
+	for _, anomaly := range report.Anomalies {
+		if anomaly.Orphaned {
+			keys = append(keys, anomaly.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+	removed, _ := config.RedisClient.Del(context.TODO(), keys...).Result()
+	config.refresh()
+	return int(removed)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	relayState.RedisClient.FlushAll(context.TODO()).Result()
+	defer relayState.RedisClient.FlushAll(context.TODO()).Result()
+
+	ctx := context.TODO()
+	staleBucket := strconv.FormatInt(time.Now().Add(-48*time.Hour).Unix()/3600*3600, 10)
+	currentBucket := strconv.FormatInt(time.Now().Unix()/3600*3600, 10)
+	relayState.RedisClient.HSet(ctx, "relay:subscription:good.example.com", "inbox_url", "https://good.example.com/inbox")
+	relayState.RedisClient.HSet(ctx, "relay:subscription:orphan.example.com", "activity_id", "https://orphan.example.com/follow")
+	relayState.RedisClient.HSet(ctx, "relay:follower:good.example.com", "inbox_url", "https://good.example.com/inbox")
+	relayState.RedisClient.HSet(ctx, "relay:activity:stuck", "body", "{}")
+	relayState.RedisClient.HSet(ctx, "fdma:hour:"+staleBucket+":old.example.com", "count", 1)
+	relayState.RedisClient.HSet(ctx, "fdma:hour:"+currentBucket+":new.example.com", "count", 1)
+	relayState.RedisClient.Expire(ctx, "fdma:hour:"+currentBucket+":new.example.com", time.Hour)
+
+	report := relayState.Validate()
+	if report.CheckedKeys != 6 {
+		t.Fatalf("Expected 6 checked keys, but got %d", report.CheckedKeys)
+	}
+	problems := map[string]bool{}
+	for _, anomaly := range report.Anomalies {
+		problems[anomaly.Key] = anomaly.Orphaned
+	}
+	expected := map[string]bool{
+		"relay:subscription:orphan.example.com":         true,
+		"relay:follower:good.example.com":               false,
+		"relay:activity:stuck":                          true,
+		"fdma:hour:" + staleBucket + ":old.example.com": true,
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d anomalies, but got %+v", len(expected), report.Anomalies)
+	}
+	for key, orphaned := range expected {
+		if got, found := problems[key]; !found || got != orphaned {
+			t.Fatalf("Expected anomaly for %s with orphaned %v, but got %+v", key, orphaned, report.Anomalies)
+		}
+	}
+	if exists, _ := relayState.RedisClient.Exists(ctx, "relay:activity:stuck").Result(); exists != 1 {
+		t.Fatal("Expected Validate not to modify state, but an entry was removed")
+	}
+
+	if removed := relayState.RepairOrphans(report); removed != 3 {
+		t.Fatalf("Expected 3 orphaned entries removed, but got %d", removed)
+	}
+	<-ch
+	if remaining := relayState.Validate(); len(remaining.Anomalies) != 1 {
+		t.Fatalf("Expected only the duplicate relation to remain, but got %+v", remaining.Anomalies)
+	}
+}